@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"roeyazroel/kubectl-pfw/pkg/cli"
+	"roeyazroel/kubectl-pfw/pkg/devcontainer"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
 
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -24,14 +27,128 @@ var (
 	# Port forward multiple pods in the current namespace
 	%[1]s pfw --pods
 
+	# Only list pods matching a label selector
+	%[1]s pfw --pods -l app=web
+
+	# Forward every service labeled tier=backend without prompting
+	%[1]s pfw --all -l tier=backend
+
+	# Forward named services without prompting, e.g. in CI
+	%[1]s pfw --select api,worker-*
+
+	# Forward the same resources and local ports as last time
+	%[1]s pfw --last
+
 	# Port forward using a configuration file
 	%[1]s pfw -f config.yaml
 
 	# Generate a configuration file from interactive selection
 	%[1]s pfw --generate-config --output my-config.yaml
 
+	# Generate a JSON configuration file for tooling that reads JSON
+	%[1]s pfw --generate-config --output my-config.json
+
 	# Generate a configuration file for pods
 	%[1]s pfw --pods --generate-config
+
+	# Only open tunnels when something connects to the local port
+	%[1]s pfw -f config.yaml --lazy
+
+	# Keep idle tunnels alive behind proxies that drop inactive streams
+	%[1]s pfw -f config.yaml --keepalive 30s
+
+	# Forward services from two clusters in one session
+	%[1]s pfw --contexts staging,production
+
+	# Forward a set of resources defined as an alias in the settings file
+	%[1]s pfw up backend-db
+
+	# Find services and pods named like "payments" in any namespace
+	%[1]s pfw find payments
+
+	# Diagnose why port forwarding does not work
+	%[1]s pfw doctor
+
+	# Check that the resources of a configuration file can be forwarded
+	%[1]s pfw verify -f config.yaml
+
+	# Show the forwards of all running sessions and how often they reconnected
+	%[1]s pfw status
+
+	# Stop one forward of a running session started with --control-addr
+	%[1]s pfw stop svc/web
+
+	# Name a session so other pfw commands can target it
+	%[1]s pfw -f payments.yaml --session payments-debug --control-addr 127.0.0.1:7070
+	%[1]s pfw status --session payments-debug
+`
+
+	stopExample = `
+	# Stop the forwards of a service in every session serving a control API
+	%[1]s pfw stop svc/web
+
+	# Only stop the forward on local port 8080 of a deployment in namespace prod
+	%[1]s pfw stop prod/deploy/api:8080
+
+	# Only stop it in the session started with --session payments-debug
+	%[1]s pfw stop svc/web --session payments-debug
+`
+
+	findExample = `
+	# Forward services or pods whose name contains or fuzzily matches "api"
+	%[1]s pfw find api
+
+	# Only search pods
+	%[1]s pfw find --pods worker
+
+	# Narrow matches to a namespace by including it in the query
+	%[1]s pfw find prod/api
+`
+
+	upExample = `
+	# Forward the resources of the backend-db alias from settings.yaml
+	%[1]s pfw up backend-db
+
+	# Combine several aliases in one session
+	%[1]s pfw up backend-db queue
+`
+
+	relayExample = `
+	# Reach an RDS database that only accepts connections from inside the VPC
+	%[1]s pfw relay mydb.abc123.eu-west-1.rds.amazonaws.com:5432
+
+	# Use another local port and a mirrored socat image
+	%[1]s pfw relay redis.internal:6379 --local-port 16379 --image registry.example.com/socat:1.8
+`
+
+	exportExample = `
+	# Let VS Code list the ports forwarded inside a dev container
+	%[1]s pfw export devcontainer
+
+	# Print the forwardPorts and portsAttributes properties instead
+	%[1]s pfw export devcontainer --print
+
+	# Document how to reach the forwarded endpoints
+	%[1]s pfw export report --title "Staging endpoints" -o docs/staging.md
+`
+
+	importExample = `
+	# Convert a kubefwd invocation; arguments after -- are kubefwd's
+	%[1]s pfw import kubefwd -o dev.yaml -- sudo kubefwd svc -n staging -l team=payments -m 80:8080
+
+	# Convert the intercepts of a telepresence script
+	%[1]s pfw import telepresence -f intercepts.sh -o dev.yaml
+`
+
+	serviceExample = `
+	# Forward the resources of dev.yaml in the background, also after reboots
+	%[1]s pfw service install -f dev.yaml
+
+	# Pin another context and review the generated unit first
+	%[1]s pfw service install -f dev.yaml --context staging --print
+
+	# Remove the service again
+	%[1]s pfw service uninstall -f dev.yaml
 `
 )
 
@@ -57,28 +174,385 @@ func main() {
 				fmt.Printf("kubectl-pfw version %s\n", version)
 				return nil
 			}
-			return cli.Run(flags, streams, cmd)
+			return cli.Run(version, flags, streams, cmd)
 		},
 	}
 
 	flags.AddFlags(root.Flags())
+	root.Flags().BoolP("version", "v", false, "Show version information")
+	addSessionFlags(root)
+	cli.RegisterCompletions(root, flags)
+
+	find := &cobra.Command{
+		Use:          cli.FindCommand + " <query>",
+		Short:        "Search services and pods in all namespaces and port forward the matches",
+		Example:      fmt.Sprintf(findExample, "kubectl"),
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.Run(version, flags, streams, cmd)
+		},
+	}
+	flags.AddFlags(find.Flags())
+	addSessionFlags(find)
+	cli.RegisterCompletions(find, flags)
+	root.AddCommand(find)
+
+	up := &cobra.Command{
+		Use:               cli.UpCommand + " <alias>...",
+		Short:             "Port forward the resources of aliases defined in the settings file",
+		Example:           fmt.Sprintf(upExample, "kubectl"),
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: cli.CompleteAliases,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.Run(version, flags, streams, cmd)
+		},
+	}
+	flags.AddFlags(up.Flags())
+	addSessionFlags(up)
+	cli.RegisterCompletions(up, flags)
+	root.AddCommand(up)
+
+	relay := &cobra.Command{
+		Use:          cli.RelayCommand + " <host:port>",
+		Short:        "Forward an endpoint reachable from the cluster through a temporary relay pod",
+		Example:      fmt.Sprintf(relayExample, "kubectl"),
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.Run(version, flags, streams, cmd)
+		},
+	}
+	flags.AddFlags(relay.Flags())
+	addSessionFlags(relay)
+	relay.Flags().String("image", k8s.DefaultRelayImage, "Image of the relay pod; its entrypoint must be socat")
+	relay.Flags().Int("local-port", 0, "Local port to listen on; by default the target port when free, otherwise any free port")
+	relay.Flags().Duration("startup-timeout", time.Minute, "How long to wait for the relay pod to start")
+	cli.RegisterCompletions(relay, flags)
+	root.AddCommand(relay)
+
+	doctor := &cobra.Command{
+		Use:          "doctor",
+		Short:        "Diagnose kubeconfig, connectivity, permission and local port problems",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunDoctor(flags, streams, cmd)
+		},
+	}
+	flags.AddFlags(doctor.Flags())
+	doctor.Flags().String("pod", "", "Pod used to test port-forward connections (default: any running pod)")
+	doctor.Flags().StringP("file", "f", "", "Configuration file whose local ports are checked")
+	cli.RegisterCompletions(doctor, flags)
+	root.AddCommand(doctor)
+
+	verify := &cobra.Command{
+		Use:          "verify",
+		Short:        "Check the resources of a configuration file against the cluster without forwarding",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunVerify(flags, streams, cmd)
+		},
+	}
+	flags.AddFlags(verify.Flags())
+	verify.Flags().StringP("file", "f", "", "Configuration file to check")
+	cli.RegisterCompletions(verify, flags)
+	root.AddCommand(verify)
 
+	status := &cobra.Command{
+		Use:          "status",
+		Short:        "List the forwards of all running sessions with their reconnection attempts",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, _ := cmd.Flags().GetString("session")
+			return cli.RunStatus(session, streams)
+		},
+	}
+	status.Flags().String("session", "", "Only list the forwards of the session with this name")
+	root.AddCommand(status)
+
+	sessions := &cobra.Command{
+		Use:          "sessions",
+		Short:        "List the running sessions with their names, control API and number of forwards",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunSessions(streams)
+		},
+	}
+	root.AddCommand(sessions)
+
+	stop := &cobra.Command{
+		Use:          "stop [namespace/]type/name[:localPort]",
+		Short:        "Stop the forwards of one resource in running sessions, keeping the others",
+		Example:      fmt.Sprintf(stopExample, "kubectl"),
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			session, _ := cmd.Flags().GetString("session")
+			return cli.RunStop(args[0], session, streams)
+		},
+	}
+	stop.Flags().String("session", "", "Only stop the forwards in the session with this name")
+	root.AddCommand(stop)
+
+	updateCmd := &cobra.Command{
+		Use:          "update",
+		Short:        "Replace this executable with the latest release from GitHub",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunUpdate(version, streams, cmd)
+		},
+	}
+	updateCmd.Flags().Bool("check", false, "Only report whether a newer release is available")
+	updateCmd.Flags().Bool("force", false, "Install the latest release even if it is not newer or kubectl-pfw is managed by krew or Homebrew")
+	root.AddCommand(updateCmd)
+
+	serviceCmd := &cobra.Command{
+		Use:   "service",
+		Short: "Run a configuration file as a background service that starts on login",
+	}
+	install := &cobra.Command{
+		Use:          "install",
+		Short:        "Install and start a systemd user unit (Linux) or launchd agent (macOS) forwarding a configuration file",
+		Example:      fmt.Sprintf(serviceExample, "kubectl"),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunServiceInstall(flags, streams, cmd)
+		},
+	}
+	flags.AddFlags(install.Flags())
+	install.Flags().StringP("file", "f", "", "Configuration file to forward")
+	install.Flags().String("name", "", "Service name (default: kubectl-pfw-<config file name>)")
+	install.Flags().Bool("print", false, "Print the unit or plist instead of installing it")
+	cli.RegisterCompletions(install, flags)
+	uninstall := &cobra.Command{
+		Use:          "uninstall",
+		Short:        "Stop and remove a service installed with service install",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunServiceUninstall(streams, cmd)
+		},
+	}
+	uninstall.Flags().StringP("file", "f", "", "Configuration file the service was installed for")
+	uninstall.Flags().String("name", "", "Service name (default: kubectl-pfw-<config file name>)")
+	serviceCmd.AddCommand(install, uninstall)
+	root.AddCommand(serviceCmd)
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Share the ports of running sessions with other tools",
+	}
+	exportDevcontainer := &cobra.Command{
+		Use:          "devcontainer",
+		Short:        "Add the forwarded local ports to forwardPorts and portsAttributes of devcontainer.json",
+		Example:      fmt.Sprintf(exportExample, "kubectl"),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunExportDevcontainer(streams, cmd)
+		},
+	}
+	exportDevcontainer.Flags().StringP("file", "f", devcontainer.DefaultPath, "Dev container configuration to update")
+	exportDevcontainer.Flags().Bool("print", false, "Print the properties to add instead of updating the file")
+	exportReport := &cobra.Command{
+		Use:          "report",
+		Short:        "Render the forwarded endpoints with their local URLs and notes as Markdown or HTML",
+		Example:      fmt.Sprintf(exportExample, "kubectl"),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunExportReport(streams, cmd)
+		},
+	}
+	exportReport.Flags().String("format", "markdown", "Format of the report: markdown or html")
+	exportReport.Flags().String("title", "Local endpoints", "Heading of the report")
+	exportReport.Flags().StringP("output", "o", cli.StdoutOutput, "File to write the report to, or - to write it to stdout")
+	exportCmd.AddCommand(exportDevcontainer, exportReport)
+	root.AddCommand(exportCmd)
+
+	importCmd := &cobra.Command{
+		Use:     "import",
+		Short:   "Convert the port-forwarding setup of another tool into a configuration file",
+		Example: fmt.Sprintf(importExample, "kubectl"),
+	}
+	importKubefwd := &cobra.Command{
+		Use:          "kubefwd -- <kubefwd arguments>",
+		Short:        "Convert a kubefwd svc invocation, forwarding the services it matches in the cluster",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunImportKubefwd(flags, streams, cmd, args)
+		},
+	}
+	importTelepresence := &cobra.Command{
+		Use:          "telepresence",
+		Short:        "Convert telepresence intercept commands, one per line, into forwards of the intercepted service ports",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunImportTelepresence(flags, streams, cmd)
+		},
+	}
+	importTelepresence.Flags().StringP("file", "f", "-", "File with the intercept commands, or - to read them from stdin")
+	for _, c := range []*cobra.Command{importKubefwd, importTelepresence} {
+		flags.AddFlags(c.Flags())
+		c.Flags().StringP("output", "o", cli.StdoutOutput, "Output file for the configuration, or - to write it to stdout")
+		c.Flags().String("format", "", "Format of the configuration: yaml or json (default: from the --output extension, yaml for stdout)")
+		cli.RegisterCompletions(c, flags)
+	}
+	importCmd.AddCommand(importKubefwd, importTelepresence)
+	root.AddCommand(importCmd)
+
+	// Internal command run under sudo by --privileged-helper
+	privilegedRelay := &cobra.Command{
+		Use:          cli.PrivilegedRelayCommand,
+		Hidden:       true,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RunPrivilegedRelay(cmd)
+		},
+	}
+	privilegedRelay.Flags().Int32("listen", 0, "Privileged local port to serve")
+	privilegedRelay.Flags().Int32("target", 0, "Local port the connections are relayed to")
+	privilegedRelay.Flags().Int("parent-pid", 0, "Exit once the process with this PID has exited")
+	root.AddCommand(privilegedRelay)
+
+	if err := root.Execute(); err != nil {
+		code, hint := cli.Explain(err)
+		if hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
+		os.Exit(code)
+	}
+}
+
+// addSessionFlags defines the flags shared by every command that starts a port forwarding session
+func addSessionFlags(cmd *cobra.Command) {
 	usePods := false
 	useDeployments := false
 	useStatefulSets := false
 	configFile := ""
 	generateConfig := false
 	outputFile := "kubectl-pfw-config.yaml"
+	outputFormat := ""
+	keepalive := time.Duration(0)
+	apiProxy := false
+	useCache := true
+	labelSelector := ""
+	lazy := false
+	maxForwards := 0
+	localPortRange := ""
+	stablePorts := false
+	portOffset := int32(0)
+	rememberPorts := true
+	privilegedHelper := false
+	docker := false
+	copyAddress := false
+	maxForwardsPolicy := "reject"
+	lazyIdleTimeout := time.Duration(0)
+	fieldSelector := ""
+	controlAddr := ""
+	sessionName := ""
+	force := false
+	preflight := true
+	var contexts []string
+	pickContext := false
+	node := ""
+	pickNode := false
+	zone := ""
+	podSelector := ""
+	selectAll := false
+	acceptDefaults := false
+	var selectNames []string
+	repeatLast := false
+	logFormat := "text"
+	onError := "abort"
+	onConflict := "fail"
+	waitForDeploy := false
+	waitReady := false
+	scaleFromZero := false
+	waitTimeout := cli.DefaultWaitTimeout
+	logLevel := "info"
+	prefixOutput := false
+	timestamps := false
+	logFile := ""
+	logConnections := false
+	logMaxSize := 10
+	logMaxAge := time.Duration(0)
+	logMaxFiles := 3
+	eventsFd := -1
+	eventsFile := ""
+	customResource := ""
+	var excludes []string
+	nameFilter := ""
+	sortOrder := ""
+	selectorPath := "{.status.selector}"
 
-	root.Flags().BoolVar(&usePods, "pods", false, "Select pods instead of services")
-	root.Flags().BoolVar(&useDeployments, "deployments", false, "Select deployments instead of services")
-	root.Flags().BoolVar(&useStatefulSets, "statefulsets", false, "Select statefulsets instead of services")
-	root.Flags().StringVarP(&configFile, "file", "f", "", "Configuration file for port forwarding")
-	root.Flags().BoolP("version", "v", false, "Show version information")
-	root.Flags().BoolVarP(&generateConfig, "generate-config", "g", false, "Generate configuration file from interactive selection")
-	root.Flags().StringVarP(&outputFile, "output", "o", outputFile, "Output file for generated configuration")
-
-	if err := root.Execute(); err != nil {
-		os.Exit(1)
-	}
+	cmd.Flags().BoolVar(&usePods, "pods", false, "Select pods instead of services")
+	cmd.Flags().BoolVar(&useDeployments, "deployments", false, "Select deployments instead of services")
+	cmd.Flags().BoolVar(&useStatefulSets, "statefulsets", false, "Select statefulsets instead of services")
+	cmd.Flags().StringVar(&customResource, "resource", "", "Select resources of this group/version/kind instead of services, e.g. kafka.strimzi.io/v1beta2/Kafka")
+	cmd.Flags().StringVar(&selectorPath, "resource-selector-path", selectorPath, "JSONPath of the label selector of the pods backing each --resource")
+	cmd.Flags().StringVarP(&configFile, "file", "f", "", "Configuration file for port forwarding")
+	cmd.Flags().StringSliceVar(&selectNames, "select", nil, "Forward the resources with these names without prompting; accepts globs like api-* and can be repeated")
+	cmd.Flags().BoolVar(&repeatLast, "last", false, "Repeat the previous session's selection and local ports without prompting")
+	cmd.Flags().BoolVar(&selectAll, "all", false, "Forward every listed resource and port without prompting, using the remote port locally when it is free")
+	cmd.Flags().BoolVarP(&acceptDefaults, "yes", "y", false, "Only ask which resources to forward; forward all their ports on the suggested local ports, or automatic ones when busy")
+	cmd.Flags().BoolVar(&acceptDefaults, "defaults", false, "Same as --yes")
+	cmd.Flags().BoolVarP(&generateConfig, "generate-config", "g", false, "Generate configuration file from interactive selection")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", outputFile, "Output file for generated configuration, or - to write it to stdout")
+	cmd.Flags().StringVar(&outputFormat, "format", outputFormat, "Format of the configuration read with --file or generated: yaml or json (default: from the file extension, yaml for stdout)")
+	cmd.Flags().StringVarP(&labelSelector, "selector", "l", "", "Label selector to filter listed resources (e.g. app=web,tier!=cache)")
+	cmd.Flags().StringVar(&fieldSelector, "field-selector", "", "Field selector to filter listed resources (e.g. metadata.name=web)")
+	cmd.Flags().StringVar(&nameFilter, "filter", "", "Only list resources whose names contain this substring or match this regular expression")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Hide resources whose names match these globs, separated by | (e.g. 'istio-*|*-canary'), or a /regular expression/; can be repeated")
+	cmd.Flags().StringVar(&sortOrder, "sort", "", "Order the selection list by name, namespace, age (newest first) or recent (last forwarded first); defaults to the settings file, then the API order")
+	cmd.Flags().BoolVar(&useCache, "cache", useCache, "Cache Kubernetes resources with shared informers instead of repeated list calls (requires watch permission)")
+	cmd.Flags().BoolVar(&lazy, "lazy", false, "Bind local ports immediately but only open each tunnel when a client connects")
+	cmd.Flags().DurationVar(&lazyIdleTimeout, "lazy-idle-timeout", lazyIdleTimeout, "Close lazy tunnels after this long without connections (default 5m)")
+	cmd.Flags().StringVar(&localPortRange, "local-port-range", "", "Range for automatically assigned local ports, e.g. 20000-21000 (default: OS ephemeral ports)")
+	cmd.Flags().BoolVar(&stablePorts, "stable-ports", false, "Derive automatic local ports from a hash of namespace/resource/port so they stay the same across runs")
+	cmd.Flags().Int32Var(&portOffset, "port-offset", portOffset, "Add this offset to every local port, e.g. 10000 forwards service port 80 on 10080, so parallel sessions can share a configuration")
+	cmd.Flags().BoolVar(&rememberPorts, "remember-ports", rememberPorts, "Reuse automatically assigned local ports from previous runs while they are still free, and offer the local ports chosen in earlier prompts")
+	cmd.Flags().BoolVar(&privilegedHelper, "privileged-helper", false, "Serve local ports below 1024 through a relay started with sudo when they cannot be bound directly")
+	cmd.Flags().BoolVar(&copyAddress, "copy", false, "Copy localhost:<port> of the first forward to the clipboard once it is ready")
+	cmd.Flags().BoolVar(&docker, "docker", false, "Also listen on the Docker bridge gateway (docker0) so local containers can reach the forwards")
+	cmd.Flags().StringVar(&onError, "on-error", onError, "What to do when a configured resource fails to start: abort the session or continue with the others and summarize the failures")
+	cmd.Flags().StringVar(&onConflict, "on-conflict", onConflict, "What to do when a requested local port is busy: fail, increment to the next free port, or use an ephemeral port")
+	cmd.Flags().BoolVar(&waitForDeploy, "wait", false, "Wait for configured resources that are not deployed yet and forward them once they appear")
+	cmd.Flags().BoolVar(&waitReady, "wait-ready", false, "Wait for a ready pod when all pods behind a resource are pending or not ready, instead of forwarding to a pod that is not ready")
+	cmd.Flags().BoolVar(&scaleFromZero, "scale-from-zero", false, "Scale deployments and statefulsets with 0 replicas to 1 before forwarding and back to 0 when the session ends")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", waitTimeout, "How long --wait waits for a resource to be deployed and --wait-ready for a ready pod")
+	cmd.Flags().IntVar(&maxForwards, "max-forwards", maxForwards, "Maximum number of simultaneous tunnels (0 for unlimited)")
+	cmd.Flags().StringVar(&maxForwardsPolicy, "max-forwards-policy", maxForwardsPolicy, "What to do with forwards beyond --max-forwards: reject or queue")
+	cmd.Flags().DurationVar(&keepalive, "keepalive", keepalive, "Interval for keepalive probes through each tunnel to prevent idle disconnects (0 disables)")
+	cmd.Flags().BoolVar(&apiProxy, "api-proxy", apiProxy, "Open tunnels through a local kubectl proxy-style API proxy, for networks whose proxies block direct port-forward upgrades")
+	cmd.Flags().StringSliceVar(&contexts, "contexts", nil, "Comma-separated kubeconfig contexts to list and forward resources from in one session")
+	cmd.Flags().StringVar(&node, "node", "", "Forward to the pods scheduled on this node, e.g. the DaemonSet pod of a node; in --pods mode only its pods are listed")
+	cmd.Flags().BoolVar(&pickNode, "pick-node", false, "Choose the node from the nodes running pods in the namespace instead of passing --node")
+	cmd.Flags().StringVar(&zone, "zone", "", "Forward services and workloads to their pods in this topology zone, e.g. eu-west-1a")
+	cmd.Flags().StringVar(&podSelector, "pod-selector", "", "Forward services and workloads to their pods matching this label selector, e.g. track=canary")
+	cmd.Flags().BoolVar(&pickContext, "pick-context", false, "Choose the kubeconfig context from a list before selecting resources")
+	cmd.Flags().BoolVar(&preflight, "preflight", preflight, "Check RBAC permissions for port forwarding and listing before starting")
+	cmd.Flags().StringVar(&logFormat, "log-format", logFormat, "Format of status and error messages: text or json (one object per line with resource, namespace, localPort and attempt fields)")
+	cmd.Flags().StringVar(&logLevel, "log-level", logLevel, "Minimum level of messages to show: debug, info, warn or error; debug includes client-go's own connection errors")
+	cmd.Flags().BoolVar(&timestamps, "timestamps", false, "Start status and error messages with the local date and time")
+	cmd.Flags().BoolVar(&prefixOutput, "prefix", false, "Start the messages of each forward with its resource, e.g. [svc/web], colored per resource on terminals")
+	cmd.Flags().StringVar(&logFile, "log-file", "", "Also append status and error messages, with their time and fields, to this file")
+	cmd.Flags().BoolVar(&logConnections, "log-connections", false, "Record every connection opened and closed through a forward in --log-file")
+	cmd.Flags().IntVar(&logMaxSize, "log-max-size", logMaxSize, "Rotate --log-file before it grows beyond this many megabytes (0 disables)")
+	cmd.Flags().DurationVar(&logMaxAge, "log-max-age", logMaxAge, "Rotate --log-file this long after it was opened or last rotated, e.g. 24h (0 disables)")
+	cmd.Flags().IntVar(&logMaxFiles, "log-max-files", logMaxFiles, "Number of rotated --log-file files kept as <file>.1 to <file>.N; older ones are deleted")
+	cmd.Flags().IntVar(&eventsFd, "events-fd", eventsFd, "Write lifecycle events (forward_ready, forward_retry, forward_failed, session_end) as JSON lines to this inherited file descriptor")
+	cmd.Flags().StringVar(&eventsFile, "events-file", "", "Append lifecycle events as JSON lines to this file or named pipe")
+	cmd.Flags().StringVar(&controlAddr, "control-addr", "", "Serve a JSON control API for this session on a localhost address, e.g. 127.0.0.1:7070")
+	cmd.Flags().BoolVar(&force, "force", false, "Start even if another running session serves the same configuration file")
+	cmd.Flags().StringVar(&sessionName, "session", "", "Name of this session, so pfw sessions, status and stop can target it; only one running session may use a name")
 }
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/ui"
+
+	"golang.org/x/term"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// addKey, followed by Enter, re-opens the resource selector while a session runs
+const addKey = "a"
+
+// canAddMore reports whether the session can prompt for more resources: its input must be a
+// terminal
+func canAddMore(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// outputHold holds back the session's messages while a prompt uses the terminal and prints
+// them once the prompt is done, so they do not garble it
+type outputHold struct {
+	mu      sync.Mutex
+	held    bool
+	pending []heldWrite
+}
+
+// heldWrite is a write held back until the prompt is done
+type heldWrite struct {
+	w io.Writer
+	p []byte
+}
+
+// streams returns streams whose output is held back along with the other streams of h
+func (h *outputHold) streams(streams genericclioptions.IOStreams) genericclioptions.IOStreams {
+	streams.Out = &holdWriter{hold: h, w: streams.Out}
+	streams.ErrOut = &holdWriter{hold: h, w: streams.ErrOut}
+	return streams
+}
+
+// hold starts holding back writes
+func (h *outputHold) hold() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.held = true
+}
+
+// release writes out the held back writes in order and stops holding back new ones
+func (h *outputHold) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, write := range h.pending {
+		write.w.Write(write.p)
+	}
+	h.pending = nil
+	h.held = false
+}
+
+// holdWriter writes to w unless its outputHold holds writes back
+type holdWriter struct {
+	hold *outputHold
+	w    io.Writer
+}
+
+func (w *holdWriter) Write(p []byte) (int, error) {
+	w.hold.mu.Lock()
+	defer w.hold.mu.Unlock()
+	if w.hold.held {
+		w.hold.pending = append(w.hold.pending, heldWrite{w: w.w, p: append([]byte(nil), p...)})
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+// Fd returns the file descriptor of the underlying writer, so messages are still colored on
+// terminals, or an invalid one if it is not a file
+func (w *holdWriter) Fd() uintptr {
+	if f, ok := w.w.(interface{ Fd() uintptr }); ok {
+		return f.Fd()
+	}
+	return ^uintptr(0)
+}
+
+// listenForAddKey re-opens the resource selector through add each time the add key is entered
+// on in, holding back the session's output while the selector is open. It returns when in is
+// closed, e.g. when the session runs in the background, or the context is done.
+func listenForAddKey(ctx context.Context, in io.Reader, output *outputHold, add func() error, logger *slog.Logger) {
+	// Reading the terminal from the background fails instead of stopping the process
+	if signals := portforward.BackgroundReadSignals(); len(signals) > 0 {
+		signal.Ignore(signals...)
+	}
+
+	lines := bufio.NewScanner(in)
+	for lines.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		if !strings.EqualFold(strings.TrimSpace(lines.Text()), addKey) {
+			continue
+		}
+		output.hold()
+		err := add()
+		output.release()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Not adding forwards: %v", err), "event", "error", "error", err.Error())
+		}
+	}
+}
+
+// addMoreSelection returns the selection used to add resources to a running session: it always
+// prompts, and hides the resources the manager forwards already instead of preselecting the
+// ones chosen last time
+func addMoreSelection(selection Selection, manager *portforward.Manager) Selection {
+	selection.All = false
+	selection.Names = nil
+	selection.History = nil
+	forwarded := forwardsByResource(manager.GetStatus())
+	selection.Skip = func(resource ui.Resource) bool {
+		return len(forwarded[resourceKey(resource.Context, string(resource.Type), resource.Namespace, resource.Name)]) > 0
+	}
+	return selection
+}
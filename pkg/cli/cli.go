@@ -3,30 +3,149 @@ package cli
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
-	"syscall"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/control"
 	"roeyazroel/kubectl-pfw/pkg/k8s"
 	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/state"
 
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
 )
 
 // Run contains the core logic: fetching resources, prompting user selection,
 // calculating port mappings (including remapping and conflict resolution),
-// and starting the port forwarding manager.
-func Run(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+// and starting the port forwarding manager. version is the running kubectl-pfw version.
+func Run(version string, flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
-	// Create Kubernetes client
-	client, err := k8s.NewClient(flags)
+	contexts, err := cmd.Flags().GetStringSlice("contexts")
+	if err != nil {
+		return fmt.Errorf("failed to get --contexts flag: %w", err)
+	}
+	if len(contexts) > 0 && flags.Context != nil && *flags.Context != "" {
+		return fmt.Errorf("cannot use both --context and --contexts flags together")
+	}
+
+	// Load user settings; flags override them
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return err
+	}
+	notifyNewVersion(ctx, version, settings, streams.ErrOut)
+
+	// Remembered selections are a convenience, so a broken history file only disables them
+	var history *state.History
+	if historyPath, err := state.Path(state.HistoryFile); err == nil {
+		if history, err = state.LoadHistory(historyPath); err != nil {
+			fmt.Fprintf(streams.ErrOut, "Warning: not remembering selections: %v\n", err)
+		}
+	}
+
+	// --last repeats the previous selection and up forwards aliases from the settings file, both
+	// without prompting and in the context they were made for
+	repeatLast, err := cmd.Flags().GetBool("last")
+	if err != nil {
+		return fmt.Errorf("failed to get --last flag: %w", err)
+	}
+	var preset *config.ForwardingConfig
+	presetSource := ""
+	if repeatLast {
+		if len(contexts) > 0 || cmd.Flags().Changed("file") || cmd.HasParent() {
+			return fmt.Errorf("--last cannot be used with --file, --contexts or subcommands")
+		}
+		if history != nil {
+			preset = history.LastSelection()
+		}
+		if preset == nil {
+			return fmt.Errorf("no previous selection to repeat")
+		}
+		presetSource = "the previous selection"
+	}
+	if cmd.Name() == UpCommand {
+		if len(contexts) > 0 || cmd.Flags().Changed("file") {
+			return fmt.Errorf("up cannot be used with --file or --contexts")
+		}
+		aliases := cmd.Flags().Args()
+		if preset, err = settings.ResolveAliases(aliases); err != nil {
+			return err
+		}
+		presetSource = "alias " + strings.Join(aliases, ", ")
+	}
+	// Presets and configuration files are forwarded in the context they were made for, unless
+	// --context says otherwise; errors in the file are reported when it is forwarded
+	contextName := ""
+	// forwarded is the preset or configuration file forwarded by the session, if any
+	forwarded := preset
+	if preset != nil {
+		contextName = preset.Context
+	} else if configFile, _ := cmd.Flags().GetString("file"); configFile != "" && len(contexts) == 0 {
+		format, _ := cmd.Flags().GetString("format")
+		if cfg, err := config.LoadConfigFormat(configFile, format); err == nil {
+			contextName = cfg.Context
+			forwarded = cfg
+		}
+	}
+	if contextName != "" && contextName != k8s.InClusterContext && (flags.Context == nil || *flags.Context == "") {
+		flags.Context = &contextName
+	}
+
+	pick, err := cmd.Flags().GetBool("pick-context")
+	if err != nil {
+		return fmt.Errorf("failed to get --pick-context flag: %w", err)
+	}
+	if !cmd.Flags().Changed("pick-context") {
+		pick = settings.PickContext
+	}
+	// Picking a context only makes sense before interactive selection with no context given
+	if pick && preset == nil && len(contexts) == 0 && (flags.Context == nil || *flags.Context == "") && !cmd.Flags().Changed("file") {
+		if err := pickContext(flags); err != nil {
+			return err
+		}
+	}
+
+	// Create Kubernetes clients; the first one is the session's default
+	var clients []*k8s.Client
+	if len(contexts) > 0 {
+		clients, err = newContextClients(flags, contexts)
+	} else {
+		var client *k8s.Client
+		client, err = newClient(flags)
+		clients = []*k8s.Client{client}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
+	client := clients[0]
+
+	// Entries of other clusters of a preset or configuration file are forwarded with their own clients
+	var clusters map[string]*k8s.Client
+	if forwarded != nil && len(forwarded.Clusters) > 0 {
+		if clusters, err = newConfigClusters(flags, forwarded); err != nil {
+			return fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+	}
+
+	// Report progress for namespaces large enough to need more than one page
+	for _, c := range clients {
+		c.SetListProgress(func(kind string, count int) {
+			if count >= int(k8s.ListPageSize) {
+				fmt.Fprintf(streams.ErrOut, "Loaded %d %s...\n", count, kind)
+			}
+		})
+	}
 
 	usePods, err := cmd.Flags().GetBool("pods")
 	if err != nil {
@@ -40,6 +159,14 @@ func Run(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStrea
 	if err != nil {
 		return fmt.Errorf("failed to get --statefulsets flag: %w", err)
 	}
+	customResource, err := cmd.Flags().GetString("resource")
+	if err != nil {
+		return fmt.Errorf("failed to get --resource flag: %w", err)
+	}
+	selectorPath, err := cmd.Flags().GetString("resource-selector-path")
+	if err != nil {
+		return fmt.Errorf("failed to get --resource-selector-path flag: %w", err)
+	}
 
 	configFile, err := cmd.Flags().GetString("file")
 	if err != nil {
@@ -55,11 +182,347 @@ func Run(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStrea
 	if err != nil {
 		return fmt.Errorf("failed to get --output flag: %w", err)
 	}
+	outputFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("failed to get --format flag: %w", err)
+	}
+	switch outputFormat {
+	case "", config.FormatYAML, config.FormatJSON:
+	default:
+		return fmt.Errorf("invalid --format '%s', must be one of: yaml, json", outputFormat)
+	}
+	if outputFormat == config.FormatJSON && !cmd.Flags().Changed("output") {
+		outputFile = strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".json"
+	}
+
+	keepalive, err := cmd.Flags().GetDuration("keepalive")
+	if err != nil {
+		return fmt.Errorf("failed to get --keepalive flag: %w", err)
+	}
+	if keepalive < 0 {
+		return fmt.Errorf("--keepalive must not be negative")
+	}
+
+	apiProxy, err := cmd.Flags().GetBool("api-proxy")
+	if err != nil {
+		return fmt.Errorf("failed to get --api-proxy flag: %w", err)
+	}
+
+	lazy, err := cmd.Flags().GetBool("lazy")
+	if err != nil {
+		return fmt.Errorf("failed to get --lazy flag: %w", err)
+	}
+	lazyIdleTimeout, err := cmd.Flags().GetDuration("lazy-idle-timeout")
+	if err != nil {
+		return fmt.Errorf("failed to get --lazy-idle-timeout flag: %w", err)
+	}
+	if lazy && keepalive > 0 {
+		return fmt.Errorf("cannot use --keepalive together with --lazy")
+	}
+
+	maxForwards, err := cmd.Flags().GetInt("max-forwards")
+	if err != nil {
+		return fmt.Errorf("failed to get --max-forwards flag: %w", err)
+	}
+	if maxForwards < 0 {
+		return fmt.Errorf("--max-forwards must not be negative")
+	}
+	maxForwardsPolicy, err := cmd.Flags().GetString("max-forwards-policy")
+	if err != nil {
+		return fmt.Errorf("failed to get --max-forwards-policy flag: %w", err)
+	}
+	if maxForwardsPolicy != "reject" && maxForwardsPolicy != "queue" {
+		return fmt.Errorf("invalid --max-forwards-policy '%s', must be one of: reject, queue", maxForwardsPolicy)
+	}
+
+	onError, err := cmd.Flags().GetString("on-error")
+	if err != nil {
+		return fmt.Errorf("failed to get --on-error flag: %w", err)
+	}
+	if onError != "abort" && onError != "continue" {
+		return fmt.Errorf("invalid --on-error '%s', must be one of: abort, continue", onError)
+	}
+	continueOnError := onError == "continue"
+
+	onConflict, err := cmd.Flags().GetString("on-conflict")
+	if err != nil {
+		return fmt.Errorf("failed to get --on-conflict flag: %w", err)
+	}
+	if onConflict != "fail" && onConflict != "increment" && onConflict != "ephemeral" {
+		return fmt.Errorf("invalid --on-conflict '%s', must be one of: fail, increment, ephemeral", onConflict)
+	}
+
+	waitForDeploy, err := cmd.Flags().GetBool("wait")
+	if err != nil {
+		return fmt.Errorf("failed to get --wait flag: %w", err)
+	}
+	waitTimeout, err := cmd.Flags().GetDuration("wait-timeout")
+	if err != nil {
+		return fmt.Errorf("failed to get --wait-timeout flag: %w", err)
+	}
+	if waitTimeout <= 0 {
+		return fmt.Errorf("invalid --wait-timeout '%s', must be positive", waitTimeout)
+	}
+	scaleFromZero, err := cmd.Flags().GetBool("scale-from-zero")
+	if err != nil {
+		return fmt.Errorf("failed to get --scale-from-zero flag: %w", err)
+	}
+	waitReady, err := cmd.Flags().GetBool("wait-ready")
+	if err != nil {
+		return fmt.Errorf("failed to get --wait-ready flag: %w", err)
+	}
+	// deployTimeout bounds waiting for configured resources to be created, 0 disables it
+	var deployTimeout time.Duration
+	if waitForDeploy {
+		deployTimeout = waitTimeout
+	}
+
+	logFormat, err := cmd.Flags().GetString("log-format")
+	if err != nil {
+		return fmt.Errorf("failed to get --log-format flag: %w", err)
+	}
+	logLevelName, err := cmd.Flags().GetString("log-level")
+	if err != nil {
+		return fmt.Errorf("failed to get --log-level flag: %w", err)
+	}
+	logLevel, err := portforward.ParseLogLevel(logLevelName)
+	if err != nil {
+		return fmt.Errorf("invalid --log-level: %w", err)
+	}
+	// Messages are held back while the selector for more resources is open
+	var output *outputHold
+	logStreams := streams
+	if canAddMore(streams.In) {
+		output = &outputHold{}
+		logStreams = output.streams(streams)
+	}
+	logger, err := portforward.NewLogger(logFormat, logLevel, logStreams)
+	if err != nil {
+		return fmt.Errorf("invalid --log-format: %w", err)
+	}
+	prefixOutput, err := cmd.Flags().GetBool("prefix")
+	if err != nil {
+		return fmt.Errorf("failed to get --prefix flag: %w", err)
+	}
+	if prefixOutput {
+		logger = portforward.PrefixForwards(logger)
+	}
+	timestamps, err := cmd.Flags().GetBool("timestamps")
+	if err != nil {
+		return fmt.Errorf("failed to get --timestamps flag: %w", err)
+	}
+	if timestamps {
+		logger = portforward.WithTimestamps(logger)
+	}
+	logger, audit, closeLogFile, err := openLogFile(cmd, logger, logLevel)
+	if err != nil {
+		return err
+	}
+	defer closeLogFile()
+	portforward.RouteKlog(logger)
+
+	events, closeEvents, err := openEvents(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+
+	localPortRange, err := cmd.Flags().GetString("local-port-range")
+	if err != nil {
+		return fmt.Errorf("failed to get --local-port-range flag: %w", err)
+	}
+	if localPortRange == "" {
+		localPortRange = settings.LocalPortRange
+	}
+
+	stablePorts, err := cmd.Flags().GetBool("stable-ports")
+	if err != nil {
+		return fmt.Errorf("failed to get --stable-ports flag: %w", err)
+	}
+
+	portOffset, err := cmd.Flags().GetInt32("port-offset")
+	if err != nil {
+		return fmt.Errorf("failed to get --port-offset flag: %w", err)
+	}
+	if portOffset < 0 || portOffset > 65535 {
+		return fmt.Errorf("invalid --port-offset '%d', must be between 0 and 65535", portOffset)
+	}
+
+	privilegedHelper, err := cmd.Flags().GetBool("privileged-helper")
+	if err != nil {
+		return fmt.Errorf("failed to get --privileged-helper flag: %w", err)
+	}
+
+	copyAddress, err := cmd.Flags().GetBool("copy")
+	if err != nil {
+		return fmt.Errorf("failed to get --copy flag: %w", err)
+	}
+
+	docker, err := cmd.Flags().GetBool("docker")
+	if err != nil {
+		return fmt.Errorf("failed to get --docker flag: %w", err)
+	}
+
+	rememberPorts, err := cmd.Flags().GetBool("remember-ports")
+	if err != nil {
+		return fmt.Errorf("failed to get --remember-ports flag: %w", err)
+	}
+
+	labelSelector, err := cmd.Flags().GetString("selector")
+	if err != nil {
+		return fmt.Errorf("failed to get --selector flag: %w", err)
+	}
+	fieldSelector, err := cmd.Flags().GetString("field-selector")
+	if err != nil {
+		return fmt.Errorf("failed to get --field-selector flag: %w", err)
+	}
+	for _, c := range clients {
+		if err := c.SetListFilter(labelSelector, fieldSelector); err != nil {
+			return err
+		}
+	}
+	if customResource != "" {
+		for _, c := range clients {
+			if err := c.SetCustomResourceKind(customResource, selectorPath); err != nil {
+				if len(clients) > 1 {
+					return fmt.Errorf("context %s: %w", c.GetContext(), err)
+				}
+				return err
+			}
+		}
+	}
+
+	controlAddr, err := cmd.Flags().GetString("control-addr")
+	if err != nil {
+		return fmt.Errorf("failed to get --control-addr flag: %w", err)
+	}
+	sessionName, err := cmd.Flags().GetString("session")
+	if err != nil {
+		return fmt.Errorf("failed to get --session flag: %w", err)
+	}
+	if err := validateSessionName(sessionName); err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return fmt.Errorf("failed to get --force flag: %w", err)
+	}
+
+	checkAccess, err := cmd.Flags().GetBool("preflight")
+	if err != nil {
+		return fmt.Errorf("failed to get --preflight flag: %w", err)
+	}
+
+	useCache, err := cmd.Flags().GetBool("cache")
+	if err != nil {
+		return fmt.Errorf("failed to get --cache flag: %w", err)
+	}
+	if useCache {
+		// Informers live for the whole session so re-selecting pods on retry is cheap
+		for _, c := range clients {
+			c.EnableCache(ctx)
+		}
+		for _, c := range clusters {
+			c.EnableCache(ctx)
+		}
+	}
 
 	// If both configFile and generateConfig are specified, show an error
 	if configFile != "" && generateConfig {
 		return fmt.Errorf("cannot use both --file and --generate-config flags together")
 	}
+	if len(contexts) > 0 && (configFile != "" || generateConfig) {
+		return fmt.Errorf("--contexts can only be used for interactive port forwarding")
+	}
+
+	selectAll, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return fmt.Errorf("failed to get --all flag: %w", err)
+	}
+	selectNames, err := cmd.Flags().GetStringSlice("select")
+	if err != nil {
+		return fmt.Errorf("failed to get --select flag: %w", err)
+	}
+	if selectAll && len(selectNames) > 0 {
+		return fmt.Errorf("cannot use both --all and --select flags together")
+	}
+	acceptDefaults, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return fmt.Errorf("failed to get --yes flag: %w", err)
+	}
+	if defaults, err := cmd.Flags().GetBool("defaults"); err != nil {
+		return fmt.Errorf("failed to get --defaults flag: %w", err)
+	} else if defaults {
+		acceptDefaults = true
+	}
+	if (selectAll || len(selectNames) > 0) && configFile != "" {
+		return fmt.Errorf("--all and --select cannot be used with --file")
+	}
+	if preset != nil && (selectAll || len(selectNames) > 0 || generateConfig) {
+		return fmt.Errorf("--all, --select and --generate-config cannot be used when forwarding %s", presetSource)
+	}
+	excludes, err := cmd.Flags().GetStringArray("exclude")
+	if err != nil {
+		return fmt.Errorf("failed to get --exclude flag: %w", err)
+	}
+	exclude, err := parseExclude(excludes)
+	if err != nil {
+		return err
+	}
+	nameFilter, err := cmd.Flags().GetString("filter")
+	if err != nil {
+		return fmt.Errorf("failed to get --filter flag: %w", err)
+	}
+	filter := NameFilter{Include: parseFilter(nameFilter), Exclude: exclude}
+	sortOrder, err := cmd.Flags().GetString("sort")
+	if err != nil {
+		return fmt.Errorf("failed to get --sort flag: %w", err)
+	}
+	if sortOrder == "" {
+		sortOrder = settings.Sort
+	}
+	selection := Selection{All: selectAll, Names: selectNames, AcceptDefaults: acceptDefaults, History: history, Filter: filter, Sort: sortOrder}
+	if err := selection.validate(); err != nil {
+		return err
+	}
+
+	// find searches every namespace instead of listing the current one
+	var findQuery string
+	if cmd.Name() == FindCommand {
+		findQuery = strings.Join(cmd.Flags().Args(), " ")
+		if configFile != "" || generateConfig || len(contexts) > 0 {
+			return fmt.Errorf("find cannot be used with --file, --generate-config or --contexts")
+		}
+		if useDeployments || useStatefulSets {
+			return fmt.Errorf("find only searches services and pods")
+		}
+	}
+
+	// relay forwards an endpoint behind the cluster instead of listing resources
+	var relayTarget, relayImage string
+	var relayTimeout time.Duration
+	var relayLocalPort int
+	if cmd.Name() == RelayCommand {
+		relayTarget = cmd.Flags().Arg(0)
+		if configFile != "" || generateConfig || len(contexts) > 0 || preset != nil {
+			return fmt.Errorf("relay cannot be used with --file, --generate-config or --contexts")
+		}
+		if usePods || useDeployments || useStatefulSets || customResource != "" || selectAll || len(selectNames) > 0 {
+			return fmt.Errorf("relay does not list resources, so it cannot be used with resource selection flags")
+		}
+		if relayImage, err = cmd.Flags().GetString("image"); err != nil {
+			return fmt.Errorf("failed to get --image flag: %w", err)
+		}
+		if relayTimeout, err = cmd.Flags().GetDuration("startup-timeout"); err != nil {
+			return fmt.Errorf("failed to get --startup-timeout flag: %w", err)
+		}
+		if relayLocalPort, err = cmd.Flags().GetInt("local-port"); err != nil {
+			return fmt.Errorf("failed to get --local-port flag: %w", err)
+		}
+		if relayLocalPort < 0 || relayLocalPort > 65535 {
+			return fmt.Errorf("invalid --local-port %d", relayLocalPort)
+		}
+	}
 
 	// Ensure only one of --pods, --deployments, or --statefulsets is set
 	selectedModes := 0
@@ -72,37 +535,244 @@ func Run(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStrea
 	if useStatefulSets {
 		selectedModes++
 	}
+	if customResource != "" {
+		selectedModes++
+	}
 	if selectedModes > 1 {
-		return fmt.Errorf("only one of --pods, --deployments, or --statefulsets can be used at a time")
+		return fmt.Errorf("only one of --pods, --deployments, --statefulsets, or --resource can be used at a time")
+	}
+	// Configuration files only describe the built-in resource types
+	if customResource != "" && (configFile != "" || generateConfig || findQuery != "" || preset != nil) {
+		return fmt.Errorf("--resource can only be used for interactive port forwarding")
+	}
+
+	node, err := cmd.Flags().GetString("node")
+	if err != nil {
+		return fmt.Errorf("failed to get --node flag: %w", err)
+	}
+	pickNodeFlag, err := cmd.Flags().GetBool("pick-node")
+	if err != nil {
+		return fmt.Errorf("failed to get --pick-node flag: %w", err)
+	}
+	if node != "" && pickNodeFlag {
+		return fmt.Errorf("cannot use both --node and --pick-node flags together")
+	}
+	zone, err := cmd.Flags().GetString("zone")
+	if err != nil {
+		return fmt.Errorf("failed to get --zone flag: %w", err)
+	}
+	podSelector, err := cmd.Flags().GetString("pod-selector")
+	if err != nil {
+		return fmt.Errorf("failed to get --pod-selector flag: %w", err)
+	}
+	if _, err := labels.Parse(podSelector); err != nil {
+		return fmt.Errorf("invalid --pod-selector %q: %w", podSelector, err)
+	}
+	if err := validatePodFilters(usePods, zone, podSelector); err != nil {
+		return err
+	}
+	// Node names belong to one cluster
+	if (node != "" || pickNodeFlag) && len(contexts) > 0 {
+		return fmt.Errorf("--node and --pick-node cannot be used with --contexts")
+	}
+	if pickNodeFlag {
+		if node, err = pickNode(ctx, client); err != nil {
+			return err
+		}
+	}
+	selection.Node = node
+	selection.PortOffset = portOffset
+
+	// Register the session so pfw sessions, status and stop can find it, and so a second
+	// session serving the same configuration file is noticed before its ports conflict
+	sessions := openSessions()
+	session := state.Session{Name: sessionName, Forced: force}
+	if configFile != "" {
+		if session.ConfigFile, err = filepath.Abs(configFile); err != nil {
+			return fmt.Errorf("failed to resolve config file path: %w", err)
+		}
+	}
+	if err := registerSession(sessions, session, streams); err != nil {
+		return err
+	}
+	if sessions != nil {
+		defer sessions.Unregister()
 	}
 
 	// Start port forwarding manager
-	manager := portforward.NewManager(client.GetConfig(), client.GetClientset(), client, streams, ctx)
+	manager := portforward.NewManager(ctx, client.GetConfig(), client.GetClientset(), client, streams)
+	manager.Logger = logger
+	manager.Events = events
+	manager.Audit = audit
+	manager.KeepaliveInterval = keepalive
+	manager.APIProxy = apiProxy
+	manager.Lazy = lazy
+	manager.LazyIdleTimeout = lazyIdleTimeout
+	manager.MaxForwards = maxForwards
+	manager.QueueExcessForwards = maxForwardsPolicy == "queue"
+	manager.OnConflict = portforward.ConflictStrategy(onConflict)
+	if localPortRange != "" {
+		min, max, err := portforward.ParsePortRange(localPortRange)
+		if err != nil {
+			return err
+		}
+		if err := manager.PortAllocator.SetRange(min, max); err != nil {
+			return err
+		}
+	}
+
+	manager.StablePorts = stablePorts
+	manager.PortOffset = portOffset
+	selection.PortAllocator = manager.PortAllocator
+	manager.Node = node
+	manager.Zone = zone
+	manager.PodSelector = podSelector
+	if waitReady {
+		manager.ReadyTimeout = waitTimeout
+	}
+	if len(contexts) > 0 {
+		manager.Clusters = contextClusters(clients)
+	}
+	if len(clusters) > 0 {
+		clusterClients := make([]*k8s.Client, 0, len(clusters))
+		for _, c := range clusters {
+			clusterClients = append(clusterClients, c)
+		}
+		manager.Clusters = contextClusters(clusterClients)
+	}
+
+	if privilegedHelper {
+		manager.PrivilegedHelper = sudoPrivilegedHelper(streams)
+	}
+
+	if copyAddress {
+		manager.OnReady = copyFirstReady(manager)
+	}
+
+	if docker {
+		if err := listenForDocker(manager); err != nil {
+			return err
+		}
+	}
+
+	// Share this session's forwards so other pfw processes can explain port conflicts
+	if registryPath, err := state.Path(state.ForwardsFile); err == nil {
+		manager.Registry = state.NewForwardRegistry(registryPath)
+	}
+	manager.SessionName = sessionName
+
+	if rememberPorts {
+		// A broken state file should never prevent forwarding, so fall back to not remembering
+		assignments, err := loadPortAssignments()
+		if err != nil {
+			fmt.Fprintf(streams.ErrOut, "Warning: not remembering local ports: %v\n", err)
+		} else {
+			manager.PortAssignments = assignments
+			selection.PortChoices = assignments
+		}
+	}
+
+	// Decide which local port is offered by default in prompts
+	var suggest PortSuggester = sameAsRemotePort
+	if stablePorts {
+		suggest = stablePortSuggester(manager.PortAllocator)
+	}
+
+	// Resources created for the session, such as relay pods, are removed when it ends
+	cleanup := &cleanups{}
+	defer cleanup.run()
+	if scaleFromZero {
+		manager.ScaleFromZero = true
+		cleanup.add(manager.RestoreScale)
+	}
+
+	// The session ends either on a signal or once all forwards have finished
+	endSession := sync.OnceValue(func() *ExitError {
+		cleanup.run()
+		summary := manager.Summary()
+		reportSession(summary, logger, logFormat == portforward.LogFormatJSON, streams.ErrOut)
+		events.Emit(portforward.Event{Type: portforward.EventSessionEnd})
+		return sessionResult(summary)
+	})
 
 	// Set up signal handler with access to the cancel function
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(signals, portforward.ShutdownSignals()...)
 	go func() {
 		<-signals
-		fmt.Fprintln(streams.Out, "\nShutting down port forwarding...")
+		if logFormat != portforward.LogFormatJSON {
+			// End the line echoing ^C
+			fmt.Fprintln(streams.Out)
+		}
+		logger.Info("Shutting down port forwarding...", "event", "shutdown")
 		manager.Stop()
+		result := endSession()
 		cancel() // Cancel the context
 
-		// Wait briefly for clean shutdown
-		time.Sleep(500 * time.Millisecond)
+		// Exit once the forwards have shut down, or after the timeout when some are stuck
+		manager.WaitForCompletionTimeout(portforward.ShutdownTimeout)
+		if result != nil {
+			os.Exit(result.Code)
+		}
 		os.Exit(0)
 	}()
 
 	// If a config file is specified, use it
 	if configFile != "" {
-		err := RunWithConfigFile(configFile, manager, client, ctx)
+		session, err := startConfigSession(configFile, outputFormat, manager, client, clusters, checkAccess, useCache, continueOnError, deployTimeout, ctx)
 		if err != nil {
 			return err
 		}
+
+		// Reconcile the forwards with the file on SIGHUP, like other long-running daemons
+		if reloadSignals := portforward.ReloadSignals(); len(reloadSignals) > 0 {
+			reloads := make(chan os.Signal, 1)
+			signal.Notify(reloads, reloadSignals...)
+			defer signal.Stop(reloads)
+			go func() {
+				for range reloads {
+					logger.Info(fmt.Sprintf("Reloading %s...", configFile), "event", "reload")
+					if err := session.reload(); err != nil {
+						logger.Error(err.Error(), "event", "error", "error", err.Error())
+					}
+				}
+			}()
+		}
+	} else if preset != nil {
+		fmt.Fprintf(streams.ErrOut, "Forwarding %d resource(s) from %s\n", len(preset.Resources), presetSource)
+		if err := RunWithConfig(preset, manager, client, clusters, checkAccess, useCache, continueOnError, deployTimeout, ctx); err != nil {
+			return err
+		}
 	} else {
+		if checkAccess {
+			permissions := modePermissions(usePods, useDeployments, useStatefulSets, !generateConfig)
+			if kind := client.CustomResourceKind(); kind != nil {
+				permissions = customResourcePermissions(kind, true)
+			}
+			if relayTarget != "" {
+				permissions = relayPermissions
+			}
+			if useCache {
+				permissions = cachedPermissions(permissions)
+			}
+			for _, c := range clients {
+				namespace := c.GetNamespace()
+				if findQuery != "" {
+					namespace = metav1.NamespaceAll
+				}
+				required := map[string][]k8s.Permission{namespace: permissions}
+				if err := preflight(ctx, c, required, streams.ErrOut); err != nil {
+					if len(clients) > 1 {
+						return fmt.Errorf("context %s: %w", c.GetContext(), err)
+					}
+					return err
+				}
+			}
+		}
+
 		// If generate config is specified, run interactive selection and generate config
 		if generateConfig {
-			err := GenerateConfigFile(usePods, useDeployments, useStatefulSets, outputFile, client, streams, ctx)
+			err := GenerateConfigFile(usePods, useDeployments, useStatefulSets, outputFile, outputFormat, client, suggest, selection, streams, ctx)
 			if err != nil {
 				return err
 			}
@@ -110,14 +780,198 @@ func Run(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStrea
 		}
 
 		// Otherwise, use interactive selection for port forwarding
-		err := RunInteractive(usePods, useDeployments, useStatefulSets, manager, client, streams, ctx)
+		switch {
+		case relayTarget != "":
+			err = RunRelay(relayTarget, relayImage, relayTimeout, int32(relayLocalPort), manager, client, cleanup, ctx)
+		case findQuery != "":
+			err = RunFind(findQuery, usePods, manager, client, suggest, selection, streams, ctx)
+		case len(contexts) > 0:
+			err = RunInteractiveContexts(usePods, useDeployments, useStatefulSets, manager, clients, suggest, selection, streams, ctx)
+		default:
+			err = RunInteractive(usePods, useDeployments, useStatefulSets, manager, client, suggest, selection, streams, ctx)
+		}
 		if err != nil {
 			return err
 		}
 	}
 
-	fmt.Fprintln(streams.Out, "Port forwarding started. Press Ctrl+C to stop.")
+	if controlAddr != "" {
+		server := control.NewServer(manager, client.GetNamespace())
+		if err := server.Start(controlAddr); err != nil {
+			manager.Stop()
+			return err
+		}
+		defer server.Close()
+		logger.Info(fmt.Sprintf("Control API listening on http://%s", server.Addr()), "event", "control", "address", server.Addr())
+		session.ControlAddr = server.Addr()
+		if err := registerSession(sessions, session, streams); err != nil {
+			manager.Stop()
+			return err
+		}
+	}
+
+	if output == nil {
+		logger.Info("Port forwarding started. Press Ctrl+C to stop.", "event", "started")
+	} else {
+		logger.Info(fmt.Sprintf("Port forwarding started. Enter %s to forward more resources, press Ctrl+C to stop.", addKey), "event", "started")
+		addMore := func() error {
+			// Keep the session alive while the selector is open
+			manager.ForwardWait.Add(1)
+			defer manager.ForwardWait.Done()
+			return RunInteractive(usePods, useDeployments, useStatefulSets, manager, client, suggest, addMoreSelection(selection, manager), streams, ctx)
+		}
+		go listenForAddKey(ctx, streams.In, output, addMore, logger)
+	}
 	manager.WaitForCompletion()
+	if result := endSession(); result != nil {
+		return result
+	}
+
+	return nil
+}
 
+// validatePodFilters rejects --zone and --pod-selector in --pods mode, where the listed pods
+// are forwarded directly and are only narrowed down by --node and the label selector
+func validatePodFilters(usePods bool, zone, podSelector string) error {
+	if usePods && (zone != "" || podSelector != "") {
+		return fmt.Errorf("--zone and --pod-selector only choose the pods behind services and workloads; with --pods, use --node and -l to narrow down the listed pods")
+	}
 	return nil
 }
+
+// loadPortAssignments opens the state file holding previously assigned local ports
+func loadPortAssignments() (*state.PortAssignments, error) {
+	path, err := state.Path(state.PortAssignmentsFile)
+	if err != nil {
+		return nil, err
+	}
+	return state.LoadPortAssignments(path)
+}
+
+// newClient creates a Kubernetes client from the kubeconfig flags. Without any kubeconfig
+// contexts, e.g. in a dev container running as a pod, the in-cluster service account is used.
+func newClient(configFlags *genericclioptions.ConfigFlags) (*k8s.Client, error) {
+	loader := configFlags.ToRawKubeConfigLoader()
+
+	// The namespace falls back to the pod's own namespace when running in-cluster
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	rawConfig, rawErr := loader.RawConfig()
+	if rawErr == nil && len(rawConfig.Contexts) == 0 {
+		if config, err := rest.InClusterConfig(); err == nil {
+			client, err := k8s.NewClientForConfig(config, namespace)
+			if err != nil {
+				return nil, err
+			}
+			client.SetContext(k8s.InClusterContext)
+			return client, nil
+		}
+	}
+
+	config, err := configFlags.ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %w", err)
+	}
+
+	client, err := k8s.NewClientForConfig(config, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the active context name; --context overrides the kubeconfig's current context
+	if configFlags.Context != nil && *configFlags.Context != "" {
+		client.SetContext(*configFlags.Context)
+	} else if rawErr == nil {
+		client.SetContext(rawConfig.CurrentContext)
+	}
+	return client, nil
+}
+
+// openEvents opens the lifecycle event stream requested with --events-fd or --events-file. It
+// returns a nil writer when neither is set.
+func openEvents(cmd *cobra.Command) (*portforward.EventWriter, func(), error) {
+	eventsFd, err := cmd.Flags().GetInt("events-fd")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get --events-fd flag: %w", err)
+	}
+	eventsFile, err := cmd.Flags().GetString("events-file")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get --events-file flag: %w", err)
+	}
+
+	var f *os.File
+	switch {
+	case eventsFd >= 0 && eventsFile != "":
+		return nil, nil, fmt.Errorf("cannot use --events-fd together with --events-file")
+	case eventsFd >= 0:
+		if eventsFd <= 2 {
+			return nil, nil, fmt.Errorf("--events-fd must not be stdin, stdout or stderr")
+		}
+		f = os.NewFile(uintptr(eventsFd), "events")
+		if f == nil {
+			return nil, nil, fmt.Errorf("invalid --events-fd %d", eventsFd)
+		}
+	case eventsFile != "":
+		f, err = os.OpenFile(eventsFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open events file: %w", err)
+		}
+	default:
+		return nil, func() {}, nil
+	}
+	return portforward.NewEventWriter(f), func() { f.Close() }, nil
+}
+
+// openLogFile opens the file requested with --log-file, rotated according to --log-max-size,
+// --log-max-age and --log-max-files, and returns logger extended to also write to it, and with
+// --log-connections a logger for connection events writing only to the file. It returns logger
+// unchanged and a nil audit logger when --log-file is not set.
+func openLogFile(cmd *cobra.Command, logger *slog.Logger, level slog.Level) (*slog.Logger, *slog.Logger, func(), error) {
+	logFile, err := cmd.Flags().GetString("log-file")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get --log-file flag: %w", err)
+	}
+	logConnections, err := cmd.Flags().GetBool("log-connections")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get --log-connections flag: %w", err)
+	}
+	maxSize, err := cmd.Flags().GetInt("log-max-size")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get --log-max-size flag: %w", err)
+	}
+	maxAge, err := cmd.Flags().GetDuration("log-max-age")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get --log-max-age flag: %w", err)
+	}
+	maxFiles, err := cmd.Flags().GetInt("log-max-files")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get --log-max-files flag: %w", err)
+	}
+	if maxSize < 0 || maxAge < 0 || maxFiles < 0 {
+		return nil, nil, nil, fmt.Errorf("--log-max-size, --log-max-age and --log-max-files must not be negative")
+	}
+	if logFile == "" {
+		if logConnections {
+			return nil, nil, nil, fmt.Errorf("--log-connections requires --log-file")
+		}
+		return logger, nil, func() {}, nil
+	}
+
+	f, err := portforward.OpenRotatingFile(logFile, portforward.RotationPolicy{
+		MaxSize:  int64(maxSize) * 1024 * 1024,
+		MaxAge:   maxAge,
+		MaxFiles: maxFiles,
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	fileLogger := portforward.NewFileLogger(f, level)
+	var audit *slog.Logger
+	if logConnections {
+		audit = fileLogger
+	}
+	return portforward.Tee(logger, fileLogger), audit, func() { f.Close() }, nil
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"testing"
+)
+
+// TestValidatePodFilters verifies that --zone and --pod-selector are rejected in --pods mode,
+// where they would otherwise be silently ignored
+func TestValidatePodFilters(t *testing.T) {
+	tests := []struct {
+		name        string
+		usePods     bool
+		zone        string
+		podSelector string
+		wantErr     bool
+	}{
+		{"services with zone", false, "eu-west-1a", "", false},
+		{"services with pod selector", false, "", "track=canary", false},
+		{"pods without filters", true, "", "", false},
+		{"pods with zone", true, "eu-west-1a", "", true},
+		{"pods with pod selector", true, "", "track=canary", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePodFilters(tt.usePods, tt.zone, tt.podSelector)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePodFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
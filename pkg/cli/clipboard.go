@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+
+	"golang.org/x/term"
+)
+
+// clipboardCommands returns the commands that can set the system clipboard, in order of
+// preference
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	default:
+		var commands [][]string
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			commands = append(commands, []string{"wl-copy"})
+		}
+		return append(commands, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	}
+}
+
+// copyToClipboard puts text on the system clipboard. Without a clipboard tool, e.g. over SSH,
+// the terminal is asked to set it with an OSC 52 escape sequence.
+func copyToClipboard(text string, terminal *os.File) error {
+	var errs []string
+	for _, command := range clipboardCommands() {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", command[0], err))
+			continue
+		}
+		return nil
+	}
+
+	if terminal != nil && term.IsTerminal(int(terminal.Fd())) {
+		return writeOSC52(terminal, text)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to copy to the clipboard: %s", strings.Join(errs, "; "))
+	}
+	return fmt.Errorf("no clipboard tool found")
+}
+
+// writeOSC52 asks the terminal to set the clipboard to text
+func writeOSC52(w io.Writer, text string) error {
+	_, err := fmt.Fprintf(w, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+// copyFirstReady returns an OnReady hook copying the address of the first forward that
+// becomes active to the clipboard
+func copyFirstReady(manager *portforward.Manager) func(portforward.ForwardStatus) {
+	var once sync.Once
+	return func(status portforward.ForwardStatus) {
+		once.Do(func() {
+			address := portforward.LocalAddress(status.Scheme, status.LocalPort)
+			if err := copyToClipboard(address, os.Stderr); err != nil {
+				manager.Log().Warn(fmt.Sprintf("Not copying %s: %v", address, err), "event", "copy")
+				return
+			}
+			manager.Log().Info(fmt.Sprintf("Copied %s to the clipboard", address), "event", "copy", "localPort", status.LocalPort)
+		})
+	}
+}
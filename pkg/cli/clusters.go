@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// newConfigClusters creates a client for each context of the clusters of a configuration,
+// keyed by context. Clusters naming the same context share its client, as the manager looks
+// clusters up by context.
+func newConfigClusters(configFlags *genericclioptions.ConfigFlags, cfg *config.ForwardingConfig) (map[string]*k8s.Client, error) {
+	clients := make(map[string]*k8s.Client)
+	kubeconfigs := make(map[string]string)
+	for name, cluster := range cfg.Clusters {
+		if kubeconfig, ok := kubeconfigs[cluster.Context]; ok {
+			if kubeconfig != cluster.Kubeconfig {
+				return nil, fmt.Errorf("clusters use context %s from different kubeconfig files", cluster.Context)
+			}
+			continue
+		}
+		kubeconfigs[cluster.Context] = cluster.Kubeconfig
+
+		rules := loadingRules(configFlags)
+		if cluster.Kubeconfig != "" {
+			rules.ExplicitPath = expandHome(cluster.Kubeconfig)
+		}
+		client, err := newKubeconfigClient(rules, cluster.Context, "")
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", name, err)
+		}
+		clients[cluster.Context] = client
+	}
+	return clients, nil
+}
+
+// expandHome replaces a leading ~ in path with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// entryResolver turns the entries of a configuration into resources and the clients looking
+// up their pods. Entries referencing a cluster use the client of its context and default to its
+// namespace, or to the namespace of the context. Entries impersonating a user get a client of
+// their own per namespace and identity.
+type entryResolver struct {
+	cfg      *config.ForwardingConfig
+	client   *k8s.Client
+	clusters map[string]*k8s.Client
+	// namespace is the namespace of entries of the session's context without one
+	namespace string
+	// contextNamespaces are the namespaces of the cluster contexts, keyed by context
+	contextNamespaces map[string]string
+	// impersonated are the clients of entries impersonating a user, keyed by ClusterKey
+	impersonated map[string]*k8s.Client
+}
+
+// newEntryResolver returns a resolver for the entries of cfg
+func newEntryResolver(cfg *config.ForwardingConfig, client *k8s.Client, clusters map[string]*k8s.Client, namespace string) *entryResolver {
+	if cfg.DefaultNamespace != "" {
+		namespace = cfg.DefaultNamespace
+	}
+	r := &entryResolver{
+		cfg:               cfg,
+		client:            client,
+		clusters:          clusters,
+		namespace:         namespace,
+		contextNamespaces: make(map[string]string),
+		impersonated:      make(map[string]*k8s.Client),
+	}
+	for contextName, c := range clusters {
+		r.contextNamespaces[contextName] = c.GetNamespace()
+	}
+	return r
+}
+
+// resolve returns the resource of an entry and the client looking up its pods
+func (r *entryResolver) resolve(entry config.PortForwardEntry) (model.Resource, *k8s.Client, error) {
+	resource, client, err := r.resolveCluster(entry)
+	if err != nil || resource.As == "" {
+		return resource, client, err
+	}
+
+	key := resource.ClusterKey()
+	if impersonated, ok := r.impersonated[key]; ok {
+		return resource, impersonated, nil
+	}
+	impersonated, err := client.Impersonate(resource.As, resource.AsGroups)
+	if err != nil {
+		return model.Resource{}, nil, err
+	}
+	impersonated.SetNamespace(resource.Namespace)
+	r.impersonated[key] = impersonated
+	return resource, impersonated, nil
+}
+
+// resolveCluster returns the resource of an entry and the client of its context
+func (r *entryResolver) resolveCluster(entry config.PortForwardEntry) (model.Resource, *k8s.Client, error) {
+	if entry.Cluster == "" {
+		resource, err := config.ConvertEntryToResource(entry, r.namespace)
+		return resource, r.client, err
+	}
+
+	cluster := r.cfg.Clusters[entry.Cluster]
+	client, ok := r.clusters[cluster.Context]
+	if !ok {
+		return model.Resource{}, nil, fmt.Errorf("cluster %s was added after the session started; restart it to forward from the cluster", entry.Cluster)
+	}
+	namespace := cluster.Namespace
+	if namespace == "" {
+		namespace = r.contextNamespaces[cluster.Context]
+	}
+	resource, err := config.ConvertEntryToResource(entry, namespace)
+	resource.Context = cluster.Context
+	return resource, client, err
+}
+
+// addImpersonatedCluster registers the client of a resource impersonating a user with the
+// manager, which otherwise forwards it with the identity of its context
+func addImpersonatedCluster(manager *portforward.Manager, resource model.Resource, client *k8s.Client) {
+	if resource.As != "" {
+		manager.AddCluster(resource.ClusterKey(), portforward.NewCluster(client.GetConfig(), client.GetClientset(), client))
+	}
+}
@@ -2,27 +2,59 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
 
+	"roeyazroel/kubectl-pfw/pkg/config"
 	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/state"
 	"roeyazroel/kubectl-pfw/pkg/ui"
 )
 
-// getResourcesForMode retrieves the appropriate resources based on the selected mode.
-func getResourcesForMode(usePods, useDeployments, useStatefulSets bool, client *k8s.Client, ctx context.Context) ([]ui.Resource, error) {
+// getResourcesForMode retrieves the appropriate resources based on the selected mode, keeping
+// those passing the selection filter in the selection sort order. Clients configured with
+// --resource list resources of that kind.
+func getResourcesForMode(usePods, useDeployments, useStatefulSets bool, selection Selection, client *k8s.Client, ctx context.Context) ([]ui.Resource, error) {
 	var resources []ui.Resource
 
-	if usePods {
+	if kind := client.CustomResourceKind(); kind != nil {
+		customResources, err := client.GetCustomResources(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resources = make([]ui.Resource, 0, len(customResources))
+		for _, custom := range customResources {
+			resources = append(resources, ui.NewResourceFromCustomResource(custom))
+		}
+		if len(resources) == 0 {
+			return nil, fmt.Errorf("no %s found in namespace %s", kind.GVR.Resource, client.GetNamespace())
+		}
+	} else if usePods {
 		pods, err := client.GetPods(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get pods: %w", err)
 		}
 		resources = make([]ui.Resource, 0, len(pods))
-		for _, pod := range pods {
+		for _, pod := range groupPodsByOwner(pods) {
+			if selection.Node != "" && pod.Node != selection.Node {
+				continue
+			}
 			if len(pod.Ports) > 0 {
-				resources = append(resources, ui.NewResourceFromPod(pod))
+				resource := ui.NewResourceFromPod(pod)
+				if pod.Owner != "" {
+					resource.DisplayName = fmt.Sprintf("[%s] %s", pod.Owner, resource.DisplayName)
+				}
+				resources = append(resources, resource)
 			}
 		}
+		if len(resources) == 0 && selection.Node != "" {
+			return nil, fmt.Errorf("no pods with exposed ports found on node %s in namespace %s", selection.Node, client.GetNamespace())
+		}
 		if len(resources) == 0 {
 			return nil, fmt.Errorf("no pods with exposed ports found in namespace %s", client.GetNamespace())
 		}
@@ -66,11 +98,52 @@ func getResourcesForMode(usePods, useDeployments, useStatefulSets bool, client *
 		}
 	}
 
+	if selection.Skip != nil {
+		kept := resources[:0]
+		for _, resource := range resources {
+			if !selection.Skip(resource) {
+				kept = append(kept, resource)
+			}
+		}
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("all resources in namespace %s are forwarded already", client.GetNamespace())
+		}
+		resources = kept
+	}
+
+	if filtered := selection.Filter.apply(resources); len(filtered) < len(resources) {
+		if len(filtered) == 0 {
+			return nil, fmt.Errorf("all %d resources in namespace %s are filtered out by name", len(resources), client.GetNamespace())
+		}
+		resources = filtered
+	}
+	sortResources(resources, selection.Sort, selection.History, client.GetContext())
+
 	return resources, nil
 }
 
-// getPromptForMode returns the appropriate prompt based on the selected mode.
-func getPromptForMode(usePods, useDeployments, useStatefulSets bool, isConfig bool, namespace string) string {
+// groupPodsByOwner orders pods by their owning workload so the replicas of a deployment or
+// statefulset are listed together. Standalone pods come last.
+func groupPodsByOwner(pods []k8s.Pod) []k8s.Pod {
+	grouped := make([]k8s.Pod, len(pods))
+	copy(grouped, pods)
+	sort.SliceStable(grouped, func(i, j int) bool {
+		a, b := grouped[i].Owner, grouped[j].Owner
+		if (a == "") != (b == "") {
+			return a != ""
+		}
+		if a != b {
+			return a < b
+		}
+		return grouped[i].Name < grouped[j].Name
+	})
+	return grouped
+}
+
+// getPromptForMode returns the appropriate prompt based on the selected mode. scope names
+// where the resources come from, such as "namespace default"; customKind is the kind selected
+// with --resource, if any.
+func getPromptForMode(usePods, useDeployments, useStatefulSets bool, customKind *k8s.CustomResourceKind, isConfig bool, scope string) string {
 	var action string
 	if isConfig {
 		action = "for configuration"
@@ -78,21 +151,23 @@ func getPromptForMode(usePods, useDeployments, useStatefulSets bool, isConfig bo
 		action = "to port-forward"
 	}
 
-	if usePods {
-		return fmt.Sprintf("Select pods %s in namespace %s:", action, namespace)
+	if customKind != nil {
+		return fmt.Sprintf("Select %s %s in %s:", customKind.GVR.Resource, action, scope)
+	} else if usePods {
+		return fmt.Sprintf("Select pods %s in %s:", action, scope)
 	} else if useDeployments {
-		return fmt.Sprintf("Select deployments %s in namespace %s:", action, namespace)
+		return fmt.Sprintf("Select deployments %s in %s:", action, scope)
 	} else if useStatefulSets {
-		return fmt.Sprintf("Select statefulsets %s in namespace %s:", action, namespace)
+		return fmt.Sprintf("Select statefulsets %s in %s:", action, scope)
 	}
-	return fmt.Sprintf("Select services %s in namespace %s:", action, namespace)
+	return fmt.Sprintf("Select services %s in %s:", action, scope)
 }
 
 // processSelectedResources handles common processing for selected resources.
 func processSelectedResources(selectedResources []ui.Resource, client *k8s.Client, ctx context.Context) error {
 	for i, resource := range selectedResources {
 		if resource.Type == ui.DeploymentResource {
-			pods, err := client.GetPodsForDeployment(ctx, resource.Name)
+			pods, err := client.GetPodsForDeploymentInNamespace(ctx, resource.Namespace, resource.Name)
 			if err != nil || len(pods) == 0 {
 				return fmt.Errorf("no pods found for deployment %s", resource.Name)
 			}
@@ -101,8 +176,9 @@ func processSelectedResources(selectedResources []ui.Resource, client *k8s.Clien
 			selectedResources[i].Name = resource.Name
 			selectedResources[i].Namespace = resource.Namespace
 			selectedResources[i].DisplayName = resource.DisplayName
+			selectedResources[i].Context = resource.Context
 		} else if resource.Type == ui.StatefulSetResource {
-			pods, err := client.GetPodsForStatefulSet(ctx, resource.Name)
+			pods, err := client.GetPodsForStatefulSetInNamespace(ctx, resource.Namespace, resource.Name)
 			if err != nil || len(pods) == 0 {
 				return fmt.Errorf("no pods found for statefulset %s", resource.Name)
 			}
@@ -111,35 +187,342 @@ func processSelectedResources(selectedResources []ui.Resource, client *k8s.Clien
 			selectedResources[i].Name = resource.Name
 			selectedResources[i].Namespace = resource.Namespace
 			selectedResources[i].DisplayName = resource.DisplayName
+			selectedResources[i].Context = resource.Context
+		} else if resource.Type == ui.CustomResource {
+			pods, err := client.GetPodsForCustomResourceInNamespace(ctx, resource.Namespace, resource.Name)
+			if err != nil {
+				return err
+			}
+			selectedResources[i] = ui.NewResourceFromPod(pods[0])
+			selectedResources[i].Type = ui.CustomResource
+			selectedResources[i].Name = resource.Name
+			selectedResources[i].Namespace = resource.Namespace
+			selectedResources[i].DisplayName = resource.DisplayName
+			selectedResources[i].Context = resource.Context
 		}
 	}
 	return nil
 }
 
-// createPortMappings builds port mappings for resources.
-func createPortMappings(selectedResources []ui.Resource, resolvedPorts map[string]map[int]int32, client *k8s.Client) (map[string]map[int]int32, error) {
+// Selection decides how resources, their ports and local ports are chosen. The zero value
+// prompts for each of them.
+type Selection struct {
+	// All selects every listed resource and port and uses the suggested local ports without prompting
+	All bool
+	// Names selects the resources whose names match any of these glob patterns without prompting
+	Names []string
+	// AcceptDefaults forwards every port of the selected resources on the suggested local ports
+	// without asking about ports
+	AcceptDefaults bool
+	// History preselects previous choices in prompts and records forwarded selections; nil disables it
+	History *state.History
+	// Filter narrows the listed resources by name
+	Filter NameFilter
+	// Node, when set, lists only the pods scheduled on this node in pod mode
+	Node string
+	// Sort orders the listed resources by name, namespace, age or recent use; empty keeps the
+	// order returned by the API
+	Sort string
+	// PortOffset is added to the chosen local ports by the manager, so suggested ports are
+	// checked with it
+	PortOffset int32
+	// PortAllocator, when set, makes prompts reject local ports already reserved in the session
+	PortAllocator *portforward.PortAllocator
+	// PortChoices, when set, offers the local ports chosen in earlier prompts as defaults and
+	// records the ports chosen now
+	PortChoices *state.PortAssignments
+	// Skip, when set, hides the resources for which it returns true, e.g. those already
+	// forwarded in the session
+	Skip func(ui.Resource) bool
+}
+
+// interactive reports whether the user is prompted
+func (s Selection) interactive() bool {
+	return !s.All && len(s.Names) == 0
+}
+
+// asksForPorts reports whether the user is asked which ports to forward and on which local ports
+func (s Selection) asksForPorts() bool {
+	return s.interactive() && !s.AcceptDefaults
+}
+
+// validate checks the name patterns
+func (s Selection) validate() error {
+	for _, pattern := range s.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --select pattern %q: %w", pattern, err)
+		}
+	}
+	return validateSort(s.Sort)
+}
+
+// selectResources picks the resources to forward from the listed ones. Prompts preselect the
+// resources remembered under historyKey. Every name pattern must match at least one resource,
+// so typos fail loudly instead of silently forwarding less.
+func (s Selection) selectResources(resources []ui.Resource, prompt, historyKey string) ([]ui.Resource, error) {
+	if s.All {
+		return resources, nil
+	}
+	if len(s.Names) == 0 {
+		return ui.SelectResourcesWithDefaults(resources, prompt, s.previous(resources, historyKey))
+	}
+
+	var selected []ui.Resource
+	matched := make(map[string]bool)
+	for _, resource := range resources {
+		include := false
+		for _, pattern := range s.Names {
+			if ok, _ := path.Match(pattern, resource.Name); ok {
+				matched[pattern] = true
+				include = true
+			}
+		}
+		if include {
+			selected = append(selected, resource)
+		}
+	}
+
+	var unmatched []string
+	for _, pattern := range s.Names {
+		if !matched[pattern] {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("no listed resources match %s", strings.Join(unmatched, ", "))
+	}
+	return selected, nil
+}
+
+// previous returns the indices of the resources selected last time under historyKey
+func (s Selection) previous(resources []ui.Resource, historyKey string) []int {
+	if s.History == nil || historyKey == "" {
+		return nil
+	}
+	remembered := s.History.Get(historyKey)
+	if remembered == nil {
+		return nil
+	}
+
+	chosen := make(map[string]bool, len(remembered.Resources))
+	for _, entry := range remembered.Resources {
+		namespace := entry.Namespace
+		if namespace == "" {
+			namespace = remembered.DefaultNamespace
+		}
+		chosen[entry.ResourceType+"/"+namespace+"/"+entry.Name] = true
+	}
+	var indices []int
+	for i, resource := range resources {
+		if chosen[string(resource.Type)+"/"+resource.Namespace+"/"+resource.Name] {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// remember records a forwarded selection as the latest one under historyKey. The history is a
+// convenience, so failing to write it only warns.
+func (s Selection) remember(historyKey string, forwarded *config.ForwardingConfig, errOut io.Writer) {
+	if s.History == nil {
+		return
+	}
+	if err := s.History.Record(historyKey, forwarded); err != nil {
+		fmt.Fprintf(errOut, "Warning: not remembering this selection: %v\n", err)
+	}
+}
+
+// modeName names the kind of resources listed in a selection mode
+func modeName(usePods, useDeployments, useStatefulSets bool, customKind *k8s.CustomResourceKind) string {
+	switch {
+	case customKind != nil:
+		return customKind.GVR.GroupResource().String()
+	case usePods:
+		return "pods"
+	case useDeployments:
+		return "deployments"
+	case useStatefulSets:
+		return "statefulsets"
+	default:
+		return "services"
+	}
+}
+
+// selectPorts asks which ports to forward for each selected resource exposing several ports and
+// narrows the resources to them, so only the chosen ports are prompted for and forwarded.
+// Non-interactive selections keep every port.
+func (s Selection) selectPorts(selectedResources []ui.Resource) error {
+	if !s.asksForPorts() {
+		return nil
+	}
+	for i, resource := range selectedResources {
+		indices, err := ui.SelectPorts(resource)
+		if err != nil {
+			return err
+		}
+		selectedResources[i] = resource.WithPorts(indices)
+	}
+	return nil
+}
+
+// PortSuggester returns the local port offered by default for a resource port. remotePort is
+// the port being forwarded to (the resolved container port for services).
+type PortSuggester func(resource ui.Resource, portIndex int, remotePort int32) int32
+
+// sameAsRemotePort is the default PortSuggester, offering the remote port number locally
+func sameAsRemotePort(resource ui.Resource, portIndex int, remotePort int32) int32 {
+	return remotePort
+}
+
+// stablePortSuggester offers the deterministic stable port for each resource port
+func stablePortSuggester(allocator *portforward.PortAllocator) PortSuggester {
+	return func(resource ui.Resource, portIndex int, remotePort int32) int32 {
+		return allocator.StablePort(portforward.StableKey(resource.Namespace, resource.Type, resource.Name, remotePort))
+	}
+}
+
+// checkLocalPort rejects local port answers already reserved by forwards of the session, and
+// those that --port-offset pushes beyond 65535
+func (s Selection) checkLocalPort(port int32) error {
+	if port != 0 && int64(port)+int64(s.PortOffset) > 65535 {
+		return fmt.Errorf("local port %d plus --port-offset %d exceeds 65535", port, s.PortOffset)
+	}
+	if s.PortAllocator != nil && s.PortAllocator.IsAllocated(port+s.PortOffset) {
+		return fmt.Errorf("local port %d is already used by a forward of this session", port+s.PortOffset)
+	}
+	return nil
+}
+
+// chosenPort returns the local port chosen for a resource port in an earlier prompt, or 0
+func (s Selection) chosenPort(client *k8s.Client, resource ui.Resource, remotePort int32) int32 {
+	if s.PortChoices == nil {
+		return 0
+	}
+	port, _ := s.PortChoices.GetChosen(choiceKey(client, resource, remotePort))
+	return port
+}
+
+// rememberPorts records the local ports chosen in prompts so they are offered next time. Ports
+// left to automatic assignment are not recorded. Remembering is a convenience, so failures are
+// ignored.
+func (s Selection) rememberPorts(client *k8s.Client, rows []ui.LocalPortRow) {
+	if s.PortChoices == nil {
+		return
+	}
+	for _, row := range rows {
+		if row.LocalPort != 0 {
+			_ = s.PortChoices.SetChosen(choiceKey(client, row.Resource, row.RemotePort), row.LocalPort)
+		}
+	}
+}
+
+// choiceKey identifies a resource port in remembered port choices
+func choiceKey(client *k8s.Client, resource ui.Resource, remotePort int32) string {
+	contextName := resource.Context
+	if contextName == "" {
+		contextName = client.GetContext()
+	}
+	return portforward.AssignmentKey(contextName, resource.Namespace, resource.Type, resource.Name, remotePort)
+}
+
+// createPortMappings builds port mappings for resources. Non-interactive selections and
+// AcceptDefaults use the suggested local port when it is free and an automatically assigned one
+// otherwise. Interactive selections show all proposed local ports in a single form to accept or edit.
+// The mappings are keyed by Resource.Key.
+func createPortMappings(selectedResources []ui.Resource, resolvedPorts map[string]map[int]int32, client *k8s.Client, suggest PortSuggester, selection Selection) (map[string]map[int]int32, error) {
 	portMaps := make(map[string]map[int]int32)
+	var rows []ui.LocalPortRow
 
 	for _, resource := range selectedResources {
 		portMap := make(map[int]int32)
-		portMaps[resource.Name] = portMap
+		portMaps[resource.Key()] = portMap
 
 		for i, portValue := range resource.Ports {
 			suggestedPort := portValue
 			if resource.Type == ui.ServiceResource {
-				if resolvedPortMap, ok := resolvedPorts[resource.Name]; ok {
+				if resolvedPortMap, ok := resolvedPorts[resource.Key()]; ok {
 					if resolvedValue, ok := resolvedPortMap[i]; ok {
 						suggestedPort = resolvedValue
 					}
 				}
 			}
-			localPort, err := ui.AskForLocalPort(resource, suggestedPort, i)
-			if err != nil {
-				return nil, fmt.Errorf("error getting local port: %w", err)
+			// The port chosen last time is offered first, then one recommended by the
+			// resource's annotations
+			defaultPort := selection.chosenPort(client, resource, suggestedPort)
+			if defaultPort == 0 {
+				defaultPort = resource.PreferredLocalPort(i)
 			}
-			portMap[i] = localPort
+			if defaultPort == 0 {
+				defaultPort = suggest(resource, i, suggestedPort)
+			}
+			if !selection.asksForPorts() {
+				localPort := defaultPort
+				if !portforward.IsPortAvailable(localPort + selection.PortOffset) {
+					localPort = 0
+				}
+				portMap[i] = localPort
+				continue
+			}
+			rows = append(rows, ui.LocalPortRow{Resource: resource, PortIndex: i, RemotePort: suggestedPort, LocalPort: defaultPort})
 		}
 	}
 
+	switch len(rows) {
+	case 0:
+	case 1:
+		// A single port is asked about directly
+		row := rows[0]
+		localPort, err := ui.AskForLocalPortWithDefault(row.Resource, row.RemotePort, row.LocalPort, row.PortIndex, selection.checkLocalPort)
+		if err != nil {
+			return nil, fmt.Errorf("error getting local port: %w", err)
+		}
+		portMaps[row.Resource.Key()][row.PortIndex] = localPort
+		row.LocalPort = localPort
+		selection.rememberPorts(client, []ui.LocalPortRow{row})
+	default:
+		edited, err := ui.EditLocalPorts(rows, selection.checkLocalPort)
+		if err != nil {
+			return nil, fmt.Errorf("error getting local ports: %w", err)
+		}
+		for _, row := range edited {
+			portMaps[row.Resource.Key()][row.PortIndex] = row.LocalPort
+		}
+		selection.rememberPorts(client, edited)
+	}
+
 	return portMaps, nil
 }
+
+// forwardSelected starts forwarding a selected resource. When a local port chosen in a prompt
+// turns out to be busy, the user is told who holds it and asked again, offering a nearby free
+// port, instead of failing the resource. portMap is updated with the ports finally chosen.
+func forwardSelected(manager *portforward.Manager, resource ui.Resource, portMap map[int]int32, selection Selection, errOut io.Writer) error {
+	for {
+		err := manager.ForwardResource(resource, portMap)
+		var conflict *portforward.PortConflictError
+		if err == nil || !selection.asksForPorts() || !errors.As(err, &conflict) {
+			return err
+		}
+		portIndex := -1
+		for i, localPort := range portMap {
+			if localPort == conflict.Port {
+				portIndex = i
+				break
+			}
+		}
+		if portIndex < 0 {
+			return err
+		}
+
+		fmt.Fprintf(errOut, "Local port %d is %s.\n", conflict.LocalPort, conflict.Reason)
+		suggestion := conflict.Port + 1
+		if conflict.Suggestion != 0 {
+			suggestion = conflict.Suggestion - selection.PortOffset
+		}
+		localPort, err := ui.AskForLocalPortWithDefault(resource, conflict.RemotePort, suggestion, portIndex, selection.checkLocalPort)
+		if err != nil {
+			return fmt.Errorf("error getting local port: %w", err)
+		}
+		portMap[portIndex] = localPort
+	}
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// completionTimeout bounds the cluster queries made while completing
+const completionTimeout = 5 * time.Second
+
+// RegisterCompletions adds dynamic completions for the namespace, context, resource and pod
+// flags defined on cmd
+func RegisterCompletions(cmd *cobra.Command, flags *genericclioptions.ConfigFlags) {
+	completions := map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+		"namespace": func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completeNamespaces(flags), cobra.ShellCompDirectiveNoFileComp
+		},
+		"context": func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completeContexts(flags), cobra.ShellCompDirectiveNoFileComp
+		},
+		"contexts": func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completeListItem(completeContexts(flags), toComplete), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		},
+		"select": func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completeListItem(completeResourceNames(cmd, flags), toComplete), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		},
+		"sort": func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return []string{SortByName, SortByNamespace, SortByAge, SortByRecent}, cobra.ShellCompDirectiveNoFileComp
+		},
+		"pod": func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return completePods(flags), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	for name, fn := range completions {
+		if cmd.Flags().Lookup(name) != nil {
+			// Registration only fails for unknown or already registered flags
+			_ = cmd.RegisterFlagCompletionFunc(name, fn)
+		}
+	}
+}
+
+// CompleteAliases completes the aliases defined in the settings file
+func CompleteAliases(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, name := range settings.AliasNames() {
+		if !contains(args, name) {
+			names = append(names, name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeListItem completes the last item of a comma-separated list, keeping the items before it
+func completeListItem(candidates []string, toComplete string) []string {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+	}
+	done := strings.Split(prefix, ",")
+
+	var items []string
+	for _, candidate := range candidates {
+		if !contains(done, candidate) {
+			items = append(items, prefix+candidate)
+		}
+	}
+	return items
+}
+
+// contains reports whether values includes value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// completeContexts returns the contexts of the kubeconfig
+func completeContexts(flags *genericclioptions.ConfigFlags) []string {
+	kubeconfig, err := loadingRules(flags).Load()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(kubeconfig.Contexts))
+	for name := range kubeconfig.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeNamespaces returns the namespaces of the cluster
+func completeNamespaces(flags *genericclioptions.ConfigFlags) []string {
+	client, err := newClient(flags)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	namespaces, err := client.GetClientset().CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.Name)
+	}
+	return names
+}
+
+// completeResourceNames returns the names of the resources listed in the mode selected by the
+// command's flags
+func completeResourceNames(cmd *cobra.Command, flags *genericclioptions.ConfigFlags) []string {
+	client, err := newClient(flags)
+	if err != nil {
+		return nil
+	}
+	usePods, _ := cmd.Flags().GetBool("pods")
+	useDeployments, _ := cmd.Flags().GetBool("deployments")
+	useStatefulSets, _ := cmd.Flags().GetBool("statefulsets")
+	labelSelector, _ := cmd.Flags().GetString("selector")
+	fieldSelector, _ := cmd.Flags().GetString("field-selector")
+	if err := client.SetListFilter(labelSelector, fieldSelector); err != nil {
+		return nil
+	}
+	if customResource, _ := cmd.Flags().GetString("resource"); customResource != "" {
+		selectorPath, _ := cmd.Flags().GetString("resource-selector-path")
+		if err := client.SetCustomResourceKind(customResource, selectorPath); err != nil {
+			return nil
+		}
+	}
+
+	nameFilter, _ := cmd.Flags().GetString("filter")
+	filter := NameFilter{Include: parseFilter(nameFilter)}
+	if excludes, _ := cmd.Flags().GetStringArray("exclude"); len(excludes) > 0 {
+		if filter.Exclude, err = parseExclude(excludes); err != nil {
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	resources, err := getResourcesForMode(usePods, useDeployments, useStatefulSets, Selection{Filter: filter}, client, ctx)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		names = append(names, resource.Name)
+	}
+	return names
+}
+
+// completePods returns the pods in the namespace
+func completePods(flags *genericclioptions.ConfigFlags) []string {
+	client, err := newClient(flags)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	pods, err := client.GetClientset().CoreV1().Pods(client.GetNamespace()).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	return names
+}
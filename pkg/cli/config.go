@@ -2,31 +2,50 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"roeyazroel/kubectl-pfw/pkg/config"
 	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
 	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/state"
 	"roeyazroel/kubectl-pfw/pkg/ui"
 
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
-// GenerateConfigFile handles interactive selection and generates a configuration file.
-func GenerateConfigFile(usePods, useDeployments, useStatefulSets bool, outputFile string, client *k8s.Client, streams genericclioptions.IOStreams, ctx context.Context) error {
+// UpCommand is the name of the subcommand forwarding aliases defined in the settings file
+const UpCommand = "up"
+
+// StdoutOutput is the --output value writing the generated configuration to stdout
+const StdoutOutput = "-"
+
+// GenerateConfigFile handles interactive selection and generates a configuration file. With
+// outputFile StdoutOutput the configuration is written to stdout and prompts go to stderr, so
+// it can be piped or redirected. An empty format is taken from the extension of outputFile.
+func GenerateConfigFile(usePods, useDeployments, useStatefulSets bool, outputFile, format string, client *k8s.Client, suggest PortSuggester, selection Selection, streams genericclioptions.IOStreams, ctx context.Context) error {
+	if outputFile == StdoutOutput {
+		ui.PromptOnStderr()
+	}
+
 	// Get resources based on the selected mode
-	resources, err := getResourcesForMode(usePods, useDeployments, useStatefulSets, client, ctx)
+	resources, err := getResourcesForMode(usePods, useDeployments, useStatefulSets, selection, client, ctx)
 	if err != nil {
 		return err
 	}
 
 	// Get the appropriate prompt
-	prompt := getPromptForMode(usePods, useDeployments, useStatefulSets, true, client.GetNamespace())
+	prompt := getPromptForMode(usePods, useDeployments, useStatefulSets, client.CustomResourceKind(), true, "namespace "+client.GetNamespace())
 
 	// Select resources
-	selectedResources, err := ui.SelectResources(resources, prompt)
+	historyKey := state.HistoryKey(client.GetContext(), client.GetNamespace(), modeName(usePods, useDeployments, useStatefulSets, client.CustomResourceKind()))
+	selectedResources, err := selection.selectResources(resources, prompt, historyKey)
 	if err != nil {
 		return err
 	}
@@ -36,6 +55,9 @@ func GenerateConfigFile(usePods, useDeployments, useStatefulSets bool, outputFil
 	if err != nil {
 		return err
 	}
+	if err := selection.selectPorts(selectedResources); err != nil {
+		return err
+	}
 
 	// Resolve target ports
 	resolvedPorts, err := config.ResolveTargetPorts(ctx, selectedResources, client)
@@ -44,13 +66,22 @@ func GenerateConfigFile(usePods, useDeployments, useStatefulSets bool, outputFil
 	}
 
 	// Create port mappings
-	portMaps, err := createPortMappings(selectedResources, resolvedPorts, client)
+	portMaps, err := createPortMappings(selectedResources, resolvedPorts, client, suggest, selection)
 	if err != nil {
 		return err
 	}
 
 	// Generate the configuration
-	cfg := config.GenerateConfig(selectedResources, portMaps, resolvedPorts, client.GetNamespace())
+	cfg := config.GenerateConfig(selectedResources, portMaps, resolvedPorts, client.GetContext(), client.GetNamespace())
+
+	if outputFile == StdoutOutput {
+		content, err := config.EncodeConfig(cfg, "<file>", format)
+		if err != nil {
+			return err
+		}
+		_, err = streams.Out.Write(content)
+		return err
+	}
 
 	// Create output directory if needed
 	outputDir := filepath.Dir(outputFile)
@@ -62,7 +93,7 @@ func GenerateConfigFile(usePods, useDeployments, useStatefulSets bool, outputFil
 	}
 
 	// Write the configuration to file
-	err = config.WriteConfig(cfg, outputFile)
+	err = config.WriteConfig(cfg, outputFile, format)
 	if err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
@@ -74,27 +105,131 @@ func GenerateConfigFile(usePods, useDeployments, useStatefulSets bool, outputFil
 }
 
 // RunWithConfigFile handles port forwarding based on a configuration file.
-func RunWithConfigFile(filePath string, manager *portforward.Manager, client *k8s.Client, ctx context.Context) error {
+// With checkAccess, the permissions for every entry are verified before forwarding starts;
+// useCache reports whether lookups go through informers. clusters holds the clients of the
+// contexts of the file's clusters, keyed by context.
+func RunWithConfigFile(filePath string, manager *portforward.Manager, client *k8s.Client, clusters map[string]*k8s.Client, checkAccess, useCache, continueOnError bool, waitTimeout time.Duration, ctx context.Context) error {
 	cfg, err := config.LoadConfig(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to load config file: %w", err)
 	}
+	return RunWithConfig(cfg, manager, client, clusters, checkAccess, useCache, continueOnError, waitTimeout, ctx)
+}
 
+// RunWithConfig forwards the resources of a loaded configuration, such as a remembered selection.
+// The first resource that fails to start aborts the run unless continueOnError is set, in which
+// case the remaining resources are started and the failures are summarized at the end. With a
+// waitTimeout, resources that are not deployed yet are forwarded once they appear. Entries
+// referencing a cluster are forwarded with the client of its context in clusters.
+func RunWithConfig(cfg *config.ForwardingConfig, manager *portforward.Manager, client *k8s.Client, clusters map[string]*k8s.Client, checkAccess, useCache, continueOnError bool, waitTimeout time.Duration, ctx context.Context) error {
 	if cfg.DefaultNamespace != "" {
 		client.SetNamespace(cfg.DefaultNamespace)
 	}
+	resolver := newEntryResolver(cfg, client, clusters, client.GetNamespace())
+
+	if checkAccess {
+		checks, err := configPermissions(resolver)
+		if err != nil {
+			return err
+		}
+		for _, check := range checks {
+			if useCache && !check.impersonated {
+				for namespace, permissions := range check.required {
+					check.required[namespace] = cachedPermissions(permissions)
+				}
+			}
+			if err := preflight(ctx, check.client, check.required, manager.Streams.ErrOut); err != nil {
+				if check.label != "" {
+					return fmt.Errorf("%s: %w", check.label, err)
+				}
+				return err
+			}
+		}
+	}
 
+	// Report every busy or duplicated local port before the first tunnel comes up; when
+	// continuing past errors the failures are summarized at the end instead, and with
+	// --on-conflict increment or ephemeral busy ports are replaced as they are allocated
+	if !continueOnError && manager.OnConflict == portforward.ConflictFail {
+		if err := manager.CheckLocalPorts(configLocalPorts(resolver)); err != nil {
+			return err
+		}
+	}
+
+	var failures []error
+	var pending []pendingResource
 	for i, entry := range cfg.Resources {
-		resource, err := config.ConvertEntryToResource(entry, client.GetNamespace())
+		resource, entryClient, err := resolver.resolve(entry)
 		if err != nil {
-			return fmt.Errorf("error processing resource %d: %w", i+1, err)
+			err = fmt.Errorf("error processing resource %d: %w", i+1, err)
+		} else {
+			addImpersonatedCluster(manager, resource, entryClient)
+			portMapping := config.CreatePortMapping(entry)
+			err = manager.ForwardResource(resource, portMapping)
+			if err != nil && waitTimeout > 0 && notDeployedYet(err) {
+				manager.Log().Info(fmt.Sprintf("Waiting up to %s for %s %s to be deployed...", waitTimeout, resource.Type, resource.Name),
+					"event", "waiting", "resource", string(resource.Type)+"/"+resource.Name, "namespace", resource.Namespace)
+				pending = append(pending, pendingResource{resource: resource, portMapping: portMapping})
+				continue
+			}
+			if err != nil {
+				err = fmt.Errorf("error forwarding resource %s: %w", resource.Name, err)
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if !continueOnError {
+			return err
 		}
-		portMapping := config.CreatePortMapping(entry)
-		err = manager.ForwardResource(resource, portMapping)
+		manager.Log().Error(err.Error(), "event", "error", "error", err.Error())
+		manager.RecordFailure(portforward.ForwardFailure{
+			Resource: model.Resource{Type: model.ResourceType(entry.ResourceType), Name: entry.Name, Namespace: entry.Namespace},
+			Err:      err,
+		})
+		failures = append(failures, err)
+	}
+
+	if len(pending) > 0 {
+		waitForResources(pending, manager, waitTimeout, ctx)
+	}
+	return summarizeFailures(manager.Log(), failures, len(cfg.Resources))
+}
+
+// configLocalPorts returns the local ports requested by the entries of a configuration.
+// Invalid entries are skipped; they are reported when forwarding them.
+func configLocalPorts(resolver *entryResolver) []portforward.LocalPortRequest {
+	var requests []portforward.LocalPortRequest
+	for _, entry := range resolver.cfg.Resources {
+		resource, _, err := resolver.resolve(entry)
 		if err != nil {
-			return fmt.Errorf("error forwarding resource %s: %w", resource.Name, err)
+			continue
+		}
+		for _, port := range entry.Ports {
+			requests = append(requests, portforward.LocalPortRequest{Resource: resource, LocalPort: port.LocalPort, RemotePort: port.RemotePort})
+		}
+	}
+	return requests
+}
+
+// summarizeFailures reports the resources that failed to start when continuing past errors.
+// It only returns an error when none of the total resources could be started.
+func summarizeFailures(logger *slog.Logger, failures []error, total int) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	if len(failures) == total {
+		return &ExitError{
+			Code: ExitTotalFailure,
+			Err:  fmt.Errorf("none of the %d resources could be started: %w", total, errors.Join(failures...)),
 		}
 	}
 
+	lines := make([]string, len(failures))
+	for i, err := range failures {
+		lines[i] = "  - " + err.Error()
+	}
+	logger.Warn(fmt.Sprintf("%d of %d resources failed to start:\n%s", len(failures), total, strings.Join(lines, "\n")),
+		"event", "summary", "failed", len(failures), "total", total)
 	return nil
 }
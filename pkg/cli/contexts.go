@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/ui"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newContextClients creates a client for each kubeconfig context. The namespace comes from
+// --namespace if given, otherwise from each context.
+func newContextClients(configFlags *genericclioptions.ConfigFlags, contexts []string) ([]*k8s.Client, error) {
+	clients := make([]*k8s.Client, 0, len(contexts))
+	seen := make(map[string]bool)
+	for _, contextName := range contexts {
+		contextName = strings.TrimSpace(contextName)
+		if contextName == "" || seen[contextName] {
+			continue
+		}
+		seen[contextName] = true
+
+		client, err := newContextClient(configFlags, contextName)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %w", contextName, err)
+		}
+		clients = append(clients, client)
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("--contexts did not name any context")
+	}
+	return clients, nil
+}
+
+// loadingRules returns the kubeconfig loading rules honoring --kubeconfig
+func loadingRules(configFlags *genericclioptions.ConfigFlags) *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if configFlags.KubeConfig != nil && *configFlags.KubeConfig != "" {
+		rules.ExplicitPath = *configFlags.KubeConfig
+	}
+	return rules
+}
+
+// pickNode prompts for one of the nodes running pods in the client namespace, so pods can be
+// picked by node without permission to list the cluster's nodes
+func pickNode(ctx context.Context, client *k8s.Client) (string, error) {
+	pods, err := client.GetPods(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get pods: %w", err)
+	}
+	counts := make(map[string]int)
+	for _, pod := range pods {
+		if pod.Node != "" {
+			counts[pod.Node]++
+		}
+	}
+	if len(counts) == 0 {
+		return "", fmt.Errorf("no scheduled pods found in namespace %s", client.GetNamespace())
+	}
+	nodes := make([]string, 0, len(counts))
+	for node := range counts {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return ui.SelectNode(nodes, counts)
+}
+
+// pickContext prompts for a kubeconfig context and sets it as --context. Kubeconfigs with a
+// single context are used without asking.
+func pickContext(configFlags *genericclioptions.ConfigFlags) error {
+	kubeconfig, err := loadingRules(configFlags).Load()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	names := make([]string, 0, len(kubeconfig.Contexts))
+	for name := range kubeconfig.Contexts {
+		names = append(names, name)
+	}
+	if len(names) <= 1 {
+		return nil
+	}
+	sort.Strings(names)
+
+	selected, err := ui.SelectContext(names, kubeconfig.CurrentContext)
+	if err != nil {
+		return err
+	}
+	configFlags.Context = &selected
+	return nil
+}
+
+// newContextClient creates a client for a named kubeconfig context
+func newContextClient(configFlags *genericclioptions.ConfigFlags, contextName string) (*k8s.Client, error) {
+	namespace := ""
+	if configFlags.Namespace != nil {
+		namespace = *configFlags.Namespace
+	}
+	return newKubeconfigClient(loadingRules(configFlags), contextName, namespace)
+}
+
+// newKubeconfigClient creates a client for a context of the kubeconfig found by rules, in
+// namespace or, if empty, the namespace of the context
+func newKubeconfigClient(rules *clientcmd.ClientConfigLoadingRules, contextName, namespace string) (*k8s.Client, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	overrides.Context.Namespace = namespace
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	restConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST config: %w", err)
+	}
+	namespace, _, err = loader.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	client, err := k8s.NewClientForConfig(restConfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+	client.SetContext(contextName)
+	return client, nil
+}
+
+// contextClusters returns the manager clusters for the given clients, keyed by context
+func contextClusters(clients []*k8s.Client) map[string]*portforward.Cluster {
+	clusters := make(map[string]*portforward.Cluster, len(clients))
+	for _, client := range clients {
+		clusters[client.GetContext()] = portforward.NewCluster(client.GetConfig(), client.GetClientset(), client)
+	}
+	return clusters
+}
+
+// RunInteractiveContexts handles interactive selection and port forwarding across several
+// kubeconfig contexts. Resources are listed together, prefixed with their context name.
+func RunInteractiveContexts(usePods, useDeployments, useStatefulSets bool, manager *portforward.Manager, clients []*k8s.Client, suggest PortSuggester, selection Selection, streams genericclioptions.IOStreams, ctx context.Context) error {
+	var resources []ui.Resource
+	scopes := make([]string, 0, len(clients))
+	for _, client := range clients {
+		contextName := client.GetContext()
+		scopes = append(scopes, fmt.Sprintf("%s/%s", contextName, client.GetNamespace()))
+
+		// A context without matching resources should not hide the others
+		contextResources, err := getResourcesForMode(usePods, useDeployments, useStatefulSets, selection, client, ctx)
+		if err != nil {
+			fmt.Fprintf(streams.ErrOut, "Warning: context %s: %v\n", contextName, err)
+			continue
+		}
+		for _, resource := range contextResources {
+			resource.Context = contextName
+			resource.DisplayName = fmt.Sprintf("[%s] %s", contextName, resource.DisplayName)
+			resources = append(resources, resource)
+		}
+	}
+	if len(resources) == 0 {
+		return fmt.Errorf("no resources found in any of the contexts")
+	}
+
+	prompt := getPromptForMode(usePods, useDeployments, useStatefulSets, clients[0].CustomResourceKind(), false, "contexts "+strings.Join(scopes, ", "))
+	// Selections spanning several clusters are not remembered
+	selectedResources, err := selection.selectResources(resources, prompt, "")
+	if err != nil {
+		return err
+	}
+
+	// Resolve and forward the selection context by context; names only need to be unique per context
+	for _, client := range clients {
+		var contextResources []ui.Resource
+		for _, resource := range selectedResources {
+			if resource.Context == client.GetContext() {
+				contextResources = append(contextResources, resource)
+			}
+		}
+		if len(contextResources) == 0 {
+			continue
+		}
+
+		if err := processSelectedResources(contextResources, client, ctx); err != nil {
+			return err
+		}
+		if err := selection.selectPorts(contextResources); err != nil {
+			return err
+		}
+		resolvedPorts, err := config.ResolveTargetPorts(ctx, contextResources, client)
+		if err != nil {
+			return fmt.Errorf("failed to resolve target ports in context %s: %w", client.GetContext(), err)
+		}
+		portMaps, err := createPortMappings(contextResources, resolvedPorts, client, suggest, selection)
+		if err != nil {
+			return err
+		}
+
+		for _, resource := range contextResources {
+			if err := forwardSelected(manager, resource, portMaps[resource.Key()], selection, streams.ErrOut); err != nil {
+				return fmt.Errorf("error starting port forward for %s in context %s: %w", resource.Name, client.GetContext(), err)
+			}
+		}
+	}
+
+	return nil
+}
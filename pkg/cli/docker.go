@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"fmt"
+	"runtime"
+
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+)
+
+// listenForDocker makes the forwards reachable from local Docker containers. On Linux they also
+// listen on the docker0 gateway; Docker Desktop already routes host.docker.internal to the
+// host's loopback addresses.
+func listenForDocker(manager *portforward.Manager) error {
+	if runtime.GOOS != "linux" {
+		manager.Log().Info("Docker Desktop containers reach the forwards at host.docker.internal:<local port>", "event", "docker")
+		return nil
+	}
+
+	address, err := portforward.DockerBridgeAddress()
+	if err != nil {
+		return fmt.Errorf("--docker: %w", err)
+	}
+	if err := manager.PortAllocator.AddListenAddress(address); err != nil {
+		return err
+	}
+	manager.Log().Info(fmt.Sprintf("Docker containers reach the forwards at %s:<local port>, or at host.docker.internal when started with --add-host=host.docker.internal:host-gateway", address),
+		"event", "docker", "address", address)
+	return nil
+}
@@ -0,0 +1,316 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/state"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+	clientportforward "k8s.io/client-go/tools/portforward"
+)
+
+// doctorTimeout bounds each network check
+const doctorTimeout = 10 * time.Second
+
+// listPermissions are used to list resources for selection and to find the pods behind them.
+// Endpoint slices only add ready endpoint counts to the service list.
+var listPermissions = []k8s.Permission{
+	{Verb: "list", Resource: "pods"},
+	{Verb: "list", Resource: "services"},
+	{Verb: "list", Group: "apps", Resource: "deployments"},
+	{Verb: "list", Group: "apps", Resource: "statefulsets"},
+	{Verb: "list", Group: "discovery.k8s.io", Resource: "endpointslices"},
+}
+
+// doctorReport prints check results and counts failures
+type doctorReport struct {
+	out      io.Writer
+	failures int
+}
+
+// ok records a passing check
+func (r *doctorReport) ok(check, detail string) {
+	fmt.Fprintf(r.out, "[OK]   %s: %s\n", check, detail)
+}
+
+// warn records a problem that only affects some features
+func (r *doctorReport) warn(check, detail, hint string) {
+	fmt.Fprintf(r.out, "[WARN] %s: %s\n", check, detail)
+	r.hint(hint)
+}
+
+// fail records a problem that prevents port forwarding
+func (r *doctorReport) fail(check, detail, hint string) {
+	r.failures++
+	fmt.Fprintf(r.out, "[FAIL] %s: %s\n", check, detail)
+	r.hint(hint)
+}
+
+// hint prints advice below a result
+func (r *doctorReport) hint(hint string) {
+	if hint != "" {
+		fmt.Fprintf(r.out, "       -> %s\n", hint)
+	}
+}
+
+// done returns an error summarizing the failed checks
+func (r *doctorReport) done() error {
+	if r.failures > 0 {
+		return fmt.Errorf("%d check(s) failed", r.failures)
+	}
+	fmt.Fprintln(r.out, "All checks passed.")
+	return nil
+}
+
+// RunDoctor implements the doctor subcommand, which diagnoses common reasons for port
+// forwarding to fail: kubeconfig, API server reachability, permissions, connection upgrades
+// through proxies, and local port issues
+func RunDoctor(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	podName, err := cmd.Flags().GetString("pod")
+	if err != nil {
+		return fmt.Errorf("failed to get --pod flag: %w", err)
+	}
+	configFile, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return fmt.Errorf("failed to get --file flag: %w", err)
+	}
+
+	report := &doctorReport{out: streams.Out}
+	ctx, cancel := context.WithTimeout(cmd.Context(), 2*time.Minute)
+	defer cancel()
+
+	checkCluster(ctx, report, flags, podName)
+
+	// Local ports
+	checkLoopback(report)
+	if configFile != "" {
+		checkConfigPorts(report, configFile)
+	}
+
+	return report.done()
+}
+
+// checkCluster checks the kubeconfig, the API server, permissions and connection upgrades,
+// stopping at the first check the later ones depend on
+func checkCluster(ctx context.Context, report *doctorReport, flags *genericclioptions.ConfigFlags, podName string) {
+	// Kubeconfig
+	rawConfig, err := flags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		report.fail("kubeconfig", err.Error(), "check KUBECONFIG or pass --kubeconfig with a valid file")
+		return
+	}
+	if len(rawConfig.Contexts) == 0 {
+		if _, err := rest.InClusterConfig(); err != nil {
+			report.fail("kubeconfig", "no contexts found", "check KUBECONFIG or pass --kubeconfig with a valid file")
+			return
+		}
+	}
+	client, err := newClient(flags)
+	if err != nil {
+		report.fail("kubeconfig", err.Error(), "run `kubectl config get-contexts` and select a context with --context")
+		return
+	}
+	report.ok("kubeconfig", fmt.Sprintf("context %q, namespace %q", client.GetContext(), client.GetNamespace()))
+
+	// API server
+	restConfig := client.GetConfig()
+	version, err := client.GetClientset().Discovery().ServerVersion()
+	if err != nil {
+		report.fail("API server", fmt.Sprintf("%s is not reachable: %v", restConfig.Host, err),
+			"check that the cluster is running and that VPN, proxy and credentials allow reaching it")
+		return
+	}
+	report.ok("API server", fmt.Sprintf("%s (Kubernetes %s)", restConfig.Host, version.GitVersion))
+	if proxy := apiProxy(restConfig); proxy != "" {
+		report.warn("proxy", "API requests go through "+proxy,
+			"port forwarding needs the proxy to allow connection upgrades; add the API server to NO_PROXY if it does not")
+	}
+
+	// Permissions, then a connection upgrade through any proxies to a pod
+	if checkDoctorAccess(ctx, report, client) {
+		checkUpgrade(ctx, report, client, podName)
+	}
+}
+
+// apiProxy returns the proxy used to reach the API server, if any
+func apiProxy(restConfig *rest.Config) string {
+	u, err := url.Parse(restConfig.Host)
+	if err != nil {
+		return ""
+	}
+	proxyFunc := http.ProxyFromEnvironment
+	if restConfig.Proxy != nil {
+		proxyFunc = restConfig.Proxy
+	}
+	proxyURL, err := proxyFunc(&http.Request{URL: u})
+	if err != nil || proxyURL == nil {
+		return ""
+	}
+	return proxyURL.Redacted()
+}
+
+// checkDoctorAccess reports the permissions kubectl-pfw uses and whether forwarding is allowed
+func checkDoctorAccess(ctx context.Context, report *doctorReport, client *k8s.Client) bool {
+	namespace := client.GetNamespace()
+	results, err := client.CheckAccess(ctx, namespace, append([]k8s.Permission{k8s.PortForwardPermission}, listPermissions...))
+	if err != nil {
+		report.warn("permissions", err.Error(), "the cluster may not support SelfSubjectAccessReview; try `kubectl auth can-i create pods/portforward`")
+		return true
+	}
+
+	allowed := true
+	for _, result := range results {
+		check := "permission " + result.Permission.String()
+		if result.Allowed {
+			report.ok(check, "allowed in namespace "+namespace)
+			continue
+		}
+		detail := "denied in namespace " + namespace
+		if result.Reason != "" {
+			detail += " (" + result.Reason + ")"
+		}
+		hint := fmt.Sprintf("ask a cluster administrator for a Role granting %q in namespace %s", result.Permission.String(), namespace)
+		if result.Permission == k8s.PortForwardPermission {
+			allowed = false
+			report.fail(check, detail, hint)
+		} else {
+			report.warn(check, detail, hint)
+		}
+	}
+	return allowed
+}
+
+// checkUpgrade opens and closes a port-forward connection to a running pod, which fails when a
+// proxy between here and the API server does not support connection upgrades
+func checkUpgrade(ctx context.Context, report *doctorReport, client *k8s.Client, podName string) {
+	const check = "port-forward upgrade"
+	namespace := client.GetNamespace()
+
+	if podName == "" {
+		pods, err := client.GetClientset().CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: "status.phase=Running",
+			Limit:         1,
+		})
+		if err != nil || len(pods.Items) == 0 {
+			report.warn(check, "skipped, no running pod found in namespace "+namespace, "pass --pod to test against a specific pod")
+			return
+		}
+		podName = pods.Items[0].Name
+	}
+
+	dialer, err := portforward.NewSPDYDialerFactory(client.GetConfig()).DialerFor(namespace, podName)
+	if err != nil {
+		report.fail(check, err.Error(), "")
+		return
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		conn, _, err := dialer.Dial(clientportforward.PortForwardProtocolV1Name)
+		if err == nil {
+			conn.Close()
+		}
+		result <- err
+	}()
+
+	select {
+	case err = <-result:
+	case <-time.After(doctorTimeout):
+		err = fmt.Errorf("timed out after %s", doctorTimeout)
+	}
+	if err != nil {
+		report.fail(check, fmt.Sprintf("pod %s: %v", podName, err),
+			"a proxy or load balancer in front of the API server may be blocking SPDY upgrades; try without the proxy or ask for upgrades to be allowed")
+		return
+	}
+	report.ok(check, "SPDY connection to pod "+podName+" established")
+}
+
+// checkLoopback verifies that local ports can be bound and connected to on the loopback addresses
+func checkLoopback(report *doctorReport) {
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		check := "local port on " + addr
+		err := loopbackRoundTrip(addr)
+		switch {
+		case err == nil:
+			report.ok(check, "bind and connect work")
+		case addr == "::1":
+			report.warn(check, err.Error(), "IPv6 clients connecting to localhost may fail; use 127.0.0.1")
+		default:
+			report.fail(check, err.Error(), "check local firewall or security software blocking loopback connections")
+		}
+	}
+}
+
+// loopbackRoundTrip binds an ephemeral port on addr and connects to it
+func loopbackRoundTrip(addr string) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(addr, "0"))
+	if err != nil {
+		return fmt.Errorf("cannot bind: %w", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), doctorTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot connect: %w", err)
+	}
+	return conn.Close()
+}
+
+// checkConfigPorts reports local ports of a configuration file that cannot be bound
+func checkConfigPorts(report *doctorReport, configFile string) {
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		report.fail("config file", err.Error(), "")
+		return
+	}
+
+	var registry *state.ForwardRegistry
+	if path, err := state.Path(state.ForwardsFile); err == nil {
+		registry = state.NewForwardRegistry(path)
+	}
+
+	problems := 0
+	for _, entry := range cfg.Resources {
+		for _, port := range entry.Ports {
+			if port.LocalPort == 0 || portforward.IsPortAvailable(port.LocalPort) {
+				continue
+			}
+			problems++
+			check := fmt.Sprintf("local port %d (%s/%s)", port.LocalPort, entry.ResourceType, entry.Name)
+			if port.LocalPort < portforward.PrivilegedPortLimit {
+				report.warn(check, "cannot be bound without elevated privileges or is in use",
+					"use a port above 1023 or run with --privileged-helper")
+				continue
+			}
+			if registry != nil {
+				if owner, err := registry.Lookup(port.LocalPort); err == nil && owner != nil {
+					report.warn(check, fmt.Sprintf("in use by kubectl-pfw (pid %d)", owner.PID), "stop the other session or change localPort")
+					continue
+				}
+			}
+			report.warn(check, "in use by another process", "stop the process using it or change localPort")
+		}
+	}
+	if problems == 0 {
+		report.ok("config file", "all local ports in "+configFile+" are free")
+	}
+}
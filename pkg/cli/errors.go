@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"errors"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+)
+
+// Exit codes of sessions that could not be started for one of the common causes, so scripts
+// can tell them apart from other errors, which exit with 1
+const (
+	ExitPortInUse         = 4
+	ExitNoReadyPods       = 5
+	ExitNamedPortNotFound = 6
+	ExitForbidden         = 7
+)
+
+// errorCauses maps the typed errors of the forwarding engine to their exit code and a hint on
+// how to fix them, in the order they are checked
+var errorCauses = []struct {
+	err  error
+	code int
+	hint string
+}{
+	{k8s.ErrForbidden, ExitForbidden,
+		"Your user lacks the RBAC permissions for this; run 'kubectl pfw doctor' to see which are missing."},
+	{portforward.ErrPortInUse, ExitPortInUse,
+		"Free the local port, choose another one, or pass --on-conflict increment or --on-conflict ephemeral to pick one automatically."},
+	{portforward.ErrNoReadyPods, ExitNoReadyPods,
+		"Check the pods with 'kubectl get pods', or pass --wait-ready to wait for a ready pod."},
+	{k8s.ErrNoPods, ExitNoReadyPods,
+		"Check the pods with 'kubectl get pods', or pass --wait-ready to wait for a ready pod."},
+	{portforward.ErrNamedPortNotFound, ExitNamedPortNotFound,
+		"The service's targetPort names a port its pods do not declare; check the names of the containerPorts."},
+}
+
+// Explain returns the exit code for an error returned by a command and, for the common causes
+// of failed sessions, a hint on how to fix it. Sessions that ended with failed forwards keep the
+// exit code of their ExitError.
+func Explain(err error) (int, string) {
+	code := 1
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.Code
+	}
+	for _, cause := range errorCauses {
+		if errors.Is(err, cause.err) {
+			if exitErr == nil {
+				code = cause.code
+			}
+			return code, cause.hint
+		}
+	}
+	return code, ""
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"roeyazroel/kubectl-pfw/pkg/devcontainer"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/report"
+	"roeyazroel/kubectl-pfw/pkg/state"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// RunExportDevcontainer adds the local ports of the forwards of all running sessions to a VS
+// Code dev container configuration, or prints them as a fragment with --print
+func RunExportDevcontainer(streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	path, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return fmt.Errorf("failed to get --file flag: %w", err)
+	}
+	printOnly, err := cmd.Flags().GetBool("print")
+	if err != nil {
+		return fmt.Errorf("failed to get --print flag: %w", err)
+	}
+
+	ports, err := activePorts()
+	if err != nil {
+		return err
+	}
+	if len(ports) == 0 {
+		return fmt.Errorf("no active forwards; start a kubectl pfw session first")
+	}
+
+	fragment, err := devcontainer.Fragment(ports)
+	if err != nil {
+		return err
+	}
+	if printOnly {
+		fmt.Fprintln(streams.Out, string(fragment))
+		return nil
+	}
+
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w; use --print to get the properties to add", path, err)
+	}
+	merged, err := devcontainer.Merge(doc, ports)
+	if errors.Is(err, devcontainer.ErrComments) {
+		return fmt.Errorf("not updating %s: %w. Add these properties instead:\n%s", path, err, fragment)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w; use --print to get the properties to add", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, merged, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Fprintf(streams.Out, "Added %d port(s) to %s\n", len(ports), path)
+	return nil
+}
+
+// RunExportReport renders the forwards of all running sessions as a Markdown or HTML snippet
+// with their local URLs and the notes of their configuration entries, to paste into docs
+func RunExportReport(streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("failed to get --format flag: %w", err)
+	}
+	title, err := cmd.Flags().GetString("title")
+	if err != nil {
+		return fmt.Errorf("failed to get --title flag: %w", err)
+	}
+	outputFile, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("failed to get --output flag: %w", err)
+	}
+
+	forwards, err := activeForwards()
+	if err != nil {
+		return err
+	}
+	if len(forwards) == 0 {
+		return fmt.Errorf("no active forwards; start a kubectl pfw session first")
+	}
+	sort.Slice(forwards, func(i, j int) bool {
+		a, b := forwards[i], forwards[j]
+		if a.Context != b.Context {
+			return a.Context < b.Context
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.LocalPort < b.LocalPort
+	})
+	endpoints := make([]report.Endpoint, 0, len(forwards))
+	for _, f := range forwards {
+		endpoints = append(endpoints, report.Endpoint{
+			Resource:   f.Type + "/" + f.Name,
+			Namespace:  f.Namespace,
+			Context:    f.Context,
+			RemotePort: f.RemotePort,
+			URL:        portforward.LocalAddress(f.Scheme, f.LocalPort),
+			Notes:      f.Notes,
+		})
+	}
+
+	var content []byte
+	switch format {
+	case "markdown":
+		content = report.Markdown(title, endpoints)
+	case "html":
+		if content, err = report.HTML(title, endpoints); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid --format '%s', must be one of: markdown, html", format)
+	}
+
+	if outputFile == StdoutOutput {
+		_, err = streams.Out.Write(content)
+		return err
+	}
+	if err := os.WriteFile(outputFile, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputFile, err)
+	}
+	fmt.Fprintf(streams.Out, "Wrote %d endpoint(s) to %s\n", len(endpoints), outputFile)
+	return nil
+}
+
+// activeForwards returns the forwards of all running sessions
+func activeForwards() ([]state.ActiveForward, error) {
+	registryPath, err := state.Path(state.ForwardsFile)
+	if err != nil {
+		return nil, err
+	}
+	forwards, err := state.NewForwardRegistry(registryPath).List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read active forwards: %w", err)
+	}
+	return forwards, nil
+}
+
+// activePorts returns the local ports of the forwards of all running sessions, labeled with
+// the resource they forward
+func activePorts() ([]devcontainer.Port, error) {
+	forwards, err := activeForwards()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int32]bool)
+	var ports []devcontainer.Port
+	for _, f := range forwards {
+		if seen[f.LocalPort] {
+			continue
+		}
+		seen[f.LocalPort] = true
+		ports = append(ports, devcontainer.Port{
+			Number: f.LocalPort,
+			Label:  fmt.Sprintf("%s %s/%s:%d", f.Type, f.Namespace, f.Name, f.RemotePort),
+		})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Number < ports[j].Number })
+	return ports, nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/ui"
+)
+
+// NameFilter narrows listed resources by name before they are offered for selection, so they
+// can neither be picked nor matched by --all or --select
+type NameFilter struct {
+	// Include keeps only resources whose names contain a match; nil keeps every resource
+	Include *regexp.Regexp
+	// Exclude drops resources whose names match any of these patterns
+	Exclude []namePattern
+}
+
+// parseFilter parses --filter, a regular expression or, when it does not compile, a plain
+// substring. Plain words such as api are both.
+func parseFilter(value string) *regexp.Regexp {
+	if value == "" {
+		return nil
+	}
+	if re, err := regexp.Compile(value); err == nil {
+		return re
+	}
+	return regexp.MustCompile(regexp.QuoteMeta(value))
+}
+
+// namePattern matches resource names with a glob such as istio-* or, when written as /.../,
+// a regular expression
+type namePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// parseExclude parses --exclude values. Each value may hold several patterns separated by |,
+// e.g. 'istio-*|*-canary'.
+func parseExclude(values []string) ([]namePattern, error) {
+	var patterns []namePattern
+	for _, value := range values {
+		// A regular expression may contain | itself
+		if len(value) > 1 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+			re, err := regexp.Compile(value[1 : len(value)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --exclude '%s': %w", value, err)
+			}
+			patterns = append(patterns, namePattern{re: re})
+			continue
+		}
+		for _, glob := range strings.Split(value, "|") {
+			glob = strings.TrimSpace(glob)
+			if glob == "" {
+				continue
+			}
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid --exclude '%s': %w", glob, err)
+			}
+			patterns = append(patterns, namePattern{glob: glob})
+		}
+	}
+	return patterns, nil
+}
+
+// matches reports whether name matches the pattern
+func (p namePattern) matches(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+// Keep reports whether a resource named name passes the filter
+func (f NameFilter) Keep(name string) bool {
+	if f.Include != nil && !f.Include.MatchString(name) {
+		return false
+	}
+	for _, pattern := range f.Exclude {
+		if pattern.matches(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// empty reports whether the filter keeps every resource
+func (f NameFilter) empty() bool {
+	return f.Include == nil && len(f.Exclude) == 0
+}
+
+// apply returns the resources passing the filter
+func (f NameFilter) apply(resources []ui.Resource) []ui.Resource {
+	if f.empty() {
+		return resources
+	}
+	kept := make([]ui.Resource, 0, len(resources))
+	for _, resource := range resources {
+		if f.Keep(resource.Name) {
+			kept = append(kept, resource)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/state"
+	"roeyazroel/kubectl-pfw/pkg/ui"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// FindCommand is the name of the subcommand searching all namespaces for resources to forward
+const FindCommand = "find"
+
+// findMatch is a resource matching a find query
+type findMatch struct {
+	resource ui.Resource
+	score    int
+}
+
+// findResources returns the services and pods in all namespaces matching query and passing
+// the selection filter, best matches first. Queries containing a slash are matched against
+// namespace/name. Pods off the selection node are left out.
+func findResources(ctx context.Context, query string, podsOnly bool, selection Selection, client *k8s.Client) ([]ui.Resource, error) {
+	namespace := client.GetNamespace()
+	client.SetNamespace(metav1.NamespaceAll)
+	defer client.SetNamespace(namespace)
+
+	var candidates []ui.Resource
+	if !podsOnly {
+		services, err := client.GetServices(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get services: %w", err)
+		}
+		for _, svc := range services {
+			if len(svc.Ports) > 0 {
+				candidates = append(candidates, ui.NewResourceFromService(svc))
+			}
+		}
+	}
+	pods, err := client.GetPods(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods: %w", err)
+	}
+	for _, pod := range pods {
+		if selection.Node != "" && pod.Node != selection.Node {
+			continue
+		}
+		candidates = append(candidates, ui.NewResourceFromPod(pod))
+	}
+
+	var matches []findMatch
+	for _, resource := range selection.Filter.apply(candidates) {
+		text := resource.Name
+		if strings.Contains(query, "/") {
+			text = resource.Namespace + "/" + resource.Name
+		}
+		if score, ok := ui.FuzzyMatch(query, text); ok {
+			resource.DisplayName = fmt.Sprintf("%s %s/%s", resource.Type, resource.Namespace, resource.DisplayName)
+			matches = append(matches, findMatch{resource: resource, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].resource.DisplayName < matches[j].resource.DisplayName
+	})
+
+	resources := make([]ui.Resource, len(matches))
+	for i, match := range matches {
+		resources[i] = match.resource
+	}
+	return resources, nil
+}
+
+// RunFind searches services and pods in all namespaces for query and forwards the selected
+// matches. With podsOnly, only pods are searched.
+func RunFind(query string, podsOnly bool, manager *portforward.Manager, client *k8s.Client, suggest PortSuggester, selection Selection, streams genericclioptions.IOStreams, ctx context.Context) error {
+	resources, err := findResources(ctx, query, podsOnly, selection, client)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		if podsOnly {
+			return fmt.Errorf("no pods with exposed ports match %q", query)
+		}
+		return fmt.Errorf("no services or pods with ports match %q", query)
+	}
+	// Matches are ranked by relevance unless another order is asked for
+	sortResources(resources, selection.Sort, selection.History, client.GetContext())
+
+	historyKey := state.HistoryKey(client.GetContext(), metav1.NamespaceAll, FindCommand)
+	selectedResources, err := selection.selectResources(resources, fmt.Sprintf("Select resources matching %q to port-forward:", query), historyKey)
+	if err != nil {
+		return err
+	}
+	if err := selection.selectPorts(selectedResources); err != nil {
+		return err
+	}
+
+	// Services are looked up in the client namespace, so forward the selection namespace by namespace
+	var namespaces []string
+	byNamespace := make(map[string][]ui.Resource)
+	for _, resource := range selectedResources {
+		if _, ok := byNamespace[resource.Namespace]; !ok {
+			namespaces = append(namespaces, resource.Namespace)
+		}
+		byNamespace[resource.Namespace] = append(byNamespace[resource.Namespace], resource)
+	}
+
+	forwarded := &config.ForwardingConfig{Context: client.GetContext()}
+	namespace := client.GetNamespace()
+	defer client.SetNamespace(namespace)
+	for _, ns := range namespaces {
+		client.SetNamespace(ns)
+		nsResources := byNamespace[ns]
+
+		resolvedPorts, err := config.ResolveTargetPorts(ctx, nsResources, client)
+		if err != nil {
+			return fmt.Errorf("failed to resolve target ports in namespace %s: %w", ns, err)
+		}
+		portMaps, err := createPortMappings(nsResources, resolvedPorts, client, suggest, selection)
+		if err != nil {
+			return err
+		}
+
+		for _, resource := range nsResources {
+			if err := forwardSelected(manager, resource, portMaps[resource.Key()], selection, streams.ErrOut); err != nil {
+				return fmt.Errorf("error starting port forward for %s in namespace %s: %w", resource.Name, ns, err)
+			}
+		}
+		forwarded.Resources = append(forwarded.Resources, config.GenerateConfig(nsResources, portMaps, resolvedPorts, "", "").Resources...)
+	}
+
+	selection.remember(historyKey, forwarded, streams.ErrOut)
+	return nil
+}
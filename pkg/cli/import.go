@@ -0,0 +1,309 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/importer"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// RunImportKubefwd converts a kubefwd invocation, passed as args, into a configuration file
+// forwarding the same services. Services are looked up in the cluster with kubefwd's
+// namespaces and selectors, since kubefwd forwards whatever matches when it starts.
+func RunImportKubefwd(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStreams, cmd *cobra.Command, args []string) error {
+	spec, err := importer.ParseKubefwd(args)
+	if err != nil {
+		return err
+	}
+	if spec.Context != "" && (flags.Context == nil || *flags.Context == "") {
+		flags.Context = &spec.Context
+	}
+	if spec.Kubeconfig != "" && (flags.KubeConfig == nil || *flags.KubeConfig == "") {
+		flags.KubeConfig = &spec.Kubeconfig
+	}
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+	if err := client.SetListFilter(spec.LabelSelector, spec.FieldSelector); err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	namespaces := spec.Namespaces
+	if spec.AllNamespaces {
+		list, err := client.GetClientset().CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list namespaces: %w", err)
+		}
+		namespaces = nil
+		for _, ns := range list.Items {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{client.GetNamespace()}
+	}
+
+	cfg := &config.ForwardingConfig{Context: client.GetContext()}
+	ports := newImportedPorts()
+	for _, namespace := range namespaces {
+		client.SetNamespace(namespace)
+		services, err := client.GetServices(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list services in namespace %s: %w", namespace, err)
+		}
+		for _, svc := range services {
+			entry, err := serviceEntry(ctx, client, svc, svc.Ports, func(port int32) int32 {
+				if local, ok := spec.Mappings[port]; ok {
+					return ports.claim(local)
+				}
+				return ports.claim(port)
+			})
+			if err != nil {
+				fmt.Fprintf(streams.ErrOut, "Skipping service %s/%s: %v\n", svc.Namespace, svc.Name, err)
+				continue
+			}
+			cfg.Resources = append(cfg.Resources, entry)
+		}
+	}
+	if len(cfg.Resources) == 0 {
+		return fmt.Errorf("no services with forwardable ports match the kubefwd invocation")
+	}
+	ports.report(streams.ErrOut)
+	return writeImported(cfg, streams, cmd)
+}
+
+// RunImportTelepresence converts telepresence intercept commands into a configuration file
+// forwarding each intercepted service port to the intercept's local port
+func RunImportTelepresence(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return fmt.Errorf("failed to get --file flag: %w", err)
+	}
+	input := streams.In
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		defer f.Close()
+		input = f
+	}
+	intercepts, err := importer.ParseIntercepts(input)
+	if err != nil {
+		return err
+	}
+
+	contextName := ""
+	for _, intercept := range intercepts {
+		if intercept.Context == "" || intercept.Context == contextName {
+			continue
+		}
+		if contextName != "" {
+			return fmt.Errorf("intercepts use contexts %s and %s; import each context separately", contextName, intercept.Context)
+		}
+		contextName = intercept.Context
+	}
+	if contextName != "" && (flags.Context == nil || *flags.Context == "") {
+		flags.Context = &contextName
+	}
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	defaultNamespace := client.GetNamespace()
+	cfg := &config.ForwardingConfig{Context: client.GetContext()}
+	ports := newImportedPorts()
+	for _, intercept := range intercepts {
+		namespace := intercept.Namespace
+		if namespace == "" {
+			namespace = defaultNamespace
+		}
+		client.SetNamespace(namespace)
+		svc, port, err := interceptedPort(ctx, client, intercept)
+		if err != nil {
+			return fmt.Errorf("intercept of %s/%s: %w", namespace, intercept.Workload, err)
+		}
+		entry, err := serviceEntry(ctx, client, svc, []k8s.ServicePort{port}, func(int32) int32 {
+			return ports.claim(intercept.LocalPort)
+		})
+		if err != nil {
+			return fmt.Errorf("intercept of %s/%s: %w", namespace, intercept.Workload, err)
+		}
+		cfg.Resources = append(cfg.Resources, entry)
+	}
+	ports.report(streams.ErrOut)
+	return writeImported(cfg, streams, cmd)
+}
+
+// interceptedPort returns the service and service port an intercept applies to: the service
+// named by --service, or the only service selecting the workload's pods, and the port named or
+// numbered by --port, or its only port
+func interceptedPort(ctx context.Context, client *k8s.Client, intercept importer.Intercept) (k8s.Service, k8s.ServicePort, error) {
+	services, err := client.GetServices(ctx)
+	if err != nil {
+		return k8s.Service{}, k8s.ServicePort{}, err
+	}
+
+	var candidates []k8s.Service
+	if intercept.Service != "" {
+		for _, svc := range services {
+			if svc.Name == intercept.Service {
+				candidates = append(candidates, svc)
+			}
+		}
+		if len(candidates) == 0 {
+			return k8s.Service{}, k8s.ServicePort{}, fmt.Errorf("service %s not found", intercept.Service)
+		}
+	} else {
+		podLabels, err := workloadLabels(ctx, client, intercept.Workload)
+		if err != nil {
+			return k8s.Service{}, k8s.ServicePort{}, err
+		}
+		for _, svc := range services {
+			if len(svc.Selector) > 0 && labels.SelectorFromSet(svc.Selector).Matches(podLabels) {
+				candidates = append(candidates, svc)
+			}
+		}
+		switch len(candidates) {
+		case 0:
+			return k8s.Service{}, k8s.ServicePort{}, fmt.Errorf("no service selects its pods")
+		case 1:
+		default:
+			return k8s.Service{}, k8s.ServicePort{}, fmt.Errorf("%d services select its pods; add --service to the intercept", len(candidates))
+		}
+	}
+	svc := candidates[0]
+
+	if intercept.Port == "" {
+		if len(svc.Ports) != 1 {
+			return k8s.Service{}, k8s.ServicePort{}, fmt.Errorf("service %s has %d ports; name one in --port, e.g. --port %d:<port>",
+				svc.Name, len(svc.Ports), intercept.LocalPort)
+		}
+		return svc, svc.Ports[0], nil
+	}
+	for _, port := range svc.Ports {
+		if port.Name == intercept.Port || fmt.Sprint(port.Port) == intercept.Port {
+			return svc, port, nil
+		}
+	}
+	return k8s.Service{}, k8s.ServicePort{}, fmt.Errorf("service %s has no port %s", svc.Name, intercept.Port)
+}
+
+// workloadLabels returns the pod template labels of the deployment, statefulset or replicaset
+// with the given name
+func workloadLabels(ctx context.Context, client *k8s.Client, name string) (labels.Set, error) {
+	apps := client.GetClientset().AppsV1()
+	namespace := client.GetNamespace()
+	if deployment, err := apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+		return deployment.Spec.Template.Labels, nil
+	}
+	if statefulSet, err := apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+		return statefulSet.Spec.Template.Labels, nil
+	}
+	replicaSet, err := apps.ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("no deployment, statefulset or replicaset named %s", name)
+	}
+	return replicaSet.Spec.Template.Labels, nil
+}
+
+// serviceEntry converts the TCP ports among ports of a service into a configuration entry.
+// Service ports are resolved to the container ports they target, as configuration files
+// expect; localPort returns the local port of each service port.
+func serviceEntry(ctx context.Context, client *k8s.Client, svc k8s.Service, ports []k8s.ServicePort, localPort func(int32) int32) (config.PortForwardEntry, error) {
+	var tcpPorts []k8s.ServicePort
+	for _, port := range ports {
+		if k8s.IsTCP(port.Protocol) {
+			tcpPorts = append(tcpPorts, port)
+		}
+	}
+	if len(tcpPorts) == 0 {
+		return config.PortForwardEntry{}, fmt.Errorf("no TCP ports; port-forwarding only supports TCP")
+	}
+	svc.Ports = tcpPorts
+
+	resource := model.NewResourceFromService(svc)
+	resolved, err := config.ResolveTargetPorts(ctx, []model.Resource{resource}, client)
+	if err != nil {
+		return config.PortForwardEntry{}, err
+	}
+	entry := config.PortForwardEntry{ResourceType: "service", Name: svc.Name, Namespace: svc.Namespace}
+	for i, port := range tcpPorts {
+		remotePort := port.Port
+		if target, ok := resolved[resource.Key()][i]; ok {
+			remotePort = target
+		}
+		entry.Ports = append(entry.Ports, config.PortMapping{LocalPort: localPort(port.Port), RemotePort: remotePort})
+	}
+	return entry, nil
+}
+
+// importedPorts hands out the local ports of an import. kubefwd gives every service its own
+// address, so services sharing a port there are assigned a local port automatically instead.
+type importedPorts struct {
+	used      map[int32]bool
+	automatic int
+}
+
+// newImportedPorts returns importedPorts with no port taken
+func newImportedPorts() *importedPorts {
+	return &importedPorts{used: make(map[int32]bool)}
+}
+
+// claim returns port, or 0 for automatic assignment when an earlier entry took it
+func (p *importedPorts) claim(port int32) int32 {
+	if p.used[port] {
+		p.automatic++
+		return 0
+	}
+	p.used[port] = true
+	return port
+}
+
+// report notes how many ports are assigned automatically
+func (p *importedPorts) report(w io.Writer) {
+	if p.automatic > 0 {
+		fmt.Fprintf(w, "%d port(s) share a local port with an earlier entry; their localPort is 0 to assign one automatically\n", p.automatic)
+	}
+}
+
+// writeImported writes an imported configuration to the --output file or stdout
+func writeImported(cfg *config.ForwardingConfig, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	outputFile, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("failed to get --output flag: %w", err)
+	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("failed to get --format flag: %w", err)
+	}
+
+	if outputFile == StdoutOutput {
+		content, err := config.EncodeConfig(cfg, "<file>", format)
+		if err != nil {
+			return err
+		}
+		_, err = streams.Out.Write(content)
+		return err
+	}
+	if err := config.WriteConfig(cfg, outputFile, format); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	fmt.Fprintf(streams.Out, "Imported %d resource(s) into %s\n", len(cfg.Resources), outputFile)
+	fmt.Fprintf(streams.Out, "You can use it with: kubectl pfw -f %s\n", outputFile)
+	return nil
+}
@@ -7,24 +7,25 @@ import (
 	"roeyazroel/kubectl-pfw/pkg/config"
 	"roeyazroel/kubectl-pfw/pkg/k8s"
 	"roeyazroel/kubectl-pfw/pkg/portforward"
-	"roeyazroel/kubectl-pfw/pkg/ui"
+	"roeyazroel/kubectl-pfw/pkg/state"
 
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
 // RunInteractive handles interactive selection of resources and port forwarding.
-func RunInteractive(usePods, useDeployments, useStatefulSets bool, manager *portforward.Manager, client *k8s.Client, streams genericclioptions.IOStreams, ctx context.Context) error {
+func RunInteractive(usePods, useDeployments, useStatefulSets bool, manager *portforward.Manager, client *k8s.Client, suggest PortSuggester, selection Selection, streams genericclioptions.IOStreams, ctx context.Context) error {
 	// Get resources based on the selected mode
-	resources, err := getResourcesForMode(usePods, useDeployments, useStatefulSets, client, ctx)
+	resources, err := getResourcesForMode(usePods, useDeployments, useStatefulSets, selection, client, ctx)
 	if err != nil {
 		return err
 	}
 
 	// Get the appropriate prompt
-	prompt := getPromptForMode(usePods, useDeployments, useStatefulSets, false, client.GetNamespace())
+	prompt := getPromptForMode(usePods, useDeployments, useStatefulSets, client.CustomResourceKind(), false, "namespace "+client.GetNamespace())
 
-	// Select resources
-	selectedResources, err := ui.SelectResources(resources, prompt)
+	// Select resources, preselecting the previous choice for this context, namespace and mode
+	historyKey := state.HistoryKey(client.GetContext(), client.GetNamespace(), modeName(usePods, useDeployments, useStatefulSets, client.CustomResourceKind()))
+	selectedResources, err := selection.selectResources(resources, prompt, historyKey)
 	if err != nil {
 		return err
 	}
@@ -34,6 +35,9 @@ func RunInteractive(usePods, useDeployments, useStatefulSets bool, manager *port
 	if err != nil {
 		return err
 	}
+	if err := selection.selectPorts(selectedResources); err != nil {
+		return err
+	}
 
 	// Resolve target ports
 	resolvedPorts, err := config.ResolveTargetPorts(ctx, selectedResources, client)
@@ -42,19 +46,25 @@ func RunInteractive(usePods, useDeployments, useStatefulSets bool, manager *port
 	}
 
 	// Create port mappings
-	portMaps, err := createPortMappings(selectedResources, resolvedPorts, client)
+	portMaps, err := createPortMappings(selectedResources, resolvedPorts, client, suggest, selection)
 	if err != nil {
 		return err
 	}
 
 	// Start port forwarding for each resource
 	for _, resource := range selectedResources {
-		portMap := portMaps[resource.Name]
-		err := manager.ForwardResource(resource, portMap)
+		portMap := portMaps[resource.Key()]
+		err := forwardSelected(manager, resource, portMap, selection, streams.ErrOut)
 		if err != nil {
 			return fmt.Errorf("error starting port forward for %s: %w", resource.Name, err)
 		}
 	}
 
+	// Custom resources cannot be written to configuration files, so --last cannot repeat them
+	if client.CustomResourceKind() == nil {
+		forwarded := config.GenerateConfig(selectedResources, portMaps, resolvedPorts, client.GetContext(), client.GetNamespace())
+		selection.remember(historyKey, forwarded, streams.ErrOut)
+	}
+
 	return nil
 }
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// resourcePermissions returns the permissions needed to find the pods behind a resource
+func resourcePermissions(resourceType model.ResourceType) []k8s.Permission {
+	listPods := k8s.Permission{Verb: "list", Resource: "pods"}
+	switch resourceType {
+	case model.ServiceResource:
+		return []k8s.Permission{{Verb: "get", Resource: "services"}, listPods}
+	case model.DeploymentResource:
+		return []k8s.Permission{{Verb: "get", Group: "apps", Resource: "deployments"}, listPods}
+	case model.StatefulSetResource:
+		return []k8s.Permission{{Verb: "get", Group: "apps", Resource: "statefulsets"}, listPods}
+	default:
+		// Pods are forwarded to directly
+		return nil
+	}
+}
+
+// modePermissions returns the permissions needed to list resources for selection in a mode and,
+// when forwarding, to open tunnels to them
+func modePermissions(usePods, useDeployments, useStatefulSets, forward bool) []k8s.Permission {
+	var permissions []k8s.Permission
+	if forward {
+		permissions = append(permissions, k8s.PortForwardPermission)
+	}
+	switch {
+	case usePods:
+		permissions = append(permissions, k8s.Permission{Verb: "list", Resource: "pods"})
+	case useDeployments:
+		permissions = append(permissions, k8s.Permission{Verb: "list", Group: "apps", Resource: "deployments"})
+		permissions = append(permissions, resourcePermissions(model.DeploymentResource)...)
+	case useStatefulSets:
+		permissions = append(permissions, k8s.Permission{Verb: "list", Group: "apps", Resource: "statefulsets"})
+		permissions = append(permissions, resourcePermissions(model.StatefulSetResource)...)
+	default:
+		permissions = append(permissions, k8s.Permission{Verb: "list", Resource: "services"})
+		permissions = append(permissions, resourcePermissions(model.ServiceResource)...)
+	}
+	return permissions
+}
+
+// customResourcePermissions returns the permissions needed to list resources of a kind selected
+// with --resource and find their pods
+func customResourcePermissions(kind *k8s.CustomResourceKind, forward bool) []k8s.Permission {
+	var permissions []k8s.Permission
+	if forward {
+		permissions = append(permissions, k8s.PortForwardPermission)
+	}
+	return append(permissions,
+		k8s.Permission{Verb: "list", Group: kind.GVR.Group, Resource: kind.GVR.Resource},
+		k8s.Permission{Verb: "get", Group: kind.GVR.Group, Resource: kind.GVR.Resource},
+		k8s.Permission{Verb: "list", Resource: "pods"},
+	)
+}
+
+// accessCheck holds the permissions needed per namespace by the entries forwarded with one client
+type accessCheck struct {
+	// label names the cluster and impersonated user of the entries, empty for the session's
+	label  string
+	client *k8s.Client
+	// impersonated is set for entries impersonating a user, whose clients have no informers
+	impersonated bool
+	required     map[string][]k8s.Permission
+	seen         map[string]map[k8s.Permission]bool
+}
+
+// configPermissions returns the permissions needed to forward the entries of a configuration
+// file, grouped by the client forwarding them, so clusters and impersonated users are checked
+// with their own identity
+func configPermissions(resolver *entryResolver) ([]*accessCheck, error) {
+	var checks []*accessCheck
+	byClient := make(map[*k8s.Client]*accessCheck)
+	for i, entry := range resolver.cfg.Resources {
+		resource, client, err := resolver.resolve(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error processing resource %d: %w", i+1, err)
+		}
+		check, ok := byClient[client]
+		if !ok {
+			check = &accessCheck{
+				label:        entryIdentity(entry),
+				client:       client,
+				impersonated: entry.As != "",
+				required:     make(map[string][]k8s.Permission),
+				seen:         make(map[string]map[k8s.Permission]bool),
+			}
+			byClient[client] = check
+			checks = append(checks, check)
+		}
+		if check.seen[resource.Namespace] == nil {
+			check.seen[resource.Namespace] = make(map[k8s.Permission]bool)
+		}
+		for _, p := range append([]k8s.Permission{k8s.PortForwardPermission}, resourcePermissions(resource.Type)...) {
+			if !check.seen[resource.Namespace][p] {
+				check.seen[resource.Namespace][p] = true
+				check.required[resource.Namespace] = append(check.required[resource.Namespace], p)
+			}
+		}
+	}
+	return checks, nil
+}
+
+// entryIdentity describes the cluster and impersonated user of an entry, e.g.
+// "cluster prod as system:serviceaccount:ops:forwarder"; empty for the session's identity
+func entryIdentity(entry config.PortForwardEntry) string {
+	var parts []string
+	if entry.Cluster != "" {
+		parts = append(parts, "cluster "+entry.Cluster)
+	}
+	if entry.As != "" {
+		parts = append(parts, "as "+entry.As)
+	}
+	return strings.Join(parts, " ")
+}
+
+// cachedPermissions adapts permissions to informer-backed lookups, which list and watch
+// resources instead of getting them
+func cachedPermissions(permissions []k8s.Permission) []k8s.Permission {
+	seen := make(map[k8s.Permission]bool)
+	var result []k8s.Permission
+	add := func(p k8s.Permission) {
+		if !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	for _, p := range permissions {
+		if p.Subresource != "" || (p.Verb != "get" && p.Verb != "list") {
+			add(p)
+			continue
+		}
+		for _, verb := range []string{"list", "watch"} {
+			add(k8s.Permission{Verb: verb, Group: p.Group, Resource: p.Resource})
+		}
+	}
+	return result
+}
+
+// preflight verifies the required permissions in each namespace before anything is started, so
+// missing RBAC rules are explained up front instead of surfacing as 403 errors mid-session.
+// When the check itself cannot be performed a warning is printed and the session continues.
+func preflight(ctx context.Context, client *k8s.Client, required map[string][]k8s.Permission, errOut io.Writer) error {
+	namespaces := make([]string, 0, len(required))
+	for namespace := range required {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		err := client.RequireAccess(ctx, namespace, required[namespace])
+		var denied *k8s.AccessDeniedError
+		if errors.As(err, &denied) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "Warning: skipping permission checks: %v\n", err)
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// PrivilegedRelayCommand is the name of the hidden subcommand run under sudo to serve privileged ports
+const PrivilegedRelayCommand = "privileged-relay"
+
+// sudoPrivilegedHelper returns a helper that re-runs this binary under sudo to relay a
+// privileged port to the unprivileged port actually used by the forward
+func sudoPrivilegedHelper(streams genericclioptions.IOStreams) func(privilegedPort, localPort int32) error {
+	return func(privilegedPort, localPort int32) error {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("the privileged helper is not supported on Windows")
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate kubectl-pfw executable: %w", err)
+		}
+
+		relay := exec.Command("sudo", executable, PrivilegedRelayCommand,
+			"--listen", strconv.Itoa(int(privilegedPort)),
+			"--target", strconv.Itoa(int(localPort)),
+			"--parent-pid", strconv.Itoa(os.Getpid()))
+		// sudo may need to ask for a password
+		relay.Stdin = os.Stdin
+		relay.Stdout = streams.Out
+		relay.Stderr = streams.ErrOut
+
+		if err := relay.Start(); err != nil {
+			return fmt.Errorf("failed to run sudo: %w", err)
+		}
+		go relay.Wait()
+		return nil
+	}
+}
+
+// RunPrivilegedRelay implements the hidden privileged-relay subcommand
+func RunPrivilegedRelay(cmd *cobra.Command) error {
+	listenPort, err := cmd.Flags().GetInt32("listen")
+	if err != nil {
+		return fmt.Errorf("failed to get --listen flag: %w", err)
+	}
+	targetPort, err := cmd.Flags().GetInt32("target")
+	if err != nil {
+		return fmt.Errorf("failed to get --target flag: %w", err)
+	}
+	parentPID, err := cmd.Flags().GetInt("parent-pid")
+	if err != nil {
+		return fmt.Errorf("failed to get --parent-pid flag: %w", err)
+	}
+
+	return portforward.RunPrivilegedRelay(listenPort, targetPort, parentPID)
+}
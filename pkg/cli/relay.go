@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+	"roeyazroel/kubectl-pfw/pkg/ui"
+)
+
+// RelayCommand is the name of the subcommand forwarding an endpoint reachable from the cluster
+// through a temporary relay pod
+const RelayCommand = "relay"
+
+// relayPermissions are the permissions needed to run a relay pod and forward to it
+var relayPermissions = []k8s.Permission{
+	k8s.PortForwardPermission,
+	{Verb: "create", Resource: "pods"},
+	{Verb: "get", Resource: "pods"},
+	{Verb: "delete", Resource: "pods"},
+}
+
+// RunRelay starts a relay pod connecting to target, a host:port reachable from the cluster
+// such as a managed database, and forwards localPort to it. The pod is deleted by cleanup when
+// the session ends.
+func RunRelay(target, image string, timeout time.Duration, localPort int32, manager *portforward.Manager, client *k8s.Client, cleanup *cleanups, ctx context.Context) error {
+	host, port, err := k8s.ParseRelayTarget(target)
+	if err != nil {
+		return err
+	}
+
+	manager.Log().Info(fmt.Sprintf("Starting relay pod for %s in namespace %s...", target, client.GetNamespace()), "event", "relay")
+	pod, err := client.CreateRelayPod(ctx, host, port, image, timeout)
+	if err != nil {
+		return err
+	}
+	deletePod := func() {
+		if err := client.DeleteRelayPod(context.Background(), pod.Name); err != nil {
+			manager.Log().Error(err.Error(), "event", "error", "error", err.Error())
+			return
+		}
+		manager.Log().Info(fmt.Sprintf("Deleted relay pod %s", pod.Name), "event", "relay")
+	}
+	cleanup.add(deletePod)
+
+	resource := ui.NewResourceFromPod(pod)
+	if err := manager.ForwardResource(resource, map[int]int32{0: localPort}); err != nil {
+		cleanup.run()
+		return fmt.Errorf("failed to forward to relay pod %s: %w", pod.Name, err)
+	}
+	return nil
+}
+
+// cleanups are run once when the session ends, also when it is interrupted
+type cleanups struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// add registers fn to run when the session ends
+func (c *cleanups) add(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fns = append(c.fns, fn)
+}
+
+// run runs the registered functions in reverse order and forgets them
+func (c *cleanups) run() {
+	c.mu.Lock()
+	fns := c.fns
+	c.fns = nil
+	c.mu.Unlock()
+
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
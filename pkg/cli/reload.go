@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+)
+
+// reloadReleaseTimeout bounds how long a reload waits for removed forwards to free their ports
+const reloadReleaseTimeout = 5 * time.Second
+
+// configSession forwards the resources of a configuration file and, when reloaded, reconciles
+// the running forwards with the file's current contents
+type configSession struct {
+	path string
+	// format is the format of the file, or empty to take it from its extension
+	format          string
+	manager         *portforward.Manager
+	client          *k8s.Client
+	clusters        map[string]*k8s.Client
+	continueOnError bool
+	// namespace is the client namespace used for configurations without defaultNamespace
+	namespace string
+
+	mu  sync.Mutex
+	cfg *config.ForwardingConfig
+}
+
+// startConfigSession loads the configuration file at path in format, or in the format of its
+// extension if empty, and forwards its resources
+func startConfigSession(path, format string, manager *portforward.Manager, client *k8s.Client, clusters map[string]*k8s.Client, checkAccess, useCache, continueOnError bool, waitTimeout time.Duration, ctx context.Context) (*configSession, error) {
+	cfg, err := config.LoadConfigFormat(path, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	session := &configSession{
+		path:            path,
+		format:          format,
+		manager:         manager,
+		client:          client,
+		clusters:        clusters,
+		continueOnError: continueOnError,
+		namespace:       client.GetNamespace(),
+		cfg:             cfg,
+	}
+	if err := RunWithConfig(cfg, manager, client, clusters, checkAccess, useCache, continueOnError, waitTimeout, ctx); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// reload re-reads the configuration file. Forwards of resources that were removed or whose
+// entries changed are stopped, and new, changed and no longer running resources are started.
+// Resources whose entries are unchanged keep their running forwards. If the file cannot be
+// read, the running forwards are left alone.
+func (s *configSession) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := config.LoadConfigFormat(s.path, s.format)
+	if err != nil {
+		return fmt.Errorf("failed to reload config file: %w", err)
+	}
+	previous, err := s.entriesByResource(s.cfg)
+	if err != nil {
+		return err
+	}
+	desired, err := s.entriesByResource(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to reload config file: %w", err)
+	}
+
+	// Keep the session alive while forwards are being replaced
+	s.manager.ForwardWait.Add(1)
+	defer s.manager.ForwardWait.Done()
+
+	running := forwardsByResource(s.manager.GetStatus())
+	var removed []string
+	for key, entries := range previous {
+		if next, ok := desired[key]; ok && reflect.DeepEqual(next.entries, entries.entries) {
+			continue
+		}
+		for _, id := range running[key] {
+			if err := s.manager.RemoveForward(id); err == nil {
+				removed = append(removed, id)
+			}
+		}
+		delete(running, key)
+	}
+	s.waitForRemoval(removed)
+
+	resolver := newEntryResolver(cfg, s.client, s.clusters, s.namespace)
+
+	var failures []error
+	started, unchanged := 0, 0
+	for _, entry := range cfg.Resources {
+		resource, entryClient, err := resolver.resolve(entry)
+		if err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		key := resourceKey(resource.Context, string(resource.Type), resource.Namespace, resource.Name)
+		if len(running[key]) > 0 {
+			unchanged++
+			continue
+		}
+		addImpersonatedCluster(s.manager, resource, entryClient)
+		if err := s.manager.ForwardResource(resource, config.CreatePortMapping(entry)); err != nil {
+			failures = append(failures, fmt.Errorf("error forwarding resource %s: %w", resource.Name, err))
+			continue
+		}
+		started++
+	}
+	s.cfg = cfg
+
+	s.manager.Log().Info(fmt.Sprintf("Reloaded %s: %d forwards stopped, %d resources started, %d unchanged", s.path, len(removed), started, unchanged),
+		"event", "reload", "stopped", len(removed), "started", started, "unchanged", unchanged)
+	return errors.Join(failures...)
+}
+
+// waitForRemoval waits until the forwards with the given IDs have shut down and released their
+// local ports, so changed entries can bind the same ports again
+func (s *configSession) waitForRemoval(ids []string) {
+	deadline := time.Now().Add(reloadReleaseTimeout)
+	for len(ids) > 0 && time.Now().Before(deadline) {
+		active := make(map[string]bool)
+		for _, status := range s.manager.GetStatus() {
+			active[status.ID] = true
+		}
+		remaining := ids[:0]
+		for _, id := range ids {
+			if active[id] {
+				remaining = append(remaining, id)
+			}
+		}
+		ids = remaining
+		if len(ids) > 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// resourceEntries are the configuration entries of one resource
+type resourceEntries struct {
+	entries []config.PortForwardEntry
+}
+
+// entriesByResource groups the entries of cfg by the resource they forward
+func (s *configSession) entriesByResource(cfg *config.ForwardingConfig) (map[string]*resourceEntries, error) {
+	resolver := newEntryResolver(cfg, s.client, s.clusters, s.namespace)
+	byResource := make(map[string]*resourceEntries)
+	for i, entry := range cfg.Resources {
+		resource, _, err := resolver.resolve(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error processing resource %d: %w", i+1, err)
+		}
+		key := resourceKey(resource.Context, string(resource.Type), resource.Namespace, resource.Name)
+		if byResource[key] == nil {
+			byResource[key] = &resourceEntries{}
+		}
+		// The namespace is resolved, so entries only differing in an explicit default match
+		entry.Namespace = resource.Namespace
+		byResource[key].entries = append(byResource[key].entries, entry)
+	}
+	return byResource, nil
+}
+
+// forwardsByResource groups the IDs of running forwards by the resource they forward
+func forwardsByResource(statuses []portforward.ForwardStatus) map[string][]string {
+	byResource := make(map[string][]string)
+	for _, status := range statuses {
+		key := resourceKey(status.Resource.Context, string(status.Resource.Type), status.Resource.Namespace, status.Resource.Name)
+		byResource[key] = append(byResource[key], status.ID)
+	}
+	return byResource
+}
+
+// resourceKey identifies a resource by its context, empty for the session's context
+func resourceKey(contextName, resourceType, namespace, name string) string {
+	return contextName + "/" + namespace + "/" + resourceType + "/" + name
+}
@@ -0,0 +1,258 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/service"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// RunServiceInstall installs a per-user service running a session with a configuration file:
+// a systemd user unit on Linux or a launchd agent on macOS
+func RunServiceInstall(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	configFile, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return fmt.Errorf("failed to get --file flag: %w", err)
+	}
+	if configFile == "" {
+		return fmt.Errorf("--file is required")
+	}
+	name, err := serviceName(cmd, configFile)
+	if err != nil {
+		return err
+	}
+	printOnly, err := cmd.Flags().GetBool("print")
+	if err != nil {
+		return fmt.Errorf("failed to get --print flag: %w", err)
+	}
+
+	configFile, err = filepath.Abs(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config file path: %w", err)
+	}
+	// Fail now rather than in a restart loop of the service
+	if _, err := config.LoadConfig(configFile); err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
+	}
+
+	spec, err := serviceSpec(name, configFile, flags)
+	if err != nil {
+		return err
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return installSystemdService(spec, printOnly, streams)
+	case "darwin":
+		return installLaunchdService(spec, printOnly, streams)
+	default:
+		return fmt.Errorf("services are not supported on %s; run kubectl pfw -f %s with your platform's service manager", runtime.GOOS, configFile)
+	}
+}
+
+// RunServiceUninstall stops and removes a service installed with RunServiceInstall
+func RunServiceUninstall(streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	configFile, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return fmt.Errorf("failed to get --file flag: %w", err)
+	}
+	name, err := serviceName(cmd, configFile)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("either --name or --file is required")
+	}
+
+	var path string
+	switch runtime.GOOS {
+	case "linux":
+		if path, err = service.SystemdUnitPath(name); err != nil {
+			return err
+		}
+		// The unit may already be stopped or disabled
+		_ = exec.Command("systemctl", "--user", "disable", "--now", name+".service").Run()
+	case "darwin":
+		if path, err = service.LaunchdPlistPath(name); err != nil {
+			return err
+		}
+		_ = exec.Command("launchctl", "unload", "-w", path).Run()
+	default:
+		return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("service %s is not installed", name)
+		}
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	if runtime.GOOS == "linux" {
+		if err := runServiceCommand("systemctl", "--user", "daemon-reload"); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(streams.Out, "Removed service %s (%s)\n", name, path)
+	return nil
+}
+
+// serviceName returns the --name flag, or the name derived from configFile
+func serviceName(cmd *cobra.Command, configFile string) (string, error) {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return "", fmt.Errorf("failed to get --name flag: %w", err)
+	}
+	if name == "" {
+		if configFile == "" {
+			return "", nil
+		}
+		name = service.DefaultName(configFile)
+	}
+	return name, service.ValidateName(name)
+}
+
+// serviceSpec describes the service running configFile. The context, kubeconfig and namespace
+// are pinned so the service does not follow later kubectl config use-context calls, and PATH
+// is kept for exec credential plugins such as aws or gke-gcloud-auth-plugin.
+func serviceSpec(name, configFile string, flags *genericclioptions.ConfigFlags) (service.Spec, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return service.Spec{}, fmt.Errorf("failed to locate kubectl-pfw executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+
+	args := []string{"-f", configFile, "--on-error", "continue"}
+	kubeconfig := ""
+	if flags.KubeConfig != nil && *flags.KubeConfig != "" {
+		if kubeconfig, err = filepath.Abs(*flags.KubeConfig); err != nil {
+			return service.Spec{}, fmt.Errorf("failed to resolve kubeconfig path: %w", err)
+		}
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	contextName := ""
+	if flags.Context != nil {
+		contextName = *flags.Context
+	}
+	if contextName == "" {
+		// Pin the current context
+		if raw, err := flags.ToRawKubeConfigLoader().RawConfig(); err == nil {
+			contextName = raw.CurrentContext
+		}
+	}
+	if contextName != "" {
+		args = append(args, "--context", contextName)
+	}
+	if flags.Namespace != nil && *flags.Namespace != "" {
+		args = append(args, "--namespace", *flags.Namespace)
+	}
+
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	if value := os.Getenv("KUBECONFIG"); value != "" && kubeconfig == "" {
+		env = append(env, "KUBECONFIG="+value)
+	}
+
+	spec := service.Spec{
+		Name:        name,
+		Description: fmt.Sprintf("kubectl-pfw port forwarding for %s", configFile),
+		Executable:  executable,
+		Args:        args,
+		Env:         env,
+	}
+	if runtime.GOOS == "darwin" {
+		if home, err := os.UserHomeDir(); err == nil {
+			spec.LogFile = filepath.Join(home, "Library", "Logs", name+".log")
+		}
+	}
+	return spec, nil
+}
+
+// installSystemdService writes the systemd user unit of spec and enables and starts it
+func installSystemdService(spec service.Spec, printOnly bool, streams genericclioptions.IOStreams) error {
+	unit, err := service.RenderSystemdUnit(spec)
+	if err != nil {
+		return err
+	}
+	if printOnly {
+		fmt.Fprint(streams.Out, unit)
+		return nil
+	}
+
+	path, err := service.SystemdUnitPath(spec.Name)
+	if err != nil {
+		return err
+	}
+	if err := writeServiceFile(path, unit); err != nil {
+		return err
+	}
+	if err := runServiceCommand("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	if err := runServiceCommand("systemctl", "--user", "enable", "--now", spec.Name+".service"); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(streams.Out, "Installed and started %s (%s)\n", spec.Name, path)
+	fmt.Fprintf(streams.Out, "Logs:   journalctl --user -u %s -f\n", spec.Name)
+	fmt.Fprintf(streams.Out, "Status: systemctl --user status %s\n", spec.Name)
+	fmt.Fprintln(streams.Out, "To keep it running while you are logged out, run: loginctl enable-linger")
+	return nil
+}
+
+// installLaunchdService writes the launchd agent of spec and loads it
+func installLaunchdService(spec service.Spec, printOnly bool, streams genericclioptions.IOStreams) error {
+	plist, err := service.RenderLaunchdPlist(spec)
+	if err != nil {
+		return err
+	}
+	if printOnly {
+		fmt.Fprint(streams.Out, plist)
+		return nil
+	}
+
+	path, err := service.LaunchdPlistPath(spec.Name)
+	if err != nil {
+		return err
+	}
+	// Replace a previously loaded version of the agent
+	_ = exec.Command("launchctl", "unload", path).Run()
+	if err := writeServiceFile(path, plist); err != nil {
+		return err
+	}
+	if err := runServiceCommand("launchctl", "load", "-w", path); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(streams.Out, "Installed and started %s (%s)\n", spec.Name, path)
+	if spec.LogFile != "" {
+		fmt.Fprintf(streams.Out, "Logs: tail -f %s\n", spec.LogFile)
+	}
+	return nil
+}
+
+// writeServiceFile writes a unit or plist, creating its directory
+func writeServiceFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// runServiceCommand runs a service manager command, including its output in the error
+func runServiceCommand(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %v failed: %w: %s", name, args, err, output)
+	}
+	return nil
+}
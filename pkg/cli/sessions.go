@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/state"
+
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// sessionNamePattern restricts session names to characters that need no quoting in shells
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validateSessionName checks a --session name; empty names leave the session unnamed
+func validateSessionName(name string) error {
+	if name != "" && !sessionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid --session name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// openSessions returns the registry of running sessions, or nil if the config directory is
+// unknown
+func openSessions() *state.SessionRegistry {
+	path, err := state.Path(state.SessionsFile)
+	if err != nil {
+		return nil
+	}
+	return state.NewSessionRegistry(path)
+}
+
+// registerSession records the session in the shared state, so other pfw commands can find it
+// and reach its control API. A name taken by another running session is an error, and so is a
+// configuration file served by another session, whose forwards are shown instead. Other
+// failures merely keep the session from being found.
+func registerSession(sessions *state.SessionRegistry, session state.Session, streams genericclioptions.IOStreams) error {
+	if sessions == nil {
+		return nil
+	}
+	err := sessions.Register(session)
+	var duplicate *state.DuplicateSessionError
+	if errors.As(err, &duplicate) {
+		showSession(duplicate.Existing, streams)
+		return fmt.Errorf("%w; pass --force to start another session anyway", err)
+	}
+	if errors.Is(err, state.ErrSessionNameTaken) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(streams.ErrOut, "Warning: other pfw commands cannot find this session: %v\n", err)
+	}
+	return nil
+}
+
+// runningSessions lists the running sessions, only the one named name if it is not empty
+func runningSessions(name string) ([]state.Session, error) {
+	var running []state.Session
+	if sessions := openSessions(); sessions != nil {
+		var err error
+		if running, err = sessions.List(); err != nil {
+			return nil, fmt.Errorf("failed to read running sessions: %w", err)
+		}
+	}
+	if name == "" {
+		return running, nil
+	}
+	for _, session := range running {
+		if session.Name == name {
+			return []state.Session{session}, nil
+		}
+	}
+	return nil, fmt.Errorf("no running session named %s", name)
+}
+
+// describeSession names a session for messages, e.g. session payments (pid 4123)
+func describeSession(session state.Session) string {
+	if session.Name == "" {
+		return fmt.Sprintf("pid %d", session.PID)
+	}
+	return fmt.Sprintf("session %s (pid %d)", session.Name, session.PID)
+}
+
+// showSession prints a running session with its control API and forwards
+func showSession(session state.Session, streams genericclioptions.IOStreams) {
+	fmt.Fprintf(streams.Out, "Running as %s for %s.\n", describeSession(session), duration.HumanDuration(time.Since(session.Started)))
+	if session.ControlAddr != "" {
+		fmt.Fprintf(streams.Out, "Its control API listens on http://%s.\n", session.ControlAddr)
+	}
+	registryPath, err := state.Path(state.ForwardsFile)
+	if err != nil {
+		return
+	}
+	forwards, err := state.NewForwardRegistry(registryPath).List()
+	if forwards = sessionForwards(forwards, session.PID); err == nil && len(forwards) > 0 {
+		printStatus(streams.Out, forwards, time.Now())
+	}
+}
+
+// RunSessions lists the running sessions with their names, control API and number of forwards
+func RunSessions(streams genericclioptions.IOStreams) error {
+	sessions, err := runningSessions("")
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Fprintln(streams.Out, "No running sessions.")
+		return nil
+	}
+
+	forwards := make(map[int]int)
+	if registryPath, err := state.Path(state.ForwardsFile); err == nil {
+		active, err := state.NewForwardRegistry(registryPath).List()
+		if err != nil {
+			return fmt.Errorf("failed to read active forwards: %w", err)
+		}
+		for _, f := range active {
+			forwards[f.PID]++
+		}
+	}
+	printSessions(streams.Out, sessions, forwards, time.Now())
+	return nil
+}
+
+// printSessions writes the sessions as a table, oldest first
+func printSessions(w io.Writer, sessions []state.Session, forwards map[int]int, now time.Time) {
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Started.Before(sessions[j].Started) })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\tNAME\tCONTROL API\tFORWARDS\tAGE")
+	for _, s := range sessions {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\n", s.PID, orDash(s.Name), orDash(s.ControlAddr), forwards[s.PID],
+			duration.HumanDuration(now.Sub(s.Started)))
+	}
+	tw.Flush()
+}
+
+// orDash returns s, or - if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
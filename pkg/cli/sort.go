@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"roeyazroel/kubectl-pfw/pkg/state"
+	"roeyazroel/kubectl-pfw/pkg/ui"
+)
+
+// Sort orders of the selection list. Without one, resources are listed in the order the API
+// returns them.
+const (
+	SortByName      = "name"
+	SortByNamespace = "namespace"
+	SortByAge       = "age"
+	SortByRecent    = "recent"
+)
+
+// validateSort checks a --sort value or settings default
+func validateSort(order string) error {
+	switch order {
+	case "", SortByName, SortByNamespace, SortByAge, SortByRecent:
+		return nil
+	default:
+		return fmt.Errorf("invalid --sort '%s', must be one of: %s, %s, %s, %s", order, SortByName, SortByNamespace, SortByAge, SortByRecent)
+	}
+}
+
+// sortResources orders resources in place. Recently used resources come first when sorting by
+// recent, looked up in history under contextName; the rest follow by name.
+func sortResources(resources []ui.Resource, order string, history *state.History, contextName string) {
+	var less func(a, b ui.Resource) bool
+	switch order {
+	case SortByName:
+		less = func(a, b ui.Resource) bool { return a.Name < b.Name }
+	case SortByNamespace:
+		less = func(a, b ui.Resource) bool {
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			return a.Name < b.Name
+		}
+	case SortByAge:
+		// Newest first
+		less = func(a, b ui.Resource) bool { return a.Created.After(b.Created) }
+	case SortByRecent:
+		if history == nil {
+			less = func(a, b ui.Resource) bool { return a.Name < b.Name }
+			break
+		}
+		used := make(map[string]int64, len(resources))
+		for _, resource := range resources {
+			key := state.ResourceKey(contextName, resource.Namespace, string(resource.Type), resource.Name)
+			if last := history.LastUsed(key); !last.IsZero() {
+				used[key] = last.UnixNano()
+			}
+		}
+		less = func(a, b ui.Resource) bool {
+			ua := used[state.ResourceKey(contextName, a.Namespace, string(a.Type), a.Name)]
+			ub := used[state.ResourceKey(contextName, b.Namespace, string(b.Type), b.Name)]
+			if ua != ub {
+				return ua > ub
+			}
+			return a.Name < b.Name
+		}
+	default:
+		return
+	}
+	sort.SliceStable(resources, func(i, j int) bool { return less(resources[i], resources[j]) })
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/state"
+
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// RunStatus lists the forwards of all running sessions, or only of the session named session,
+// with their uptime, reconnection attempts and most recent error, so forwards that keep
+// dropping stand out
+func RunStatus(session string, streams genericclioptions.IOStreams) error {
+	registryPath, err := state.Path(state.ForwardsFile)
+	if err != nil {
+		return err
+	}
+	forwards, err := state.NewForwardRegistry(registryPath).List()
+	if err != nil {
+		return fmt.Errorf("failed to read active forwards: %w", err)
+	}
+	if session != "" {
+		sessions, err := runningSessions(session)
+		if err != nil {
+			return err
+		}
+		forwards = sessionForwards(forwards, sessions[0].PID)
+	}
+	if len(forwards) == 0 {
+		fmt.Fprintln(streams.Out, "No active forwards.")
+		return nil
+	}
+	printStatus(streams.Out, forwards, time.Now())
+	return nil
+}
+
+// printStatus writes the forwards as a table, ordered by session and local port
+func printStatus(w io.Writer, forwards []state.ActiveForward, now time.Time) {
+	sort.Slice(forwards, func(i, j int) bool {
+		if forwards[i].PID != forwards[j].PID {
+			return forwards[i].PID < forwards[j].PID
+		}
+		return forwards[i].LocalPort < forwards[j].LocalPort
+	})
+
+	// Session names are only shown when a session has one
+	named := false
+	for _, f := range forwards {
+		named = named || f.Session != ""
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if named {
+		fmt.Fprint(tw, "SESSION\t")
+	}
+	fmt.Fprintln(tw, "PID\tRESOURCE\tNAMESPACE\tPOD\tLOCAL\tREMOTE\tUPTIME\tRETRIES\tLAST ERROR")
+	for _, f := range forwards {
+		if named {
+			fmt.Fprintf(tw, "%s\t", orDash(f.Session))
+		}
+		lastError := "-"
+		if f.LastError != "" {
+			lastError = fmt.Sprintf("%s (%s ago)", f.LastError, duration.HumanDuration(now.Sub(f.LastErrorTime)))
+		}
+		name := f.Type + "/" + f.Name
+		if f.Context != "" {
+			name = f.Context + ":" + name
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%s\t%d\t%s\n", f.PID, name, f.Namespace, orDash(f.Pod), f.LocalPort, f.RemotePort,
+			duration.HumanDuration(f.Uptime(now)), f.Retries, lastError)
+	}
+	tw.Flush()
+}
+
+// sessionForwards returns the forwards served by the process pid
+func sessionForwards(forwards []state.ActiveForward, pid int) []state.ActiveForward {
+	var kept []state.ActiveForward
+	for _, f := range forwards {
+		if f.PID == pid {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
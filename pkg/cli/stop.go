@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/control"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// stopTimeout bounds how long a session may take to shut the stopped forwards down
+const stopTimeout = 30 * time.Second
+
+// RunStop stops the forwards of resource, e.g. svc/web, in every running session serving a
+// control API, or only in the session named sessionName, leaving the rest of those sessions
+// running
+func RunStop(resource, sessionName string, streams genericclioptions.IOStreams) error {
+	sessions, err := runningSessions(sessionName)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: stopTimeout}
+	reachable, stopped := 0, 0
+	for _, session := range sessions {
+		if session.ControlAddr == "" {
+			continue
+		}
+		reachable++
+		ids, err := stopInSession(client, session.ControlAddr, resource)
+		if err != nil {
+			fmt.Fprintf(streams.ErrOut, "Warning: %s: %v\n", describeSession(session), err)
+			continue
+		}
+		for _, id := range ids {
+			fmt.Fprintf(streams.Out, "Stopped %s (%s)\n", id, describeSession(session))
+		}
+		stopped += len(ids)
+	}
+
+	switch {
+	case reachable == 0 && sessionName != "":
+		return fmt.Errorf("session %s serves no control API; start it with --control-addr to stop single forwards", sessionName)
+	case reachable == 0:
+		return errors.New("no running session serves a control API; start sessions with --control-addr to stop single forwards")
+	case stopped == 0:
+		return fmt.Errorf("no running session forwards %s", resource)
+	}
+	return nil
+}
+
+// stopInSession asks the session listening on addr to stop the forwards of resource and
+// returns their IDs, or none if the session does not forward it
+func stopInSession(client *http.Client, addr, resource string) ([]string, error) {
+	endpoint := url.URL{Scheme: "http", Host: addr, Path: "/v1/forwards", RawQuery: url.Values{"resource": {resource}}.Encode()}
+	req, err := http.NewRequest(http.MethodDelete, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var stopped control.StopResponse
+		if err := json.NewDecoder(resp.Body).Decode(&stopped); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return stopped.IDs, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return nil, fmt.Errorf("%s: %s", resp.Status, failure.Error)
+	}
+}
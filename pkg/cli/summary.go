@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+)
+
+// Exit codes of a session in which forwards failed. Sessions that could not be started exit
+// with the codes of Explain.
+const (
+	ExitPartialFailure = 2
+	ExitTotalFailure   = 3
+)
+
+// ExitError is returned when a session ended with failed forwards. Code is the exit code the
+// process should end with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// sessionResult returns the ExitError describing the outcome of a session, or nil if no
+// forward failed
+func sessionResult(summary portforward.SessionSummary) *ExitError {
+	failed := len(summary.Failures)
+	switch {
+	case failed == 0:
+		return nil
+	case failed >= summary.Forwards:
+		return &ExitError{Code: ExitTotalFailure, Err: fmt.Errorf("all %d forwards failed", failed)}
+	default:
+		return &ExitError{Code: ExitPartialFailure, Err: fmt.Errorf("%d of %d forwards failed", failed, summary.Forwards)}
+	}
+}
+
+// reportSession prints the forwards that failed during the session, as a table on w or, with
+// structured logs, as one message per failure
+func reportSession(summary portforward.SessionSummary, logger *slog.Logger, structured bool, w io.Writer) {
+	if len(summary.Failures) == 0 {
+		return
+	}
+
+	if structured {
+		for _, f := range summary.Failures {
+			logger.Error(fmt.Sprintf("Forward of %s/%s failed: %v", f.Resource.Type, f.Resource.Name, f.Err),
+				"event", "summary", "resource", string(f.Resource.Type)+"/"+f.Resource.Name, "namespace", f.Resource.Namespace,
+				"localPort", f.LocalPort, "remotePort", f.RemotePort, "retries", f.Retries, "error", f.Err.Error())
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "\n%d of %d forwards failed:\n", len(summary.Failures), summary.Forwards)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tNAMESPACE\tLOCAL\tREMOTE\tRETRIES\tERROR")
+	for _, f := range summary.Failures {
+		fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\t%d\t%v\n", f.Resource.Type, f.Resource.Name, f.Resource.Namespace,
+			portOrDash(f.LocalPort), portOrDash(f.RemotePort), f.Retries, f.Err)
+	}
+	tw.Flush()
+}
+
+// portOrDash formats a port, using "-" for ports that were never assigned
+func portOrDash(port int32) string {
+	if port == 0 {
+		return "-"
+	}
+	return fmt.Sprint(port)
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/state"
+	"roeyazroel/kubectl-pfw/pkg/update"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// updateTimeout bounds checking for and downloading a release
+const updateTimeout = 5 * time.Minute
+
+// RunUpdate replaces the running kubectl-pfw executable with the latest release when it is
+// newer than version
+func RunUpdate(version string, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	checkOnly, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return fmt.Errorf("failed to get --check flag: %w", err)
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return fmt.Errorf("failed to get --force flag: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), updateTimeout)
+	defer cancel()
+	client := &http.Client{}
+
+	release, err := update.LatestRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	newer := update.IsNewer(release.TagName, version)
+	if !newer && !force {
+		if version == "dev" {
+			return fmt.Errorf("cannot compare development build with %s; use --force to install it anyway", release.TagName)
+		}
+		fmt.Fprintf(streams.Out, "kubectl-pfw %s is up to date\n", version)
+		return nil
+	}
+	if checkOnly {
+		fmt.Fprintf(streams.Out, "kubectl-pfw %s is available (installed: %s): %s\n", release.TagName, version, release.HTMLURL)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate kubectl-pfw executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	if manager := packageManager(executable); manager != "" && !force {
+		return fmt.Errorf("kubectl-pfw was installed with %s; update it with %s or use --force", manager, manager)
+	}
+
+	fmt.Fprintf(streams.ErrOut, "Downloading kubectl-pfw %s for %s/%s...\n", release.TagName, runtime.GOOS, runtime.GOARCH)
+	binary, err := update.DownloadBinary(ctx, client, release, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	if err := update.ReplaceExecutable(executable, binary); err != nil {
+		return err
+	}
+	fmt.Fprintf(streams.Out, "Updated kubectl-pfw %s -> %s (%s)\n", version, release.TagName, executable)
+	return nil
+}
+
+// packageManager returns the package manager owning executable, whose files should not be
+// replaced behind its back, or "" if it was installed manually
+func packageManager(executable string) string {
+	path := filepath.ToSlash(executable)
+	switch {
+	case strings.Contains(path, "/.krew/"):
+		return "krew (kubectl krew upgrade pfw)"
+	case strings.Contains(path, "/Cellar/") || strings.Contains(path, "/homebrew/") || strings.Contains(path, "/linuxbrew/"):
+		return "Homebrew (brew upgrade kubectl-pfw)"
+	}
+	return ""
+}
+
+// NoUpdateCheckEnvVar disables the new-version hint when set to a non-empty value
+const NoUpdateCheckEnvVar = "KUBECTL_PFW_NO_UPDATE_CHECK"
+
+const (
+	// updateCheckInterval is how often sessions look up the latest release
+	updateCheckInterval = 24 * time.Hour
+	// updateCheckTimeout bounds the background lookup of the latest release
+	updateCheckTimeout = 5 * time.Second
+)
+
+// notifyNewVersion prints a one-line hint when the latest known release is newer than
+// version. The latest release is looked up in the background at most once per day, so the
+// hint is based on the previous lookup and never delays the session.
+func notifyNewVersion(ctx context.Context, version string, settings *config.Settings, errOut io.Writer) {
+	if settings.DisableUpdateCheck || os.Getenv(NoUpdateCheckEnvVar) != "" || !update.IsRelease(version) {
+		return
+	}
+	path, err := state.Path(state.UpdateCheckFile)
+	if err != nil {
+		return
+	}
+	check, err := state.LoadUpdateCheck(path)
+	if err != nil {
+		return
+	}
+
+	if update.IsNewer(check.Latest, version) {
+		fmt.Fprintf(errOut, "kubectl-pfw %s is available (installed: %s); run kubectl pfw update to install it\n", check.Latest, version)
+	}
+
+	now := time.Now()
+	if !check.Due(now, updateCheckInterval) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+		defer cancel()
+		release, err := update.LatestRelease(ctx, &http.Client{})
+		if err != nil {
+			// Offline or rate-limited; try again next time
+			return
+		}
+		_ = check.Record(now, release.TagName)
+	}()
+}
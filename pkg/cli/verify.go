@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// verifyTimeout bounds the lookups of a verify run
+const verifyTimeout = time.Minute
+
+// verifyResult is a row of the verify table
+type verifyResult struct {
+	resource model.Resource
+	port     int32
+	passed   bool
+	detail   string
+}
+
+// RunVerify checks every entry of a configuration file against the cluster without forwarding
+// anything: the resource exists, has ready pods and its remote ports are served by them. It
+// prints a PASS/FAIL table and fails when any check failed, for onboarding docs and CI.
+func RunVerify(flags *genericclioptions.ConfigFlags, streams genericclioptions.IOStreams, cmd *cobra.Command) error {
+	configFile, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return fmt.Errorf("failed to get --file flag: %w", err)
+	}
+	if configFile == "" {
+		return fmt.Errorf("--file is required")
+	}
+
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
+	}
+	if cfg.Context != "" && cfg.Context != k8s.InClusterContext && (flags.Context == nil || *flags.Context == "") {
+		contextName := cfg.Context
+		flags.Context = &contextName
+	}
+	client, err := newClient(flags)
+	if err != nil {
+		return err
+	}
+	if cfg.DefaultNamespace != "" {
+		client.SetNamespace(cfg.DefaultNamespace)
+	}
+	clusters, err := newConfigClusters(flags, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), verifyTimeout)
+	defer cancel()
+
+	results := verifyConfig(ctx, cfg, client, clusters)
+	return printVerifyResults(streams.Out, results)
+}
+
+// verifyConfig checks each entry of cfg and returns a result per port, or a single failed
+// result for entries whose resource cannot be used at all. Entries referencing a cluster are
+// checked with the client of its context in clusters.
+func verifyConfig(ctx context.Context, cfg *config.ForwardingConfig, client *k8s.Client, clusters map[string]*k8s.Client) []verifyResult {
+	resolver := newEntryResolver(cfg, client, clusters, client.GetNamespace())
+
+	var results []verifyResult
+	for i, entry := range cfg.Resources {
+		resource, entryClient, err := resolver.resolve(entry)
+		if err != nil {
+			results = append(results, verifyResult{
+				resource: model.Resource{Type: model.ResourceType(entry.ResourceType), Name: entry.Name, Namespace: entry.Namespace},
+				detail:   fmt.Sprintf("resource %d: %v", i+1, err),
+			})
+			continue
+		}
+		results = append(results, verifyEntry(ctx, resource, entryClient)...)
+	}
+	return results
+}
+
+// verifyEntry checks a single resource and its ports
+func verifyEntry(ctx context.Context, resource model.Resource, client *k8s.Client) []verifyResult {
+	fail := func(detail string) []verifyResult {
+		return []verifyResult{{resource: resource, detail: detail}}
+	}
+
+	pods, err := portforward.BackingPods(ctx, client, resource)
+	if err != nil {
+		return fail(err.Error())
+	}
+	var pod *k8s.Pod
+	for i := range pods {
+		if pods[i].Ready {
+			pod = &pods[i]
+			break
+		}
+	}
+	if pod == nil {
+		return fail(fmt.Sprintf("none of the %d pod(s) is ready", len(pods)))
+	}
+
+	var servicePorts []k8s.ServicePort
+	if resource.Type == model.ServiceResource {
+		if servicePorts, err = verifyServicePorts(ctx, resource.Namespace, resource.Name, client); err != nil {
+			return fail(err.Error())
+		}
+	}
+
+	results := make([]verifyResult, 0, len(resource.Ports))
+	for _, port := range resource.Ports {
+		result := verifyResult{resource: resource, port: port}
+		result.passed, result.detail = verifyPort(port, *pod, servicePorts)
+		results = append(results, result)
+	}
+	return results
+}
+
+// verifyServicePorts returns the ports of a service in namespace
+func verifyServicePorts(ctx context.Context, namespace, name string, client *k8s.Client) ([]k8s.ServicePort, error) {
+	service, err := client.GetClientset().CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service %s: %w", name, err)
+	}
+	ports := make([]k8s.ServicePort, 0, len(service.Spec.Ports))
+	for i := range service.Spec.Ports {
+		p := service.Spec.Ports[i]
+		ports = append(ports, k8s.ServicePort{Name: p.Name, Port: p.Port, Protocol: string(p.Protocol), TargetPortSpec: &p.TargetPort})
+	}
+	return ports, nil
+}
+
+// verifyPort checks that remotePort is served by pod over TCP. Configuration files name the container
+// port, so a service port whose target port differs, or whose named target port does not
+// resolve on the pod, fails with the port to use instead.
+func verifyPort(remotePort int32, pod k8s.Pod, servicePorts []k8s.ServicePort) (bool, string) {
+	if protocol := pod.PortProtocol(remotePort); !k8s.IsTCP(protocol) {
+		return false, fmt.Sprintf("%d is a %s port; port-forwarding only supports TCP", remotePort, protocol)
+	}
+	for _, port := range pod.Ports {
+		if port.ContainerPort != remotePort {
+			continue
+		}
+		detail := fmt.Sprintf("pod %s port %d", pod.Name, remotePort)
+		if port.Name != "" {
+			detail += " (" + port.Name + ")"
+		}
+		return true, detail
+	}
+
+	for _, servicePort := range servicePorts {
+		if servicePort.Port != remotePort {
+			continue
+		}
+		target := servicePort.TargetPortSpec
+		if target == nil || (target.Type == intstr.Int && (target.IntVal == 0 || target.IntVal == remotePort)) {
+			break
+		}
+		if target.Type == intstr.String {
+			for _, port := range pod.Ports {
+				if port.Name == target.StrVal {
+					return false, fmt.Sprintf("%d is the service port; pods listen on %d (%s), use it as remotePort", remotePort, port.ContainerPort, target.StrVal)
+				}
+			}
+			return false, fmt.Sprintf("named target port %s of service port %d not found on pod %s", target.StrVal, remotePort, pod.Name)
+		}
+		return false, fmt.Sprintf("%d is the service port; pods listen on %d, use it as remotePort", remotePort, target.IntVal)
+	}
+
+	return true, fmt.Sprintf("pod %s port %d (not declared by its containers)", pod.Name, remotePort)
+}
+
+// printVerifyResults writes the results as a table and returns an error if any check failed
+func printVerifyResults(w io.Writer, results []verifyResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tNAMESPACE\tREMOTE\tRESULT\tDETAIL")
+	failed := 0
+	for _, r := range results {
+		result := "PASS"
+		if !r.passed {
+			result = "FAIL"
+			failed++
+		}
+		name := string(r.resource.Type) + "/" + r.resource.Name
+		if r.resource.Context != "" {
+			name = r.resource.Context + ":" + name
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, r.resource.Namespace, portOrDash(r.port), result, r.detail)
+	}
+	tw.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d check(s) failed", failed, len(results))
+	}
+	fmt.Fprintln(w, "All checks passed.")
+	return nil
+}
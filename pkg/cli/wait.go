@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// DefaultWaitTimeout is how long --wait waits for configured resources to be deployed
+const DefaultWaitTimeout = 5 * time.Minute
+
+// waitPollInterval is how often resources that are not deployed yet are looked up again
+const waitPollInterval = 2 * time.Second
+
+// pendingResource is a configured resource that was not deployed when the session started
+type pendingResource struct {
+	resource    model.Resource
+	portMapping map[int]int32
+}
+
+// notDeployedYet reports whether forwarding failed because the resource or its pods do not
+// exist yet, which --wait waits out
+func notDeployedYet(err error) bool {
+	return apierrors.IsNotFound(err) || errors.Is(err, k8s.ErrNoPods)
+}
+
+// waitForResources forwards the pending resources as soon as they are deployed, polling until
+// timeout. The session is kept alive while resources are pending; those still missing at the
+// timeout are recorded as failures.
+func waitForResources(pending []pendingResource, manager *portforward.Manager, timeout time.Duration, ctx context.Context) {
+	manager.ForwardWait.Add(1)
+	go func() {
+		defer manager.ForwardWait.Done()
+
+		ticker := time.NewTicker(waitPollInterval)
+		defer ticker.Stop()
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+
+		for len(pending) > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-deadline.C:
+				for _, p := range pending {
+					err := fmt.Errorf("%s %s was not deployed within %s", p.resource.Type, p.resource.Name, timeout)
+					manager.Log().Error(err.Error(), "event", "error", "error", err.Error())
+					manager.RecordFailure(portforward.ForwardFailure{Resource: p.resource, Err: err})
+				}
+				return
+			case <-ticker.C:
+			}
+
+			remaining := pending[:0]
+			for _, p := range pending {
+				err := manager.ForwardResource(p.resource, p.portMapping)
+
+				switch {
+				case err == nil:
+					manager.Log().Info(fmt.Sprintf("%s %s is deployed, forwarding started", p.resource.Type, p.resource.Name), "event", "deployed")
+				case notDeployedYet(err):
+					remaining = append(remaining, p)
+				default:
+					err = fmt.Errorf("error forwarding resource %s: %w", p.resource.Name, err)
+					manager.Log().Error(err.Error(), "event", "error", "error", err.Error())
+					manager.RecordFailure(portforward.ForwardFailure{Resource: p.resource, Err: err})
+				}
+			}
+			pending = remaining
+		}
+	}()
+}
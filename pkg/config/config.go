@@ -2,48 +2,112 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
 	"roeyazroel/kubectl-pfw/pkg/k8s"
-	"roeyazroel/kubectl-pfw/pkg/ui"
+	"roeyazroel/kubectl-pfw/pkg/model"
 
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // PortForwardEntry represents a single port forwarding configuration entry
 type PortForwardEntry struct {
 	// ResourceType can be "service", "pod", "deployment", or "statefulset"
-	ResourceType string `yaml:"resourceType"`
+	ResourceType string `yaml:"resourceType" json:"resourceType"`
 	// Name of the resource to forward to
-	Name string `yaml:"name"`
+	Name string `yaml:"name" json:"name"`
 	// Optional namespace, uses current context namespace if empty
-	Namespace string `yaml:"namespace,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
 	// Port mappings
-	Ports []PortMapping `yaml:"ports"`
+	Ports []PortMapping `yaml:"ports" json:"ports"`
+	// Optional URL scheme of the ports, "http" or "https"; detected from each port if empty
+	Scheme string `yaml:"scheme,omitempty" json:"scheme,omitempty"`
+	// Optional notes about the resource, shown next to it by pfw export report
+	Notes string `yaml:"notes,omitempty" json:"notes,omitempty"`
+	// Optional name of the cluster in clusters to forward from; the session's context if empty
+	Cluster string `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	// Optional user to impersonate for the entry, e.g. system:serviceaccount:ns:sa; overrides --as
+	As string `yaml:"as,omitempty" json:"as,omitempty"`
+	// Optional groups to impersonate along with As
+	AsGroups []string `yaml:"asGroups,omitempty" json:"asGroups,omitempty"`
+	// Optional label selector the chosen backing pod must match, e.g. track=canary
+	PodSelector string `yaml:"podSelector,omitempty" json:"podSelector,omitempty"`
+	// Optional node the chosen backing pod must be scheduled on; overrides --node
+	Node string `yaml:"node,omitempty" json:"node,omitempty"`
+	// Optional topology zone the chosen backing pod must run in, e.g. eu-west-1a; overrides --zone
+	Zone string `yaml:"zone,omitempty" json:"zone,omitempty"`
 }
 
 // PortMapping defines a local-to-remote port mapping
 type PortMapping struct {
 	// Local port to use. If 0, auto-assign based on remote port
-	LocalPort int32 `yaml:"localPort"`
+	LocalPort int32 `yaml:"localPort" json:"localPort"`
 	// Remote port to forward to
-	RemotePort int32 `yaml:"remotePort"`
+	RemotePort int32 `yaml:"remotePort" json:"remotePort"`
+}
+
+// ClusterConfig describes a cluster that entries of a configuration can forward from
+type ClusterConfig struct {
+	// Context is the kubeconfig context of the cluster
+	Context string `yaml:"context" json:"context"`
+	// Kubeconfig is the kubeconfig file holding the context (optional, uses the default kubeconfig if empty)
+	Kubeconfig string `yaml:"kubeconfig,omitempty" json:"kubeconfig,omitempty"`
+	// Namespace is the namespace of the cluster's entries if not specified (optional, uses the context's if empty)
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
 }
 
 // ForwardingConfig defines the structure of a configuration file for port forwarding
 type ForwardingConfig struct {
 	// Context is the Kubernetes context to use (optional, uses current if empty)
-	Context string `yaml:"context,omitempty"`
+	Context string `yaml:"context,omitempty" json:"context,omitempty"`
 	// DefaultNamespace is the namespace to use for resources if not specified (optional)
-	DefaultNamespace string `yaml:"defaultNamespace,omitempty"`
+	DefaultNamespace string `yaml:"defaultNamespace,omitempty" json:"defaultNamespace,omitempty"`
+	// Clusters are other clusters entries can forward from, by name (optional)
+	Clusters map[string]ClusterConfig `yaml:"clusters,omitempty" json:"clusters,omitempty"`
 	// Resources is a list of resources to forward
-	Resources []PortForwardEntry `yaml:"resources"`
+	Resources []PortForwardEntry `yaml:"resources" json:"resources"`
 }
 
-// LoadConfig loads a forwarding configuration from a YAML file
+// Configuration file formats
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// FormatFor returns the format of a configuration file from its extension: JSON for .json
+// files, YAML otherwise
+func FormatFor(filePath string) string {
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// LoadConfig loads a forwarding configuration from a YAML or JSON file, depending on its extension
 func LoadConfig(filePath string) (*ForwardingConfig, error) {
+	return LoadConfigFormat(filePath, "")
+}
+
+// LoadConfigFormat loads a forwarding configuration from a file in format, FormatYAML or
+// FormatJSON. An empty format is taken from the file's extension like in LoadConfig.
+func LoadConfigFormat(filePath, format string) (*ForwardingConfig, error) {
+	switch format {
+	case "":
+		format = FormatFor(filePath)
+	case FormatYAML, FormatJSON:
+	default:
+		return nil, fmt.Errorf("unsupported config format %q, must be one of: yaml, json", format)
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open config file: %w", err)
@@ -56,7 +120,11 @@ func LoadConfig(filePath string) (*ForwardingConfig, error) {
 	}
 
 	config := &ForwardingConfig{}
-	err = yaml.Unmarshal(content, config)
+	if format == FormatJSON {
+		err = json.Unmarshal(content, config)
+	} else {
+		err = yaml.Unmarshal(content, config)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
@@ -75,43 +143,78 @@ func validateConfig(config *ForwardingConfig) error {
 		return fmt.Errorf("no resources specified in config")
 	}
 
-	for i, res := range config.Resources {
-		if res.ResourceType == "" {
-			return fmt.Errorf("resource %d: resourceType is required", i+1)
+	for name, cluster := range config.Clusters {
+		if cluster.Context == "" {
+			return fmt.Errorf("cluster %s: context is required", name)
 		}
+	}
 
-		// Check if resource type is valid
-		switch res.ResourceType {
-		case "service", "pod", "deployment", "statefulset":
-			// Valid resource type
-		default:
-			return fmt.Errorf("resource %d: invalid resourceType '%s', must be one of: service, pod, deployment, statefulset", i+1, res.ResourceType)
+	for i, res := range config.Resources {
+		if err := ValidateEntry(res); err != nil {
+			return fmt.Errorf("resource %d: %w", i+1, err)
 		}
-
-		if res.Name == "" {
-			return fmt.Errorf("resource %d: name is required", i+1)
+		if _, ok := config.Clusters[res.Cluster]; res.Cluster != "" && !ok {
+			return fmt.Errorf("resource %d: cluster '%s' is not defined in clusters", i+1, res.Cluster)
 		}
+	}
 
-		if len(res.Ports) == 0 {
-			return fmt.Errorf("resource %d: no ports specified", i+1)
-		}
+	return nil
+}
 
-		for j, port := range res.Ports {
-			if port.RemotePort <= 0 {
-				return fmt.Errorf("resource %d, port %d: remotePort must be greater than 0", i+1, j+1)
-			}
+// ValidateEntry validates a single resource entry
+func ValidateEntry(res PortForwardEntry) error {
+	if res.ResourceType == "" {
+		return fmt.Errorf("resourceType is required")
+	}
 
-			if port.LocalPort < 0 {
-				return fmt.Errorf("resource %d, port %d: localPort must be at least 0", i+1, j+1)
-			}
+	// Check if resource type is valid
+	switch res.ResourceType {
+	case "service", "pod", "deployment", "statefulset":
+		// Valid resource type
+	default:
+		return fmt.Errorf("invalid resourceType '%s', must be one of: service, pod, deployment, statefulset", res.ResourceType)
+	}
+
+	if res.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if len(res.Ports) == 0 {
+		return fmt.Errorf("no ports specified")
+	}
+
+	switch res.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("invalid scheme '%s', must be one of: http, https", res.Scheme)
+	}
+
+	if len(res.AsGroups) > 0 && res.As == "" {
+		return fmt.Errorf("asGroups requires as")
+	}
+
+	if res.ResourceType == "pod" && (res.PodSelector != "" || res.Node != "" || res.Zone != "") {
+		return fmt.Errorf("podSelector, node and zone only apply to services, deployments and statefulsets")
+	}
+	if _, err := labels.Parse(res.PodSelector); err != nil {
+		return fmt.Errorf("invalid podSelector '%s': %w", res.PodSelector, err)
+	}
+
+	for j, port := range res.Ports {
+		if port.RemotePort <= 0 {
+			return fmt.Errorf("port %d: remotePort must be greater than 0", j+1)
+		}
+
+		if port.LocalPort < 0 {
+			return fmt.Errorf("port %d: localPort must be at least 0", j+1)
 		}
 	}
 
 	return nil
 }
 
-// ConvertEntryToResource converts a PortForwardEntry to a ui.Resource
-func ConvertEntryToResource(entry PortForwardEntry, defaultNamespace string) (ui.Resource, error) {
+// ConvertEntryToResource converts a PortForwardEntry to a model.Resource
+func ConvertEntryToResource(entry PortForwardEntry, defaultNamespace string) (model.Resource, error) {
 	// Determine the namespace to use
 	namespace := defaultNamespace
 	if entry.Namespace != "" {
@@ -119,18 +222,18 @@ func ConvertEntryToResource(entry PortForwardEntry, defaultNamespace string) (ui
 	}
 
 	// Determine the resource type
-	var resourceType ui.ResourceType
+	var resourceType model.ResourceType
 	switch entry.ResourceType {
 	case "service":
-		resourceType = ui.ServiceResource
+		resourceType = model.ServiceResource
 	case "pod":
-		resourceType = ui.PodResource
+		resourceType = model.PodResource
 	case "deployment":
-		resourceType = ui.DeploymentResource
+		resourceType = model.DeploymentResource
 	case "statefulset":
-		resourceType = ui.StatefulSetResource
+		resourceType = model.StatefulSetResource
 	default:
-		return ui.Resource{}, fmt.Errorf("invalid resource type: %s", entry.ResourceType)
+		return model.Resource{}, fmt.Errorf("invalid resource type: %s", entry.ResourceType)
 	}
 
 	// Extract ports
@@ -142,13 +245,13 @@ func ConvertEntryToResource(entry PortForwardEntry, defaultNamespace string) (ui
 		ports[i] = p.RemotePort
 
 		// Create a target port spec for each port
-		// This is needed because the Manager.forwardServicePort function checks this
+		// This is needed because the Manager.serviceTarget function checks this
 		targetPort := intstr.FromInt(int(p.RemotePort))
 		targetPortSpecs[i] = &targetPort
 	}
 
 	// Create a resource object
-	return ui.Resource{
+	return model.Resource{
 		Name:            entry.Name,
 		Namespace:       namespace,
 		Type:            resourceType,
@@ -156,6 +259,13 @@ func ConvertEntryToResource(entry PortForwardEntry, defaultNamespace string) (ui
 		PortNames:       make([]string, len(entry.Ports)), // Empty port names
 		TargetPortSpecs: targetPortSpecs,
 		DisplayName:     fmt.Sprintf("%s/%s", entry.ResourceType, entry.Name),
+		Scheme:          entry.Scheme,
+		Notes:           entry.Notes,
+		As:              entry.As,
+		AsGroups:        entry.AsGroups,
+		PodSelector:     entry.PodSelector,
+		Node:            entry.Node,
+		Zone:            entry.Zone,
 	}, nil
 }
 
@@ -170,44 +280,63 @@ func CreatePortMapping(entry PortForwardEntry) map[int]int32 {
 	return mapping
 }
 
-// GenerateConfig creates a ForwardingConfig from a list of resources and port mappings
-func GenerateConfig(resources []ui.Resource, portMappings map[string]map[int]int32, resolvedPorts map[string]map[int]int32, defaultNamespace string) *ForwardingConfig {
+// GenerateConfig creates a ForwardingConfig from a list of resources and port mappings.
+// contextName is the kubeconfig context the resources were listed from. When the resources
+// span several namespaces, every entry names its namespace so the file does not depend on
+// the default namespace. portMappings and resolvedPorts are keyed by Resource.Key.
+func GenerateConfig(resources []model.Resource, portMappings map[string]map[int]int32, resolvedPorts map[string]map[int]int32, contextName, defaultNamespace string) *ForwardingConfig {
 	config := &ForwardingConfig{
+		Context:          contextName,
 		DefaultNamespace: defaultNamespace,
 		Resources:        make([]PortForwardEntry, 0, len(resources)),
 	}
 
+	spansNamespaces := false
+	for _, resource := range resources {
+		if resource.Namespace != resources[0].Namespace {
+			spansNamespaces = true
+			break
+		}
+	}
+
 	for _, resource := range resources {
 		// Create a new entry
 		entry := PortForwardEntry{
-			Name:  resource.Name,
-			Ports: make([]PortMapping, 0, len(resource.Ports)),
+			Name:        resource.Name,
+			Ports:       make([]PortMapping, 0, len(resource.Ports)),
+			Scheme:      resource.Scheme,
+			Notes:       resource.Notes,
+			As:          resource.As,
+			AsGroups:    resource.AsGroups,
+			PodSelector: resource.PodSelector,
+			Node:        resource.Node,
+			Zone:        resource.Zone,
 		}
 
-		// Set resource type based on the ui.ResourceType
+		// Set resource type based on the model.ResourceType
 		switch resource.Type {
-		case ui.ServiceResource:
+		case model.ServiceResource:
 			entry.ResourceType = "service"
-		case ui.PodResource:
+		case model.PodResource:
 			entry.ResourceType = "pod"
-		case ui.DeploymentResource:
+		case model.DeploymentResource:
 			entry.ResourceType = "deployment"
-		case ui.StatefulSetResource:
+		case model.StatefulSetResource:
 			entry.ResourceType = "statefulset"
 		}
 
-		// Set namespace if different from default
-		if resource.Namespace != defaultNamespace {
+		// Set namespace if different from default, or on every entry across namespaces
+		if spansNamespaces || resource.Namespace != defaultNamespace {
 			entry.Namespace = resource.Namespace
 		}
 
 		// Get port mappings for this resource
-		portMap := portMappings[resource.Name]
+		portMap := portMappings[resource.Key()]
 
 		// Get resolved ports for services
 		resolvedPortMap := make(map[int]int32)
-		if resource.Type == ui.ServiceResource {
-			if resolved, ok := resolvedPorts[resource.Name]; ok {
+		if resource.Type == model.ServiceResource {
+			if resolved, ok := resolvedPorts[resource.Key()]; ok {
 				resolvedPortMap = resolved
 			}
 		}
@@ -223,7 +352,7 @@ func GenerateConfig(resources []ui.Resource, portMappings map[string]map[int]int
 
 			// For services, use the resolved container port if available
 			targetPort := remotePort
-			if resource.Type == ui.ServiceResource {
+			if resource.Type == model.ServiceResource {
 				if resolvedTargetPort, exists := resolvedPortMap[i]; exists {
 					targetPort = resolvedTargetPort
 				}
@@ -241,8 +370,42 @@ func GenerateConfig(resources []ui.Resource, portMappings map[string]map[int]int
 	return config
 }
 
-// WriteConfig writes a ForwardingConfig to a YAML file
-func WriteConfig(config *ForwardingConfig, filePath string) error {
+// WriteConfig writes a ForwardingConfig to a file in the given format, or in the format of its
+// extension when format is empty
+func WriteConfig(config *ForwardingConfig, filePath, format string) error {
+	content, err := EncodeConfig(config, filePath, format)
+	if err != nil {
+		return err
+	}
+
+	// Write to file
+	err = os.WriteFile(filePath, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// EncodeConfig renders a ForwardingConfig as YAML with a header explaining its use, or as JSON,
+// which has no comments. filePath is the file it is meant to be stored in, as shown in the usage
+// line; an empty format is taken from its extension.
+func EncodeConfig(config *ForwardingConfig, filePath, format string) ([]byte, error) {
+	if format == "" {
+		format = FormatFor(filePath)
+	}
+	switch format {
+	case FormatYAML:
+	case FormatJSON:
+		jsonData, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config to JSON: %w", err)
+		}
+		return append(jsonData, '\n'), nil
+	default:
+		return nil, fmt.Errorf("invalid format '%s', must be one of: yaml, json", format)
+	}
+
 	// Generate YAML with comments
 	content := "# Configuration file for kubectl-pfw\n"
 	content += "# Generated by kubectl-pfw\n"
@@ -256,104 +419,139 @@ func WriteConfig(config *ForwardingConfig, filePath string) error {
 	// Marshal the config to YAML
 	yamlData, err := yaml.Marshal(config)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config to YAML: %w", err)
+		return nil, fmt.Errorf("failed to marshal config to YAML: %w", err)
 	}
 
 	// Combine the header and YAML data
-	content += string(yamlData)
+	return append([]byte(content), yamlData...), nil
+}
 
-	// Write to file
-	err = os.WriteFile(filePath, []byte(content), 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
-	}
+// MaxConcurrentLookups limits how many services are resolved against the API server at once
+const MaxConcurrentLookups = 8
 
-	return nil
+// ServicePodResolver finds the pods backing a service. *k8s.Client implements it.
+type ServicePodResolver interface {
+	GetPodsForService(ctx context.Context, serviceName string) ([]k8s.Pod, error)
+}
+
+// NamespacedServicePodResolver is implemented by ServicePodResolvers that can look up the pods
+// of a service in any namespace, so services are looked up in their own namespace instead of
+// the one of the resolver. *k8s.Client implements it.
+type NamespacedServicePodResolver interface {
+	GetPodsForServiceInNamespace(ctx context.Context, namespace, serviceName string) ([]k8s.Pod, error)
 }
 
 // ResolveTargetPorts resolves service ports to actual container ports for services
-// Returns a map of resource names to a map of port indices to resolved container ports
-func ResolveTargetPorts(ctx context.Context, resources []ui.Resource, k8sClient *k8s.Client) (map[string]map[int]int32, error) {
+// Returns a map of resource keys (see Resource.Key) to a map of port indices to resolved
+// container ports
+func ResolveTargetPorts(ctx context.Context, resources []model.Resource, k8sClient ServicePodResolver) (map[string]map[int]int32, error) {
 	resolvedPorts := make(map[string]map[int]int32)
+	var mu sync.Mutex
+
+	// Look up the backing pods of every service concurrently, bounded by MaxConcurrentLookups
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(MaxConcurrentLookups)
 
 	for _, resource := range resources {
 		// Only process service resources
-		if resource.Type != ui.ServiceResource {
+		if resource.Type != model.ServiceResource {
 			continue
 		}
 
-		// Find pods that back this service
-		pods, err := k8sClient.GetPodsForService(ctx, resource.Name)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find pods for service %s: %w", resource.Name, err)
-		}
+		resource := resource
+		g.Go(func() error {
+			portMap, err := resolveServiceTargetPorts(gctx, resource, k8sClient)
+			if err != nil {
+				return err
+			}
 
-		// Get the first pod (same logic as in portforward.Manager.forwardServicePort)
-		var selectedPod *k8s.Pod
-		for i := range pods {
-			selectedPod = &pods[i]
-			break
-		}
+			mu.Lock()
+			resolvedPorts[resource.Key()] = portMap
+			mu.Unlock()
+			return nil
+		})
+	}
 
-		if selectedPod == nil {
-			return nil, fmt.Errorf("no pods found for service %s", resource.Name)
-		}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
 
-		// Create mapping of port indices to resolved container ports
-		portMap := make(map[int]int32)
-		resolvedPorts[resource.Name] = portMap
+	return resolvedPorts, nil
+}
 
-		// Resolve each port
-		for i, servicePort := range resource.Ports {
-			// Skip if we don't have the target port spec
-			if i >= len(resource.TargetPortSpecs) || resource.TargetPortSpecs[i] == nil {
-				continue
-			}
+// resolveServiceTargetPorts resolves the container port for each port of a single service
+func resolveServiceTargetPorts(ctx context.Context, resource model.Resource, k8sClient ServicePodResolver) (map[int]int32, error) {
+	// Find pods that back this service
+	var pods []k8s.Pod
+	var err error
+	if namespaced, ok := k8sClient.(NamespacedServicePodResolver); ok {
+		pods, err = namespaced.GetPodsForServiceInNamespace(ctx, resource.Namespace, resource.Name)
+	} else {
+		pods, err = k8sClient.GetPodsForService(ctx, resource.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pods for service %s: %w", resource.Name, err)
+	}
 
-			// Use the same logic as in portforward.Manager.resolveTargetPort
-			targetSpec := resource.TargetPortSpecs[i]
+	// Get the first pod (same logic as in portforward.Manager.serviceTarget)
+	var selectedPod *k8s.Pod
+	for i := range pods {
+		selectedPod = &pods[i]
+		break
+	}
 
-			var resolvedPort int32
+	if selectedPod == nil {
+		return nil, fmt.Errorf("no pods found for service %s", resource.Name)
+	}
+
+	// Create mapping of port indices to resolved container ports
+	portMap := make(map[int]int32)
+
+	// Resolve each port
+	for i, servicePort := range resource.Ports {
+		// Skip if we don't have the target port spec
+		if i >= len(resource.TargetPortSpecs) || resource.TargetPortSpecs[i] == nil {
+			continue
+		}
+
+		// Use the same logic as in portforward.Manager.resolveTargetPort
+		targetSpec := resource.TargetPortSpecs[i]
 
-			// Logic from portforward.Manager.resolveTargetPort
-			if targetSpec == nil {
-				// Default to service port
+		var resolvedPort int32
+
+		// Logic from portforward.Manager.resolveTargetPort
+		switch targetSpec.Type {
+		case intstr.Int:
+			// If IntVal is 0, default to service port
+			if targetSpec.IntVal == 0 {
 				resolvedPort = servicePort
 			} else {
-				switch targetSpec.Type {
-				case intstr.Int:
-					// If IntVal is 0, default to service port
-					if targetSpec.IntVal == 0 {
-						resolvedPort = servicePort
-					} else {
-						// Use specified numeric target port
-						resolvedPort = targetSpec.IntVal
-					}
-				case intstr.String:
-					// Find container port with matching name
-					found := false
-					portName := targetSpec.StrVal
-					for _, podPort := range selectedPod.Ports {
-						if podPort.Name == portName {
-							resolvedPort = podPort.ContainerPort
-							found = true
-							break
-						}
-					}
-
-					if !found {
-						return nil, fmt.Errorf("named target port '%s' not found on pod '%s' in namespace '%s'",
-							portName, selectedPod.Name, selectedPod.Namespace)
-					}
-				default:
-					return nil, fmt.Errorf("unknown targetPort type: %v", targetSpec.Type)
+				// Use specified numeric target port
+				resolvedPort = targetSpec.IntVal
+			}
+		case intstr.String:
+			// Find container port with matching name
+			found := false
+			portName := targetSpec.StrVal
+			for _, podPort := range selectedPod.Ports {
+				if podPort.Name == portName {
+					resolvedPort = podPort.ContainerPort
+					found = true
+					break
 				}
 			}
 
-			// Store the resolved port
-			portMap[i] = resolvedPort
+			if !found {
+				return nil, fmt.Errorf("named target port '%s' not found on pod '%s' in namespace '%s'",
+					portName, selectedPod.Name, selectedPod.Namespace)
+			}
+		default:
+			return nil, fmt.Errorf("unknown targetPort type: %v", targetSpec.Type)
 		}
+
+		// Store the resolved port
+		portMap[i] = resolvedPort
 	}
 
-	return resolvedPorts, nil
+	return portMap, nil
 }
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// TestLoadConfigFormat verifies that an explicit format overrides the file extension, and
+// that the extension decides without one.
+func TestLoadConfigFormat(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.txt")
+	jsonFile := filepath.Join(dir, "config.conf")
+	if err := os.WriteFile(yamlFile, []byte("resources:\n  - resourceType: service\n    name: web\n    ports:\n      - remotePort: 80\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonFile, []byte(`{"resources":[{"resourceType":"service","name":"web","ports":[{"remotePort":80}]}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		format  string
+		wantErr bool
+	}{
+		{"yaml by default", yamlFile, "", false},
+		{"explicit yaml", yamlFile, FormatYAML, false},
+		{"explicit json", jsonFile, FormatJSON, false},
+		{"yaml read as json", yamlFile, FormatJSON, true},
+		{"unknown format", yamlFile, "toml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfigFormat(tt.path, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfigFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (len(cfg.Resources) != 1 || cfg.Resources[0].Name != "web") {
+				t.Errorf("unexpected resources %+v", cfg.Resources)
+			}
+		})
+	}
+}
+
+// namespacedResolver serves the pods of services by namespace
+type namespacedResolver map[string][]k8s.Pod
+
+func (r namespacedResolver) GetPodsForService(ctx context.Context, serviceName string) ([]k8s.Pod, error) {
+	return r["default"], nil
+}
+
+func (r namespacedResolver) GetPodsForServiceInNamespace(ctx context.Context, namespace, serviceName string) ([]k8s.Pod, error) {
+	return r[namespace], nil
+}
+
+// TestSameNamedServices verifies that two services with the same name in different namespaces
+// keep their own resolved target ports and local ports
+func TestSameNamedServices(t *testing.T) {
+	target := intstr.FromString("http")
+	resources := []model.Resource{
+		{Name: "web", Namespace: "ns1", Context: "prod", Type: model.ServiceResource, Ports: []int32{80}, TargetPortSpecs: []*intstr.IntOrString{&target}},
+		{Name: "web", Namespace: "ns2", Context: "prod", Type: model.ServiceResource, Ports: []int32{80}, TargetPortSpecs: []*intstr.IntOrString{&target}},
+	}
+	resolver := namespacedResolver{
+		"ns1": {{Name: "web-1", Namespace: "ns1", Ports: []k8s.PodPort{{Name: "http", ContainerPort: 8080}}}},
+		"ns2": {{Name: "web-2", Namespace: "ns2", Ports: []k8s.PodPort{{Name: "http", ContainerPort: 9090}}}},
+	}
+
+	resolved, err := ResolveTargetPorts(context.Background(), resources, resolver)
+	if err != nil {
+		t.Fatalf("ResolveTargetPorts() error = %v", err)
+	}
+	portMappings := map[string]map[int]int32{
+		resources[0].Key(): {0: 8081},
+		resources[1].Key(): {0: 8082},
+	}
+
+	cfg := GenerateConfig(resources, portMappings, resolved, "prod", "default")
+	want := []struct {
+		namespace string
+		local     int32
+		target    int32
+	}{
+		{"ns1", 8081, 8080},
+		{"ns2", 8082, 9090},
+	}
+	if len(cfg.Resources) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(cfg.Resources), len(want))
+	}
+	for i, w := range want {
+		entry := cfg.Resources[i]
+		if entry.Namespace != w.namespace || len(entry.Ports) != 1 {
+			t.Errorf("entry %d = %+v, want namespace %s with one port", i, entry, w.namespace)
+			continue
+		}
+		if entry.Ports[0].LocalPort != w.local || entry.Ports[0].RemotePort != w.target {
+			t.Errorf("entry %d ports = %+v, want local %d remote %d", i, entry.Ports[0], w.local, w.target)
+		}
+	}
+}
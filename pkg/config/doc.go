@@ -0,0 +1,4 @@
+// Package config loads, validates and writes kubectl-pfw configuration files and the user
+// settings file. ConvertEntryToResource and CreatePortMapping turn configuration entries into
+// arguments for portforward.Manager.AddForward.
+package config
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SettingsEnvVar overrides the location of the settings file
+const SettingsEnvVar = "KUBECTL_PFW_SETTINGS"
+
+// Settings holds user preferences that apply to every kubectl-pfw invocation.
+// Command-line flags take precedence over values from the settings file.
+type Settings struct {
+	// LocalPortRange restricts ephemeral local ports to a range such as "20000-21000"
+	LocalPortRange string `yaml:"localPortRange,omitempty"`
+	// PickContext prompts for a kubeconfig context when --context is not given
+	PickContext bool `yaml:"pickContext,omitempty"`
+	// Sort is the default order of the selection list: name, namespace, age or recent
+	Sort string `yaml:"sort,omitempty"`
+	// DisableUpdateCheck stops sessions from checking for new releases
+	DisableUpdateCheck bool `yaml:"disableUpdateCheck,omitempty"`
+	// Aliases name sets of resources and ports that `pfw up <alias>` forwards, written like
+	// configuration files
+	Aliases map[string]*ForwardingConfig `yaml:"aliases,omitempty"`
+}
+
+// ConfigDir returns the directory holding kubectl-pfw's settings and state files
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine user config directory: %w", err)
+	}
+	return filepath.Join(dir, "kubectl-pfw"), nil
+}
+
+// SettingsPath returns the path of the settings file
+func SettingsPath() (string, error) {
+	if path := os.Getenv(SettingsEnvVar); path != "" {
+		return path, nil
+	}
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "settings.yaml"), nil
+}
+
+// LoadSettings loads the settings file. A missing file yields empty settings.
+func LoadSettings() (*Settings, error) {
+	settings := &Settings{}
+
+	path, err := SettingsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(content, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse settings file %s: %w", path, err)
+	}
+
+	return settings, nil
+}
+
+// AliasNames returns the names of the defined aliases in order
+func (s *Settings) AliasNames() []string {
+	names := make([]string, 0, len(s.Aliases))
+	for name := range s.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveAliases combines the named aliases into one configuration. Each entry keeps the
+// namespace it would have had in its own alias, and all aliases must use the same context.
+func (s *Settings) ResolveAliases(names []string) (*ForwardingConfig, error) {
+	resolved := &ForwardingConfig{}
+	for i, name := range names {
+		alias, ok := s.Aliases[name]
+		if !ok || alias == nil {
+			if len(s.Aliases) == 0 {
+				return nil, fmt.Errorf("unknown alias %q: no aliases are defined in the settings file", name)
+			}
+			return nil, fmt.Errorf("unknown alias %q, must be one of: %s", name, strings.Join(s.AliasNames(), ", "))
+		}
+		if err := validateConfig(alias); err != nil {
+			return nil, fmt.Errorf("alias %s: %w", name, err)
+		}
+		if i > 0 && alias.Context != resolved.Context {
+			return nil, fmt.Errorf("aliases %s and %s use different contexts", names[0], name)
+		}
+		resolved.Context = alias.Context
+
+		for _, entry := range alias.Resources {
+			if entry.Namespace == "" {
+				entry.Namespace = alias.DefaultNamespace
+			}
+			resolved.Resources = append(resolved.Resources, entry)
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,3 @@
+// Package control serves a JSON API on localhost that lets editors and scripts list, add and
+// stop the forwards of a running kubectl-pfw session.
+package control
@@ -0,0 +1,71 @@
+package control
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+)
+
+// resourceKinds maps the resource types accepted in resource references, including kubectl's
+// abbreviations, to the types of forwarded resources
+var resourceKinds = map[string]model.ResourceType{
+	"svc":          model.ServiceResource,
+	"service":      model.ServiceResource,
+	"services":     model.ServiceResource,
+	"po":           model.PodResource,
+	"pod":          model.PodResource,
+	"pods":         model.PodResource,
+	"deploy":       model.DeploymentResource,
+	"deployment":   model.DeploymentResource,
+	"deployments":  model.DeploymentResource,
+	"sts":          model.StatefulSetResource,
+	"statefulset":  model.StatefulSetResource,
+	"statefulsets": model.StatefulSetResource,
+	"custom":       model.CustomResource,
+}
+
+// resourceRef names the forwards of a resource, e.g. svc/web or prod/deploy/api:8080
+type resourceRef struct {
+	namespace string
+	kind      model.ResourceType
+	name      string
+	// localPort limits the reference to the forward on this local port, 0 matches all
+	localPort int32
+}
+
+// parseResourceRef parses a reference of the form [NAMESPACE/]TYPE/NAME[:LOCALPORT]
+func parseResourceRef(ref string) (resourceRef, error) {
+	var parsed resourceRef
+	path := ref
+	if before, port, ok := strings.Cut(ref, ":"); ok {
+		localPort, err := strconv.ParseInt(port, 10, 32)
+		if err != nil || localPort <= 0 {
+			return parsed, fmt.Errorf("invalid local port in %q", ref)
+		}
+		path, parsed.localPort = before, int32(localPort)
+	}
+
+	parts := strings.Split(path, "/")
+	if len(parts) == 3 {
+		parsed.namespace, parts = parts[0], parts[1:]
+	}
+	if len(parts) != 2 || parts[1] == "" {
+		return parsed, fmt.Errorf("invalid resource %q, expected [namespace/]type/name", ref)
+	}
+	kind, ok := resourceKinds[strings.ToLower(parts[0])]
+	if !ok {
+		return parsed, fmt.Errorf("unknown resource type %q in %q", parts[0], ref)
+	}
+	parsed.kind, parsed.name = kind, parts[1]
+	return parsed, nil
+}
+
+// matches reports whether the forward belongs to the referenced resource
+func (r resourceRef) matches(status portforward.ForwardStatus) bool {
+	return status.Resource.Type == r.kind && status.Resource.Name == r.name &&
+		(r.namespace == "" || status.Resource.Namespace == r.namespace) &&
+		(r.localPort == 0 || status.LocalPort == r.localPort)
+}
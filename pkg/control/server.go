@@ -0,0 +1,408 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+)
+
+// Forward is the JSON representation of a forward
+type Forward struct {
+	ID         string `json:"id"`
+	Context    string `json:"context,omitempty"`
+	Namespace  string `json:"namespace"`
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Pod        string `json:"pod,omitempty"`
+	LocalPort  int32  `json:"localPort"`
+	RemotePort int32  `json:"remotePort"`
+	State      string `json:"state"`
+	// URL is set for forwards whose scheme is known, e.g. https://localhost:8443
+	URL string `json:"url,omitempty"`
+	// Retries counts reconnection attempts; LastError is the error of the most recent one
+	Retries       int        `json:"retries"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+	// ConnectedSince is when the tunnel was last (re)established; Uptime is the time since
+	ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+	Uptime         string     `json:"uptime,omitempty"`
+}
+
+// Stats summarizes the session
+type Stats struct {
+	PID      int            `json:"pid"`
+	Started  time.Time      `json:"started"`
+	Uptime   string         `json:"uptime"`
+	Forwards int            `json:"forwards"`
+	States   map[string]int `json:"states"`
+}
+
+// AddResponse lists the IDs of the forwards started by an add request
+type AddResponse struct {
+	IDs []string `json:"ids"`
+}
+
+// StopResponse lists the IDs of the forwards stopped by a stop request
+type StopResponse struct {
+	IDs []string `json:"ids"`
+}
+
+// SwitchRequest moves a forward to another pod; an empty Pod picks the next ready one
+type SwitchRequest struct {
+	ID  string `json:"id"`
+	Pod string `json:"pod,omitempty"`
+}
+
+// SwitchResponse names the pod carrying the forward after a switch
+type SwitchResponse struct {
+	ID  string `json:"id"`
+	Pod string `json:"pod"`
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server serves the control API of a Manager
+type Server struct {
+	Manager *portforward.Manager
+	// Namespace is the session namespace, which added forwards without a namespace default to
+	Namespace string
+
+	started  time.Time
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewServer creates a control API server for manager
+func NewServer(manager *portforward.Manager, namespace string) *Server {
+	return &Server{
+		Manager:   manager,
+		Namespace: namespace,
+		started:   time.Now(),
+	}
+}
+
+// Start listens on addr, which must be a loopback address, and serves the API in the background
+func (s *Server) Start(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid control address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("control address %q must be on localhost", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control address %s: %w", addr, err)
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go s.server.Serve(listener)
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+// Handler returns the HTTP handler serving the API:
+//
+//	GET    /v1/forwards         list forwards
+//	POST   /v1/forwards         add a forward, the body is a config file resource entry
+//	DELETE /v1/forwards?id=ID   stop a forward
+//	DELETE /v1/forwards?resource=[NAMESPACE/]TYPE/NAME[:LOCALPORT]
+//	                            stop the forwards of a resource, e.g. svc/web
+//	POST   /v1/forwards/pod     move a forward to another pod, the body is a SwitchRequest
+//	GET    /v1/stats            session statistics
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/forwards", s.handleForwards)
+	mux.HandleFunc("/v1/forwards/pod", s.handleSwitchPod)
+	mux.HandleFunc("/v1/stats", s.handleStats)
+	return localOnly(mux)
+}
+
+// localOnly rejects requests that a web page could forge: the Host header must name a loopback
+// address (defeating DNS rebinding) and request bodies must be JSON, which browsers only send
+// cross-origin after a CORS preflight that this API never approves
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host %s is not allowed", r.Host))
+			return
+		}
+		if r.Method == http.MethodPost && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("request body must be application/json"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleForwards dispatches requests on the forwards collection
+func (s *Server) handleForwards(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listForwards(w)
+	case http.MethodPost:
+		s.addForward(w, r)
+	case http.MethodDelete:
+		s.removeForward(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// listForwards writes the status of every forward
+func (s *Server) listForwards(w http.ResponseWriter) {
+	statuses := s.Manager.GetStatus()
+	forwards := make([]Forward, 0, len(statuses))
+	for _, status := range statuses {
+		forward := Forward{
+			ID:         status.ID,
+			Context:    status.Resource.Context,
+			Namespace:  status.Resource.Namespace,
+			Type:       string(status.Resource.Type),
+			Name:       status.Resource.Name,
+			Pod:        status.PodName,
+			LocalPort:  status.LocalPort,
+			RemotePort: status.RemotePort,
+			State:      string(status.State),
+			URL:        forwardURL(status),
+			Retries:    status.Retries,
+			LastError:  status.LastError,
+		}
+		if lastErrorTime := status.LastErrorTime; !lastErrorTime.IsZero() {
+			forward.LastErrorTime = &lastErrorTime
+		}
+		if connectedSince := status.ConnectedSince; !connectedSince.IsZero() {
+			forward.ConnectedSince = &connectedSince
+			forward.Uptime = time.Since(connectedSince).Round(time.Second).String()
+		}
+		forwards = append(forwards, forward)
+	}
+	writeJSON(w, http.StatusOK, forwards)
+}
+
+// addForward starts forwarding the resource entry in the request body
+func (s *Server) addForward(w http.ResponseWriter, r *http.Request) {
+	var entry config.PortForwardEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := config.ValidateEntry(entry); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Forwards use the session's clients, which impersonate nobody but the session's user
+	if entry.As != "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("impersonating %s is only supported in configuration files", entry.As))
+		return
+	}
+	// Clusters are defined by configuration files; the API forwards from the session's cluster
+	if entry.Cluster != "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("forwarding from cluster %s is only supported in configuration files", entry.Cluster))
+		return
+	}
+
+	resource, err := config.ConvertEntryToResource(entry, s.Namespace)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ids, err := s.Manager.AddForward(resource, config.CreatePortMapping(entry))
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	writeJSON(w, http.StatusCreated, AddResponse{IDs: ids})
+}
+
+// removeForward stops the forward named by the id query parameter, or every forward of the
+// resource named by the resource parameter. It responds once the forwards have shut down and
+// released their local ports. Ports sharing a tunnel can only be stopped together, so stopping
+// a single one of them is refused.
+func (s *Server) removeForward(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id, resource := query.Get("id"), query.Get("resource")
+	switch {
+	case id != "" && resource != "":
+		writeError(w, http.StatusBadRequest, errors.New("pass either an id or a resource parameter"))
+	case id != "":
+		tunnel := s.Manager.TunnelIDs(id)
+		if len(tunnel) > 1 {
+			writeError(w, http.StatusConflict, sharedTunnelError(id, tunnel))
+			return
+		}
+		if err := s.Manager.StopForward(id); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case resource != "":
+		s.stopResource(w, resource)
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("missing id or resource parameter"))
+	}
+}
+
+// stopResource stops the forwards matching the resource reference ref
+func (s *Server) stopResource(w http.ResponseWriter, ref string) {
+	match, err := parseResourceRef(ref)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	matched := make(map[string]bool)
+	for _, status := range s.Manager.GetStatus() {
+		if match.matches(status) {
+			matched[status.ID] = true
+		}
+	}
+	if len(matched) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no forward of %s", ref))
+		return
+	}
+
+	// Stop each tunnel once, refusing references to only some of the ports it carries
+	var tunnels [][]string
+	seen := make(map[string]bool)
+	for _, status := range s.Manager.GetStatus() {
+		if !matched[status.ID] || seen[status.ID] {
+			continue
+		}
+		tunnel := s.Manager.TunnelIDs(status.ID)
+		for _, id := range tunnel {
+			if !matched[id] {
+				writeError(w, http.StatusConflict, sharedTunnelError(status.ID, tunnel))
+				return
+			}
+			seen[id] = true
+		}
+		tunnels = append(tunnels, tunnel)
+	}
+
+	ids := []string{}
+	for _, tunnel := range tunnels {
+		// A forward that ended meanwhile is stopped as well
+		if err := s.Manager.StopForward(tunnel[0]); err != nil && s.Manager.Context.Err() != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		ids = append(ids, tunnel...)
+	}
+	writeJSON(w, http.StatusOK, StopResponse{IDs: ids})
+}
+
+// sharedTunnelError explains that the forward id cannot be stopped on its own because its
+// tunnel carries the ports of all IDs in tunnel
+func sharedTunnelError(id string, tunnel []string) error {
+	var others []string
+	for _, other := range tunnel {
+		if other != id {
+			others = append(others, other)
+		}
+	}
+	return fmt.Errorf("forward %s shares its tunnel with %s and can only be stopped together with them, by resource",
+		id, strings.Join(others, ", "))
+}
+
+// handleSwitchPod moves the forward named in the request body to another backing pod
+func (s *Server) handleSwitchPod(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	var req SwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.ID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing id"))
+		return
+	}
+	pod, err := s.Manager.SwitchPod(req.ID, req.Pod)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SwitchResponse{ID: req.ID, Pod: pod})
+}
+
+// handleStats writes the session statistics
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	statuses := s.Manager.GetStatus()
+	stats := Stats{
+		PID:      os.Getpid(),
+		Started:  s.started,
+		Uptime:   time.Since(s.started).Round(time.Second).String(),
+		Forwards: len(statuses),
+		States:   make(map[string]int),
+	}
+	for _, status := range statuses {
+		stats.States[string(status.State)]++
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err as a JSON error response
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+// forwardURL returns the local URL of a forward, or "" when its scheme is unknown
+func forwardURL(status portforward.ForwardStatus) string {
+	if status.Scheme == "" {
+		return ""
+	}
+	return portforward.LocalAddress(status.Scheme, status.LocalPort)
+}
@@ -0,0 +1,309 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// unreachableDialers simulates a pod that cannot be reached, keeping forwards in the starting state
+type unreachableDialers struct{}
+
+func (unreachableDialers) DialerFor(namespace, podName string) (httpstream.Dialer, error) {
+	return unreachableDialer{}, nil
+}
+
+type unreachableDialer struct{}
+
+func (unreachableDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	return nil, "", errors.New("pod unreachable")
+}
+
+// newTestServer returns a control server over a manager with no reachable pods
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	clientset := fake.NewSimpleClientset()
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := portforward.NewManager(context.Background(), nil, clientset, k8s.NewClientForInterface(clientset, "ns1"), streams)
+	mgr.Dialers = unreachableDialers{}
+	t.Cleanup(mgr.Stop)
+
+	server := NewServer(mgr, "ns1")
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+// freePort returns a local port that is currently unused
+func freePort(t *testing.T) int32 {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	return int32(l.Addr().(*net.TCPAddr).Port)
+}
+
+// TestServer_AddListRemove verifies the forward lifecycle through the API.
+func TestServer_AddListRemove(t *testing.T) {
+	_, ts := newTestServer(t)
+	port := freePort(t)
+
+	body := fmt.Sprintf(`{"resourceType":"pod","name":"web-0","ports":[{"localPort":%d,"remotePort":8080}]}`, port)
+	resp, err := http.Post(ts.URL+"/v1/forwards", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("add request failed: %v", err)
+	}
+	var added AddResponse
+	json.NewDecoder(resp.Body).Decode(&added)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+	wantID := fmt.Sprintf("ns1/pod/web-0:%d", port)
+	if len(added.IDs) != 1 || added.IDs[0] != wantID {
+		t.Fatalf("expected IDs [%s], got %v", wantID, added.IDs)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/forwards")
+	if err != nil {
+		t.Fatalf("list request failed: %v", err)
+	}
+	var forwards []Forward
+	json.NewDecoder(resp.Body).Decode(&forwards)
+	resp.Body.Close()
+	if len(forwards) != 1 || forwards[0].ID != wantID || forwards[0].LocalPort != port {
+		t.Fatalf("unexpected forwards: %+v", forwards)
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/stats")
+	if err != nil {
+		t.Fatalf("stats request failed: %v", err)
+	}
+	var stats Stats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if stats.Forwards != 1 {
+		t.Errorf("expected 1 forward in stats, got %d", stats.Forwards)
+	}
+
+	del := func(id string) int {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/v1/forwards?id="+url.QueryEscape(id), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("delete request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := del(wantID); code != http.StatusNoContent {
+		t.Errorf("expected status 204 removing %s, got %d", wantID, code)
+	}
+	if code := del("ns1/pod/missing:1"); code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown forward, got %d", code)
+	}
+}
+
+// TestServer_AddOtherNamespace verifies that forwards can be added in namespaces other than the
+// session's.
+func TestServer_AddOtherNamespace(t *testing.T) {
+	_, ts := newTestServer(t)
+	port := freePort(t)
+
+	body := fmt.Sprintf(`{"resourceType":"pod","name":"web-0","namespace":"ns2","ports":[{"localPort":%d,"remotePort":8080}]}`, port)
+	resp, err := http.Post(ts.URL+"/v1/forwards", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("add request failed: %v", err)
+	}
+	var added AddResponse
+	json.NewDecoder(resp.Body).Decode(&added)
+	resp.Body.Close()
+	wantID := fmt.Sprintf("ns2/pod/web-0:%d", port)
+	if resp.StatusCode != http.StatusCreated || len(added.IDs) != 1 || added.IDs[0] != wantID {
+		t.Fatalf("expected status 201 and IDs [%s], got %d and %v", wantID, resp.StatusCode, added.IDs)
+	}
+}
+
+// TestServer_StopResource verifies that the forwards of a resource can be stopped by name.
+func TestServer_StopResource(t *testing.T) {
+	_, ts := newTestServer(t)
+	webPort, apiPort := freePort(t), freePort(t)
+	for name, port := range map[string]int32{"web-0": webPort, "api-0": apiPort} {
+		body := fmt.Sprintf(`{"resourceType":"pod","name":"%s","ports":[{"localPort":%d,"remotePort":8080}]}`, name, port)
+		resp, err := http.Post(ts.URL+"/v1/forwards", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("add request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	stop := func(ref string) (int, StopResponse) {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/v1/forwards?resource="+url.QueryEscape(ref), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("stop request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var stopped StopResponse
+		json.NewDecoder(resp.Body).Decode(&stopped)
+		return resp.StatusCode, stopped
+	}
+	for ref, want := range map[string]int{
+		"job/web-0":     http.StatusBadRequest,
+		"web-0":         http.StatusBadRequest,
+		"po/web-0:http": http.StatusBadRequest,
+		"svc/web-0":     http.StatusNotFound,
+		"ns2/pod/web-0": http.StatusNotFound,
+		"pod/web-0:1":   http.StatusNotFound,
+	} {
+		if code, _ := stop(ref); code != want {
+			t.Errorf("expected status %d stopping %s, got %d", want, ref, code)
+		}
+	}
+
+	code, stopped := stop("ns1/po/web-0")
+	wantID := fmt.Sprintf("ns1/pod/web-0:%d", webPort)
+	if code != http.StatusOK || len(stopped.IDs) != 1 || stopped.IDs[0] != wantID {
+		t.Fatalf("expected %s to be stopped, got status %d and %+v", wantID, code, stopped)
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/forwards")
+	if err != nil {
+		t.Fatalf("list request failed: %v", err)
+	}
+	var forwards []Forward
+	json.NewDecoder(resp.Body).Decode(&forwards)
+	resp.Body.Close()
+	if len(forwards) != 1 || forwards[0].Name != "api-0" {
+		t.Errorf("expected only api-0 to remain, got %+v", forwards)
+	}
+}
+
+// TestServer_StopSharedTunnel verifies that a port sharing its tunnel with other ports cannot be
+// stopped on its own, and that stopping the resource reports every port stopped.
+func TestServer_StopSharedTunnel(t *testing.T) {
+	_, ts := newTestServer(t)
+	httpPort, metricsPort := freePort(t), freePort(t)
+	body := fmt.Sprintf(`{"resourceType":"pod","name":"web-0","ports":[{"localPort":%d,"remotePort":8080},{"localPort":%d,"remotePort":9090}]}`, httpPort, metricsPort)
+	resp, err := http.Post(ts.URL+"/v1/forwards", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("add request failed: %v", err)
+	}
+	resp.Body.Close()
+	httpID := fmt.Sprintf("ns1/pod/web-0:%d", httpPort)
+	metricsID := fmt.Sprintf("ns1/pod/web-0:%d", metricsPort)
+
+	remove := func(query string) (int, StopResponse) {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/v1/forwards?"+query, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("stop request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var stopped StopResponse
+		json.NewDecoder(resp.Body).Decode(&stopped)
+		return resp.StatusCode, stopped
+	}
+	for _, query := range []string{
+		"id=" + url.QueryEscape(metricsID),
+		"resource=" + url.QueryEscape(fmt.Sprintf("pod/web-0:%d", metricsPort)),
+	} {
+		if code, _ := remove(query); code != http.StatusConflict {
+			t.Errorf("expected status %d stopping with %s, got %d", http.StatusConflict, query, code)
+		}
+	}
+
+	code, stopped := remove("resource=pod/web-0")
+	if code != http.StatusOK || len(stopped.IDs) != 2 || stopped.IDs[0] != httpID || stopped.IDs[1] != metricsID {
+		t.Errorf("expected %s and %s to be stopped, got status %d and %+v", httpID, metricsID, code, stopped)
+	}
+}
+
+// TestServer_RejectsInvalidRequests verifies validation of add and switch requests and the
+// local-only guards.
+func TestServer_RejectsInvalidRequests(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        int
+	}{
+		{"invalid type", `{"resourceType":"job","name":"x","ports":[{"remotePort":80}]}`, "application/json", http.StatusBadRequest},
+		{"impersonation", `{"resourceType":"pod","name":"x","as":"system:serviceaccount:ns1:sa","ports":[{"remotePort":80}]}`, "application/json", http.StatusBadRequest},
+		{"other cluster", `{"resourceType":"pod","name":"x","cluster":"prod","ports":[{"remotePort":80}]}`, "application/json", http.StatusBadRequest},
+		{"malformed", `{`, "application/json", http.StatusBadRequest},
+		{"form post", `{"resourceType":"pod","name":"x","ports":[{"remotePort":80}]}`, "text/plain", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+"/v1/forwards", tt.contentType, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+
+	switches := map[string]int{
+		`{"pod":"web-1"}`:               http.StatusBadRequest,
+		`{"id":"ns1/service/web:8080"}`: http.StatusConflict,
+		`{"id":"ns1/service/web:8080",`: http.StatusBadRequest,
+	}
+	for body, want := range switches {
+		resp, err := http.Post(ts.URL+"/v1/forwards/pod", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("expected status %d switching with %s, got %d", want, body, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/forwards", nil)
+	req.Host = "attacker.example:80"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403 for a foreign Host header, got %d", resp.StatusCode)
+	}
+}
+
+// TestServer_StartRequiresLoopback verifies that the API cannot be exposed beyond localhost.
+func TestServer_StartRequiresLoopback(t *testing.T) {
+	server, _ := newTestServer(t)
+	if err := server.Start("0.0.0.0:0"); err == nil {
+		server.Close()
+		t.Fatal("expected an error for a non-loopback address")
+	}
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer server.Close()
+	if server.Addr() == "" {
+		t.Error("expected the listening address to be reported")
+	}
+}
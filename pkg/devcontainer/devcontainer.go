@@ -0,0 +1,208 @@
+// Package devcontainer adds forwarded ports to VS Code dev container configurations, so ports
+// forwarded inside a dev container are listed and labeled by VS Code.
+package devcontainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// DefaultPath is where VS Code looks for the dev container configuration of a workspace
+const DefaultPath = ".devcontainer/devcontainer.json"
+
+// ErrComments is returned for configurations with comments, which rewriting would drop
+var ErrComments = errors.New("the file contains comments that rewriting it would drop")
+
+// Port is a local port to surface in VS Code
+type Port struct {
+	Number int32
+	// Label is shown next to the port in the Ports view
+	Label string
+}
+
+// Fragment returns the forwardPorts and portsAttributes properties for ports as a JSON object
+// to paste into a configuration
+func Fragment(ports []Port) ([]byte, error) {
+	attributes := make(map[string]interface{}, len(ports))
+	numbers := make([]interface{}, 0, len(ports))
+	for _, port := range sortedPorts(ports) {
+		numbers = append(numbers, port.Number)
+		attributes[strconv.Itoa(int(port.Number))] = map[string]interface{}{"label": port.Label}
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"forwardPorts":    numbers,
+		"portsAttributes": attributes,
+	}, "", "\t")
+}
+
+// Merge adds ports to the forwardPorts and portsAttributes of the configuration doc. Other
+// properties keep their order, ports listed already are kept and attributes other than the
+// label are preserved. Configurations with comments are rejected with ErrComments.
+func Merge(doc []byte, ports []Port) ([]byte, error) {
+	if hasComments(doc) {
+		return nil, ErrComments
+	}
+	properties, err := parseObject(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var forwardPorts []interface{}
+	attributes := make(map[string]interface{})
+	for _, property := range properties {
+		switch property.key {
+		case "forwardPorts":
+			if err := json.Unmarshal(property.value, &forwardPorts); err != nil {
+				return nil, fmt.Errorf("invalid forwardPorts: %w", err)
+			}
+		case "portsAttributes":
+			if err := json.Unmarshal(property.value, &attributes); err != nil {
+				return nil, fmt.Errorf("invalid portsAttributes: %w", err)
+			}
+		}
+	}
+
+	for _, port := range sortedPorts(ports) {
+		if !listsPort(forwardPorts, port.Number) {
+			forwardPorts = append(forwardPorts, port.Number)
+		}
+		key := strconv.Itoa(int(port.Number))
+		attribute, ok := attributes[key].(map[string]interface{})
+		if !ok {
+			attribute = make(map[string]interface{})
+		}
+		attribute["label"] = port.Label
+		attributes[key] = attribute
+	}
+
+	if properties, err = setProperty(properties, "forwardPorts", forwardPorts); err != nil {
+		return nil, err
+	}
+	if properties, err = setProperty(properties, "portsAttributes", attributes); err != nil {
+		return nil, err
+	}
+	return formatObject(properties)
+}
+
+// sortedPorts returns ports ordered by number
+func sortedPorts(ports []Port) []Port {
+	sorted := make([]Port, len(ports))
+	copy(sorted, ports)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Number < sorted[j].Number })
+	return sorted
+}
+
+// listsPort reports whether forwardPorts contains port, either as a number or as the string
+// form VS Code also accepts
+func listsPort(forwardPorts []interface{}, port int32) bool {
+	for _, existing := range forwardPorts {
+		switch v := existing.(type) {
+		case float64:
+			if int32(v) == port {
+				return true
+			}
+		case string:
+			if v == strconv.Itoa(int(port)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// property is a top-level property of a configuration
+type property struct {
+	key   string
+	value json.RawMessage
+}
+
+// parseObject splits a JSON object into its properties, keeping their order
+func parseObject(doc []byte) ([]property, error) {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	var properties []property
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid JSON: unexpected %v", token)
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", key, err)
+		}
+		properties = append(properties, property{key: key, value: value})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return properties, nil
+}
+
+// setProperty replaces the value of key, or appends the property if it is missing
+func setProperty(properties []property, key string, value interface{}) ([]property, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	for i := range properties {
+		if properties[i].key == key {
+			properties[i].value = raw
+			return properties, nil
+		}
+	}
+	return append(properties, property{key: key, value: raw}), nil
+}
+
+// formatObject writes properties as a tab-indented JSON object, the style of VS Code's
+// dev container templates
+func formatObject(properties []property) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, p := range properties {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(p.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(p.value)
+	}
+	buf.WriteByte('}')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "\t"); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// hasComments reports whether a JSON with comments document contains // or /* comments
+// outside of strings
+func hasComments(doc []byte) bool {
+	inString := false
+	for i := 0; i < len(doc); i++ {
+		switch c := doc[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString && c == '/' && i+1 < len(doc) && (doc[i+1] == '/' || doc[i+1] == '*'):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package devcontainer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestMerge verifies that ports are added without disturbing the rest of the configuration.
+func TestMerge(t *testing.T) {
+	doc := []byte(`{
+	"name": "api",
+	"image": "mcr.microsoft.com/devcontainers/go:1",
+	"forwardPorts": [3000, "5432"],
+	"portsAttributes": {"5432": {"label": "db", "onAutoForward": "silent"}}
+}`)
+	ports := []Port{{Number: 8080, Label: "service apps/web"}, {Number: 5432, Label: "service data/postgres"}}
+
+	merged, err := Merge(doc, ports)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{
+	"name": "api",
+	"image": "mcr.microsoft.com/devcontainers/go:1",
+	"forwardPorts": [
+		3000,
+		"5432",
+		8080
+	],
+	"portsAttributes": {
+		"5432": {
+			"label": "service data/postgres",
+			"onAutoForward": "silent"
+		},
+		"8080": {
+			"label": "service apps/web"
+		}
+	}
+}
+`
+	if string(merged) != want {
+		t.Errorf("unexpected configuration:\n%s\nwant:\n%s", merged, want)
+	}
+}
+
+// TestMerge_AddsMissingProperties verifies that configurations without ports get both properties.
+func TestMerge_AddsMissingProperties(t *testing.T) {
+	merged, err := Merge([]byte(`{"image": "debian"}`), []Port{{Number: 6379, Label: "pod cache/redis-0"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{`"forwardPorts": [`, `6379`, `"label": "pod cache/redis-0"`} {
+		if !strings.Contains(string(merged), want) {
+			t.Errorf("expected %s in:\n%s", want, merged)
+		}
+	}
+}
+
+// TestMerge_RejectsComments verifies that commented configurations are left alone, while
+// comment-like text in strings is fine.
+func TestMerge_RejectsComments(t *testing.T) {
+	commented := []byte("{\n\t// Go toolchain\n\t\"image\": \"golang\"\n}")
+	if _, err := Merge(commented, []Port{{Number: 80}}); !errors.Is(err, ErrComments) {
+		t.Errorf("expected ErrComments, got %v", err)
+	}
+	url := []byte(`{"image": "https://registry.example.com/go", "name": "a \"quoted\" /* name"}`)
+	if _, err := Merge(url, []Port{{Number: 80}}); err != nil {
+		t.Errorf("unexpected error for URLs in strings: %v", err)
+	}
+}
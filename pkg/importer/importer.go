@@ -0,0 +1,206 @@
+// Package importer reads the port-forwarding setups of other tools, kubefwd invocations and
+// telepresence intercept commands, so they can be converted into kubectl-pfw configurations.
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Kubefwd is a parsed kubefwd invocation
+type Kubefwd struct {
+	// Namespaces whose services are forwarded; empty for the current namespace
+	Namespaces []string
+	// AllNamespaces forwards the services of every namespace
+	AllNamespaces bool
+	LabelSelector string
+	FieldSelector string
+	// Context is the kubeconfig context; empty for the current context
+	Context string
+	// Kubeconfig is the kubeconfig file; empty for the default one
+	Kubeconfig string
+	// Mappings maps service ports to the local ports they are forwarded on
+	Mappings map[int32]int32
+}
+
+// ParseKubefwd parses the arguments of a kubefwd invocation, such as
+// "sudo -E kubefwd svc -n staging -l app=api -m 80:8080". Leading "sudo" and "kubefwd" words
+// are skipped and flags that do not affect which ports are forwarded are ignored.
+func ParseKubefwd(args []string) (Kubefwd, error) {
+	args = skipCommand(args, "kubefwd")
+	if len(args) == 0 || (args[0] != "svc" && args[0] != "services") {
+		return Kubefwd{}, fmt.Errorf("expected a kubefwd svc invocation")
+	}
+
+	fs := pflag.NewFlagSet("kubefwd", pflag.ContinueOnError)
+	fs.ParseErrorsWhitelist.UnknownFlags = true
+	fs.SetOutput(io.Discard)
+	namespaces := fs.StringSliceP("namespace", "n", nil, "")
+	allNamespaces := fs.BoolP("all-namespaces", "A", false, "")
+	labelSelector := fs.StringP("selector", "l", "", "")
+	fieldSelector := fs.StringP("field-selector", "f", "", "")
+	contexts := fs.StringSliceP("context", "x", nil, "")
+	kubeconfig := fs.StringP("kubeconfig", "c", "", "")
+	mappings := fs.StringSliceP("mapping", "m", nil, "")
+	fs.BoolP("verbose", "v", false, "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return Kubefwd{}, fmt.Errorf("failed to parse kubefwd arguments: %w", err)
+	}
+
+	if len(*contexts) > 1 {
+		return Kubefwd{}, fmt.Errorf("kubefwd forwards %d contexts; import each context separately", len(*contexts))
+	}
+	result := Kubefwd{
+		Namespaces:    *namespaces,
+		AllNamespaces: *allNamespaces,
+		LabelSelector: *labelSelector,
+		FieldSelector: *fieldSelector,
+		Kubeconfig:    *kubeconfig,
+		Mappings:      make(map[int32]int32, len(*mappings)),
+	}
+	if len(*contexts) == 1 {
+		result.Context = (*contexts)[0]
+	}
+	for _, mapping := range *mappings {
+		servicePort, localPort, ok := strings.Cut(mapping, ":")
+		if !ok {
+			return Kubefwd{}, fmt.Errorf("invalid mapping '%s', must be <service port>:<local port>", mapping)
+		}
+		remote, err := parsePort(servicePort)
+		if err != nil {
+			return Kubefwd{}, fmt.Errorf("invalid mapping '%s': %w", mapping, err)
+		}
+		local, err := parsePort(localPort)
+		if err != nil {
+			return Kubefwd{}, fmt.Errorf("invalid mapping '%s': %w", mapping, err)
+		}
+		result.Mappings[remote] = local
+	}
+	return result, nil
+}
+
+// Intercept is a parsed telepresence intercept command
+type Intercept struct {
+	// Workload is the intercepted deployment, replicaset or statefulset
+	Workload string
+	// Service is the service whose port is intercepted; empty when the workload has a single service
+	Service string
+	// Namespace is empty for the current namespace
+	Namespace string
+	// Context is empty for the current context
+	Context string
+	// LocalPort is the local port the intercepted traffic was sent to
+	LocalPort int32
+	// Port names or numbers the intercepted service port; empty when the service has a single port
+	Port string
+}
+
+// ParseIntercepts reads telepresence intercept commands, one per line, such as
+// "telepresence intercept api --port 8080:http -n staging". Lines ending with a backslash are
+// continued on the next line; blank lines, comments and other telepresence commands are skipped.
+func ParseIntercepts(r io.Reader) ([]Intercept, error) {
+	var intercepts []Intercept
+	scanner := bufio.NewScanner(r)
+	line, command := 0, ""
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasSuffix(text, "\\") {
+			command += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		command += text
+		if command == "" || strings.HasPrefix(command, "#") {
+			command = ""
+			continue
+		}
+
+		intercept, ok, err := parseIntercept(strings.Fields(command))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ok {
+			intercepts = append(intercepts, intercept)
+		}
+		command = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read intercepts: %w", err)
+	}
+	if len(intercepts) == 0 {
+		return nil, fmt.Errorf("no telepresence intercept commands found")
+	}
+	return intercepts, nil
+}
+
+// parseIntercept parses a single command and reports whether it is an intercept
+func parseIntercept(args []string) (Intercept, bool, error) {
+	args = skipCommand(args, "telepresence")
+	if len(args) == 0 || args[0] != "intercept" {
+		return Intercept{}, false, nil
+	}
+
+	fs := pflag.NewFlagSet("intercept", pflag.ContinueOnError)
+	fs.ParseErrorsWhitelist.UnknownFlags = true
+	fs.SetOutput(io.Discard)
+	port := fs.StringP("port", "p", "", "")
+	namespace := fs.StringP("namespace", "n", "", "")
+	workload := fs.StringP("workload", "w", "", "")
+	service := fs.String("service", "", "")
+	contextName := fs.String("context", "", "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return Intercept{}, false, fmt.Errorf("failed to parse intercept arguments: %w", err)
+	}
+	if fs.NArg() == 0 {
+		return Intercept{}, false, fmt.Errorf("intercept name is missing")
+	}
+
+	intercept := Intercept{
+		Workload:  fs.Arg(0),
+		Service:   *service,
+		Namespace: *namespace,
+		Context:   *contextName,
+		LocalPort: 8080, // telepresence's default local port
+	}
+	if *workload != "" {
+		intercept.Workload = *workload
+	}
+	if *port != "" {
+		local, identifier, _ := strings.Cut(*port, ":")
+		localPort, err := parsePort(local)
+		if err != nil {
+			return Intercept{}, false, fmt.Errorf("invalid --port '%s': %w", *port, err)
+		}
+		intercept.LocalPort = localPort
+		intercept.Port = identifier
+	}
+	return intercept, true, nil
+}
+
+// skipCommand drops a leading "sudo" with its flags and the command name from args
+func skipCommand(args []string, name string) []string {
+	if len(args) > 0 && args[0] == "sudo" {
+		args = args[1:]
+		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+			args = args[1:]
+		}
+	}
+	if len(args) > 0 && (args[0] == name || strings.HasSuffix(args[0], "/"+name)) {
+		args = args[1:]
+	}
+	return args
+}
+
+// parsePort parses a port number between 1 and 65535
+func parsePort(s string) (int32, error) {
+	port, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("'%s' is not a port between 1 and 65535", s)
+	}
+	return int32(port), nil
+}
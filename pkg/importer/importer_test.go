@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseKubefwd verifies that namespaces, selectors, the context and port mappings are read
+// from a kubefwd invocation.
+func TestParseKubefwd(t *testing.T) {
+	args := strings.Fields("sudo -E kubefwd svc -n staging -n payments -l app=api -f metadata.name!=debug -x prod -m 80:8080 --mapping 443:8443 -d example.com -v")
+	got, err := ParseKubefwd(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Kubefwd{
+		Namespaces:    []string{"staging", "payments"},
+		LabelSelector: "app=api",
+		FieldSelector: "metadata.name!=debug",
+		Context:       "prod",
+		Mappings:      map[int32]int32{80: 8080, 443: 8443},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// TestParseKubefwd_Invalid verifies that invocations that cannot be converted are rejected.
+func TestParseKubefwd_Invalid(t *testing.T) {
+	tests := []string{
+		"kubefwd version",
+		"kubefwd svc -m 80",
+		"kubefwd svc -m 80:http",
+		"kubefwd svc -x dev -x prod",
+	}
+	for _, test := range tests {
+		if _, err := ParseKubefwd(strings.Fields(test)); err == nil {
+			t.Errorf("%q: expected an error", test)
+		}
+	}
+}
+
+// TestParseIntercepts verifies that intercept commands are read and other lines are skipped.
+func TestParseIntercepts(t *testing.T) {
+	input := `#!/bin/sh
+telepresence connect --context prod
+
+# API and its worker
+telepresence intercept api --port 9000:http -n staging
+telepresence intercept worker-intercept --workload worker \
+    --service worker-metrics --port 9100 --context prod -- ./run.sh
+telepresence intercept web
+`
+	got, err := ParseIntercepts(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Intercept{
+		{Workload: "api", Namespace: "staging", LocalPort: 9000, Port: "http"},
+		{Workload: "worker", Service: "worker-metrics", Context: "prod", LocalPort: 9100},
+		{Workload: "web", LocalPort: 8080},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// TestParseIntercepts_Invalid verifies that malformed intercepts and inputs without intercepts
+// are rejected.
+func TestParseIntercepts_Invalid(t *testing.T) {
+	tests := []string{
+		"telepresence intercept api --port http",
+		"telepresence intercept --port 8080",
+		"telepresence connect",
+	}
+	for _, test := range tests {
+		if _, err := ParseIntercepts(strings.NewReader(test)); err == nil {
+			t.Errorf("%q: expected an error", test)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Permission is an API action kubectl-pfw may need in a namespace
+type Permission struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+}
+
+// String formats the permission the way `kubectl auth can-i` expects it
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	if p.Subresource != "" {
+		resource += "/" + p.Subresource
+	}
+	return p.Verb + " " + resource
+}
+
+// PortForwardPermission is required to open any tunnel
+var PortForwardPermission = Permission{Verb: "create", Resource: "pods", Subresource: "portforward"}
+
+// AccessResult is the outcome of a permission check
+type AccessResult struct {
+	Permission Permission
+	Namespace  string
+	Allowed    bool
+	// Reason is the authorizer's explanation, if any
+	Reason string
+}
+
+// CheckAccess asks the API server whether the current user holds each permission in namespace
+// using SelfSubjectAccessReviews
+func (c *Client) CheckAccess(ctx context.Context, namespace string, permissions []Permission) ([]AccessResult, error) {
+	results := make([]AccessResult, 0, len(permissions))
+	for _, p := range permissions {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   namespace,
+					Verb:        p.Verb,
+					Group:       p.Group,
+					Resource:    p.Resource,
+					Subresource: p.Subresource,
+				},
+			},
+		}
+		resp, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check permission to %s: %w", p, err)
+		}
+		results = append(results, AccessResult{
+			Permission: p,
+			Namespace:  namespace,
+			Allowed:    resp.Status.Allowed,
+			Reason:     strings.TrimSpace(resp.Status.Reason),
+		})
+	}
+	return results, nil
+}
+
+// AccessDeniedError lists the permissions missing in a namespace
+type AccessDeniedError struct {
+	Namespace string
+	Denied    []AccessResult
+}
+
+func (e *AccessDeniedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "missing permissions in namespace %s:", e.Namespace)
+	for _, result := range e.Denied {
+		fmt.Fprintf(&b, "\n  - %s", result.Permission)
+		if result.Reason != "" {
+			fmt.Fprintf(&b, " (%s)", result.Reason)
+		}
+	}
+	fmt.Fprintf(&b, "\nask a cluster administrator to grant them, or verify with `kubectl auth can-i %s -n %s`",
+		e.Denied[0].Permission, e.Namespace)
+	return b.String()
+}
+
+// RequireAccess checks the permissions in namespace and returns an *AccessDeniedError naming
+// every permission that is missing
+func (c *Client) RequireAccess(ctx context.Context, namespace string, permissions []Permission) error {
+	results, err := c.CheckAccess(ctx, namespace, permissions)
+	if err != nil {
+		return err
+	}
+
+	var denied []AccessResult
+	for _, result := range results {
+		if !result.Allowed {
+			denied = append(denied, result)
+		}
+	}
+	if len(denied) > 0 {
+		return &AccessDeniedError{Namespace: namespace, Denied: denied}
+	}
+	return nil
+}
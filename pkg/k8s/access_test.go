@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newAccessClient returns a client whose access reviews allow only the given permissions
+func newAccessClient(allowed ...Permission) *Client {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		requested := Permission{Verb: attrs.Verb, Group: attrs.Group, Resource: attrs.Resource, Subresource: attrs.Subresource}
+		for _, p := range allowed {
+			if p == requested {
+				review.Status.Allowed = true
+			}
+		}
+		if !review.Status.Allowed {
+			review.Status.Reason = "no RBAC policy matched"
+		}
+		return true, review, nil
+	})
+	return NewClientForInterface(clientset, "default")
+}
+
+// TestRequireAccess verifies that every missing permission is reported.
+func TestRequireAccess(t *testing.T) {
+	listPods := Permission{Verb: "list", Resource: "pods"}
+	getServices := Permission{Verb: "get", Resource: "services"}
+	client := newAccessClient(listPods)
+
+	if err := client.RequireAccess(context.Background(), "apps", []Permission{listPods}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := client.RequireAccess(context.Background(), "apps", []Permission{PortForwardPermission, listPods, getServices})
+	var denied *AccessDeniedError
+	if !errors.As(err, &denied) {
+		t.Fatalf("expected *AccessDeniedError, got %v", err)
+	}
+	if denied.Namespace != "apps" || len(denied.Denied) != 2 {
+		t.Fatalf("expected 2 denied permissions in apps, got %+v", denied)
+	}
+	for _, want := range []string{"create pods/portforward", "get services", "no RBAC policy matched", "-n apps"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got:\n%s", want, err)
+		}
+	}
+}
+
+// TestPermissionString verifies the kubectl auth can-i formatting.
+func TestPermissionString(t *testing.T) {
+	tests := []struct {
+		p    Permission
+		want string
+	}{
+		{PortForwardPermission, "create pods/portforward"},
+		{Permission{Verb: "list", Group: "apps", Resource: "deployments"}, "list deployments.apps"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.String(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PortsAnnotation advertises forwardable ports that are not declared in a pod's containers or
+// a service's spec, e.g. "8080,metrics:9090". Many images listen on ports their manifests omit.
+const PortsAnnotation = "pfw.dev/ports"
+
+// AnnotatedPort is a port advertised with PortsAnnotation
+type AnnotatedPort struct {
+	Name string
+	Port int32
+}
+
+// ParsePortsAnnotation parses a comma-separated list of [name:]port entries. Malformed entries
+// are skipped so a typo in one manifest never hides a resource.
+func ParsePortsAnnotation(value string) []AnnotatedPort {
+	var ports []AnnotatedPort
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, number := "", entry
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			name, number = strings.TrimSpace(entry[:i]), entry[i+1:]
+		}
+		port, ok := parsePort(number)
+		if !ok {
+			continue
+		}
+		ports = append(ports, AnnotatedPort{Name: name, Port: port})
+	}
+	return ports
+}
+
+// LocalPortAnnotation recommends local ports for a resource's ports, either one port for the
+// first declared port ("15432") or remote:local pairs ("5432:15432,8080:18080")
+const LocalPortAnnotation = "pfw.dev/local-port"
+
+// parseLocalPortAnnotation returns the local ports recommended by value keyed by remote port.
+// firstPort is the port a single unpaired local port applies to. Malformed entries are skipped.
+func parseLocalPortAnnotation(value string, firstPort int32) map[int32]int32 {
+	var localPorts map[int32]int32
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		remote, local := firstPort, entry
+		if i := strings.Index(entry, ":"); i >= 0 {
+			port, ok := parsePort(entry[:i])
+			if !ok {
+				continue
+			}
+			remote, local = port, entry[i+1:]
+		}
+		port, ok := parsePort(local)
+		if !ok || remote == 0 {
+			continue
+		}
+		if localPorts == nil {
+			localPorts = make(map[int32]int32)
+		}
+		localPorts[remote] = port
+	}
+	return localPorts
+}
+
+// parsePort parses a port number between 1 and 65535
+func parsePort(s string) (int32, bool) {
+	port, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, false
+	}
+	return int32(port), true
+}
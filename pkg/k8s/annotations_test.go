@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TestParsePortsAnnotation verifies named and unnamed entries and that malformed ones are skipped.
+func TestParsePortsAnnotation(t *testing.T) {
+	got := ParsePortsAnnotation(" 8080, metrics:9090,,http:abc,70000")
+	want := []AnnotatedPort{{Port: 8080}, {Name: "metrics", Port: 9090}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+// TestNewPod_AnnotatedPorts verifies that annotated ports are merged with declared container ports.
+func TestNewPod_AnnotatedPorts(t *testing.T) {
+	pod := newTestPod(true, 0, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})
+	pod.Annotations = map[string]string{PortsAnnotation: "8080,debug:6060"}
+
+	converted := newPod(pod)
+	if len(converted.Ports) != 2 {
+		t.Fatalf("expected the declared and one annotated port, got %+v", converted.Ports)
+	}
+	if port := converted.Ports[1]; port.Name != "debug" || port.ContainerPort != 6060 || port.Protocol != "TCP" {
+		t.Errorf("unexpected annotated port %+v", port)
+	}
+}
+
+// TestParseLocalPortAnnotation verifies single ports and remote:local pairs.
+func TestParseLocalPortAnnotation(t *testing.T) {
+	if got := parseLocalPortAnnotation("15432", 5432); !reflect.DeepEqual(got, map[int32]int32{5432: 15432}) {
+		t.Errorf("unexpected local ports %v", got)
+	}
+	got := parseLocalPortAnnotation("5432:15432, 8080:18080,x:1,9090:0", 5432)
+	if !reflect.DeepEqual(got, map[int32]int32{5432: 15432, 8080: 18080}) {
+		t.Errorf("unexpected local ports %v", got)
+	}
+	if got := parseLocalPortAnnotation("", 5432); got != nil {
+		t.Errorf("expected no local ports, got %v", got)
+	}
+}
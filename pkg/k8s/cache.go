@@ -0,0 +1,386 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ListPageSize is the maximum number of items requested per page when listing directly from the API server
+const ListPageSize int64 = 500
+
+// SetListProgress registers a callback invoked after each page of a direct list call with the
+// resource kind and the number of items received so far
+func (c *Client) SetListProgress(fn func(kind string, count int)) {
+	c.listProgress = fn
+}
+
+// reportListProgress forwards paging progress to the registered callback, if any
+func (c *Client) reportListProgress(kind string, count int) {
+	if c.listProgress != nil {
+		c.listProgress(kind, count)
+	}
+}
+
+// SetListFilter restricts top-level resource listings to objects matching the given label and
+// field selectors. The selectors are sent to the API server so large namespaces are filtered
+// server-side; empty strings clear the filter.
+func (c *Client) SetListFilter(labelSelector, fieldSelector string) error {
+	ls, err := labels.Parse(labelSelector)
+	if err != nil {
+		return fmt.Errorf("invalid label selector %q: %w", labelSelector, err)
+	}
+	fs, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return fmt.Errorf("invalid field selector %q: %w", fieldSelector, err)
+	}
+
+	c.labelSelector = ls
+	c.fieldSelector = fs
+	return nil
+}
+
+// filterListOptions returns paged list options carrying the configured filters
+func (c *Client) filterListOptions() metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: c.labelSelector.String(),
+		FieldSelector: c.fieldSelector.String(),
+		Limit:         ListPageSize,
+	}
+}
+
+// objectFields returns the generic field set supported by every resource kind
+func objectFields(meta *metav1.ObjectMeta) fields.Set {
+	return fields.Set{
+		"metadata.name":      meta.Name,
+		"metadata.namespace": meta.Namespace,
+	}
+}
+
+// podFields returns the field set used to evaluate field selectors against cached pods
+func podFields(pod *corev1.Pod) fields.Set {
+	set := objectFields(&pod.ObjectMeta)
+	set["spec.nodeName"] = pod.Spec.NodeName
+	set["status.phase"] = string(pod.Status.Phase)
+	return set
+}
+
+// resourceCache holds shared informers and listers for a single namespace
+type resourceCache struct {
+	factory      informers.SharedInformerFactory
+	pods         corelisters.PodLister
+	services     corelisters.ServiceLister
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+	// synced tracks which informers have completed their initial sync
+	synced map[string]cache.InformerSynced
+	mu     sync.Mutex
+}
+
+// EnableCache switches the client to informer-backed listings. Informers are created lazily
+// per namespace and kind on first use and run until ctx is done.
+func (c *Client) EnableCache(ctx context.Context) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.cacheCtx = ctx
+	c.caches = make(map[string]*resourceCache)
+}
+
+// cacheFor returns the resource cache for a namespace, or nil if caching is disabled
+func (c *Client) cacheFor(namespace string) *resourceCache {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	if c.caches == nil {
+		return nil
+	}
+
+	rc, ok := c.caches[namespace]
+	if !ok {
+		factory := informers.NewSharedInformerFactoryWithOptions(c.clientset, 0, informers.WithNamespace(namespace))
+		rc = &resourceCache{
+			factory: factory,
+			synced:  make(map[string]cache.InformerSynced),
+		}
+		c.caches[namespace] = rc
+	}
+	return rc
+}
+
+// ensureSynced registers the informer for the given kind, starts it and waits for the initial sync
+func (c *Client) ensureSynced(ctx context.Context, rc *resourceCache, kind string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, ok := rc.synced[kind]; !ok {
+		var informer cache.SharedIndexInformer
+		switch kind {
+		case "pods":
+			rc.pods = rc.factory.Core().V1().Pods().Lister()
+			informer = rc.factory.Core().V1().Pods().Informer()
+		case "services":
+			rc.services = rc.factory.Core().V1().Services().Lister()
+			informer = rc.factory.Core().V1().Services().Informer()
+		case "deployments":
+			rc.deployments = rc.factory.Apps().V1().Deployments().Lister()
+			informer = rc.factory.Apps().V1().Deployments().Informer()
+		case "statefulsets":
+			rc.statefulSets = rc.factory.Apps().V1().StatefulSets().Lister()
+			informer = rc.factory.Apps().V1().StatefulSets().Informer()
+		default:
+			return fmt.Errorf("unsupported cache kind: %s", kind)
+		}
+		rc.synced[kind] = informer.HasSynced
+		// Start only launches informers that are not running yet
+		rc.factory.Start(c.cacheCtx.Done())
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), rc.synced[kind]) {
+		return fmt.Errorf("timed out waiting for %s cache to sync", kind)
+	}
+	return nil
+}
+
+// listPods lists pods in namespace matching the label and field selectors
+func (c *Client) listPods(ctx context.Context, namespace string, selector labels.Selector, fieldSelector fields.Selector) ([]corev1.Pod, error) {
+	if rc := c.cacheFor(namespace); rc != nil {
+		if err := c.ensureSynced(ctx, rc, "pods"); err != nil {
+			return nil, err
+		}
+		objs, err := rc.pods.Pods(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		pods := make([]corev1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			if fieldSelector.Matches(podFields(obj)) {
+				pods = append(pods, *obj)
+			}
+		}
+		sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+		return pods, nil
+	}
+
+	var pods []corev1.Pod
+	opts := metav1.ListOptions{LabelSelector: selector.String(), FieldSelector: fieldSelector.String(), Limit: ListPageSize}
+	for {
+		var page *corev1.PodList
+		err := retryTransient(ctx, func() (err error) {
+			page, err = c.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, page.Items...)
+		c.reportListProgress("pods", len(pods))
+		if page.Continue == "" {
+			return pods, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// listServices lists all services in namespace
+func (c *Client) listServices(ctx context.Context, namespace string) ([]corev1.Service, error) {
+	if rc := c.cacheFor(namespace); rc != nil {
+		if err := c.ensureSynced(ctx, rc, "services"); err != nil {
+			return nil, err
+		}
+		objs, err := rc.services.Services(namespace).List(c.labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		services := make([]corev1.Service, 0, len(objs))
+		for _, obj := range objs {
+			if c.fieldSelector.Matches(objectFields(&obj.ObjectMeta)) {
+				services = append(services, *obj)
+			}
+		}
+		sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+		return services, nil
+	}
+
+	var services []corev1.Service
+	opts := c.filterListOptions()
+	for {
+		var page *corev1.ServiceList
+		err := retryTransient(ctx, func() (err error) {
+			page, err = c.clientset.CoreV1().Services(namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, page.Items...)
+		c.reportListProgress("services", len(services))
+		if page.Continue == "" {
+			return services, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// listEndpointSlices lists all endpoint slices in namespace. They are only used to
+// annotate the selection list, so they are always listed directly: an informer would block
+// forever if watching them is forbidden.
+func (c *Client) listEndpointSlices(ctx context.Context, namespace string) ([]discoveryv1.EndpointSlice, error) {
+	var slices []discoveryv1.EndpointSlice
+	opts := metav1.ListOptions{Limit: ListPageSize}
+	for {
+		var page *discoveryv1.EndpointSliceList
+		err := retryTransient(ctx, func() (err error) {
+			page, err = c.clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		slices = append(slices, page.Items...)
+		if page.Continue == "" {
+			return slices, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// getService fetches a single service in namespace
+func (c *Client) getService(ctx context.Context, namespace, name string) (*corev1.Service, error) {
+	if rc := c.cacheFor(namespace); rc != nil {
+		if err := c.ensureSynced(ctx, rc, "services"); err != nil {
+			return nil, err
+		}
+		return rc.services.Services(namespace).Get(name)
+	}
+	var obj *corev1.Service
+	err := retryTransient(ctx, func() (err error) {
+		obj, err = c.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return obj, err
+}
+
+// listDeployments lists all deployments in namespace
+func (c *Client) listDeployments(ctx context.Context, namespace string) ([]appsv1.Deployment, error) {
+	if rc := c.cacheFor(namespace); rc != nil {
+		if err := c.ensureSynced(ctx, rc, "deployments"); err != nil {
+			return nil, err
+		}
+		objs, err := rc.deployments.Deployments(namespace).List(c.labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		deployments := make([]appsv1.Deployment, 0, len(objs))
+		for _, obj := range objs {
+			if c.fieldSelector.Matches(objectFields(&obj.ObjectMeta)) {
+				deployments = append(deployments, *obj)
+			}
+		}
+		sort.Slice(deployments, func(i, j int) bool { return deployments[i].Name < deployments[j].Name })
+		return deployments, nil
+	}
+
+	var deployments []appsv1.Deployment
+	opts := c.filterListOptions()
+	for {
+		var page *appsv1.DeploymentList
+		err := retryTransient(ctx, func() (err error) {
+			page, err = c.clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, page.Items...)
+		c.reportListProgress("deployments", len(deployments))
+		if page.Continue == "" {
+			return deployments, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// getDeployment fetches a single deployment in namespace
+func (c *Client) getDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	if rc := c.cacheFor(namespace); rc != nil {
+		if err := c.ensureSynced(ctx, rc, "deployments"); err != nil {
+			return nil, err
+		}
+		return rc.deployments.Deployments(namespace).Get(name)
+	}
+	var obj *appsv1.Deployment
+	err := retryTransient(ctx, func() (err error) {
+		obj, err = c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return obj, err
+}
+
+// listStatefulSets lists all statefulsets in namespace
+func (c *Client) listStatefulSets(ctx context.Context, namespace string) ([]appsv1.StatefulSet, error) {
+	if rc := c.cacheFor(namespace); rc != nil {
+		if err := c.ensureSynced(ctx, rc, "statefulsets"); err != nil {
+			return nil, err
+		}
+		objs, err := rc.statefulSets.StatefulSets(namespace).List(c.labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		statefulSets := make([]appsv1.StatefulSet, 0, len(objs))
+		for _, obj := range objs {
+			if c.fieldSelector.Matches(objectFields(&obj.ObjectMeta)) {
+				statefulSets = append(statefulSets, *obj)
+			}
+		}
+		sort.Slice(statefulSets, func(i, j int) bool { return statefulSets[i].Name < statefulSets[j].Name })
+		return statefulSets, nil
+	}
+
+	var statefulSets []appsv1.StatefulSet
+	opts := c.filterListOptions()
+	for {
+		var page *appsv1.StatefulSetList
+		err := retryTransient(ctx, func() (err error) {
+			page, err = c.clientset.AppsV1().StatefulSets(namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		statefulSets = append(statefulSets, page.Items...)
+		c.reportListProgress("statefulsets", len(statefulSets))
+		if page.Continue == "" {
+			return statefulSets, nil
+		}
+		opts.Continue = page.Continue
+	}
+}
+
+// getStatefulSet fetches a single statefulset in namespace
+func (c *Client) getStatefulSet(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+	if rc := c.cacheFor(namespace); rc != nil {
+		if err := c.ensureSynced(ctx, rc, "statefulsets"); err != nil {
+			return nil, err
+		}
+		return rc.statefulSets.StatefulSets(namespace).Get(name)
+	}
+	var obj *appsv1.StatefulSet
+	err := retryTransient(ctx, func() (err error) {
+		obj, err = c.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return obj, err
+}
@@ -1,42 +1,62 @@
 package k8s
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
-	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
+// InClusterContext is the context name reported when running inside a pod with its service account
+const InClusterContext = "in-cluster"
+
 // Client wraps the Kubernetes client and provides methods to interact with the Kubernetes API
 type Client struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 	config    *rest.Config
 	namespace string
+	// Name of the kubeconfig context in use (InClusterContext inside a pod, empty when unknown)
+	contextName string
+	// Informer caches keyed by namespace, nil when caching is disabled
+	caches   map[string]*resourceCache
+	cacheCtx context.Context
+	cacheMu  sync.Mutex
+	// Filters applied to top-level listings
+	labelSelector labels.Selector
+	fieldSelector fields.Selector
+	// listProgress is notified as pages of large listings arrive
+	listProgress func(kind string, count int)
+	// dynamic lists the resources of customKind, set with --resource; both are nil otherwise
+	dynamic    dynamic.Interface
+	customKind *CustomResourceKind
 }
 
-// NewClient creates a new Kubernetes client using the provided config flags
-func NewClient(configFlags *genericclioptions.ConfigFlags) (*Client, error) {
-	config, err := configFlags.ToRESTConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get REST config: %w", err)
-	}
-
+// NewClientForConfig creates a client for the given REST config and namespace
+func NewClientForConfig(config *rest.Config, namespace string) (*Client, error) {
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
 
-	namespace, _, err := configFlags.ToRawKubeConfigLoader().Namespace()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get namespace: %w", err)
-	}
+	client := NewClientForInterface(clientset, namespace)
+	client.config = config
+	return client, nil
+}
 
+// NewClientForInterface creates a client on top of an existing clientset, such as a fake
+// clientset in tests. GetConfig returns nil for such clients.
+func NewClientForInterface(clientset kubernetes.Interface, namespace string) *Client {
 	return &Client{
-		clientset: clientset,
-		config:    config,
-		namespace: namespace,
-	}, nil
+		clientset:     clientset,
+		namespace:     namespace,
+		labelSelector: labels.Everything(),
+		fieldSelector: fields.Everything(),
+	}
 }
 
 // GetNamespace returns the current namespace
@@ -49,12 +69,38 @@ func (c *Client) SetNamespace(namespace string) {
 	c.namespace = namespace
 }
 
+// GetContext returns the name of the kubeconfig context in use
+func (c *Client) GetContext() string {
+	return c.contextName
+}
+
+// SetContext records the name of the kubeconfig context the client was created from
+func (c *Client) SetContext(contextName string) {
+	c.contextName = contextName
+}
+
 // GetConfig returns the REST config
 func (c *Client) GetConfig() *rest.Config {
 	return c.config
 }
 
 // GetClientset returns the Kubernetes clientset
-func (c *Client) GetClientset() *kubernetes.Clientset {
+func (c *Client) GetClientset() kubernetes.Interface {
 	return c.clientset
 }
+
+// Impersonate returns a client of the same context and namespace whose requests impersonate
+// user and groups. Caches, list filters and custom resource kinds are not carried over.
+func (c *Client) Impersonate(user string, groups []string) (*Client, error) {
+	if c.config == nil {
+		return nil, fmt.Errorf("cannot impersonate %s without a REST config", user)
+	}
+	config := rest.CopyConfig(c.config)
+	config.Impersonate = rest.ImpersonationConfig{UserName: user, Groups: groups}
+	client, err := NewClientForConfig(config, c.namespace)
+	if err != nil {
+		return nil, err
+	}
+	client.SetContext(c.contextName)
+	return client, nil
+}
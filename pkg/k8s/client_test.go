@@ -0,0 +1,37 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+// TestImpersonate verifies that the impersonating client keeps the context and namespace and
+// leaves the original config untouched.
+func TestImpersonate(t *testing.T) {
+	client, err := NewClientForConfig(&rest.Config{Host: "https://cluster.example"}, "apps")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.SetContext("staging")
+
+	impersonated, err := client.Impersonate("system:serviceaccount:ops:forwarder", []string{"ops"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := rest.ImpersonationConfig{UserName: "system:serviceaccount:ops:forwarder", Groups: []string{"ops"}}
+	if got := impersonated.GetConfig().Impersonate; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected impersonation %+v, got %+v", want, got)
+	}
+	if impersonated.GetContext() != "staging" || impersonated.GetNamespace() != "apps" {
+		t.Errorf("expected context staging and namespace apps, got %s and %s", impersonated.GetContext(), impersonated.GetNamespace())
+	}
+	if client.GetConfig().Impersonate.UserName != "" {
+		t.Errorf("original config was modified: %+v", client.GetConfig().Impersonate)
+	}
+
+	if _, err := NewClientForInterface(nil, "apps").Impersonate("someone", nil); err == nil {
+		t.Error("expected an error for a client without a REST config")
+	}
+}
@@ -0,0 +1,244 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// DefaultSelectorPath locates the pod label selector of a custom resource by default. It
+// follows the convention of resources with a scale subresource.
+const DefaultSelectorPath = "{.status.selector}"
+
+// CustomResourceKind describes the kind of arbitrary namespaced resources listed with --resource
+type CustomResourceKind struct {
+	GVK schema.GroupVersionKind
+	GVR schema.GroupVersionResource
+	// SelectorPath is the JSONPath of the label selector of the pods backing a resource
+	SelectorPath string
+}
+
+// CustomResource represents a namespaced resource of a CustomResourceKind
+type CustomResource struct {
+	Name      string
+	Namespace string
+	Kind      string
+	Created   time.Time
+}
+
+// ParseGroupVersionKind parses group/version/kind, e.g. kafka.strimzi.io/v1beta2/Kafka. Kinds
+// of the core group are written as version/kind.
+func ParseGroupVersionKind(s string) (schema.GroupVersionKind, error) {
+	parts := strings.Split(s, "/")
+	switch {
+	case len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "":
+		return schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}, nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return schema.GroupVersionKind{Version: parts[0], Kind: parts[1]}, nil
+	default:
+		return schema.GroupVersionKind{}, fmt.Errorf("invalid resource '%s', must be group/version/kind, e.g. kafka.strimzi.io/v1beta2/Kafka", s)
+	}
+}
+
+// SetCustomResourceKind configures the client to list resources of kind gvk, finding the pods
+// of each resource with the label selector at selectorPath. The kind is looked up with the
+// discovery API and must be namespaced.
+func (c *Client) SetCustomResourceKind(gvk, selectorPath string) error {
+	parsed, err := ParseGroupVersionKind(gvk)
+	if err != nil {
+		return err
+	}
+	if selectorPath == "" {
+		selectorPath = DefaultSelectorPath
+	}
+	if _, err := parseJSONPath(selectorPath); err != nil {
+		return err
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(c.clientset.Discovery()))
+	mapping, err := mapper.RESTMapping(parsed.GroupKind(), parsed.Version)
+	if err != nil {
+		return fmt.Errorf("failed to find resource %s: %w", gvk, err)
+	}
+	if mapping.Scope.Name() != "namespace" {
+		return fmt.Errorf("resource %s is not namespaced", gvk)
+	}
+
+	if c.dynamic == nil {
+		if c.config == nil {
+			return fmt.Errorf("no REST config to list %s", gvk)
+		}
+		if c.dynamic, err = dynamic.NewForConfig(c.config); err != nil {
+			return fmt.Errorf("failed to create dynamic client: %w", err)
+		}
+	}
+	c.customKind = &CustomResourceKind{GVK: parsed, GVR: mapping.Resource, SelectorPath: selectorPath}
+	return nil
+}
+
+// CustomResourceKind returns the kind configured with SetCustomResourceKind, or nil
+func (c *Client) CustomResourceKind() *CustomResourceKind {
+	return c.customKind
+}
+
+// SetDynamicClient sets the client used for custom resources, such as a fake client in tests
+func (c *Client) SetDynamicClient(client dynamic.Interface) {
+	c.dynamic = client
+}
+
+// GetCustomResources retrieves all resources of the configured kind in the client namespace
+func (c *Client) GetCustomResources(ctx context.Context) ([]CustomResource, error) {
+	kind := c.customKind
+	if kind == nil {
+		return nil, fmt.Errorf("no resource kind configured")
+	}
+
+	var items []unstructured.Unstructured
+	opts := c.filterListOptions()
+	for {
+		var page *unstructured.UnstructuredList
+		err := retryTransient(ctx, func() (err error) {
+			page, err = c.dynamic.Resource(kind.GVR).Namespace(c.namespace).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", kind.GVR.Resource, err)
+		}
+		items = append(items, page.Items...)
+		c.reportListProgress(kind.GVR.Resource, len(items))
+		if page.GetContinue() == "" {
+			break
+		}
+		opts.Continue = page.GetContinue()
+	}
+
+	resources := make([]CustomResource, 0, len(items))
+	for _, item := range items {
+		resources = append(resources, CustomResource{
+			Name:      item.GetName(),
+			Namespace: item.GetNamespace(),
+			Kind:      kind.GVK.Kind,
+			Created:   item.GetCreationTimestamp().Time,
+		})
+	}
+	return resources, nil
+}
+
+// GetPodsForCustomResource returns the pods matching the label selector of a resource of the
+// configured kind in the current namespace
+func (c *Client) GetPodsForCustomResource(ctx context.Context, name string) ([]Pod, error) {
+	return c.GetPodsForCustomResourceInNamespace(ctx, c.namespace, name)
+}
+
+// GetPodsForCustomResourceInNamespace returns the pods matching the label selector of a
+// resource of the configured kind in namespace
+func (c *Client) GetPodsForCustomResourceInNamespace(ctx context.Context, namespace, name string) ([]Pod, error) {
+	kind := c.customKind
+	if kind == nil {
+		return nil, fmt.Errorf("no resource kind configured")
+	}
+
+	var obj *unstructured.Unstructured
+	err := retryTransient(ctx, func() (err error) {
+		obj, err = c.dynamic.Resource(kind.GVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %w", kind.GVK.Kind, name, err)
+	}
+	selector, err := customResourceSelector(obj, kind.SelectorPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", kind.GVK.Kind, name, err)
+	}
+
+	podList, err := c.listPods(ctx, namespace, selector, fields.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for %s %s: %w", kind.GVK.Kind, name, err)
+	}
+	if len(podList) == 0 {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoPods, kind.GVK.Kind, name)
+	}
+
+	return podsWithPorts(podList), nil
+}
+
+// CustomResourceToString returns a string representation of a custom resource
+func CustomResourceToString(resource CustomResource) string {
+	return fmt.Sprintf("%s (%s)", resource.Name, strings.ToLower(resource.Kind))
+}
+
+// parseJSONPath parses a JSONPath template such as {.spec.selector}
+func parseJSONPath(path string) (*jsonpath.JSONPath, error) {
+	parser := jsonpath.New("selector")
+	if err := parser.Parse(path); err != nil {
+		return nil, fmt.Errorf("invalid selector path '%s': %w", path, err)
+	}
+	return parser, nil
+}
+
+// customResourceSelector evaluates selectorPath on obj and converts the result into a label
+// selector. The value may be a selector string such as app=kafka,role=broker, a LabelSelector
+// with matchLabels or matchExpressions, or a map of labels.
+func customResourceSelector(obj *unstructured.Unstructured, selectorPath string) (labels.Selector, error) {
+	parser, err := parseJSONPath(selectorPath)
+	if err != nil {
+		return nil, err
+	}
+	results, err := parser.FindResults(obj.Object)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		return nil, fmt.Errorf("no pod selector found at %s", selectorPath)
+	}
+
+	var selector labels.Selector
+	switch value := results[0][0].Interface().(type) {
+	case string:
+		if selector, err = labels.Parse(value); err != nil {
+			return nil, fmt.Errorf("invalid pod selector '%s' at %s: %w", value, selectorPath, err)
+		}
+	case map[string]interface{}:
+		_, hasLabels := value["matchLabels"]
+		_, hasExpressions := value["matchExpressions"]
+		if hasLabels || hasExpressions {
+			var labelSelector metav1.LabelSelector
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(value, &labelSelector); err != nil {
+				return nil, fmt.Errorf("invalid pod selector at %s: %w", selectorPath, err)
+			}
+			if selector, err = metav1.LabelSelectorAsSelector(&labelSelector); err != nil {
+				return nil, fmt.Errorf("invalid pod selector at %s: %w", selectorPath, err)
+			}
+			break
+		}
+		set := labels.Set{}
+		for key, v := range value {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid pod selector at %s: label %s is not a string", selectorPath, key)
+			}
+			set[key] = s
+		}
+		selector = labels.SelectorFromSet(set)
+	default:
+		var buf bytes.Buffer
+		_ = parser.PrintResults(&buf, results[0])
+		return nil, fmt.Errorf("unsupported pod selector '%s' at %s", buf.String(), selectorPath)
+	}
+
+	// An empty selector would match every pod in the namespace
+	if selector.Empty() {
+		return nil, fmt.Errorf("empty pod selector at %s", selectorPath)
+	}
+	return selector, nil
+}
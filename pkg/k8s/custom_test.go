@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newCustomResourceClient returns a client serving two Kafka resources and the pods of one
+func newCustomResourceClient(t *testing.T) *Client {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "events-broker-0", Namespace: "data", Labels: map[string]string{"cluster": "events", "role": "broker"}},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "kafka", Ports: []corev1.ContainerPort{{Name: "clients", ContainerPort: 9092, Protocol: corev1.ProtocolTCP}}}},
+		},
+	})
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: "kafka.strimzi.io/v1beta2",
+		APIResources: []metav1.APIResource{{Name: "kafkas", Kind: "Kafka", Namespaced: true}},
+	}}
+
+	kafka := func(name string, selector interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "kafka.strimzi.io/v1beta2",
+			"kind":       "Kafka",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "data"},
+			"spec":       map[string]interface{}{"selector": selector},
+		}}
+	}
+	gvr := schema.GroupVersionResource{Group: "kafka.strimzi.io", Version: "v1beta2", Resource: "kafkas"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "KafkaList"},
+		kafka("events", map[string]interface{}{"matchLabels": map[string]interface{}{"cluster": "events"}}),
+		kafka("logs", "cluster=logs"),
+	)
+
+	client := NewClientForInterface(clientset, "data")
+	client.SetDynamicClient(dynamicClient)
+	if err := client.SetCustomResourceKind("kafka.strimzi.io/v1beta2/Kafka", "{.spec.selector}"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return client
+}
+
+// TestGetCustomResources verifies that resources of the configured kind are listed.
+func TestGetCustomResources(t *testing.T) {
+	client := newCustomResourceClient(t)
+
+	resources, err := client.GetCustomResources(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	if got := CustomResourceToString(resources[0]); got != "events (kafka)" {
+		t.Errorf("unexpected description %q", got)
+	}
+}
+
+// TestGetPodsForCustomResource verifies that pods are found with the selector at the
+// configured path.
+func TestGetPodsForCustomResource(t *testing.T) {
+	client := newCustomResourceClient(t)
+
+	pods, err := client.GetPodsForCustomResourceInNamespace(context.Background(), "data", "events")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pods) != 1 || pods[0].Name != "events-broker-0" {
+		t.Errorf("expected pod events-broker-0, got %+v", pods)
+	}
+
+	if _, err := client.GetPodsForCustomResourceInNamespace(context.Background(), "data", "logs"); err == nil {
+		t.Error("expected an error for a resource without pods")
+	}
+}
+
+// TestSetCustomResourceKind_Invalid verifies that malformed kinds and unknown resources are rejected.
+func TestSetCustomResourceKind_Invalid(t *testing.T) {
+	client := newCustomResourceClient(t)
+	for _, gvk := range []string{"Kafka", "kafka.strimzi.io/v1beta2/KafkaTopic"} {
+		if err := client.SetCustomResourceKind(gvk, ""); err == nil {
+			t.Errorf("expected an error for %q", gvk)
+		}
+	}
+	if err := client.SetCustomResourceKind("kafka.strimzi.io/v1beta2/Kafka", "{.spec.selector"); err == nil {
+		t.Error("expected an error for an invalid selector path")
+	}
+}
@@ -3,28 +3,32 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 )
 
 // Deployment represents a Kubernetes deployment
 type Deployment struct {
 	Name      string
 	Namespace string
+	Created   time.Time
 }
 
 // GetDeployments retrieves all deployments in the specified namespace
 func (c *Client) GetDeployments(ctx context.Context) ([]Deployment, error) {
-	deploymentList, err := c.clientset.AppsV1().Deployments(c.namespace).List(ctx, metav1.ListOptions{})
+	deploymentList, err := c.listDeployments(ctx, c.namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list deployments: %w", err)
 	}
 
-	deployments := make([]Deployment, 0, len(deploymentList.Items))
-	for _, d := range deploymentList.Items {
+	deployments := make([]Deployment, 0, len(deploymentList))
+	for _, d := range deploymentList {
 		deployment := Deployment{
 			Name:      d.Name,
 			Namespace: d.Namespace,
+			Created:   d.CreationTimestamp.Time,
 		}
 		deployments = append(deployments, deployment)
 	}
@@ -32,9 +36,14 @@ func (c *Client) GetDeployments(ctx context.Context) ([]Deployment, error) {
 	return deployments, nil
 }
 
-// GetPodsForDeployment returns pods managed by a deployment
+// GetPodsForDeployment returns pods managed by a deployment in the current namespace
 func (c *Client) GetPodsForDeployment(ctx context.Context, deploymentName string) ([]Pod, error) {
-	deployment, err := c.clientset.AppsV1().Deployments(c.namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+	return c.GetPodsForDeploymentInNamespace(ctx, c.namespace, deploymentName)
+}
+
+// GetPodsForDeploymentInNamespace returns pods managed by a deployment in namespace
+func (c *Client) GetPodsForDeploymentInNamespace(ctx context.Context, namespace, deploymentName string) ([]Pod, error) {
+	deployment, err := c.getDeployment(ctx, namespace, deploymentName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployment %s: %w", deploymentName, err)
 	}
@@ -45,65 +54,23 @@ func (c *Client) GetPodsForDeployment(ctx context.Context, deploymentName string
 		return nil, fmt.Errorf("deployment %s does not have a selector", deploymentName)
 	}
 
-	// Format the label selector
-	labelSelector := metav1.FormatLabelSelector(selector)
+	// Convert the label selector
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector for deployment %s: %w", deploymentName, err)
+	}
 
 	// List pods matching the deployment's selector
-	podList, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
+	podList, err := c.listPods(ctx, namespace, labelSelector, fields.Everything())
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pods for deployment %s: %w", deploymentName, err)
 	}
 
-	if len(podList.Items) == 0 {
-		return nil, fmt.Errorf("no pods found for deployment %s", deploymentName)
-	}
-
-	// Convert to our Pod type
-	pods := make([]Pod, 0, len(podList.Items))
-	for _, p := range podList.Items {
-		pod := Pod{
-			Name:      p.Name,
-			Namespace: p.Namespace,
-			Ports:     []PodPort{},
-		}
-
-		// Add ports from init containers
-		for _, container := range p.Spec.InitContainers {
-			for _, port := range container.Ports {
-				podPort := PodPort{
-					Name:            port.Name,
-					ContainerPort:   port.ContainerPort,
-					Protocol:        string(port.Protocol),
-					ContainerName:   container.Name,
-					IsInitContainer: true,
-				}
-				pod.Ports = append(pod.Ports, podPort)
-			}
-		}
-
-		// Add ports from regular containers
-		for _, container := range p.Spec.Containers {
-			for _, port := range container.Ports {
-				podPort := PodPort{
-					Name:            port.Name,
-					ContainerPort:   port.ContainerPort,
-					Protocol:        string(port.Protocol),
-					ContainerName:   container.Name,
-					IsInitContainer: false,
-				}
-				pod.Ports = append(pod.Ports, podPort)
-			}
-		}
-
-		// Only add pods with ports
-		if len(pod.Ports) > 0 {
-			pods = append(pods, pod)
-		}
+	if len(podList) == 0 {
+		return nil, fmt.Errorf("%w for deployment %s", ErrNoPods, deploymentName)
 	}
 
-	return pods, nil
+	return podsWithPorts(podList), nil
 }
 
 // DeploymentToString returns a string representation of a deployment
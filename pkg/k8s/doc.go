@@ -0,0 +1,4 @@
+// Package k8s wraps the Kubernetes API calls kubectl-pfw needs: listing services, pods,
+// deployments and statefulsets and finding the pods backing them. Create a Client with
+// NewClientForConfig; all methods take a context as their first argument.
+package k8s
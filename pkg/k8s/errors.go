@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrForbidden is matched with errors.Is by the errors of API calls the user lacks RBAC
+// permissions for; the error itself is a *ForbiddenError
+var ErrForbidden = errors.New("forbidden")
+
+// ForbiddenError is returned when the API server denies a list or get call for lack of RBAC
+// permissions. Err is the API server's error.
+type ForbiddenError struct {
+	Err error
+}
+
+func (e *ForbiddenError) Error() string { return e.Err.Error() }
+
+func (e *ForbiddenError) Unwrap() error { return e.Err }
+
+// Is makes the error match ErrForbidden
+func (e *ForbiddenError) Is(target error) bool { return target == ErrForbidden }
+
+// asForbidden wraps err in a *ForbiddenError when the API server denied the call
+func asForbidden(err error) error {
+	if err != nil && apierrors.IsForbidden(err) {
+		return &ForbiddenError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// legacyZoneLabel is the zone label of nodes in clusters older than Kubernetes 1.17
+const legacyZoneLabel = "failure-domain.beta.kubernetes.io/zone"
+
+// NodeZone returns the topology zone of a node, e.g. eu-west-1a, from its
+// topology.kubernetes.io/zone label, or an empty zone if the node has none
+func (c *Client) NodeZone(ctx context.Context, name string) (string, error) {
+	var node *corev1.Node
+	err := retryTransient(ctx, func() (err error) {
+		node, err = c.clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %s: %w", name, err)
+	}
+	if zone := node.Labels[corev1.LabelTopologyZone]; zone != "" {
+		return zone, nil
+	}
+	return node.Labels[legacyZoneLabel], nil
+}
@@ -0,0 +1,30 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestClient_NodeZone verifies that the zone is read from the topology label, falling back to
+// the legacy label, and is empty for nodes without either.
+func TestClient_NodeZone(t *testing.T) {
+	client := NewClientForInterface(fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{corev1.LabelTopologyZone: "eu-west-1a"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{legacyZoneLabel: "eu-west-1b"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}},
+	), "default")
+
+	for node, want := range map[string]string{"node-a": "eu-west-1a", "node-b": "eu-west-1b", "node-c": ""} {
+		zone, err := client.NodeZone(context.Background(), node)
+		if err != nil || zone != want {
+			t.Errorf("NodeZone(%s) = %q, %v; want %q", node, zone, err, want)
+		}
+	}
+	if _, err := client.NodeZone(context.Background(), "node-d"); err == nil {
+		t.Error("expected an error for a missing node")
+	}
+}
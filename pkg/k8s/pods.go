@@ -2,22 +2,53 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
+// ErrNoPods is returned when a resource exists but no pods back it, e.g. while it is rolled out
+var ErrNoPods = errors.New("no pods found")
+
 // Pod represents a Kubernetes pod with container port information
 type Pod struct {
 	Name      string
 	Namespace string
 	Ports     []PodPort
+	// Status is the pod status as shown by kubectl get pods, e.g. Running or CrashLoopBackOff
+	Status string
+	// Ready reports whether the pod passes its readiness checks
+	Ready           bool
+	ReadyContainers int
+	Containers      int
+	Restarts        int32
+	Created         time.Time
+	// Owner is the workload controlling the pod, e.g. deployment/web, or empty for standalone pods
+	Owner string
+	// Node is the node the pod is scheduled on, or empty while it is pending
+	Node string
+	// Labels are the labels of the pod
+	Labels map[string]string
+	// LocalPorts are the local ports recommended with the local-port annotation, keyed by
+	// container port
+	LocalPorts map[int32]int32
 }
 
+// now is the clock used for pod ages
+var now = time.Now
+
 // PortMetadata contains additional information about a container port
 type PortMetadata struct {
 	ContainerName   string
 	IsInitContainer bool
+	// IsEphemeralContainer marks ports of ephemeral debug containers added with kubectl debug
+	IsEphemeralContainer bool
 }
 
 // PodPort represents a container port in a Kubernetes pod
@@ -27,72 +58,257 @@ type PodPort struct {
 	Protocol        string
 	ContainerName   string
 	IsInitContainer bool
+	// IsEphemeralContainer marks ports of ephemeral debug containers added with kubectl debug
+	IsEphemeralContainer bool
 }
 
 // GetPods retrieves all pods in the specified namespace
 func (c *Client) GetPods(ctx context.Context) ([]Pod, error) {
-	podList, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{})
+	podList, err := c.listPods(ctx, c.namespace, c.labelSelector, c.fieldSelector)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pods: %w", err)
 	}
 
-	pods := make([]Pod, 0, len(podList.Items))
-	for _, p := range podList.Items {
-		pod := Pod{
-			Name:      p.Name,
-			Namespace: p.Namespace,
-			Ports:     []PodPort{},
-		}
-
-		// Add ports from init containers
-		for _, container := range p.Spec.InitContainers {
-			for _, port := range container.Ports {
-				podPort := PodPort{
-					Name:            port.Name,
-					ContainerPort:   port.ContainerPort,
-					Protocol:        string(port.Protocol),
-					ContainerName:   container.Name,
-					IsInitContainer: true,
-				}
-				pod.Ports = append(pod.Ports, podPort)
+	return podsWithPorts(podList), nil
+}
+
+// GetPod retrieves a single pod in the current namespace, also when it exposes no ports
+func (c *Client) GetPod(ctx context.Context, name string) (Pod, error) {
+	return c.GetPodInNamespace(ctx, c.namespace, name)
+}
+
+// GetPodInNamespace retrieves a single pod in namespace, also when it exposes no ports
+func (c *Client) GetPodInNamespace(ctx context.Context, namespace, name string) (Pod, error) {
+	var pod *corev1.Pod
+	err := retryTransient(ctx, func() (err error) {
+		pod, err = c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return Pod{}, fmt.Errorf("failed to get pod %s: %w", name, err)
+	}
+	return newPod(pod), nil
+}
+
+// newPod converts a Kubernetes pod into our Pod type, collecting the ports of all containers
+func newPod(p *corev1.Pod) Pod {
+	pod := Pod{
+		Name:       p.Name,
+		Namespace:  p.Namespace,
+		Ports:      []PodPort{},
+		Status:     podStatus(p),
+		Containers: len(p.Spec.Containers),
+		Created:    p.CreationTimestamp.Time,
+		Owner:      podOwner(p),
+		Node:       p.Spec.NodeName,
+		Labels:     p.Labels,
+	}
+
+	for _, condition := range p.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			pod.Ready = condition.Status == corev1.ConditionTrue
+		}
+	}
+	for _, status := range p.Status.ContainerStatuses {
+		if status.Ready {
+			pod.ReadyContainers++
+		}
+		pod.Restarts += status.RestartCount
+	}
+
+	// Add ports from init containers
+	for _, container := range p.Spec.InitContainers {
+		for _, port := range container.Ports {
+			podPort := PodPort{
+				Name:            port.Name,
+				ContainerPort:   port.ContainerPort,
+				Protocol:        string(port.Protocol),
+				ContainerName:   container.Name,
+				IsInitContainer: true,
+			}
+			pod.Ports = append(pod.Ports, podPort)
+		}
+	}
+
+	// Add ports from regular containers
+	for _, container := range p.Spec.Containers {
+		for _, port := range container.Ports {
+			podPort := PodPort{
+				Name:            port.Name,
+				ContainerPort:   port.ContainerPort,
+				Protocol:        string(port.Protocol),
+				ContainerName:   container.Name,
+				IsInitContainer: false,
 			}
+			pod.Ports = append(pod.Ports, podPort)
 		}
+	}
 
-		// Add ports from regular containers
-		for _, container := range p.Spec.Containers {
-			for _, port := range container.Ports {
-				podPort := PodPort{
-					Name:            port.Name,
-					ContainerPort:   port.ContainerPort,
-					Protocol:        string(port.Protocol),
-					ContainerName:   container.Name,
-					IsInitContainer: false,
-				}
-				pod.Ports = append(pod.Ports, podPort)
+	// Add ports from ephemeral debug containers, e.g. a delve or profiler port of a kubectl
+	// debug session; they share the pod's network namespace and are forwarded like any other
+	for _, container := range p.Spec.EphemeralContainers {
+		for _, port := range container.Ports {
+			podPort := PodPort{
+				Name:                 port.Name,
+				ContainerPort:        port.ContainerPort,
+				Protocol:             string(port.Protocol),
+				ContainerName:        container.Name,
+				IsEphemeralContainer: true,
 			}
+			pod.Ports = append(pod.Ports, podPort)
+		}
+	}
+
+	// Add ports advertised with the ports annotation that no container declares
+	for _, annotated := range ParsePortsAnnotation(p.Annotations[PortsAnnotation]) {
+		if !hasContainerPort(pod.Ports, annotated.Port) {
+			pod.Ports = append(pod.Ports, PodPort{
+				Name:          annotated.Name,
+				ContainerPort: annotated.Port,
+				Protocol:      string(corev1.ProtocolTCP),
+			})
+		}
+	}
+
+	if len(pod.Ports) > 0 {
+		pod.LocalPorts = parseLocalPortAnnotation(p.Annotations[LocalPortAnnotation], pod.Ports[0].ContainerPort)
+	}
+
+	return pod
+}
+
+// hasContainerPort reports whether ports include the container port number
+func hasContainerPort(ports []PodPort, number int32) bool {
+	for _, port := range ports {
+		if port.ContainerPort == number {
+			return true
 		}
+	}
+	return false
+}
+
+// IsTCP reports whether protocol, as found in a port spec, is TCP, which it defaults to when
+// empty. Port-forwarding only tunnels TCP.
+func IsTCP(protocol string) bool {
+	return protocol == "" || protocol == string(corev1.ProtocolTCP)
+}
+
+// PortProtocol returns the protocol the pod serves a container port with: TCP if any container
+// declares it over TCP or none declares it at all, or else the protocol declared, e.g. UDP
+func (p Pod) PortProtocol(number int32) string {
+	protocol := string(corev1.ProtocolTCP)
+	for _, port := range p.Ports {
+		if port.ContainerPort != number {
+			continue
+		}
+		if IsTCP(port.Protocol) {
+			return string(corev1.ProtocolTCP)
+		}
+		protocol = port.Protocol
+	}
+	return protocol
+}
+
+// podOwner returns the workload controlling a pod as kind/name. Pods of a ReplicaSet created by
+// a Deployment are attributed to the Deployment, derived from the pod-template-hash suffix of
+// the ReplicaSet name so no further API calls are needed.
+func podOwner(p *corev1.Pod) string {
+	owner := metav1.GetControllerOf(p)
+	if owner == nil {
+		return ""
+	}
+
+	kind, name := strings.ToLower(owner.Kind), owner.Name
+	if owner.Kind == "ReplicaSet" {
+		if hash := p.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" && strings.HasSuffix(name, "-"+hash) {
+			kind, name = "deployment", strings.TrimSuffix(name, "-"+hash)
+		}
+	}
+	return kind + "/" + name
+}
+
+// podStatus summarizes a pod like the STATUS column of kubectl get pods, preferring the reason a
+// container is waiting or terminated over the phase
+func podStatus(p *corev1.Pod) string {
+	if p.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+
+	status := string(p.Status.Phase)
+	if p.Status.Reason != "" {
+		status = p.Status.Reason
+	}
+	for _, container := range p.Status.InitContainerStatuses {
+		if container.State.Waiting != nil && container.State.Waiting.Reason != "" && container.State.Waiting.Reason != "PodInitializing" {
+			return "Init:" + container.State.Waiting.Reason
+		}
+		if container.State.Terminated != nil && container.State.Terminated.ExitCode != 0 {
+			return "Init:Error"
+		}
+	}
+	for _, container := range p.Status.ContainerStatuses {
+		if container.State.Waiting != nil && container.State.Waiting.Reason != "" {
+			status = container.State.Waiting.Reason
+		} else if container.State.Terminated != nil && container.State.Terminated.Reason != "" {
+			status = container.State.Terminated.Reason
+		}
+	}
+	return status
+}
+
+// podsWithPorts converts Kubernetes pods into our Pod type, keeping only pods that expose ports
+func podsWithPorts(items []corev1.Pod) []Pod {
+	pods := make([]Pod, 0, len(items))
+	for i := range items {
+		pod := newPod(&items[i])
 
 		// Only add pods with ports
 		if len(pod.Ports) > 0 {
 			pods = append(pods, pod)
 		}
 	}
-
-	return pods, nil
+	return pods
 }
 
-// PodToString returns a string representation of a pod
+// PodToString returns a string representation of a pod including its status, readiness,
+// restarts and age. Pods that are not ready are marked so they are not picked by accident.
 func PodToString(pod Pod) string {
+	description := podPortsToString(pod)
+	if pod.Status == "" {
+		return description
+	}
+
+	restarts := fmt.Sprintf("%d restarts", pod.Restarts)
+	if pod.Restarts == 1 {
+		restarts = "1 restart"
+	}
+	status := fmt.Sprintf("%s %d/%d, %s", pod.Status, pod.ReadyContainers, pod.Containers, restarts)
+	if !pod.Created.IsZero() {
+		status += ", " + duration.HumanDuration(now().Sub(pod.Created))
+	}
+	description = fmt.Sprintf("%s [%s]", description, status)
+
+	if !pod.Ready {
+		return "[not ready] " + description
+	}
+	return description
+}
+
+// podPortsToString returns a pod's name with a summary of its ports
+func podPortsToString(pod Pod) string {
 	if len(pod.Ports) == 0 {
 		return fmt.Sprintf("%s (no ports)", pod.Name)
 	}
 
-	// Count init container ports and regular container ports
-	var initContainerPorts, regularContainerPorts int
+	// Count init, debug and regular container ports
+	var initContainerPorts, debugContainerPorts, regularContainerPorts int
 	for _, port := range pod.Ports {
-		if port.IsInitContainer {
+		switch {
+		case port.IsInitContainer:
 			initContainerPorts++
-		} else {
+		case port.IsEphemeralContainer:
+			debugContainerPorts++
+		default:
 			regularContainerPorts++
 		}
 	}
@@ -103,6 +319,8 @@ func PodToString(pod Pod) string {
 		containerType := ""
 		if port.IsInitContainer {
 			containerType = "init:"
+		} else if port.IsEphemeralContainer {
+			containerType = "debug:"
 		}
 		if port.Name != "" {
 			return fmt.Sprintf("%s (%s%s:%d/%s)", pod.Name, containerType, port.Name, port.ContainerPort, port.Protocol)
@@ -111,12 +329,25 @@ func PodToString(pod Pod) string {
 	}
 
 	// If there are multiple ports but they're all of the same type
-	if initContainerPorts == 0 {
+	switch len(pod.Ports) {
+	case regularContainerPorts:
 		return fmt.Sprintf("%s (%d ports)", pod.Name, regularContainerPorts)
-	} else if regularContainerPorts == 0 {
+	case initContainerPorts:
 		return fmt.Sprintf("%s (%d init ports)", pod.Name, initContainerPorts)
+	case debugContainerPorts:
+		return fmt.Sprintf("%s (%d debug ports)", pod.Name, debugContainerPorts)
 	}
 
-	// If there are both init and regular container ports
-	return fmt.Sprintf("%s (%d regular, %d init ports)", pod.Name, regularContainerPorts, initContainerPorts)
+	// If there are ports of several container types
+	var counts []string
+	if regularContainerPorts > 0 {
+		counts = append(counts, fmt.Sprintf("%d regular", regularContainerPorts))
+	}
+	if initContainerPorts > 0 {
+		counts = append(counts, fmt.Sprintf("%d init", initContainerPorts))
+	}
+	if debugContainerPorts > 0 {
+		counts = append(counts, fmt.Sprintf("%d debug", debugContainerPorts))
+	}
+	return fmt.Sprintf("%s (%s ports)", pod.Name, strings.Join(counts, ", "))
 }
@@ -0,0 +1,163 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestPod returns a pod with one container exposing port 8080 in the given state
+func newTestPod(ready bool, restarts int32, state corev1.ContainerState) *corev1.Pod {
+	readyStatus := corev1.ConditionFalse
+	if ready {
+		readyStatus = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "web-1",
+			Namespace:         "apps",
+			CreationTimestamp: metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "web", Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}}}},
+		},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: readyStatus}},
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "web", Ready: ready, RestartCount: restarts, State: state}},
+		},
+	}
+}
+
+// TestPodToString verifies that status, readiness, restarts and age are shown and that pods
+// which are not ready are marked.
+func TestPodToString(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want string
+	}{
+		{
+			name: "ready",
+			pod:  newTestPod(true, 0, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}),
+			want: "web-1 (http:8080/TCP) [Running 1/1, 0 restarts, 2d]",
+		},
+		{
+			name: "crash looping",
+			pod:  newTestPod(false, 7, corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}),
+			want: "[not ready] web-1 (http:8080/TCP) [CrashLoopBackOff 0/1, 7 restarts, 2d]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PodToString(newPod(tt.pod)); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestPodStatus verifies the kubectl-style status summary.
+func TestPodStatus(t *testing.T) {
+	pod := newTestPod(false, 0, corev1.ContainerState{})
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+	}}
+	if got := podStatus(pod); got != "Init:ImagePullBackOff" {
+		t.Errorf("expected Init:ImagePullBackOff, got %q", got)
+	}
+
+	pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	if got := podStatus(pod); got != "Terminating" {
+		t.Errorf("expected Terminating, got %q", got)
+	}
+}
+
+// TestPodOwner verifies that pods are attributed to their deployment or other controller.
+func TestPodOwner(t *testing.T) {
+	controller := true
+	pod := newTestPod(true, 0, corev1.ContainerState{})
+	if got := podOwner(pod); got != "" {
+		t.Errorf("expected no owner for a standalone pod, got %q", got)
+	}
+
+	pod.Labels = map[string]string{"pod-template-hash": "7d9f8b"}
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-7d9f8b", Controller: &controller}}
+	if got := podOwner(pod); got != "deployment/web" {
+		t.Errorf("expected deployment/web, got %q", got)
+	}
+
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: &controller}}
+	if got := podOwner(pod); got != "statefulset/db" {
+		t.Errorf("expected statefulset/db, got %q", got)
+	}
+}
+
+// TestNewPod_EphemeralContainers verifies that ports of debug containers are listed and labeled.
+func TestNewPod_EphemeralContainers(t *testing.T) {
+	pod := newTestPod(true, 0, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:  "debugger",
+			Ports: []corev1.ContainerPort{{Name: "delve", ContainerPort: 2345, Protocol: corev1.ProtocolTCP}},
+		},
+	}}
+
+	converted := newPod(pod)
+	if len(converted.Ports) != 2 {
+		t.Fatalf("expected 2 ports, got %d", len(converted.Ports))
+	}
+	debug := converted.Ports[1]
+	if !debug.IsEphemeralContainer || debug.ContainerName != "debugger" || debug.ContainerPort != 2345 {
+		t.Errorf("unexpected debug port %+v", debug)
+	}
+	if got := podPortsToString(converted); got != "web-1 (1 regular, 1 debug ports)" {
+		t.Errorf("unexpected description %q", got)
+	}
+
+	converted.Ports = converted.Ports[1:]
+	if got := podPortsToString(converted); got != "web-1 (debug:delve:2345/TCP)" {
+		t.Errorf("unexpected description %q", got)
+	}
+}
+
+// TestGetPod verifies that a single pod is returned even without declared ports.
+func TestGetPod(t *testing.T) {
+	portless := newTestPod(true, 0, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})
+	portless.Spec.Containers[0].Ports = nil
+	client := NewClientForInterface(fake.NewSimpleClientset(portless), "apps")
+
+	pod, err := client.GetPodInNamespace(context.Background(), "apps", "web-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Name != "web-1" || !pod.Ready || len(pod.Ports) != 0 {
+		t.Errorf("unexpected pod %+v", pod)
+	}
+	if _, err := client.GetPodInNamespace(context.Background(), "apps", "missing"); err == nil {
+		t.Error("expected an error for a missing pod")
+	}
+}
+
+// TestPodPortProtocol verifies that ports declared only over UDP are reported as such, while
+// ports also declared over TCP or not declared at all are TCP.
+func TestPodPortProtocol(t *testing.T) {
+	pod := Pod{Ports: []PodPort{
+		{ContainerPort: 53, Protocol: "UDP"},
+		{ContainerPort: 53, Protocol: "TCP"},
+		{ContainerPort: 5353, Protocol: "UDP"},
+		{ContainerPort: 8080},
+	}}
+	for port, want := range map[int32]string{53: "TCP", 5353: "UDP", 8080: "TCP", 9090: "TCP"} {
+		if got := pod.PortProtocol(port); got != want {
+			t.Errorf("port %d: expected %s, got %s", port, want, got)
+		}
+	}
+}
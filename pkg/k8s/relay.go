@@ -0,0 +1,136 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DefaultRelayImage runs socat in relay pods
+const DefaultRelayImage = "alpine/socat:1.8.0.0"
+
+// RelayTargetAnnotation records the endpoint a relay pod connects to
+const RelayTargetAnnotation = "pfw.dev/relay-target"
+
+// relayLifetime bounds how long a relay pod runs, so pods left behind by a killed session do
+// not run forever
+const relayLifetime = 24 * time.Hour
+
+// relayPollInterval is how often a starting relay pod is checked
+const relayPollInterval = 500 * time.Millisecond
+
+// ParseRelayTarget parses a host:port endpoint reachable from the cluster, e.g.
+// mydb.abc123.eu-west-1.rds.amazonaws.com:5432
+func ParseRelayTarget(target string) (string, int32, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil || host == "" {
+		return "", 0, fmt.Errorf("invalid relay target '%s', must be host:port", target)
+	}
+	port, err := strconv.ParseInt(portStr, 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in relay target '%s'", target)
+	}
+	return host, int32(port), nil
+}
+
+// relayPod describes a pod relaying connections on port to host:port
+func relayPod(namespace, host string, port int32, image string) *corev1.Pod {
+	lifetime := int64(relayLifetime.Seconds())
+	gracePeriod := int64(0)
+	noEscalation := false
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pfw-relay-" + utilrand.String(5),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "pfw-relay",
+				"app.kubernetes.io/managed-by": "kubectl-pfw",
+			},
+			Annotations: map[string]string{
+				RelayTargetAnnotation: net.JoinHostPort(host, strconv.Itoa(int(port))),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:         &lifetime,
+			TerminationGracePeriodSeconds: &gracePeriod,
+			AutomountServiceAccountToken:  &noEscalation,
+			Containers: []corev1.Container{{
+				Name:  "relay",
+				Image: image,
+				Args: []string{
+					fmt.Sprintf("TCP-LISTEN:%d,fork,reuseaddr", port),
+					fmt.Sprintf("TCP:%s", net.JoinHostPort(host, strconv.Itoa(int(port)))),
+				},
+				Ports: []corev1.ContainerPort{{Name: "relay", ContainerPort: port, Protocol: corev1.ProtocolTCP}},
+				SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: &noEscalation,
+				},
+			}},
+		},
+	}
+}
+
+// CreateRelayPod starts a pod in the client namespace that relays connections on port to
+// host:port with socat and waits up to timeout for it to run. The pod is deleted again if it
+// does not start.
+func (c *Client) CreateRelayPod(ctx context.Context, host string, port int32, image string, timeout time.Duration) (Pod, error) {
+	if image == "" {
+		image = DefaultRelayImage
+	}
+	created, err := c.clientset.CoreV1().Pods(c.namespace).Create(ctx, relayPod(c.namespace, host, port, image), metav1.CreateOptions{})
+	if err != nil {
+		return Pod{}, fmt.Errorf("failed to create relay pod: %w", err)
+	}
+
+	var running *corev1.Pod
+	err = wait.PollUntilContextTimeout(ctx, relayPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		p, err := c.clientset.CoreV1().Pods(c.namespace).Get(ctx, created.Name, metav1.GetOptions{})
+		if err != nil && isTransient(err) {
+			// Polled again anyway
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch p.Status.Phase {
+		case corev1.PodRunning:
+			running = p
+			return true, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, fmt.Errorf("relay pod %s stopped: %s", p.Name, podStatus(p))
+		}
+		for _, status := range p.Status.ContainerStatuses {
+			if waiting := status.State.Waiting; waiting != nil && (waiting.Reason == "ErrImagePull" || waiting.Reason == "ImagePullBackOff" || waiting.Reason == "InvalidImageName") {
+				return false, fmt.Errorf("relay pod %s cannot pull image %s: %s", p.Name, image, waiting.Reason)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		// Waiting may have been cancelled, so clean up with a fresh context
+		_ = c.DeleteRelayPod(context.Background(), created.Name)
+		return Pod{}, fmt.Errorf("relay pod %s did not start: %w", created.Name, err)
+	}
+	return newPod(running), nil
+}
+
+// DeleteRelayPod deletes a pod created with CreateRelayPod without waiting for it to terminate
+func (c *Client) DeleteRelayPod(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	gracePeriod := int64(0)
+	err := c.clientset.CoreV1().Pods(c.namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+	if err != nil {
+		return fmt.Errorf("failed to delete relay pod %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestParseRelayTarget verifies that endpoints need a host and a valid port.
+func TestParseRelayTarget(t *testing.T) {
+	host, port, err := ParseRelayTarget("db.internal:5432")
+	if err != nil || host != "db.internal" || port != 5432 {
+		t.Errorf("unexpected result %s, %d, %v", host, port, err)
+	}
+	for _, target := range []string{"db.internal", ":5432", "db.internal:0", "db.internal:http"} {
+		if _, _, err := ParseRelayTarget(target); err == nil {
+			t.Errorf("expected an error for %q", target)
+		}
+	}
+}
+
+// newRelayClientset returns a fake clientset whose created pods report the given status
+func newRelayClientset(status corev1.PodStatus) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status = status
+		return false, nil, nil
+	})
+	return clientset
+}
+
+// TestCreateRelayPod verifies that the relay pod listens on the target port and connects to
+// the target endpoint.
+func TestCreateRelayPod(t *testing.T) {
+	clientset := newRelayClientset(corev1.PodStatus{Phase: corev1.PodRunning})
+	client := NewClientForInterface(clientset, "apps")
+
+	pod, err := client.CreateRelayPod(context.Background(), "db.internal", 5432, "", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pod.Ports) != 1 || pod.Ports[0].ContainerPort != 5432 {
+		t.Errorf("expected the relay pod to expose 5432, got %+v", pod.Ports)
+	}
+
+	created, err := clientset.CoreV1().Pods("apps").Get(context.Background(), pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the relay pod to exist: %v", err)
+	}
+	container := created.Spec.Containers[0]
+	if container.Image != DefaultRelayImage {
+		t.Errorf("expected the default image, got %s", container.Image)
+	}
+	if len(container.Args) != 2 || container.Args[0] != "TCP-LISTEN:5432,fork,reuseaddr" || container.Args[1] != "TCP:db.internal:5432" {
+		t.Errorf("unexpected socat arguments %v", container.Args)
+	}
+
+	if err := client.DeleteRelayPod(context.Background(), pod.Name); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	pods, _ := clientset.CoreV1().Pods("apps").List(context.Background(), metav1.ListOptions{})
+	if len(pods.Items) != 0 {
+		t.Errorf("expected the relay pod to be deleted, found %d pods", len(pods.Items))
+	}
+}
+
+// TestCreateRelayPod_ImagePullFailure verifies that a relay pod that cannot start is removed.
+func TestCreateRelayPod_ImagePullFailure(t *testing.T) {
+	clientset := newRelayClientset(corev1.PodStatus{
+		Phase: corev1.PodPending,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "relay",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		}},
+	})
+	client := NewClientForInterface(clientset, "apps")
+
+	if _, err := client.CreateRelayPod(context.Background(), "db.internal", 5432, "registry.invalid/socat", time.Second); err == nil {
+		t.Fatal("expected an error for a relay pod that cannot pull its image")
+	}
+	pods, _ := clientset.CoreV1().Pods("apps").List(context.Background(), metav1.ListOptions{})
+	if len(pods.Items) != 0 {
+		t.Errorf("expected the failed relay pod to be deleted, found %d pods", len(pods.Items))
+	}
+}
@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// retryAttempts is the number of times a list or get call failing with a transient error is made
+const retryAttempts = 4
+
+// retryBackoff spaces the attempts of a call
+var retryBackoff = wait.Backoff{Duration: 250 * time.Millisecond, Factor: 2, Jitter: 0.2, Steps: retryAttempts}
+
+// retryTransient calls fn until it succeeds, fails with an error that is not transient, ctx is
+// done or retryAttempts calls were made, and returns its last error. A single flaky response
+// would otherwise abort the whole interactive session. Denied calls return a *ForbiddenError.
+func retryTransient(ctx context.Context, fn func() error) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == retryAttempts || !isTransient(err) {
+			return asForbidden(err)
+		}
+		timer := time.NewTimer(backoff.Step())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// isTransient reports whether err may go away when the call is repeated: timeouts, throttling,
+// an unavailable API server and connections closed or reset mid-response
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || utilnet.IsProbableEOF(err) || utilnet.IsConnectionReset(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestRetryTransient verifies that transient errors are retried up to retryAttempts times while
+// other errors are returned right away.
+func TestRetryTransient(t *testing.T) {
+	defer func(orig time.Duration) { retryBackoff.Duration = orig }(retryBackoff.Duration)
+	retryBackoff.Duration = time.Millisecond
+
+	podsGR := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", nil, 1, false},
+		{"throttled then success", []error{apierrors.NewTooManyRequests("slow down", 0)}, 2, false},
+		{"timeout and EOF then success", []error{apierrors.NewTimeoutError("busy", 0), io.EOF}, 3, false},
+		{"not found", []error{apierrors.NewNotFound(podsGR, "web-1")}, 1, true},
+		{"always unavailable", []error{
+			apierrors.NewServiceUnavailable("down"), apierrors.NewServiceUnavailable("down"),
+			apierrors.NewServiceUnavailable("down"), apierrors.NewServiceUnavailable("down"),
+		}, retryAttempts, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			calls := 0
+			clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return true, nil, tt.errs[calls-1]
+				}
+				return true, newTestPod(true, 0, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}), nil
+			})
+
+			_, err := NewClientForInterface(clientset, "apps").GetPod(context.Background(), "web-1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+// TestRetryTransient_Forbidden verifies that calls denied by RBAC return a *ForbiddenError
+// matching ErrForbidden.
+func TestRetryTransient_Forbidden(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "web-1", errors.New("no RBAC"))
+	})
+
+	_, err := NewClientForInterface(clientset, "apps").GetPod(context.Background(), "web-1")
+	var forbidden *ForbiddenError
+	if !errors.Is(err, ErrForbidden) || !errors.As(err, &forbidden) {
+		t.Fatalf("expected a forbidden error, got %v", err)
+	}
+	if !apierrors.IsForbidden(err) {
+		t.Error("expected the API server's error to stay available")
+	}
+}
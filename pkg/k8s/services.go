@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -14,8 +18,20 @@ type Service struct {
 	Name      string
 	Namespace string
 	Ports     []ServicePort
+	// Type is the service type, or Headless for ClusterIP services without a cluster IP
+	Type     string
+	Selector map[string]string
+	// ReadyEndpoints is the number of ready backends, or -1 if unknown
+	ReadyEndpoints int
+	Created        time.Time
+	// LocalPorts are the local ports recommended with the local-port annotation, keyed by
+	// service port
+	LocalPorts map[int32]int32
 }
 
+// HeadlessService is the Type reported for services without a cluster IP
+const HeadlessService = "Headless"
+
 // ServicePort represents a port in a Kubernetes service
 type ServicePort struct {
 	Name           string
@@ -26,17 +42,33 @@ type ServicePort struct {
 
 // GetServices retrieves all services in the specified namespace
 func (c *Client) GetServices(ctx context.Context) ([]Service, error) {
-	serviceList, err := c.clientset.CoreV1().Services(c.namespace).List(ctx, metav1.ListOptions{})
+	serviceList, err := c.listServices(ctx, c.namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list services: %w", err)
 	}
 
-	services := make([]Service, 0, len(serviceList.Items))
-	for _, svc := range serviceList.Items {
+	// Endpoint counts are informational, so services are still listed when they cannot be read
+	ready, _ := c.readyEndpoints(ctx, c.namespace)
+
+	services := make([]Service, 0, len(serviceList))
+	for _, svc := range serviceList {
 		service := Service{
-			Name:      svc.Name,
-			Namespace: svc.Namespace,
-			Ports:     make([]ServicePort, 0, len(svc.Spec.Ports)),
+			Name:           svc.Name,
+			Namespace:      svc.Namespace,
+			Ports:          make([]ServicePort, 0, len(svc.Spec.Ports)),
+			Type:           string(svc.Spec.Type),
+			Selector:       svc.Spec.Selector,
+			ReadyEndpoints: -1,
+			Created:        svc.CreationTimestamp.Time,
+		}
+		if service.Type == "" {
+			service.Type = string(corev1.ServiceTypeClusterIP)
+		}
+		if svc.Spec.ClusterIP == corev1.ClusterIPNone {
+			service.Type = HeadlessService
+		}
+		if ready != nil {
+			service.ReadyEndpoints = ready[svc.Namespace+"/"+svc.Name]
 		}
 
 		for _, port := range svc.Spec.Ports {
@@ -53,15 +85,86 @@ func (c *Client) GetServices(ctx context.Context) ([]Service, error) {
 			service.Ports = append(service.Ports, servicePort)
 		}
 
+		// Ports advertised with the ports annotation are forwarded to the same port of a backing pod
+		for _, annotated := range ParsePortsAnnotation(svc.Annotations[PortsAnnotation]) {
+			if hasServicePort(service.Ports, annotated.Port) {
+				continue
+			}
+			targetPort := intstr.FromInt32(annotated.Port)
+			service.Ports = append(service.Ports, ServicePort{
+				Name:           annotated.Name,
+				Port:           annotated.Port,
+				Protocol:       string(corev1.ProtocolTCP),
+				TargetPortSpec: &targetPort,
+			})
+		}
+
+		if len(service.Ports) > 0 {
+			service.LocalPorts = parseLocalPortAnnotation(svc.Annotations[LocalPortAnnotation], service.Ports[0].Port)
+		}
+
 		services = append(services, service)
 	}
 
 	return services, nil
 }
 
-// GetPodsForService returns pods matching a service's selector
+// hasServicePort reports whether ports include the service port number
+func hasServicePort(ports []ServicePort, number int32) bool {
+	for _, port := range ports {
+		if port.Port == number {
+			return true
+		}
+	}
+	return false
+}
+
+// readyEndpoints counts the ready endpoints of each service in namespace, keyed by
+// namespace/name. Endpoints listed for several address families are counted once.
+func (c *Client) readyEndpoints(ctx context.Context, namespace string) (map[string]int, error) {
+	slices, err := c.listEndpointSlices(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]map[string]bool)
+	for _, slice := range slices {
+		serviceName := slice.Labels[discoveryv1.LabelServiceName]
+		if serviceName == "" {
+			continue
+		}
+		key := slice.Namespace + "/" + serviceName
+		if seen[key] == nil {
+			seen[key] = make(map[string]bool)
+		}
+		for _, endpoint := range slice.Endpoints {
+			// A nil ready condition means ready
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			id := strings.Join(endpoint.Addresses, ",")
+			if endpoint.TargetRef != nil {
+				id = endpoint.TargetRef.Kind + "/" + endpoint.TargetRef.Name
+			}
+			seen[key][id] = true
+		}
+	}
+
+	ready := make(map[string]int, len(seen))
+	for key, endpoints := range seen {
+		ready[key] = len(endpoints)
+	}
+	return ready, nil
+}
+
+// GetPodsForService returns pods matching the selector of a service in the current namespace
 func (c *Client) GetPodsForService(ctx context.Context, serviceName string) ([]Pod, error) {
-	service, err := c.clientset.CoreV1().Services(c.namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	return c.GetPodsForServiceInNamespace(ctx, c.namespace, serviceName)
+}
+
+// GetPodsForServiceInNamespace returns pods matching the selector of a service in namespace
+func (c *Client) GetPodsForServiceInNamespace(ctx context.Context, namespace, serviceName string) ([]Pod, error) {
+	service, err := c.getService(ctx, namespace, serviceName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get service %s: %w", serviceName, err)
 	}
@@ -71,71 +174,17 @@ func (c *Client) GetPodsForService(ctx context.Context, serviceName string) ([]P
 		return nil, fmt.Errorf("service %s does not have a selector", serviceName)
 	}
 
-	// Build label selector string from the service's selector
-	var labelSelectors []string
-	for key, value := range service.Spec.Selector {
-		labelSelectors = append(labelSelectors, fmt.Sprintf("%s=%s", key, value))
-	}
-	labelSelector := metav1.FormatLabelSelector(&metav1.LabelSelector{
-		MatchLabels: service.Spec.Selector,
-	})
-
 	// List pods matching the service's selector
-	podList, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
+	podList, err := c.listPods(ctx, namespace, labels.SelectorFromSet(service.Spec.Selector), fields.Everything())
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pods for service %s: %w", serviceName, err)
 	}
 
-	if len(podList.Items) == 0 {
-		return nil, fmt.Errorf("no pods found for service %s", serviceName)
-	}
-
-	// Convert to our Pod type
-	pods := make([]Pod, 0, len(podList.Items))
-	for _, p := range podList.Items {
-		pod := Pod{
-			Name:      p.Name,
-			Namespace: p.Namespace,
-			Ports:     []PodPort{},
-		}
-
-		// Add ports from init containers
-		for _, container := range p.Spec.InitContainers {
-			for _, port := range container.Ports {
-				podPort := PodPort{
-					Name:            port.Name,
-					ContainerPort:   port.ContainerPort,
-					Protocol:        string(port.Protocol),
-					ContainerName:   container.Name,
-					IsInitContainer: true,
-				}
-				pod.Ports = append(pod.Ports, podPort)
-			}
-		}
-
-		// Add ports from regular containers
-		for _, container := range p.Spec.Containers {
-			for _, port := range container.Ports {
-				podPort := PodPort{
-					Name:            port.Name,
-					ContainerPort:   port.ContainerPort,
-					Protocol:        string(port.Protocol),
-					ContainerName:   container.Name,
-					IsInitContainer: false,
-				}
-				pod.Ports = append(pod.Ports, podPort)
-			}
-		}
-
-		// Only add pods with ports
-		if len(pod.Ports) > 0 {
-			pods = append(pods, pod)
-		}
+	if len(podList) == 0 {
+		return nil, fmt.Errorf("%w for service %s", ErrNoPods, serviceName)
 	}
 
-	return pods, nil
+	return podsWithPorts(podList), nil
 }
 
 // formatTargetPort returns a string representation of a targetPort from a ServicePort
@@ -157,8 +206,30 @@ func formatTargetPort(port ServicePort) string {
 	}
 }
 
-// ServiceToString returns a string representation of a service
+// ServiceToString returns a string representation of a service including its type, ready
+// endpoints and selector, so services without backends stand out
 func ServiceToString(service Service) string {
+	description := servicePortsToString(service)
+	if service.Type == "" {
+		return description
+	}
+
+	details := []string{service.Type}
+	if service.ReadyEndpoints == 1 {
+		details = append(details, "1 ready endpoint")
+	} else if service.ReadyEndpoints >= 0 {
+		details = append(details, fmt.Sprintf("%d ready endpoints", service.ReadyEndpoints))
+	}
+	if len(service.Selector) == 0 {
+		details = append(details, "no selector")
+	} else {
+		details = append(details, labels.SelectorFromSet(service.Selector).String())
+	}
+	return fmt.Sprintf("%s [%s]", description, strings.Join(details, ", "))
+}
+
+// servicePortsToString returns a service's name with a summary of its ports
+func servicePortsToString(service Service) string {
 	if len(service.Ports) == 0 {
 		return fmt.Sprintf("%s (no ports)", service.Name)
 	}
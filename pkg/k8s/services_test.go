@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestGetServices_Details verifies service types, selectors and ready endpoint counts.
+func TestGetServices_Details(t *testing.T) {
+	ready, notReady := true, false
+	clientset := fake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Selector: map[string]string{"app": "web"},
+				Ports:    []corev1.ServicePort{{Port: 80, Protocol: corev1.ProtocolTCP}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "apps"},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: corev1.ClusterIPNone,
+				Ports:     []corev1.ServicePort{{Port: 5432, Protocol: corev1.ProtocolTCP}},
+			},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web-abc",
+				Namespace: "apps",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+			},
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+				{Addresses: []string{"10.0.0.2"}},
+				{Addresses: []string{"10.0.0.3"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+			},
+		},
+	)
+
+	services, err := NewClientForInterface(clientset, "apps").GetServices(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, svc := range services {
+		got[svc.Name] = ServiceToString(svc)
+	}
+	want := map[string]string{
+		"web": "web (80->80/TCP) [ClusterIP, 2 ready endpoints, app=web]",
+		"db":  "db (5432->5432/TCP) [Headless, 0 ready endpoints, no selector]",
+	}
+	for name, description := range want {
+		if got[name] != description {
+			t.Errorf("expected %q, got %q", description, got[name])
+		}
+	}
+}
+
+// TestGetPodsForService_NotDeployed verifies that missing services and services without pods
+// can be told apart from other errors, so callers can wait for them to be deployed.
+func TestGetPodsForService_NotDeployed(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "apps"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	})
+	client := NewClientForInterface(clientset, "apps")
+
+	if _, err := client.GetPodsForServiceInNamespace(context.Background(), "apps", "web"); !errors.Is(err, ErrNoPods) {
+		t.Errorf("expected ErrNoPods, got %v", err)
+	}
+	if _, err := client.GetPodsForServiceInNamespace(context.Background(), "apps", "api"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+// Package model defines the resources kubectl-pfw forwards to. It has no dependencies on the
+// interactive UI, so it can be imported by programs embedding the forwarding engine.
+package model
@@ -0,0 +1,227 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ResourceType represents the type of Kubernetes resource
+type ResourceType string
+
+const (
+	// ServiceResource represents a Kubernetes service
+	ServiceResource ResourceType = "service"
+	// PodResource represents a Kubernetes pod
+	PodResource ResourceType = "pod"
+	// DeploymentResource represents a Kubernetes deployment
+	DeploymentResource ResourceType = "deployment"
+	// StatefulSetResource represents a Kubernetes statefulset
+	StatefulSetResource ResourceType = "statefulset"
+	// CustomResource represents a resource of an arbitrary kind listed with --resource
+	CustomResource ResourceType = "custom"
+)
+
+// Resource represents a Kubernetes resource that can be port-forwarded
+type Resource struct {
+	Name            string
+	Namespace       string
+	Type            ResourceType
+	Ports           []int32               // ServicePort or ContainerPort
+	PortNames       []string              // Name of the port (if specified)
+	TargetPortSpecs []*intstr.IntOrString // For services, the original targetPort spec
+	DisplayName     string
+	PortMetadata    []k8s.PortMetadata // Additional metadata about ports (like init container info)
+	// Protocols are the protocols of the ports (TCP, UDP or SCTP), empty when unknown
+	Protocols []string
+	// Context is the kubeconfig context the resource belongs to; empty for the session's default
+	Context string
+	// LocalPorts are the local ports recommended by the resource's annotations, keyed by port
+	LocalPorts map[int32]int32
+	// Created is the creation time of the resource, zero if unknown
+	Created time.Time
+	// Scheme is the URL scheme of the resource's ports, e.g. https; empty to detect it per port
+	Scheme string
+	// Notes describe the resource in reports, e.g. the notes of its configuration entry
+	Notes string
+	// As and AsGroups are the user and groups impersonated to look up and forward the resource;
+	// empty to use the identity of its context
+	As       string
+	AsGroups []string
+	// PodSelector, Node and Zone restrict the pods backing a service or workload to those
+	// matching the label selector, scheduled on the node and running in the topology zone;
+	// empty ones fall back to the session's settings
+	PodSelector string
+	Node        string
+	Zone        string
+}
+
+// ClusterKey identifies the clients used for the resource: its context, or for resources
+// impersonating a user, the context, namespace, user and groups
+func (r Resource) ClusterKey() string {
+	if r.As == "" {
+		return r.Context
+	}
+	return strings.Join([]string{r.Context, r.Namespace, r.As, strings.Join(r.AsGroups, ",")}, "|")
+}
+
+// Key identifies the resource across contexts and namespaces, e.g. prod/default/service/web,
+// for maps holding data per resource
+func (r Resource) Key() string {
+	return strings.Join([]string{r.Context, r.Namespace, string(r.Type), r.Name}, "/")
+}
+
+// NewResourceFromService creates a Resource from a k8s.Service
+func NewResourceFromService(svc k8s.Service) Resource {
+	ports := make([]int32, len(svc.Ports))
+	portNames := make([]string, len(svc.Ports))
+	targetPortSpecs := make([]*intstr.IntOrString, len(svc.Ports))
+	protocols := make([]string, len(svc.Ports))
+
+	for i, port := range svc.Ports {
+		ports[i] = port.Port
+		portNames[i] = port.Name
+		targetPortSpecs[i] = port.TargetPortSpec
+		protocols[i] = port.Protocol
+	}
+
+	return Resource{
+		Name:            svc.Name,
+		Namespace:       svc.Namespace,
+		Type:            ServiceResource,
+		Ports:           ports,
+		PortNames:       portNames,
+		TargetPortSpecs: targetPortSpecs,
+		Protocols:       protocols,
+		DisplayName:     k8s.ServiceToString(svc),
+		LocalPorts:      svc.LocalPorts,
+		Created:         svc.Created,
+	}
+}
+
+// NewResourceFromPod creates a Resource from a k8s.Pod
+func NewResourceFromPod(pod k8s.Pod) Resource {
+	ports := make([]int32, len(pod.Ports))
+	portNames := make([]string, len(pod.Ports))
+	targetPortSpecs := make([]*intstr.IntOrString, len(pod.Ports))
+	portMetadata := make([]k8s.PortMetadata, len(pod.Ports))
+	protocols := make([]string, len(pod.Ports))
+
+	for i, port := range pod.Ports {
+		ports[i] = port.ContainerPort
+		portNames[i] = port.Name
+		protocols[i] = port.Protocol
+		intOrStr := intstr.FromInt(int(port.ContainerPort))
+		targetPortSpecs[i] = &intOrStr
+
+		// Store metadata about the port
+		portMetadata[i] = k8s.PortMetadata{
+			ContainerName:        port.ContainerName,
+			IsInitContainer:      port.IsInitContainer,
+			IsEphemeralContainer: port.IsEphemeralContainer,
+		}
+	}
+
+	return Resource{
+		Name:            pod.Name,
+		Namespace:       pod.Namespace,
+		Type:            PodResource,
+		Ports:           ports,
+		PortNames:       portNames,
+		TargetPortSpecs: targetPortSpecs,
+		DisplayName:     k8s.PodToString(pod),
+		PortMetadata:    portMetadata,
+		Protocols:       protocols,
+		LocalPorts:      pod.LocalPorts,
+		Created:         pod.Created,
+	}
+}
+
+// NewResourceFromDeployment creates a Resource from a k8s.Deployment
+func NewResourceFromDeployment(deployment k8s.Deployment) Resource {
+	// For deployments, ports will be populated when resolving pods
+	return Resource{
+		Name:        deployment.Name,
+		Namespace:   deployment.Namespace,
+		Type:        DeploymentResource,
+		Ports:       []int32{},  // Will be populated when selecting a pod
+		PortNames:   []string{}, // Will be populated when selecting a pod
+		DisplayName: k8s.DeploymentToString(deployment),
+		Created:     deployment.Created,
+	}
+}
+
+// NewResourceFromStatefulSet creates a Resource from a k8s.StatefulSet
+func NewResourceFromStatefulSet(statefulSet k8s.StatefulSet) Resource {
+	// For statefulsets, ports will be populated when resolving pods
+	return Resource{
+		Name:        statefulSet.Name,
+		Namespace:   statefulSet.Namespace,
+		Type:        StatefulSetResource,
+		Ports:       []int32{},  // Will be populated when selecting a pod
+		PortNames:   []string{}, // Will be populated when selecting a pod
+		DisplayName: k8s.StatefulSetToString(statefulSet),
+		Created:     statefulSet.Created,
+	}
+}
+
+// NewResourceFromCustomResource creates a Resource from a k8s.CustomResource
+func NewResourceFromCustomResource(custom k8s.CustomResource) Resource {
+	// For custom resources, ports will be populated when resolving pods
+	return Resource{
+		Name:        custom.Name,
+		Namespace:   custom.Namespace,
+		Type:        CustomResource,
+		Ports:       []int32{},  // Will be populated when selecting a pod
+		PortNames:   []string{}, // Will be populated when selecting a pod
+		DisplayName: k8s.CustomResourceToString(custom),
+		Created:     custom.Created,
+	}
+}
+
+// PreferredLocalPort returns the local port recommended for the port at index i, or 0
+func (r Resource) PreferredLocalPort(i int) int32 {
+	if i < 0 || i >= len(r.Ports) {
+		return 0
+	}
+	return r.LocalPorts[r.Ports[i]]
+}
+
+// PortProtocol returns the protocol of the port at index i, or "" if unknown
+func (r Resource) PortProtocol(i int) string {
+	if i < 0 || i >= len(r.Protocols) {
+		return ""
+	}
+	return r.Protocols[i]
+}
+
+// WithPorts returns a copy of the resource exposing only the ports at the given indices, in order
+func (r Resource) WithPorts(indices []int) Resource {
+	narrowed := r
+	narrowed.Ports = make([]int32, 0, len(indices))
+	narrowed.PortNames = make([]string, 0, len(indices))
+	narrowed.TargetPortSpecs = nil
+	narrowed.PortMetadata = nil
+	narrowed.Protocols = nil
+	for _, i := range indices {
+		narrowed.Ports = append(narrowed.Ports, r.Ports[i])
+		if i < len(r.PortNames) {
+			narrowed.PortNames = append(narrowed.PortNames, r.PortNames[i])
+		} else {
+			narrowed.PortNames = append(narrowed.PortNames, "")
+		}
+		if i < len(r.TargetPortSpecs) {
+			narrowed.TargetPortSpecs = append(narrowed.TargetPortSpecs, r.TargetPortSpecs[i])
+		}
+		if i < len(r.PortMetadata) {
+			narrowed.PortMetadata = append(narrowed.PortMetadata, r.PortMetadata[i])
+		}
+		if i < len(r.Protocols) {
+			narrowed.Protocols = append(narrowed.Protocols, r.Protocols[i])
+		}
+	}
+	return narrowed
+}
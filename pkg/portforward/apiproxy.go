@@ -0,0 +1,141 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/proxy"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+// APIProxy serves the Kubernetes API of a REST config on a loopback port without
+// authentication, like kubectl proxy. Tunnels dialed through it upgrade a plain HTTP connection
+// to localhost, while the proxy opens its own HTTP/1.1 upgrade to the API server. This gets
+// port-forwarding through networks whose TLS-intercepting proxies break the upgrades of
+// client-go but pass those of kubectl proxy.
+type APIProxy struct {
+	// URL is the address of the proxy, e.g. http://127.0.0.1:41234
+	URL    string
+	server *http.Server
+}
+
+// StartAPIProxy starts an API proxy for config on a free loopback port. It serves until ctx is
+// done or Close is called.
+func StartAPIProxy(ctx context.Context, config *rest.Config) (*APIProxy, error) {
+	target, _, err := rest.DefaultServerUrlFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server address: %w", err)
+	}
+	roundTripper, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API proxy transport: %w", err)
+	}
+	upgradeTransport, err := upgradeTransportFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API proxy transport: %w", err)
+	}
+
+	handler := proxy.NewUpgradeAwareHandler(target, roundTripper, false, false, proxyErrorResponder{})
+	handler.UpgradeTransport = upgradeTransport
+	handler.UseRequestLocation = true
+	handler.UseLocationHost = true
+	// Keep the path of API servers behind gateways, e.g. https://rancher/k8s/clusters/c-1
+	handler.AppendLocationPath = true
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the API proxy: %w", err)
+	}
+	p := &APIProxy{
+		URL:    "http://" + listener.Addr().String(),
+		server: &http.Server{Handler: handler, ReadHeaderTimeout: 30 * time.Second},
+	}
+	// Serve only returns once the proxy is closed
+	go func() { _ = p.server.Serve(listener) }()
+	go func() {
+		<-ctx.Done()
+		p.Close()
+	}()
+	return p, nil
+}
+
+// Config returns a REST config reaching the API server through the proxy
+func (p *APIProxy) Config() *rest.Config {
+	return &rest.Config{Host: p.URL}
+}
+
+// Close stops the proxy and closes its connections, including running tunnels
+func (p *APIProxy) Close() error {
+	return p.server.Close()
+}
+
+// upgradeTransportFor returns the transport upgrading proxied connections, which speaks
+// HTTP/1.1 as upgrades are not possible over HTTP/2
+func upgradeTransportFor(config *rest.Config) (proxy.UpgradeRequestRoundTripper, error) {
+	transportConfig, err := config.TransportConfig()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := transport.TLSConfigFor(transportConfig)
+	if err != nil {
+		return nil, err
+	}
+	roundTripper := utilnet.SetOldTransportDefaults(&http.Transport{
+		TLSClientConfig: tlsConfig,
+		DialContext:     (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+	})
+	upgrader, err := transport.HTTPWrappersForConfig(transportConfig, proxy.MirrorRequest)
+	if err != nil {
+		return nil, err
+	}
+	return proxy.NewUpgradeRequestRoundTripper(roundTripper, upgrader), nil
+}
+
+// proxyErrorResponder answers requests the proxy could not forward with a bad gateway error
+type proxyErrorResponder struct{}
+
+func (proxyErrorResponder) Error(w http.ResponseWriter, req *http.Request, err error) {
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+// ProxyDialerFactory dials pods through an APIProxy, started when the first tunnel is dialed
+type ProxyDialerFactory struct {
+	ctx        context.Context
+	restConfig *rest.Config
+	once       sync.Once
+	dialers    *SPDYDialerFactory
+	err        error
+}
+
+// NewProxyDialerFactory creates a DialerFactory tunneling through an API proxy for restConfig
+// that serves until ctx is done
+func NewProxyDialerFactory(ctx context.Context, restConfig *rest.Config) *ProxyDialerFactory {
+	return &ProxyDialerFactory{ctx: ctx, restConfig: restConfig}
+}
+
+// DialerFor returns a SPDY dialer for the pod's port-forward endpoint behind the proxy
+func (f *ProxyDialerFactory) DialerFor(namespace, podName string) (httpstream.Dialer, error) {
+	f.once.Do(func() {
+		if f.restConfig == nil {
+			f.err = fmt.Errorf("no REST config to start an API proxy for")
+			return
+		}
+		p, err := StartAPIProxy(f.ctx, f.restConfig)
+		if err != nil {
+			f.err = err
+			return
+		}
+		f.dialers = NewSPDYDialerFactory(p.Config())
+	})
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.dialers.DialerFor(namespace, podName)
+}
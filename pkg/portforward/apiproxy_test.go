@@ -0,0 +1,60 @@
+package portforward
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// TestAPIProxy verifies that requests to the proxy reach the API server under its path and
+// with the credentials of the REST config.
+func TestAPIProxy(t *testing.T) {
+	var gotPath, gotAuth string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		io.WriteString(w, `{"kind":"NamespaceList"}`)
+	}))
+	defer apiServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := StartAPIProxy(ctx, &rest.Config{Host: apiServer.URL + "/k8s/clusters/c-1", BearerToken: "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := http.Get(p.URL + "/api/v1/namespaces")
+	if err != nil {
+		t.Fatalf("request through the proxy failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"kind":"NamespaceList"}` {
+		t.Fatalf("unexpected response %d: %s", resp.StatusCode, body)
+	}
+	if gotPath != "/k8s/clusters/c-1/api/v1/namespaces" {
+		t.Errorf("expected the API server path to be kept, got %s", gotPath)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("expected the bearer token to be sent, got %q", gotAuth)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.Get(p.URL + "/api/v1/namespaces")
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("expected the proxy to stop with its context")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
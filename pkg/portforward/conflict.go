@@ -0,0 +1,314 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/state"
+)
+
+// errForwardedElsewhere is returned when another pfw process already serves the exact same
+// forward, so it is reused instead of started again
+var errForwardedElsewhere = errors.New("already forwarded by another kubectl-pfw process")
+
+// maxRemapSuggestionDistance bounds the search for a free port to suggest on conflicts
+const maxRemapSuggestionDistance = 100
+
+// describePortConflict explains who holds a busy local port: another pfw process from the
+// shared state file, a `kubectl port-forward` process, or an unknown process
+func (m *Manager) describePortConflict(port int32) string {
+	if m.Registry != nil {
+		if owner, err := m.Registry.Lookup(port); err == nil && owner != nil {
+			return fmt.Sprintf("used by kubectl-pfw forwarding %s", owner)
+		}
+	}
+	if pid, cmdline, ok := findKubectlPortForward(port); ok {
+		return fmt.Sprintf("used by kubectl port-forward (pid %d: %s)", pid, cmdline)
+	}
+	if hint := reservedPortHint(port); hint != "" {
+		return hint
+	}
+	if !IsPortAvailable(port) {
+		return "in use by another process"
+	}
+	return "already allocated in this session"
+}
+
+// ConflictStrategy says what to do when a requested local port is busy
+type ConflictStrategy string
+
+const (
+	// ConflictFail fails the forward, naming the process holding the port
+	ConflictFail ConflictStrategy = "fail"
+	// ConflictIncrement forwards on the next free port above the requested one
+	ConflictIncrement ConflictStrategy = "increment"
+	// ConflictEphemeral forwards on a free port chosen by the system, or from the local port range
+	ConflictEphemeral ConflictStrategy = "ephemeral"
+)
+
+// substitutePort reserves another local port for a busy requested localPort according to
+// OnConflict and reports the substitution. It returns false when the forward should fail.
+func (m *Manager) substitutePort(resource model.Resource, localPort, remotePort int32) (int32, bool) {
+	var substitute int32
+	switch m.OnConflict {
+	case ConflictIncrement:
+		for candidate := localPort + 1; candidate <= localPort+maxRemapSuggestionDistance && candidate <= 65535; candidate++ {
+			if _, err := m.PortAllocator.AllocatePort(candidate); err == nil {
+				substitute = candidate
+				break
+			}
+		}
+	case ConflictEphemeral:
+		if port, err := m.PortAllocator.AllocatePort(0); err == nil {
+			substitute = port
+		}
+	}
+	if substitute == 0 {
+		return 0, false
+	}
+
+	m.Log().Warn(fmt.Sprintf("Local port %d is %s; forwarding %s/%s port %d on localhost:%d instead",
+		localPort, m.describePortConflict(localPort), resource.Type, resource.Name, remotePort, substitute),
+		append(forwardAttrs(resource, substitute, remotePort), "event", "remapped", "requestedPort", localPort)...)
+	return substitute, true
+}
+
+// checkPortConflict is called when a requested local port cannot be reserved. If another pfw
+// process serves the same resource and remote port there, errForwardedElsewhere is returned so
+// the existing forward is reused; otherwise a *PortConflictError names the conflicting process
+// and suggests a free port to re-map to.
+func (m *Manager) checkPortConflict(resource model.Resource, localPort, remotePort int32) error {
+	if m.Registry != nil {
+		if owner, err := m.Registry.Lookup(localPort); err == nil && owner != nil &&
+			owner.Namespace == resource.Namespace && owner.Type == string(resource.Type) &&
+			owner.Name == resource.Name && owner.RemotePort == remotePort &&
+			owner.Context == m.contextFor(resource) {
+			m.Log().Info(fmt.Sprintf("Reusing existing forward of %s/%s port %d on localhost:%d (kubectl-pfw pid %d)",
+				resource.Type, resource.Name, remotePort, localPort, owner.PID),
+				append(forwardAttrs(resource, localPort, remotePort), "event", "reused", "pid", owner.PID)...)
+			return errForwardedElsewhere
+		}
+	}
+
+	return &PortConflictError{
+		Port:       localPort - m.PortOffset,
+		LocalPort:  localPort,
+		RemotePort: remotePort,
+		Reason:     m.describePortConflict(localPort),
+		Suggestion: suggestFreePort(localPort),
+	}
+}
+
+// PortConflictError is returned when a requested local port is busy
+type PortConflictError struct {
+	// Port is the local port as requested, before PortOffset is added
+	Port int32
+	// LocalPort is the busy port, with PortOffset added
+	LocalPort  int32
+	RemotePort int32
+	// Reason explains who holds the port, e.g. "in use by another process"
+	Reason string
+	// Suggestion is a nearby free port, or 0 if none was found
+	Suggestion int32
+}
+
+// Is makes the error match ErrPortInUse
+func (e *PortConflictError) Is(target error) bool {
+	return target == ErrPortInUse
+}
+
+func (e *PortConflictError) Error() string {
+	msg := fmt.Sprintf("local port %d is %s", e.LocalPort, e.Reason)
+	if e.Suggestion != 0 {
+		msg += fmt.Sprintf("; choose another local port such as %d", e.Suggestion)
+	}
+	return msg
+}
+
+// LocalPortRequest is a local port asked for by a forward that is about to start
+type LocalPortRequest struct {
+	Resource   model.Resource
+	LocalPort  int32
+	RemotePort int32
+}
+
+// CheckLocalPorts verifies the requested local ports before any forward starts, so every
+// duplicate and busy port is reported at once instead of failing after other tunnels came up.
+// Requests for port 0 are skipped, as are ports another pfw process already serves for the same
+// resource, which are reused, and privileged ports left to the privileged helper. Requested
+// ports are checked with PortOffset added. A resource
+// and remote port listed twice on the same local port is forwarded once, so it is no conflict.
+func (m *Manager) CheckLocalPorts(requests []LocalPortRequest) error {
+	requestedBy := make(map[int32]LocalPortRequest)
+	var conflicts []string
+	for _, req := range requests {
+		if err := m.checkOffset(req.Resource, req.LocalPort); err != nil {
+			conflicts = append(conflicts, err.Error())
+			continue
+		}
+		req.LocalPort = m.withOffset(req.LocalPort)
+		if req.LocalPort == 0 {
+			continue
+		}
+		resource := req.Resource
+		if first, ok := requestedBy[req.LocalPort]; ok {
+			if first.RemotePort == req.RemotePort && first.Resource.Context == resource.Context &&
+				first.Resource.Namespace == resource.Namespace && first.Resource.Type == resource.Type && first.Resource.Name == resource.Name {
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("local port %d is requested by both %s/%s and %s/%s",
+				req.LocalPort, first.Resource.Type, first.Resource.Name, resource.Type, resource.Name))
+			continue
+		}
+		requestedBy[req.LocalPort] = req
+
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", req.LocalPort))
+		if err == nil {
+			listener.Close()
+			continue
+		}
+		if privilegedPortsEnforced && req.LocalPort < PrivilegedPortLimit && isPermissionDenied(err) {
+			continue
+		}
+		if m.Registry != nil {
+			if owner, err := m.Registry.Lookup(req.LocalPort); err == nil && owner != nil &&
+				owner.Namespace == resource.Namespace && owner.Type == string(resource.Type) &&
+				owner.Name == resource.Name && owner.Context == m.contextFor(resource) {
+				continue
+			}
+		}
+
+		msg := fmt.Sprintf("local port %d for %s/%s is %s", req.LocalPort, resource.Type, resource.Name, m.describePortConflict(req.LocalPort))
+		if free := suggestFreePort(req.LocalPort); free != 0 {
+			msg += fmt.Sprintf("; choose another local port such as %d", free)
+		}
+		conflicts = append(conflicts, msg)
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return withSentinel(ErrPortInUse, fmt.Errorf("%d local port conflict(s), nothing was started:\n  - %s", len(conflicts), strings.Join(conflicts, "\n  - ")))
+}
+
+// suggestFreePort returns the first available port above port, or 0 if none is found nearby
+func suggestFreePort(port int32) int32 {
+	for candidate := port + 1; candidate <= port+maxRemapSuggestionDistance && candidate <= 65535; candidate++ {
+		if IsPortAvailable(candidate) {
+			return candidate
+		}
+	}
+	return 0
+}
+
+// isKubectlPortForward reports whether args are a `kubectl port-forward` invocation binding
+// localPort. Port arguments take the forms LOCAL:REMOTE and PORT.
+func isKubectlPortForward(args []string, localPort int32) bool {
+	if len(args) < 2 || !strings.HasPrefix(filepath.Base(args[0]), "kubectl") {
+		return false
+	}
+
+	portForward := false
+	for _, arg := range args[1:] {
+		if arg == "port-forward" || arg == "pf" {
+			portForward = true
+			continue
+		}
+		if !portForward || strings.HasPrefix(arg, "-") {
+			continue
+		}
+		local := strings.SplitN(arg, ":", 2)[0]
+		if p, err := strconv.Atoi(local); err == nil && int32(p) == localPort {
+			return true
+		}
+	}
+	return false
+}
+
+// registerForward records every port of a started forward in the shared state file
+func (m *Manager) registerForward(req ForwardRequest) {
+	if m.Registry == nil {
+		return
+	}
+	for _, port := range req.ports() {
+		err := m.Registry.Register(state.ActiveForward{
+			LocalPort:  port.LocalPort,
+			Context:    m.contextFor(req.Resource),
+			Namespace:  req.Resource.Namespace,
+			Type:       string(req.Resource.Type),
+			Name:       req.Resource.Name,
+			RemotePort: port.RemotePort,
+			Pod:        req.targetPod(),
+			Scheme:     port.Scheme,
+			Notes:      req.Resource.Notes,
+			Session:    m.SessionName,
+		})
+		if err != nil {
+			m.Log().Warn(fmt.Sprintf("Failed to record forward on port %d: %v", port.LocalPort, err),
+				"localPort", port.LocalPort, "error", err.Error())
+		}
+	}
+}
+
+// recordRetry counts a reconnection attempt of the forward on localPort in the shared state
+// file, so pfw status shows flapping forwards
+func (m *Manager) recordRetry(localPort int32, retryErr error) {
+	if m.Registry == nil {
+		return
+	}
+	if err := m.Registry.RecordRetry(localPort, retryErr.Error()); err != nil {
+		m.Log().Warn(fmt.Sprintf("Failed to record retry of forward on port %d: %v", localPort, err),
+			"localPort", localPort, "error", err.Error())
+	}
+}
+
+// recordReconnect records in the shared state file that the tunnel of the forward on
+// localPort was re-established, so pfw status shows its uptime since then
+func (m *Manager) recordReconnect(localPort int32) {
+	if m.Registry == nil {
+		return
+	}
+	if err := m.Registry.RecordConnected(localPort); err != nil {
+		m.Log().Warn(fmt.Sprintf("Failed to record reconnection of forward on port %d: %v", localPort, err),
+			"localPort", localPort, "error", err.Error())
+	}
+}
+
+// recordPod records in the shared state file that the forward on localPort is now carried by
+// pod, so pfw status shows where it goes
+func (m *Manager) recordPod(localPort int32, pod string) {
+	if m.Registry == nil {
+		return
+	}
+	if err := m.Registry.RecordPod(localPort, pod); err != nil {
+		m.Log().Warn(fmt.Sprintf("Failed to record pod of forward on port %d: %v", localPort, err),
+			"localPort", localPort, "error", err.Error())
+	}
+}
+
+// unregisterForward removes a finished forward from the shared state file
+func (m *Manager) unregisterForward(localPort int32) {
+	if m.Registry == nil {
+		return
+	}
+	if err := m.Registry.Unregister(localPort); err != nil {
+		m.Log().Warn(fmt.Sprintf("Failed to remove forward on port %d from state: %v", localPort, err),
+			"localPort", localPort, "error", err.Error())
+	}
+}
+
+// contextFor returns the kubeconfig context of a resource, if known
+func (m *Manager) contextFor(resource model.Resource) string {
+	if resource.Context != "" {
+		return resource.Context
+	}
+	if m.K8sClient == nil {
+		return ""
+	}
+	return m.K8sClient.GetContext()
+}
@@ -0,0 +1,108 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// TestIsKubectlPortForward verifies detection of kubectl port-forward command lines.
+func TestIsKubectlPortForward(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"kubectl", "port-forward", "svc/web", "8080:80"}, true},
+		{[]string{"/usr/local/bin/kubectl", "-n", "dev", "port-forward", "pod/api", "8080"}, true},
+		{[]string{"kubectl", "port-forward", "svc/web", "9090:8080"}, false},
+		{[]string{"kubectl", "get", "pods", "8080"}, false},
+		{[]string{"curl", "port-forward", "8080"}, false},
+	}
+	for _, tt := range tests {
+		if got := isKubectlPortForward(tt.args, 8080); got != tt.want {
+			t.Errorf("isKubectlPortForward(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestCheckLocalPorts verifies that duplicated and busy local ports are all reported together.
+func TestCheckLocalPorts(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer busy.Close()
+	busyPort := int32(busy.Addr().(*net.TCPAddr).Port)
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	free := int32(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	mgr := &Manager{PortAllocator: NewPortAllocator()}
+	web := model.Resource{Name: "web", Namespace: "ns1", Type: model.ServiceResource}
+	api := model.Resource{Name: "api", Namespace: "ns1", Type: model.DeploymentResource}
+	db := model.Resource{Name: "db", Namespace: "ns1", Type: model.StatefulSetResource}
+
+	err = mgr.CheckLocalPorts([]LocalPortRequest{
+		{Resource: web, LocalPort: free, RemotePort: 80},
+		{Resource: api, LocalPort: free, RemotePort: 8080},
+		{Resource: db, LocalPort: busyPort, RemotePort: 5432},
+		{Resource: db, LocalPort: 0, RemotePort: 5433},
+		{Resource: web, LocalPort: free, RemotePort: 80},
+	})
+	if err == nil {
+		t.Fatal("expected conflicts to be reported")
+	}
+	for _, want := range []string{"2 local port conflict(s)", fmt.Sprintf("local port %d is requested by both service/web and deployment/api", free),
+		fmt.Sprintf("local port %d for statefulset/db is", busyPort)} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err.Error())
+		}
+	}
+
+	if err := mgr.CheckLocalPorts([]LocalPortRequest{{Resource: web, LocalPort: free, RemotePort: 80}}); err != nil {
+		t.Errorf("unexpected error for a free port: %v", err)
+	}
+}
+
+// TestAllocateLocalPort_OnConflict verifies that a busy requested port fails by default and is
+// replaced by the next free port or an ephemeral one depending on OnConflict.
+func TestAllocateLocalPort_OnConflict(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer busy.Close()
+	busyPort := int32(busy.Addr().(*net.TCPAddr).Port)
+	web := model.Resource{Name: "web", Namespace: "ns1", Type: model.ServiceResource}
+
+	mgr := &Manager{PortAllocator: NewPortAllocator()}
+	var logs strings.Builder
+	mgr.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	_, err = mgr.allocateLocalPort(web, busyPort, 80, 0)
+	var conflict *PortConflictError
+	if !errors.As(err, &conflict) || conflict.Port != busyPort || conflict.RemotePort != 80 || conflict.Reason == "" {
+		t.Errorf("expected a *PortConflictError for port %d without a conflict strategy, got %v", busyPort, err)
+	}
+
+	mgr.OnConflict = ConflictIncrement
+	port, err := mgr.allocateLocalPort(web, busyPort, 80, 0)
+	if err != nil || port <= busyPort || port > busyPort+maxRemapSuggestionDistance {
+		t.Errorf("expected a port above %d, got %d, %v", busyPort, port, err)
+	}
+	if want := fmt.Sprintf("Local port %d is in use by another process; forwarding service/web port 80 on localhost:%d instead", busyPort, port); !strings.Contains(logs.String(), want) {
+		t.Errorf("expected %q in %q", want, logs.String())
+	}
+
+	mgr.OnConflict = ConflictEphemeral
+	if port, err := mgr.allocateLocalPort(web, busyPort, 80, 0); err != nil || port == 0 || port == busyPort {
+		t.Errorf("expected an ephemeral port, got %d, %v", port, err)
+	}
+}
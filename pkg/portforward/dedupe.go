@@ -0,0 +1,59 @@
+package portforward
+
+import (
+	"fmt"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// reuseDuplicate reports whether a forward of this session already tunnels to remotePort of
+// pod podName, e.g. because two entries name the same service or a service and its
+// deployment, in which case that forward is reused instead of opening a second tunnel. A
+// duplicate explicitly asked for on another local port is still started, with a warning.
+// localPort is the requested local port, or 0 for any. Must be called with m.mutex held.
+func (m *Manager) reuseDuplicate(resource model.Resource, podName string, localPort, remotePort int32) bool {
+	localPort = m.withOffset(localPort)
+	for _, entry := range m.forwards {
+		for _, existing := range entry.statuses() {
+			if existing.PodName != podName || existing.RemotePort != remotePort ||
+				existing.Resource.Namespace != resource.Namespace || existing.Resource.Context != resource.Context {
+				continue
+			}
+
+			attrs := append(forwardAttrs(resource, existing.LocalPort, remotePort), "pod", podName, "duplicateOf", existing.ID)
+			if localPort != 0 && localPort != existing.LocalPort {
+				m.Log().Warn(fmt.Sprintf("%s/%s on localhost:%d duplicates %s/%s on localhost:%d, both tunnel to pod %s port %d",
+					resource.Type, resource.Name, localPort, existing.Resource.Type, existing.Resource.Name, existing.LocalPort, podName, remotePort),
+					append(attrs, "event", "duplicate")...)
+				return false
+			}
+			m.Log().Info(fmt.Sprintf("Reusing forward of %s/%s on localhost:%d for %s/%s, both tunnel to pod %s port %d",
+				existing.Resource.Type, existing.Resource.Name, existing.LocalPort, resource.Type, resource.Name, podName, remotePort),
+				append(attrs, "event", "reused")...)
+			return true
+		}
+	}
+	return false
+}
+
+// reusePlanned reports whether a port planned earlier for the same resource already forwards
+// to remotePort, in which case it is reused like in reuseDuplicate. localPort is the requested
+// local port, or 0 for any.
+func (m *Manager) reusePlanned(resource model.Resource, planned []plannedPort, localPort, remotePort int32) bool {
+	localPort = m.withOffset(localPort)
+	for _, p := range planned {
+		if p.remotePort != remotePort {
+			continue
+		}
+		attrs := append(forwardAttrs(resource, p.localPort, remotePort), "pod", p.podName)
+		if localPort != 0 && localPort != p.localPort {
+			m.Log().Warn(fmt.Sprintf("%s/%s forwards port %d on both localhost:%d and localhost:%d",
+				resource.Type, resource.Name, remotePort, p.localPort, localPort), append(attrs, "event", "duplicate")...)
+			return false
+		}
+		m.Log().Info(fmt.Sprintf("Reusing localhost:%d of %s/%s for another of its ports, both tunnel to port %d",
+			p.localPort, resource.Type, resource.Name, remotePort), append(attrs, "event", "reused")...)
+		return true
+	}
+	return false
+}
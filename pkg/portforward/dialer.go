@@ -0,0 +1,58 @@
+package portforward
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// DialerFactory creates the dialer used to open port-forward connections to a pod. Replacing
+// it allows alternative transports and fake connections in tests.
+type DialerFactory interface {
+	DialerFor(namespace, podName string) (httpstream.Dialer, error)
+}
+
+// SPDYDialerFactory dials the pods/portforward subresource of the API server over SPDY
+type SPDYDialerFactory struct {
+	RestConfig *rest.Config
+}
+
+// NewSPDYDialerFactory creates a DialerFactory using the given REST config
+func NewSPDYDialerFactory(restConfig *rest.Config) *SPDYDialerFactory {
+	return &SPDYDialerFactory{RestConfig: restConfig}
+}
+
+// DialerFor returns a SPDY dialer for the pod's port-forward endpoint
+func (f *SPDYDialerFactory) DialerFor(namespace, podName string) (httpstream.Dialer, error) {
+	if f.RestConfig == nil {
+		return nil, fmt.Errorf("no REST config to dial pod %s/%s", namespace, podName)
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, podName)
+	return newDialer(f.RestConfig, path)
+}
+
+// newDialer creates a SPDY dialer for the given port-forward API path
+func newDialer(restConfig *rest.Config, path string) (httpstream.Dialer, error) {
+	// API proxies are reached over plain HTTP
+	scheme := "https"
+	if strings.HasPrefix(restConfig.Host, "http://") {
+		scheme = "http"
+	}
+	hostIP := strings.TrimPrefix(strings.TrimPrefix(restConfig.Host, "https://"), "http://")
+
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create round tripper: %w", err)
+	}
+
+	return spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, &url.URL{
+		Scheme: scheme,
+		Path:   path,
+		Host:   hostIP,
+	}), nil
+}
@@ -0,0 +1,21 @@
+// Package portforward is the multi-forward engine of kubectl-pfw.
+//
+// A Manager forwards the ports of pods, services, deployments and statefulsets, allocating
+// local ports, retrying broken tunnels and tracking every forward by ID:
+//
+//	manager := portforward.NewManager(ctx, restConfig, clientset, client, streams)
+//	ids, err := manager.AddForward(resource, map[int]int32{0: 8080})
+//	...
+//	manager.Stop()
+//	manager.WaitForCompletion()
+//
+// The ports of a resource are carried to its pod by one forwarder over a single connection,
+// but each port keeps a forward ID and status of its own.
+//
+// The supported surface is NewManager and the exported Manager fields and methods
+// (AddForward, RemoveForward, GetStatus, Stop, WaitForCompletion), StartPortForward for single
+// forwards, which carries further ports of the same pod given as ForwardRequest.ExtraPorts, and
+// the PortAllocator. Pods are looked up through the PodResolver given to NewManager, in the
+// namespace of each resource if it also implements NamespacedPodResolver. The package does not
+// prompt or read command line flags.
+package portforward
@@ -0,0 +1,45 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+)
+
+// DockerBridgeInterface is the network interface of Docker's default bridge network on Linux
+const DockerBridgeInterface = "docker0"
+
+// DockerBridgeAddress returns the host's IPv4 address on Docker's default bridge, the gateway
+// of containers on that network. Containers on other bridge networks, such as those created by
+// Compose, can reach it as well.
+func DockerBridgeAddress() (string, error) {
+	iface, err := net.InterfaceByName(DockerBridgeInterface)
+	if err != nil {
+		return "", fmt.Errorf("no %s interface found, is Docker running? %w", DockerBridgeInterface, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to get addresses of %s: %w", DockerBridgeInterface, err)
+	}
+	ip := firstIPv4(addrs)
+	if ip == "" {
+		return "", fmt.Errorf("%s has no IPv4 address", DockerBridgeInterface)
+	}
+	return ip, nil
+}
+
+// firstIPv4 returns the first IPv4 address among addrs, or ""
+func firstIPv4(addrs []net.Addr) string {
+	for _, addr := range addrs {
+		var ip net.IP
+		switch a := addr.(type) {
+		case *net.IPNet:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,20 @@
+package portforward
+
+import (
+	"net"
+	"testing"
+)
+
+// TestFirstIPv4 verifies that IPv6 addresses of the bridge are skipped.
+func TestFirstIPv4(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPNet{IP: net.ParseIP("fe80::42:acff:fe11:1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("172.17.0.1"), Mask: net.CIDRMask(16, 32)},
+	}
+	if got := firstIPv4(addrs); got != "172.17.0.1" {
+		t.Errorf("expected 172.17.0.1, got %q", got)
+	}
+	if got := firstIPv4(addrs[:1]); got != "" {
+		t.Errorf("expected no address, got %q", got)
+	}
+}
@@ -0,0 +1,374 @@
+package portforward
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/state"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// echoDialerFactory hands out connections whose data streams echo everything written to them
+type echoDialerFactory struct {
+	mu   sync.Mutex
+	pods []string
+}
+
+func (f *echoDialerFactory) DialerFor(namespace, podName string) (httpstream.Dialer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pods = append(f.pods, namespace+"/"+podName)
+	return echoDialer{}, nil
+}
+
+type echoDialer struct{}
+
+func (echoDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	return &echoConnection{closed: make(chan bool)}, protocols[0], nil
+}
+
+// echoConnection is a fake port-forward connection to a pod running an echo server
+type echoConnection struct {
+	once   sync.Once
+	closed chan bool
+}
+
+func (c *echoConnection) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	if headers.Get(corev1.StreamType) == corev1.StreamTypeError {
+		// An empty error stream reports success
+		local, remote := net.Pipe()
+		remote.Close()
+		return &pipeStream{Conn: local, headers: headers}, nil
+	}
+	local, remote := net.Pipe()
+	go func() {
+		defer remote.Close()
+		io.Copy(remote, remote)
+	}()
+	return &pipeStream{Conn: local, headers: headers}, nil
+}
+
+func (c *echoConnection) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *echoConnection) CloseChan() <-chan bool             { return c.closed }
+func (c *echoConnection) SetIdleTimeout(time.Duration)       {}
+func (c *echoConnection) RemoveStreams(...httpstream.Stream) {}
+
+// pipeStream adapts one end of a net.Pipe to httpstream.Stream
+type pipeStream struct {
+	net.Conn
+	headers http.Header
+}
+
+func (s *pipeStream) Reset() error         { return s.Conn.Close() }
+func (s *pipeStream) Headers() http.Header { return s.headers }
+func (s *pipeStream) Identifier() uint32   { return 0 }
+
+// newWebClientset returns a fake clientset with service web in ns1 backed by pod web-0
+func newWebClientset() *fake.Clientset {
+	return fake.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "ns1"},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "web"},
+				Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromString("http")}},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "ns1", Labels: map[string]string{"app": "web"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "web",
+					Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+				}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+	)
+}
+
+// recordHandler is a slog.Handler sending every record to the channel
+type recordHandler chan slog.Record
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h recordHandler) Handle(_ context.Context, record slog.Record) error {
+	h <- record
+	return nil
+}
+
+func (h recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h recordHandler) WithGroup(string) slog.Handler { return h }
+
+// recordAttr returns the value of a record's attribute as a string, or ""
+func recordAttr(record slog.Record, key string) string {
+	var value string
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == key {
+			value = attr.Value.String()
+			return false
+		}
+		return true
+	})
+	return value
+}
+
+// webResource returns the service resource for the web service
+func webResource() model.Resource {
+	targetPort := intstr.FromString("http")
+	return model.Resource{
+		Name:            "web",
+		Namespace:       "ns1",
+		Type:            model.ServiceResource,
+		Ports:           []int32{80},
+		TargetPortSpecs: []*intstr.IntOrString{&targetPort},
+	}
+}
+
+// TestManager_ForwardServiceEndToEnd drives a service forward through a fake clientset and
+// a fake dialer and checks that data round-trips through the local port.
+func TestManager_ForwardServiceEndToEnd(t *testing.T) {
+	clientset := newWebClientset()
+	k8sClient := k8s.NewClientForInterface(clientset, "ns1")
+
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, clientset, k8sClient, streams)
+	dialers := &echoDialerFactory{}
+	mgr.Dialers = dialers
+	ready := make(chan ForwardStatus, 1)
+	mgr.OnReady = func(status ForwardStatus) { ready <- status }
+	audit := make(recordHandler, 2)
+	mgr.Audit = slog.New(audit)
+
+	ids, err := mgr.AddForward(webResource(), map[int]int32{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("expected 1 forward, got %d", len(ids))
+	}
+
+	var localPort int32
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := mgr.GetStatus()
+		if len(status) == 1 && status[0].State == ForwardActive {
+			localPort = status[0].LocalPort
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("forward did not become active: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer func() {
+		// Wait for the port to be released so repeated runs can bind it again
+		mgr.Stop()
+		deadline := time.Now().Add(2 * time.Second)
+		for !IsPortAvailable(localPort) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	select {
+	case status := <-ready:
+		if status.LocalPort != localPort || status.State != ForwardActive {
+			t.Errorf("expected OnReady for the active forward on port %d, got %+v", localPort, status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("expected OnReady to be called")
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", localPort), time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to local port %d: %v", localPort, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := fmt.Fprintln(conn, "ping"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read echo: %v", err)
+	}
+	if line != "ping\n" {
+		t.Errorf("expected echo %q, got %q", "ping\n", line)
+	}
+	conn.Close()
+
+	for _, event := range []string{"connection_opened", "connection_closed"} {
+		select {
+		case record := <-audit:
+			if got := recordAttr(record, "event"); got != event {
+				t.Errorf("expected audit event %s, got %s", event, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected audit event %s", event)
+		}
+	}
+
+	dialers.mu.Lock()
+	defer dialers.mu.Unlock()
+	if len(dialers.pods) == 0 || dialers.pods[0] != "ns1/web-0" {
+		t.Errorf("expected dialer for ns1/web-0, got %v", dialers.pods)
+	}
+}
+
+// TestManager_ForwardThroughContextCluster verifies that resources of another context are
+// resolved and dialed through that context's clients.
+func TestManager_ForwardThroughContextCluster(t *testing.T) {
+	// The default clients know nothing about the web service
+	defaultClientset := fake.NewSimpleClientset()
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, defaultClientset, k8s.NewClientForInterface(defaultClientset, "ns1"), streams)
+	defer mgr.Stop()
+
+	prodClientset := newWebClientset()
+	dialers := &echoDialerFactory{}
+	mgr.Clusters = map[string]*Cluster{
+		"prod": {ClientSet: prodClientset, K8sClient: k8s.NewClientForInterface(prodClientset, "ns1"), Dialers: dialers},
+	}
+
+	resource := webResource()
+	resource.Context = "prod"
+	ids, err := mgr.AddForward(resource, map[int]int32{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 1 || !strings.HasPrefix(ids[0], "prod/ns1/service/web:") {
+		t.Fatalf("expected a forward ID prefixed with the context, got %v", ids)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		dialers.mu.Lock()
+		dialed := len(dialers.pods) > 0
+		dialers.mu.Unlock()
+		if dialed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the prod cluster's dialer to be used")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestManager_SwitchPod verifies that a running service forward moves to another ready pod
+// while keeping its local port, that the state file records the new pod, and that data still
+// round-trips afterwards. The client's own namespace differs from the resource's, which the pods
+// are looked up in.
+func TestManager_SwitchPod(t *testing.T) {
+	clientset := newWebClientset()
+	ready := []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	for _, name := range []string{"web-0", "web-1"} {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns1", Labels: map[string]string{"app": "web"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "web",
+					Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+				}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, Conditions: ready},
+		}
+		if name == "web-0" {
+			clientset.CoreV1().Pods("ns1").Update(context.Background(), pod, metav1.UpdateOptions{})
+		} else {
+			clientset.CoreV1().Pods("ns1").Create(context.Background(), pod, metav1.CreateOptions{})
+		}
+	}
+
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, clientset, k8s.NewClientForInterface(clientset, "default"), streams)
+	dialers := &echoDialerFactory{}
+	mgr.Dialers = dialers
+	mgr.Registry = state.NewForwardRegistry(filepath.Join(t.TempDir(), state.ForwardsFile))
+
+	ids, err := mgr.AddForward(webResource(), map[int]int32{})
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("unexpected result %v, %v", ids, err)
+	}
+
+	var localPort int32
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := mgr.GetStatus()
+		if len(status) == 1 && status[0].State == ForwardActive {
+			localPort = status[0].LocalPort
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("forward did not become active: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer func() {
+		mgr.Stop()
+		deadline := time.Now().Add(2 * time.Second)
+		for !IsPortAvailable(localPort) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	pod, err := mgr.SwitchPod(ids[0], "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod != "web-1" {
+		t.Errorf("expected the next ready pod web-1, got %s", pod)
+	}
+	if status := mgr.GetStatus(); status[0].PodName != "web-1" || status[0].LocalPort != localPort {
+		t.Errorf("expected the forward on port %d via web-1, got %+v", localPort, status[0])
+	}
+	if forwards, _ := mgr.Registry.List(); len(forwards) != 1 || forwards[0].Pod != "web-1" {
+		t.Errorf("expected the state file to record pod web-1, got %+v", forwards)
+	}
+	if _, err := mgr.SwitchPod(ids[0], "web-9"); err == nil {
+		t.Error("expected an error for a pod not backing the service")
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", localPort), time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to local port %d: %v", localPort, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	fmt.Fprintln(conn, "ping")
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "ping\n" {
+		t.Errorf("expected echo after switching, got %q, %v", line, err)
+	}
+
+	dialers.mu.Lock()
+	defer dialers.mu.Unlock()
+	if want := []string{"ns1/web-0", "ns1/web-1"}; strings.Join(dialers.pods, ",") != strings.Join(want, ",") {
+		t.Errorf("expected dialers for %v, got %v", want, dialers.pods)
+	}
+	if len(mgr.GetStatus()) != 1 {
+		t.Error("expected the forward to keep running after switching")
+	}
+}
@@ -0,0 +1,46 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+)
+
+// Errors matched with errors.Is by the errors of the Manager, so programs embedding it can react
+// to the common causes of failed forwards. The errors keep their own messages.
+var (
+	// ErrPortInUse is matched when a requested local port is busy; the error is a
+	// *PortConflictError when it names who holds the port
+	ErrPortInUse = errors.New("local port in use")
+	// ErrNoReadyPods is matched when no pod backs a resource, or none became ready in time
+	ErrNoReadyPods = errors.New("no ready pods")
+	// ErrNamedPortNotFound is matched when a service's named target port is not declared by
+	// the container ports of its pod
+	ErrNamedPortNotFound = errors.New("named target port not found")
+)
+
+// sentinelError is an error that also matches a sentinel error, keeping its own message
+type sentinelError struct {
+	err      error
+	sentinel error
+}
+
+func (e *sentinelError) Error() string { return e.err.Error() }
+
+func (e *sentinelError) Unwrap() []error { return []error{e.err, e.sentinel} }
+
+// withSentinel makes err match sentinel with errors.Is
+func withSentinel(sentinel, err error) error {
+	return &sentinelError{err: err, sentinel: sentinel}
+}
+
+// findPodsError describes a failed lookup of the pods backing owner, e.g. "service web". A
+// resource without pods matches ErrNoReadyPods.
+func findPodsError(owner string, err error) error {
+	err = fmt.Errorf("failed to find pods for %s: %w", owner, err)
+	if errors.Is(err, k8s.ErrNoPods) {
+		return withSentinel(ErrNoReadyPods, err)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// TestTypedErrors verifies that the common causes of failed forwards match their exported
+// errors while keeping their messages.
+func TestTypedErrors(t *testing.T) {
+	named := intstr.FromString("metrics")
+	_, err := resolveTargetPort(&named, 80, k8s.Pod{Name: "web-0", Namespace: "ns1"})
+	if !errors.Is(err, ErrNamedPortNotFound) || err.Error() != "named target port 'metrics' not found on pod 'web-0' in namespace 'ns1'" {
+		t.Errorf("expected ErrNamedPortNotFound with the port and pod, got %v", err)
+	}
+
+	mgr := &Manager{}
+	if _, err := mgr.selectPod(model.Resource{}, nil, "service web"); !errors.Is(err, ErrNoReadyPods) {
+		t.Errorf("expected ErrNoReadyPods without pods, got %v", err)
+	}
+	err = findPodsError("deployment web", fmt.Errorf("%w for deployment web", k8s.ErrNoPods))
+	if !errors.Is(err, ErrNoReadyPods) || !errors.Is(err, k8s.ErrNoPods) {
+		t.Errorf("expected a resource without pods to match ErrNoReadyPods, got %v", err)
+	}
+	if err := findPodsError("deployment web", errors.New("timeout")); errors.Is(err, ErrNoReadyPods) {
+		t.Errorf("expected other lookup errors not to match ErrNoReadyPods, got %v", err)
+	}
+
+	err = fmt.Errorf("failed to allocate requested local port 8080: %w", &PortConflictError{LocalPort: 8080, Reason: "in use by another process"})
+	var conflict *PortConflictError
+	if !errors.Is(err, ErrPortInUse) || !errors.As(err, &conflict) || conflict.LocalPort != 8080 {
+		t.Errorf("expected ErrPortInUse with the conflict details, got %v", err)
+	}
+}
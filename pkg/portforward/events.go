@@ -0,0 +1,83 @@
+package portforward
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Lifecycle event types written by EventWriter
+const (
+	EventForwardReady  = "forward_ready"
+	EventForwardRetry  = "forward_retry"
+	EventForwardFailed = "forward_failed"
+	EventSessionEnd    = "session_end"
+)
+
+// Event is a lifecycle event of a session, written as one JSON object per line
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Resource   string    `json:"resource,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Context    string    `json:"context,omitempty"`
+	Pod        string    `json:"pod,omitempty"`
+	LocalPort  int32     `json:"localPort,omitempty"`
+	RemotePort int32     `json:"remotePort,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// EventWriter writes lifecycle events as JSON lines so wrappers such as editor plugins can
+// follow a session without parsing its messages. A nil EventWriter discards events.
+type EventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewEventWriter returns an EventWriter writing to w
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{enc: json.NewEncoder(w)}
+}
+
+// Emit writes event, setting its time if unset. Write errors are ignored so a closed reader
+// cannot stop the session.
+func (e *EventWriter) Emit(event Event) {
+	if e == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.enc.Encode(event)
+}
+
+// forwardEvent returns an event of type typ for the request's forward
+func (req ForwardRequest) forwardEvent(typ string, err error) Event {
+	event := Event{
+		Type:       typ,
+		Resource:   string(req.Resource.Type) + "/" + req.Resource.Name,
+		Namespace:  req.Resource.Namespace,
+		Context:    req.Resource.Context,
+		LocalPort:  req.LocalPort,
+		RemotePort: req.RemotePort,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	return event
+}
+
+// failure returns the summary entry of the request's forward ending with err
+func (req ForwardRequest) failure(retries int, err error) ForwardFailure {
+	return ForwardFailure{
+		Resource:   req.Resource,
+		LocalPort:  req.LocalPort,
+		RemotePort: req.RemotePort,
+		Retries:    retries,
+		Err:        err,
+	}
+}
@@ -0,0 +1,46 @@
+package portforward
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// TestEventWriter verifies that events are written as JSON lines and that a nil writer
+// discards them.
+func TestEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	events := NewEventWriter(&buf)
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "web", Namespace: "apps", Type: model.ServiceResource},
+		LocalPort:  8080,
+		RemotePort: 80,
+		Events:     events,
+	}
+
+	req.logRetry(errors.New("lost connection to pod"), 1, InitialBackoff)
+	events.Emit(Event{Type: EventSessionEnd})
+
+	dec := json.NewDecoder(&buf)
+	var retry, end Event
+	if err := dec.Decode(&retry); err != nil {
+		t.Fatalf("failed to decode retry event: %v", err)
+	}
+	if err := dec.Decode(&end); err != nil {
+		t.Fatalf("failed to decode session end event: %v", err)
+	}
+
+	if retry.Type != EventForwardRetry || retry.Resource != "service/web" || retry.Namespace != "apps" ||
+		retry.LocalPort != 8080 || retry.RemotePort != 80 || retry.Attempt != 1 || retry.Error != "lost connection to pod" {
+		t.Errorf("unexpected retry event %+v", retry)
+	}
+	if end.Type != EventSessionEnd || end.Time.IsZero() {
+		t.Errorf("unexpected session end event %+v", end)
+	}
+
+	var discard *EventWriter
+	discard.Emit(Event{Type: EventSessionEnd})
+}
@@ -0,0 +1,40 @@
+package portforward_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/portforward"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ExampleManager shows how to embed the forwarding engine in another program.
+func ExampleManager() {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	client, err := k8s.NewClientForConfig(restConfig, "default")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	streams := genericiooptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr}
+	manager := portforward.NewManager(context.Background(), restConfig, client.GetClientset(), client, streams)
+
+	// Forward port 80 of pod "web-0" to localhost:8080
+	web := model.Resource{Name: "web-0", Namespace: "default", Type: model.PodResource, Ports: []int32{80}}
+	if _, err := manager.AddForward(web, map[int]int32{0: 8080}); err != nil {
+		fmt.Println(err)
+	}
+
+	manager.Stop()
+	manager.WaitForCompletion()
+}
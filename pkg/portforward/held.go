@@ -0,0 +1,102 @@
+package portforward
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// startHeldPortForward forwards connections accepted on the listeners reserved by the
+// PortAllocator. Because the local port stays bound from allocation onwards, no other process
+// can take it in between. The tunnel is dialed right away and re-established with backoff
+// when the connection to the pod is lost.
+func startHeldPortForward(req ForwardRequest, dialer httpstream.Dialer) (*PortForwarder, error) {
+	ports, err := req.bindListeners()
+	if err != nil {
+		return nil, err
+	}
+	forwarder := newListenerForwarder(req)
+	// Without an idle timeout the connection is only replaced after it drops
+	t := newTunnel(dialer, 0, req.log())
+	forwarder.tunnel = t
+	t.audit = req.auditLog()
+
+	go func() {
+		var retryCount int
+		var backoff time.Duration = InitialBackoff
+		ready := false
+
+		// Listeners are owned by serve once ready; otherwise they are closed here
+		defer func() {
+			if !ready {
+				closeServed(ports)
+			}
+		}()
+
+		for {
+			forwarder.status.publish(TunnelConnecting, retryCount, nil)
+			conn, generation, err := t.connect()
+			if err == nil {
+				if !ready {
+					// Only start accepting connections once the pod can be reached
+					forwarder.serve(ports, t)
+					ready = true
+				}
+				forwarder.markReady(req, retryCount)
+
+				// Wait until the connection drops or the forward is stopped
+				select {
+				case <-forwarder.StopChannel:
+					return
+				case <-conn.CloseChan():
+					if t.switchedSince(generation) {
+						// Moved to another pod on purpose, dial it right away
+						continue
+					}
+					err = fmt.Errorf("lost connection to pod")
+				}
+			}
+
+			// Stopped while dialing
+			select {
+			case <-forwarder.StopChannel:
+				return
+			default:
+			}
+
+			// Error occurred, decide whether to retry
+			if !forwarder.AutoRetry || retryCount >= MaxRetries {
+				forwarder.status.publish(TunnelFailed, retryCount, err)
+				forwarder.ErrorChannel <- fmt.Errorf("port forwarding failed after %d attempts: %w", retryCount+1, err)
+				forwarder.Stop()
+				return
+			}
+
+			// Log the retry attempt
+			req.logRetry(err, retryCount+1, backoff)
+			forwarder.recordRetry(err)
+			forwarder.status.publish(TunnelRetrying, retryCount+1, err)
+
+			// Wait before retrying
+			select {
+			case <-forwarder.StopChannel:
+				return
+			case <-time.After(backoff):
+				// Continue with retry
+			}
+
+			// Increase retry count and backoff
+			retryCount++
+			forwarder.setAttempts(retryCount)
+
+			// Apply exponential backoff with a maximum limit
+			backoff = time.Duration(float64(backoff) * BackoffFactor)
+			if backoff > MaxBackoff {
+				backoff = MaxBackoff
+			}
+		}
+	}()
+
+	return forwarder, nil
+}
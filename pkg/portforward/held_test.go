@@ -0,0 +1,53 @@
+package portforward
+
+import (
+	"testing"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+// TestStartHeldPortForward_StopReleasesListeners verifies that stopping a forward that never connected frees the port.
+func TestStartHeldPortForward_StopReleasesListeners(t *testing.T) {
+	pa := NewPortAllocator()
+	port, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Fatalf("failed to allocate port: %v", err)
+	}
+	if IsPortAvailable(port) {
+		t.Fatal("expected the allocated port to stay bound")
+	}
+
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+		LocalPort:  port,
+		RemotePort: 8080,
+		Streams:    streams,
+		Listeners:  pa.TakeListeners(port),
+	}
+
+	pf, err := startHeldPortForward(req, &countingDialer{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case <-pf.ReadyChannel:
+		t.Fatal("expected forwarder not to be ready while the pod is unreachable")
+	case <-time.After(100 * time.Millisecond):
+		// ok
+	}
+
+	pf.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !IsPortAvailable(port) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the port to be released after Stop")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
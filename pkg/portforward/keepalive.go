@@ -0,0 +1,55 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// keepaliveDialTimeout bounds how long a single keepalive probe may take
+const keepaliveDialTimeout = 5 * time.Second
+
+// startKeepalive starts the keepalive loop once the tunnel is ready, if enabled
+func (pf *PortForwarder) startKeepalive() {
+	if pf.KeepaliveInterval <= 0 {
+		return
+	}
+	go func() {
+		select {
+		case <-pf.ReadyChannel:
+			pf.runKeepalive(pf.KeepaliveInterval, pf.StopChannel)
+		case <-pf.StopChannel:
+		}
+	}()
+}
+
+// runKeepalive periodically opens and closes a connection through the local end of the
+// tunnel. Each probe creates a fresh stream on the underlying SPDY connection, which keeps
+// proxies that drop idle streams from silently killing the forward.
+func (pf *PortForwarder) runKeepalive(interval time.Duration, stopChannel <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChannel:
+			return
+		case <-ticker.C:
+			// Errors are expected while the tunnel is reconnecting, so they are ignored here
+			_ = probeLocalPort(pf.LocalPort)
+		}
+	}
+}
+
+// probeLocalPort connects to the given local port and immediately closes the connection
+func probeLocalPort(port int32) error {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), keepaliveDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
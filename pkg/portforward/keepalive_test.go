@@ -0,0 +1,56 @@
+package portforward
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestProbeLocalPort verifies that a probe connects to a listening port and fails on a closed one.
+func TestProbeLocalPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	port := int32(listener.Addr().(*net.TCPAddr).Port)
+
+	accepted := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+			close(accepted)
+		}
+	}()
+
+	if err := probeLocalPort(port); err != nil {
+		t.Fatalf("unexpected error probing open port: %v", err)
+	}
+	select {
+	case <-accepted:
+		// ok
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected probe connection to be accepted")
+	}
+
+	listener.Close()
+	if err := probeLocalPort(port); err == nil {
+		t.Error("expected error probing closed port")
+	}
+}
+
+// TestRunKeepalive_Disabled verifies that a zero interval returns immediately.
+func TestRunKeepalive_Disabled(t *testing.T) {
+	pf := &PortForwarder{}
+	done := make(chan struct{})
+	go func() {
+		pf.runKeepalive(0, make(chan struct{}))
+		close(done)
+	}()
+	select {
+	case <-done:
+		// ok
+	case <-time.After(time.Second):
+		t.Fatal("expected runKeepalive to return when disabled")
+	}
+}
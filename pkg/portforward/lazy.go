@@ -0,0 +1,151 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// DefaultLazyIdleTimeout is how long a lazily established tunnel stays open without connections
+const DefaultLazyIdleTimeout = 5 * time.Minute
+
+// startLazyPortForward binds the local ports right away (or uses the listeners held in the
+// request) but only dials the pod when the first client connects. The tunnel is torn down
+// again after req.IdleTimeout without connections.
+func startLazyPortForward(req ForwardRequest, dialer httpstream.Dialer) (*PortForwarder, error) {
+	ports, err := req.bindListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	idleTimeout := req.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultLazyIdleTimeout
+	}
+
+	forwarder := newListenerForwarder(req)
+	t := newTunnel(dialer, idleTimeout, req.log())
+	forwarder.tunnel = t
+	t.audit = req.auditLog()
+	forwarder.serve(ports, t)
+
+	// The local port is bound, so the forward is ready from the client's point of view
+	forwarder.markReady(req, 0)
+
+	return forwarder, nil
+}
+
+// newListenerForwarder creates a PortForwarder for forwards that serve their own listeners
+func newListenerForwarder(req ForwardRequest) *PortForwarder {
+	return &PortForwarder{
+		Resource:     req.Resource,
+		LocalPort:    req.LocalPort,
+		RemotePort:   req.RemotePort,
+		StopChannel:  make(chan struct{}, 1),
+		ReadyChannel: make(chan struct{}, 1),
+		ErrorChannel: make(chan error, 1),
+		AutoRetry:    AutoRetryEnable,
+		// Keepalive is opt-in to avoid generating extra connections against the pod
+		KeepaliveInterval: req.KeepaliveInterval,
+		PodName:           req.targetPod(),
+		Scheme:            req.Scheme,
+		ExtraPorts:        req.ExtraPorts,
+		status:            newStatusStream(),
+		onPodChange:       req.onPodChange,
+		state:             &forwarderState{},
+	}
+}
+
+// servedPort is a local port of a forward serving its own listeners, with the listeners bound
+// to it
+type servedPort struct {
+	PortPair
+	listeners []net.Listener
+}
+
+// bindListeners returns every port of the request with its listeners, binding the ports no
+// listeners are held for. On error all listeners of the request are closed.
+func (req ForwardRequest) bindListeners() ([]servedPort, error) {
+	held := append([][]net.Listener{req.Listeners}, req.ExtraListeners...)
+	var ports []servedPort
+	for i, pair := range req.ports() {
+		var listeners []net.Listener
+		if i < len(held) {
+			listeners = held[i]
+		}
+		if len(listeners) == 0 {
+			var err error
+			if listeners, err = listenLocal(pair.LocalPort); err != nil {
+				closeServed(ports)
+				req.closeAllListeners()
+				return nil, err
+			}
+		}
+		ports = append(ports, servedPort{PortPair: pair, listeners: listeners})
+	}
+	return ports, nil
+}
+
+// closeServed closes the listeners of every port
+func closeServed(ports []servedPort) {
+	for _, port := range ports {
+		closeListeners(port.listeners)
+	}
+}
+
+// serve accepts local connections on the listeners of ports and proxies them through t to
+// their remote ports until the forwarder is stopped, then closes the listeners and the tunnel
+func (pf *PortForwarder) serve(ports []servedPort, t *tunnel) {
+	for _, port := range ports {
+		for _, listener := range port.listeners {
+			go func(l net.Listener, port PortPair) {
+				for {
+					conn, err := l.Accept()
+					if err != nil {
+						select {
+						case <-pf.StopChannel:
+						default:
+							if !errors.Is(err, net.ErrClosed) {
+								select {
+								case pf.ErrorChannel <- fmt.Errorf("error accepting connection on port %d: %w", port.LocalPort, err):
+								default:
+								}
+							}
+						}
+						return
+					}
+					go t.handleConnection(conn, port.RemotePort)
+				}
+			}(listener, port.PortPair)
+		}
+	}
+
+	// Tear everything down once stopped
+	go func() {
+		<-pf.StopChannel
+		closeServed(ports)
+		t.close()
+	}()
+}
+
+// listenLocal binds the local port on the IPv4 and IPv6 loopback addresses, succeeding if at
+// least one of them could be bound
+func listenLocal(port int32) ([]net.Listener, error) {
+	var listeners []net.Listener
+	var errs []error
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		l, err := net.Listen("tcp", net.JoinHostPort(addr, fmt.Sprintf("%d", port)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("unable to listen on port %d: %w", port, errors.Join(errs...))
+	}
+	return listeners, nil
+}
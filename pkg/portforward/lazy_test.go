@@ -0,0 +1,75 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+// countingDialer is an httpstream.Dialer that records dial attempts and always fails.
+type countingDialer struct {
+	dials int32
+}
+
+func (d *countingDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	atomic.AddInt32(&d.dials, 1)
+	return nil, "", errors.New("dial not supported in tests")
+}
+
+// TestStartLazyPortForward_DialsOnFirstConnection verifies that the tunnel is only dialed once a client connects.
+func TestStartLazyPortForward_DialsOnFirstConnection(t *testing.T) {
+	pa := NewPortAllocator()
+	port, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Fatalf("failed to allocate port: %v", err)
+	}
+
+	dialer := &countingDialer{}
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+		LocalPort:  port,
+		RemotePort: 8080,
+		Streams:    streams,
+		Lazy:       true,
+		Listeners:  pa.TakeListeners(port),
+	}
+
+	pf, err := startLazyPortForward(req, dialer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pf.Stop()
+
+	select {
+	case <-pf.ReadyChannel:
+		// ok
+	default:
+		t.Fatal("expected lazy forwarder to be ready immediately")
+	}
+	if atomic.LoadInt32(&dialer.dials) != 0 {
+		t.Fatal("expected no dial before the first connection")
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	// The failed dial closes the local connection
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1)
+	conn.Read(buf)
+	conn.Close()
+
+	if atomic.LoadInt32(&dialer.dials) != 1 {
+		t.Errorf("expected exactly one dial, got %d", dialer.dials)
+	}
+}
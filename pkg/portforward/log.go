@@ -0,0 +1,427 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"github.com/go-logr/logr/slogr"
+	"golang.org/x/term"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/klog/v2"
+)
+
+// Log formats accepted by NewLogger
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogger returns a logger for operational messages such as ready, retry and error
+// notifications that drops messages below level. The text format prints only the message,
+// informational ones to Out and all others to ErrOut. The JSON format writes one object per
+// message, including fields such as resource, namespace, localPort and attempt, to Out.
+func NewLogger(format string, level slog.Level, streams genericiooptions.IOStreams) (*slog.Logger, error) {
+	switch format {
+	case "", LogFormatText:
+		return slog.New(newConsoleHandler(streams, level)), nil
+	case LogFormatJSON:
+		return slog.New(slog.NewJSONHandler(streams.Out, &slog.HandlerOptions{Level: level})), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+}
+
+// ParseLogLevel parses a log level name: debug, info, warn or error
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// RouteKlog sends the messages client-go logs through klog, such as the "lost connection to
+// pod" errors of a dropped tunnel, to logger at debug level. Auto-retry already reports these
+// failures, so they are only shown when debug messages are enabled.
+func RouteKlog(logger *slog.Logger) {
+	klog.SetLogger(slogr.NewLogr(debugHandler{logger.Handler()}))
+}
+
+// debugHandler passes every record to its handler at debug level
+type debugHandler struct {
+	slog.Handler
+}
+
+func (h debugHandler) Enabled(ctx context.Context, _ slog.Level) bool {
+	return h.Handler.Enabled(ctx, slog.LevelDebug)
+}
+
+func (h debugHandler) Handle(ctx context.Context, record slog.Record) error {
+	// logr hands over errors without checking whether they are enabled
+	if !h.Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+	record.Level = slog.LevelDebug
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h debugHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return debugHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h debugHandler) WithGroup(name string) slog.Handler {
+	return debugHandler{h.Handler.WithGroup(name)}
+}
+
+// logWriter logs each line written to it at debug level
+type logWriter struct {
+	logger *slog.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line != "" {
+			w.logger.Debug(line, "source", "client-go")
+		}
+	}
+	return len(p), nil
+}
+
+// newConsoleLogger returns a logger printing plain messages at info level and above to streams
+func newConsoleLogger(streams genericiooptions.IOStreams) *slog.Logger {
+	return slog.New(newConsoleHandler(streams, slog.LevelInfo))
+}
+
+// newConsoleHandler returns a handler printing messages at level and above to streams,
+// colored on terminals unless NO_COLOR is set
+func newConsoleHandler(streams genericiooptions.IOStreams, level slog.Level) *consoleHandler {
+	return &consoleHandler{
+		out:      streams.Out,
+		errOut:   streams.ErrOut,
+		outColor: colorEnabled(streams.Out),
+		errColor: colorEnabled(streams.ErrOut),
+		level:    level,
+		mu:       &sync.Mutex{},
+	}
+}
+
+// ANSI escape sequences used to color messages
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+)
+
+// prefixColors are the colors of resource prefixes, picked per resource so interleaved
+// messages of different forwards are easy to tell apart
+var prefixColors = []string{colorCyan, colorMagenta, colorBlue, "\x1b[96m", "\x1b[95m", "\x1b[94m"}
+
+// colorEnabled reports whether messages written to w should be colored: w must be a
+// terminal, or a writer passing its file descriptor on, and NO_COLOR (https://no-color.org)
+// must not be set
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(interface{ Fd() uintptr })
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// messageColor returns the color of a record: failures are red, retries and other warnings
+// yellow and ready forwards green. Other messages are not colored.
+func messageColor(record slog.Record) string {
+	switch {
+	case record.Level >= slog.LevelError:
+		return colorRed
+	case record.Level >= slog.LevelWarn:
+		return colorYellow
+	}
+	color := ""
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == "event" && attr.Value.String() == "ready" {
+			color = colorGreen
+			return false
+		}
+		return true
+	})
+	return color
+}
+
+// consoleHandler prints the message of each record on its own line and drops its fields.
+// With prefixed set, messages of a forward start with its resource, e.g. [svc/web], and with
+// timestamps set every message starts with the time it was logged.
+type consoleHandler struct {
+	out      io.Writer
+	errOut   io.Writer
+	outColor bool
+	errColor bool
+	level    slog.Level
+	mu       *sync.Mutex
+	prefixed bool
+	// timestamps starts each message with its local date and time
+	timestamps bool
+	// resource is the resource field added with WithAttrs, e.g. service/web
+	resource string
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	w, colored := h.errOut, h.errColor
+	if record.Level >= slog.LevelInfo && record.Level < slog.LevelWarn {
+		w, colored = h.out, h.outColor
+	}
+	if w == nil {
+		return nil
+	}
+	msg := record.Message
+	if color := messageColor(record); colored && color != "" {
+		msg = color + msg + colorReset
+	}
+	if prefix := h.prefix(record, colored); prefix != "" {
+		msg = prefix + " " + msg
+	}
+	if h.timestamps && !record.Time.IsZero() {
+		msg = record.Time.Format(time.DateTime) + " " + msg
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintln(w, msg)
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if !h.prefixed {
+		return h
+	}
+	for _, attr := range attrs {
+		if attr.Key == "resource" {
+			withResource := *h
+			withResource.resource = attr.Value.String()
+			return &withResource
+		}
+	}
+	return h
+}
+
+func (h *consoleHandler) WithGroup(string) slog.Handler { return h }
+
+// prefix returns the prefix of a record naming the resource it is about, e.g. [svc/web], or ""
+// when prefixes are disabled or the record is not about a resource
+func (h *consoleHandler) prefix(record slog.Record, colored bool) string {
+	if !h.prefixed {
+		return ""
+	}
+	resource := h.resource
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == "resource" {
+			resource = attr.Value.String()
+			return false
+		}
+		return true
+	})
+	if resource == "" {
+		return ""
+	}
+	prefix := "[" + shortResource(resource) + "]"
+	if colored {
+		hash := fnv.New32a()
+		hash.Write([]byte(resource))
+		prefix = prefixColors[hash.Sum32()%uint32(len(prefixColors))] + prefix + colorReset
+	}
+	return prefix
+}
+
+// shortResource abbreviates the type of a resource field like kubectl does, e.g. service/web
+// becomes svc/web
+func shortResource(resource string) string {
+	kind, name, ok := strings.Cut(resource, "/")
+	if !ok {
+		return resource
+	}
+	switch model.ResourceType(kind) {
+	case model.ServiceResource:
+		kind = "svc"
+	case model.DeploymentResource:
+		kind = "deploy"
+	case model.StatefulSetResource:
+		kind = "sts"
+	}
+	return kind + "/" + name
+}
+
+// PrefixForwards returns a logger that starts the messages of each forward with its resource,
+// e.g. [svc/web], colored per resource on terminals, so the interleaved output of many forwards,
+// including client-go's own, stays attributable. Structured loggers already carry the resource
+// field and are returned unchanged.
+func PrefixForwards(logger *slog.Logger) *slog.Logger {
+	console, ok := logger.Handler().(*consoleHandler)
+	if !ok {
+		return logger
+	}
+	prefixed := *console
+	prefixed.prefixed = true
+	return slog.New(&prefixed)
+}
+
+// WithTimestamps returns a logger that starts every message with the local date and time it
+// was logged, e.g. 2024-05-01 03:12:45, so dropped forwards can be dated from the scrollback.
+// Structured loggers already carry a time field and are returned unchanged.
+func WithTimestamps(logger *slog.Logger) *slog.Logger {
+	console, ok := logger.Handler().(*consoleHandler)
+	if !ok {
+		return logger
+	}
+	stamped := *console
+	stamped.timestamps = true
+	return slog.New(&stamped)
+}
+
+// forwardAttrs returns the log fields identifying a forward
+func forwardAttrs(resource model.Resource, localPort, remotePort int32) []any {
+	attrs := []any{
+		"resource", string(resource.Type) + "/" + resource.Name,
+		"namespace", resource.Namespace,
+		"localPort", localPort,
+		"remotePort", remotePort,
+	}
+	if resource.Context != "" {
+		attrs = append(attrs, "context", resource.Context)
+	}
+	return attrs
+}
+
+// Log returns the logger used for the manager's operational messages. Without a Logger, all
+// messages go through one console logger so that its lock serializes writes to Streams.
+func (m *Manager) Log() *slog.Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	m.consoleOnce.Do(func() {
+		m.console = newConsoleLogger(m.Streams)
+	})
+	return m.console
+}
+
+// forwardLog returns the manager's logger with the fields identifying the request's forward
+func (m *Manager) forwardLog(req ForwardRequest) *slog.Logger {
+	return m.Log().With(forwardAttrs(req.Resource, req.LocalPort, req.RemotePort)...)
+}
+
+// log returns the logger for the request's messages, with the fields identifying the forward
+func (req ForwardRequest) log() *slog.Logger {
+	logger := req.Logger
+	if logger == nil {
+		logger = newConsoleLogger(req.Streams)
+	}
+	return logger.With(forwardAttrs(req.Resource, req.LocalPort, req.RemotePort)...)
+}
+
+// auditLog returns the logger for the request's connection events, with the fields
+// identifying the forward, or nil when they are disabled
+func (req ForwardRequest) auditLog() *slog.Logger {
+	if req.Audit == nil {
+		return nil
+	}
+	return req.Audit.With(forwardAttrs(req.Resource, req.LocalPort, req.RemotePort)...)
+}
+
+// logRetry reports a failed attempt that is retried after backoff
+func (req ForwardRequest) logRetry(err error, attempt int, backoff time.Duration) {
+	req.log().Warn(fmt.Sprintf("Port forwarding error: %v. Retrying (%d/%d) in %v...", err, attempt, MaxRetries, backoff),
+		"event", "retry", "error", err.Error(), "attempt", attempt, "maxAttempts", MaxRetries, "backoff", backoff.String())
+	event := req.forwardEvent(EventForwardRetry, err)
+	event.Attempt = attempt
+	req.Events.Emit(event)
+	if req.onRetry != nil {
+		req.onRetry(err)
+	}
+}
+
+// clientGoOut returns the writer for client-go's own progress and error output, which
+// repeats what the forward reports itself and is therefore logged at debug level
+func (req ForwardRequest) clientGoOut() io.Writer {
+	return logWriter{req.log()}
+}
+
+// isConsole reports whether logger prints plain messages rather than a structured format
+func isConsole(logger *slog.Logger) bool {
+	handler := logger.Handler()
+	if tee, ok := handler.(teeHandler); ok {
+		handler = tee[0]
+	}
+	_, ok := handler.(*consoleHandler)
+	return ok
+}
+
+// NewFileLogger returns a logger writing messages at level and above to w with their time,
+// level and fields, for log files read after the fact
+func NewFileLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Tee returns a logger passing every message to each of loggers, e.g. to the terminal and to a
+// log file. The first logger decides how the session's output is formatted on the terminal.
+func Tee(loggers ...*slog.Logger) *slog.Logger {
+	handlers := make(teeHandler, len(loggers))
+	for i, logger := range loggers {
+		handlers[i] = logger.Handler()
+	}
+	return slog.New(handlers)
+}
+
+// teeHandler passes records to each of its handlers that is enabled for them
+type teeHandler []slog.Handler
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			if err := handler.Handle(ctx, record.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
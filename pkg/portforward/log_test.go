@@ -0,0 +1,211 @@
+package portforward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/klog/v2"
+)
+
+// TestNewLogger_Text verifies that text logging prints only the message, informational ones
+// to Out and warnings to ErrOut.
+func TestNewLogger_Text(t *testing.T) {
+	streams, _, out, errOut := genericiooptions.NewTestIOStreams()
+	logger, err := NewLogger(LogFormatText, slog.LevelInfo, streams)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "web", Namespace: "apps", Type: model.ServiceResource},
+		LocalPort:  8080,
+		RemotePort: 80,
+		Logger:     logger,
+	}
+
+	req.log().Info("ready", "event", "ready")
+	req.logRetry(errors.New("connection refused"), 1, time.Second)
+
+	if got := out.String(); got != "ready\n" {
+		t.Errorf("expected plain message on Out, got %q", got)
+	}
+	if got := errOut.String(); got != "Port forwarding error: connection refused. Retrying (1/5) in 1s...\n" {
+		t.Errorf("unexpected retry message %q", got)
+	}
+}
+
+// TestNewLogger_JSON verifies that JSON logging writes one object per message with the
+// fields identifying the forward.
+func TestNewLogger_JSON(t *testing.T) {
+	streams, _, out, errOut := genericiooptions.NewTestIOStreams()
+	logger, err := NewLogger(LogFormatJSON, slog.LevelInfo, streams)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "web", Namespace: "apps", Type: model.ServiceResource},
+		LocalPort:  8080,
+		RemotePort: 80,
+		Logger:     logger,
+	}
+
+	req.logRetry(errors.New("connection refused"), 2, time.Second)
+
+	if errOut.Len() != 0 {
+		t.Errorf("expected nothing on ErrOut, got %q", errOut.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out.String())), &record); err != nil {
+		t.Fatalf("expected a JSON object, got %q: %v", out.String(), err)
+	}
+	for field, want := range map[string]any{
+		"level":      "WARN",
+		"event":      "retry",
+		"resource":   "service/web",
+		"namespace":  "apps",
+		"localPort":  float64(8080),
+		"remotePort": float64(80),
+		"attempt":    float64(2),
+		"error":      "connection refused",
+	} {
+		if record[field] != want {
+			t.Errorf("expected %s=%v, got %v", field, want, record[field])
+		}
+	}
+
+	if _, err := NewLogger("xml", slog.LevelInfo, streams); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+// TestRouteKlog verifies that client-go's klog messages are only shown at debug level.
+func TestRouteKlog(t *testing.T) {
+	defer klog.ClearLogger()
+
+	streams, _, _, errOut := genericiooptions.NewTestIOStreams()
+	logger, _ := NewLogger(LogFormatText, slog.LevelInfo, streams)
+	RouteKlog(logger)
+	klog.Error("lost connection to pod")
+	if errOut.Len() != 0 {
+		t.Errorf("expected klog errors to be hidden at info level, got %q", errOut.String())
+	}
+
+	logger, _ = NewLogger(LogFormatText, slog.LevelDebug, streams)
+	RouteKlog(logger)
+	klog.Error("lost connection to pod")
+	if got := errOut.String(); got != "lost connection to pod\n" {
+		t.Errorf("expected klog error at debug level, got %q", got)
+	}
+}
+
+// TestConsoleColors verifies that ready lines, retries and failures are colored on terminals
+// and that other writers and NO_COLOR get plain text.
+func TestConsoleColors(t *testing.T) {
+	streams, _, out, errOut := genericiooptions.NewTestIOStreams()
+	handler := newConsoleHandler(streams, slog.LevelInfo)
+	if handler.outColor || handler.errColor {
+		t.Fatal("expected no colors for writers that are not terminals")
+	}
+	handler.outColor, handler.errColor = true, true
+	logger := slog.New(handler)
+
+	logger.Info("ready", "event", "ready")
+	logger.Info("started", "event", "started")
+	logger.Warn("retry", "event", "retry")
+	logger.Error("failed", "event", "error")
+
+	if got, want := out.String(), colorGreen+"ready"+colorReset+"\nstarted\n"; got != want {
+		t.Errorf("expected %q on Out, got %q", want, got)
+	}
+	if got, want := errOut.String(), colorYellow+"retry"+colorReset+"\n"+colorRed+"failed"+colorReset+"\n"; got != want {
+		t.Errorf("expected %q on ErrOut, got %q", want, got)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if colorEnabled(os.Stdout) {
+		t.Error("expected NO_COLOR to disable colors")
+	}
+}
+
+// TestPrefixForwards verifies that messages of a forward, including client-go's output, start
+// with its abbreviated resource, and that other messages are left alone.
+func TestPrefixForwards(t *testing.T) {
+	streams, _, out, errOut := genericiooptions.NewTestIOStreams()
+	logger, _ := NewLogger(LogFormatText, slog.LevelDebug, streams)
+	logger = PrefixForwards(logger)
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "web", Namespace: "apps", Type: model.ServiceResource},
+		LocalPort:  8080,
+		RemotePort: 80,
+		Logger:     logger,
+	}
+
+	req.log().Info("ready", "event", "ready")
+	req.clientGoOut().Write([]byte("Handling connection for 8080\n"))
+	logger.Warn("skipped", "resource", "deployment/api")
+	logger.Info("session started")
+
+	if got, want := out.String(), "[svc/web] ready\nsession started\n"; got != want {
+		t.Errorf("expected %q on Out, got %q", want, got)
+	}
+	if got, want := errOut.String(), "[svc/web] Handling connection for 8080\n[deploy/api] skipped\n"; got != want {
+		t.Errorf("expected %q on ErrOut, got %q", want, got)
+	}
+
+	handler := logger.Handler().(*consoleHandler)
+	if prefix := handler.prefix(slog.NewRecord(time.Time{}, slog.LevelInfo, "", 0), true); prefix != "" {
+		t.Errorf("expected no prefix without a resource, got %q", prefix)
+	}
+
+	jsonLogger, _ := NewLogger(LogFormatJSON, slog.LevelInfo, streams)
+	if PrefixForwards(jsonLogger) != jsonLogger {
+		t.Error("expected JSON loggers to be returned unchanged")
+	}
+}
+
+// TestWithTimestamps verifies that messages start with the time they were logged, before the
+// resource prefix.
+func TestWithTimestamps(t *testing.T) {
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	logger, _ := NewLogger(LogFormatText, slog.LevelInfo, streams)
+	logger = WithTimestamps(PrefixForwards(logger))
+
+	record := slog.NewRecord(time.Date(2024, 5, 1, 3, 12, 45, 0, time.Local), slog.LevelInfo, "ready", 0)
+	record.AddAttrs(slog.String("resource", "service/web"))
+	if err := logger.Handler().Handle(context.Background(), record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := out.String(), "2024-05-01 03:12:45 [svc/web] ready\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// TestTee verifies that messages reach every logger, each with its own level and format.
+func TestTee(t *testing.T) {
+	streams, _, out, _ := genericiooptions.NewTestIOStreams()
+	console, _ := NewLogger(LogFormatText, slog.LevelInfo, streams)
+	var file strings.Builder
+	logger := Tee(console, NewFileLogger(&file, slog.LevelDebug))
+
+	logger.With("resource", "service/web").Info("ready", "event", "ready")
+	logger.Debug("handling connection")
+
+	if got := out.String(); got != "ready\n" {
+		t.Errorf("expected only the info message on the terminal, got %q", got)
+	}
+	if got := file.String(); !strings.Contains(got, "level=INFO msg=ready resource=service/web event=ready") ||
+		!strings.Contains(got, `level=DEBUG msg="handling connection"`) {
+		t.Errorf("expected both messages with their fields in the file, got %q", got)
+	}
+	if !isConsole(logger) {
+		t.Error("expected a tee to the terminal to print plain messages")
+	}
+}
@@ -2,18 +2,21 @@ package portforward
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"roeyazroel/kubectl-pfw/pkg/k8s"
-	"roeyazroel/kubectl-pfw/pkg/ui"
+	"roeyazroel/kubectl-pfw/pkg/model"
+	"roeyazroel/kubectl-pfw/pkg/state"
 
 	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -21,452 +24,724 @@ import (
 // Manager manages multiple port forwarding connections
 type Manager struct {
 	RestConfig  *rest.Config
-	ClientSet   *kubernetes.Clientset
-	K8sClient   *k8s.Client
-	Streams     genericclioptions.IOStreams
+	ClientSet   kubernetes.Interface
+	K8sClient   PodResolver
+	Streams     genericiooptions.IOStreams
 	Context     context.Context
-	Forwarders  []*PortForwarder
 	ForwardWait sync.WaitGroup
 	mutex       sync.Mutex
 	// Port allocator for managing local ports
 	PortAllocator *PortAllocator
+	// Dialers opens connections to pods; defaults to SPDY over RestConfig
+	Dialers DialerFactory
+	// Clusters holds the clients of other kubeconfig contexts by name. Resources whose Context
+	// names one of them are resolved and forwarded through it instead of the fields above.
+	// Clients impersonating a user are added with AddCluster under the resource's ClusterKey.
+	Clusters   map[string]*Cluster
+	clustersMu sync.RWMutex
+	// APIProxy opens the tunnels of each cluster through a local API proxy instead of upgrading
+	// connections to the API server directly (see APIProxy)
+	APIProxy  bool
+	proxies   map[*rest.Config]*ProxyDialerFactory
+	proxiesMu sync.Mutex
+	// sharedDialers holds the connections shared by the forwards to each pod
+	sharedDialers sharedDialers
+	// KeepaliveInterval is passed to every forwarder; 0 disables keepalive probes
+	KeepaliveInterval time.Duration
+	// Lazy defers dialing each tunnel until a client connects to its local port
+	Lazy bool
+	// LazyIdleTimeout closes lazy tunnels after this long without connections
+	LazyIdleTimeout time.Duration
+	// StablePorts derives auto-assigned local ports from a hash of the resource and port
+	StablePorts bool
+	// PortOffset is added to every requested and suggested local port, e.g. 10000 turns 80 into
+	// 10080, so parallel sessions against different environments can share a configuration
+	PortOffset int32
+	// Node, when set, restricts the pods backing services and workloads to those scheduled on
+	// this node, e.g. to reach the DaemonSet pod of a particular node
+	Node string
+	// Zone, when set, restricts those pods to the ones running on nodes of this topology zone,
+	// e.g. the zone closest to you
+	Zone string
+	// PodSelector, when set, restricts those pods to the ones matching this label selector
+	PodSelector string
+	// Registry, when set, shares this session's forwards with other pfw processes and is
+	// consulted to explain local port conflicts
+	Registry *state.ForwardRegistry
+	// SessionName is recorded with the forwards in Registry, so they can be told apart by the
+	// session serving them; empty for unnamed sessions
+	SessionName string
+	// PrivilegedHelper, when set, is called after a privileged local port was replaced by an
+	// unprivileged one so it can serve the original port, e.g. through a sudo-run relay
+	PrivilegedHelper func(privilegedPort, localPort int32) error
+	// PortAssignments, when set, remembers auto-assigned local ports across runs
+	PortAssignments *state.PortAssignments
+	// MaxForwards caps the number of simultaneously running tunnels (0 means unlimited)
+	MaxForwards int
+	// Logger receives operational messages such as ready, retry and error notifications; nil
+	// prints them to Streams
+	Logger *slog.Logger
+	// Events, when set, receives the lifecycle events of all forwards
+	Events *EventWriter
+	// Audit, when set, receives an event for every local connection through a forward
+	Audit *slog.Logger
+	// OnReady, when set, is called each time a forward becomes active
+	OnReady func(ForwardStatus)
+	// ReadyTimeout, when set, makes AddForward wait up to this long for a ready pod behind
+	// services and workloads whose pods are all pending or not ready
+	ReadyTimeout time.Duration
+	// ScaleFromZero scales deployments and statefulsets with 0 replicas to 1 before forwarding
+	// them; RestoreScale scales them back down
+	ScaleFromZero bool
+	// QueueExcessForwards queues forwards beyond MaxForwards instead of rejecting them
+	QueueExcessForwards bool
+	// OnConflict says what to do when a requested local port is busy; empty fails like
+	// ConflictFail
+	OnConflict ConflictStrategy
+	// running counts started forwarders and queue holds requests waiting for a free slot
+	running int
+	queue   []ForwardRequest
+	// forwards is the registry of all queued and running forwards, keyed by forward ID
+	forwards map[string]*forwardEntry
+	seq      int
+	// stopped is set once Stop was called so no further forwards are started
+	stopped bool
+	// attempted counts the forwards of the session and failures lists those that failed
+	attempted int
+	failures  []ForwardFailure
+	// scaledUp lists the workloads scaled up from zero replicas for this session
+	scaledUp []model.Resource
+	// lifecycle carries the events of running forwarders to the supervision loop
+	lifecycle      chan lifecycleEvent
+	supervisorOnce sync.Once
+	// nodeZones caches the zones of nodes looked up for Zone, keyed by cluster and node
+	nodeZones sync.Map
+	// console is the logger of Log when Logger is nil
+	console     *slog.Logger
+	consoleOnce sync.Once
 }
 
-// NewManager creates a new port forward manager
-func NewManager(config *rest.Config, clientset *kubernetes.Clientset, k8sClient *k8s.Client, streams genericclioptions.IOStreams, ctx context.Context) *Manager {
+// PodResolver finds the pods backing services, deployments, statefulsets and custom
+// resources. *k8s.Client implements it.
+type PodResolver interface {
+	GetPodsForService(ctx context.Context, serviceName string) ([]k8s.Pod, error)
+	GetPodsForDeployment(ctx context.Context, deploymentName string) ([]k8s.Pod, error)
+	GetPodsForStatefulSet(ctx context.Context, statefulSetName string) ([]k8s.Pod, error)
+	GetPodsForCustomResource(ctx context.Context, name string) ([]k8s.Pod, error)
+	GetPod(ctx context.Context, name string) (k8s.Pod, error)
+	// GetContext returns the kubeconfig context name, or "" if unknown
+	GetContext() string
+}
+
+// NamespacedPodResolver is implemented by PodResolvers that can look up pods in any namespace.
+// Resources are then looked up in their own namespace instead of the one of the resolver.
+// *k8s.Client implements it.
+type NamespacedPodResolver interface {
+	GetPodsForServiceInNamespace(ctx context.Context, namespace, serviceName string) ([]k8s.Pod, error)
+	GetPodsForDeploymentInNamespace(ctx context.Context, namespace, deploymentName string) ([]k8s.Pod, error)
+	GetPodsForStatefulSetInNamespace(ctx context.Context, namespace, statefulSetName string) ([]k8s.Pod, error)
+	GetPodsForCustomResourceInNamespace(ctx context.Context, namespace, name string) ([]k8s.Pod, error)
+	GetPodInNamespace(ctx context.Context, namespace, name string) (k8s.Pod, error)
+}
+
+// ZoneResolver is implemented by PodResolvers that can look up the topology zone of a node,
+// which restricting pods to a zone requires. *k8s.Client implements it.
+type ZoneResolver interface {
+	NodeZone(ctx context.Context, node string) (string, error)
+}
+
+// Cluster holds the clients used for the resources of one kubeconfig context
+type Cluster struct {
+	RestConfig *rest.Config
+	ClientSet  kubernetes.Interface
+	K8sClient  PodResolver
+	Dialers    DialerFactory
+}
+
+// NewCluster creates a Cluster dialing pods over SPDY with config
+func NewCluster(config *rest.Config, clientset kubernetes.Interface, k8sClient PodResolver) *Cluster {
+	return &Cluster{
+		RestConfig: config,
+		ClientSet:  clientset,
+		K8sClient:  k8sClient,
+		Dialers:    NewSPDYDialerFactory(config),
+	}
+}
+
+// AddCluster registers the clients used for resources with the given ClusterKey, unless
+// clients are registered for it already
+func (m *Manager) AddCluster(key string, cluster *Cluster) {
+	m.clustersMu.Lock()
+	defer m.clustersMu.Unlock()
+	if m.Clusters == nil {
+		m.Clusters = make(map[string]*Cluster)
+	}
+	if _, ok := m.Clusters[key]; !ok {
+		m.Clusters[key] = cluster
+	}
+}
+
+// clusterFor returns the clients for a resource's context, or for the user it impersonates
+func (m *Manager) clusterFor(resource model.Resource) *Cluster {
+	m.clustersMu.RLock()
+	defer m.clustersMu.RUnlock()
+	cluster, ok := m.Clusters[resource.ClusterKey()]
+	if !ok || resource.ClusterKey() == "" {
+		cluster = &Cluster{RestConfig: m.RestConfig, ClientSet: m.ClientSet, K8sClient: m.K8sClient, Dialers: m.Dialers}
+	}
+	if m.APIProxy {
+		proxied := *cluster
+		proxied.Dialers = m.proxyDialers(cluster.RestConfig)
+		return &proxied
+	}
+	return cluster
+}
+
+// proxyDialers returns the dialers tunneling through the API proxy of a cluster's REST config
+func (m *Manager) proxyDialers(config *rest.Config) *ProxyDialerFactory {
+	m.proxiesMu.Lock()
+	defer m.proxiesMu.Unlock()
+	if m.proxies == nil {
+		m.proxies = make(map[*rest.Config]*ProxyDialerFactory)
+	}
+	if _, ok := m.proxies[config]; !ok {
+		m.proxies[config] = NewProxyDialerFactory(m.Context, config)
+	}
+	return m.proxies[config]
+}
+
+// NewManager creates a new port forward manager. ctx bounds the lifetime of all forwards.
+func NewManager(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, k8sClient PodResolver, streams genericiooptions.IOStreams) *Manager {
 	return &Manager{
 		RestConfig:    config,
 		ClientSet:     clientset,
 		K8sClient:     k8sClient,
 		Streams:       streams,
 		Context:       ctx,
-		Forwarders:    []*PortForwarder{},
 		PortAllocator: NewPortAllocator(),
+		Dialers:       NewSPDYDialerFactory(config),
+		forwards:      make(map[string]*forwardEntry),
 	}
 }
 
 // ForwardResource starts port forwarding for a resource
-func (m *Manager) ForwardResource(resource ui.Resource, portMapping map[int]int32) error {
+func (m *Manager) ForwardResource(resource model.Resource, portMapping map[int]int32) error {
+	_, err := m.AddForward(resource, portMapping)
+	return err
+}
+
+// AddForward starts port forwarding for every port of a resource and returns the IDs of the
+// new forwards, one per port. The ports are forwarded to a single pod over one connection by
+// one forwarder, so they are retried and stopped together. If any port fails, none is forwarded.
+// With ReadyTimeout set, it first waits for a ready pod to back the resource; with
+// ScaleFromZero, workloads without replicas are scaled up first.
+func (m *Manager) AddForward(resource model.Resource, portMapping map[int]int32) ([]string, error) {
+	// Scale and wait outside the lock so other forwards can be managed meanwhile
+	readyTimeout := m.ReadyTimeout
+	scaled, err := m.scaleFromZero(resource)
+	if err != nil {
+		return nil, err
+	}
+	if scaled && readyTimeout <= 0 {
+		readyTimeout = DefaultScaleReadyTimeout
+	}
+	if err := m.awaitReadyPod(resource, readyTimeout); err != nil {
+		return nil, err
+	}
+	resource = m.withPodProtocols(resource)
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	if m.stopped {
+		return nil, fmt.Errorf("port forwarding manager is stopped")
+	}
+
+	// Pick the backing pod once, so that all ports of the resource share its tunnel
+	var pod *k8s.Pod
+	if resource.Type != model.PodResource {
+		if pod, err = m.selectBackingPod(resource); err != nil {
+			return nil, err
+		}
+	}
+
+	var planned []plannedPort
+	// Release the local ports allocated for this resource so far
+	release := func() {
+		for _, p := range planned {
+			m.PortAllocator.ReleasePort(p.localPort)
+		}
+	}
+
 	for i, portValue := range resource.Ports {
 		// Get local port. Check if explicitly mapped by user
 		var localPort int32
 		if mappedPort, ok := portMapping[i]; ok {
 			// Use the explicitly mapped port (may be 0 for ephemeral)
 			localPort = mappedPort
-		} else {
-			// If no explicit mapping, default local port depends on the *target*
-			if resource.Type == ui.ServiceResource || resource.Type == ui.DeploymentResource || resource.Type == ui.StatefulSetResource {
-				// We don't know the resolved target port yet. Set to 0 and determine in forward*Port.
-				localPort = 0 // Will allocate an ephemeral port later
-			} else {
-				// For pods, the target *is* the container port.
-				localPort = portValue // Default local to container port
-			}
+		} else if resource.Type == model.PodResource {
+			// For pods, the target *is* the container port.
+			localPort = portValue // Default local to container port
 		}
+		// Otherwise the target port is not resolved yet; 0 allocates the suggested or an
+		// ephemeral port below
 
-		switch resource.Type {
-		case ui.ServiceResource:
-			// portValue represents the service port here
-			servicePort := portValue
-			// Pass localPort (might be 0 if defaulting or for ephemeral port allocation)
-			err := m.forwardServicePort(resource, i, localPort, servicePort)
-			if err != nil {
-				return err // Propagate error from forwarding attempt
-			}
-		case ui.DeploymentResource:
-			err := m.forwardDeploymentPort(resource, i, localPort, portValue)
-			if err != nil {
-				return err
-			}
-		case ui.StatefulSetResource:
-			err := m.forwardStatefulSetPort(resource, i, localPort, portValue)
-			if err != nil {
-				return err
-			}
-		default: // PodResource
-			// portValue represents the container port here
-			podContainerPort := portValue
-
-			// If localPort was 0 (ephemeral case), allocate a port
-			if localPort == 0 {
-				// Use a default suggestion based on the remote port
-				suggestedPort := podContainerPort
-
-				// Try to allocate that port
-				allocatedPort, err := m.PortAllocator.AllocatePort(suggestedPort)
-				if err != nil {
-					// If the suggested port is unavailable, try to get any available port
-					allocatedPort, err = m.PortAllocator.AllocatePort(0)
-					if err != nil {
-						return fmt.Errorf("failed to allocate local port: %w", err)
-					}
-				}
-				localPort = allocatedPort
-			} else {
-				// If a specific port was requested, try to allocate it
-				_, err := m.PortAllocator.AllocatePort(localPort)
-				if err != nil {
-					return fmt.Errorf("failed to allocate requested local port %d: %w", localPort, err)
-				}
-			}
-
-			// For pods, forward directly
-			req := ForwardRequest{
-				RestConfig: m.RestConfig,
-				ClientSet:  m.ClientSet,
-				Resource:   resource,
-				LocalPort:  localPort,        // Use allocated port
-				RemotePort: podContainerPort, // Use the container port directly as the remote port
-				Streams:    m.Streams,
-				Context:    m.Context,
-				// PodName is not needed when forwarding directly to a pod
-				AutoRetry: true, // Enable auto-retry by default
-			}
+		target, err := m.portTarget(resource, pod, i, portValue)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if target == nil {
+			continue
+		}
+		dedupePod := target.podName
+		if resource.Type == model.PodResource {
+			dedupePod = resource.Name
+		}
+		if m.reuseDuplicate(resource, dedupePod, portMapping[i], target.remotePort) ||
+			m.reusePlanned(resource, planned, portMapping[i], target.remotePort) {
+			continue
+		}
 
-			forwarder, err := StartPortForward(req)
-			if err != nil {
-				// Release the allocated port
-				m.PortAllocator.ReleasePort(localPort)
-				// Stop any previously started forwarders for this resource
-				m.stopResourceForwarders(resource)
-				return fmt.Errorf("failed to start port forward for %s: %w", resource.Name, err)
-			}
+		// Allocate the local port, suggesting the remote port when none was requested
+		localPort, err = m.allocateLocalPort(resource, localPort, target.remotePort, target.preferredPort)
+		if errors.Is(err, errForwardedElsewhere) {
+			continue
+		}
+		if err != nil {
+			release()
+			return nil, err
+		}
+		planned = append(planned, plannedPort{portTarget: *target, localPort: localPort})
+	}
+	if len(planned) == 0 {
+		return nil, nil
+	}
 
-			m.Forwarders = append(m.Forwarders, forwarder)
-			m.startForwarderMonitor(forwarder)
+	// One forward carries all ports of the pod over a single connection
+	first := planned[0]
+	req := m.newForwardRequest(resource, first.index, first.localPort, first.remotePort, first.podName)
+	req = m.withExtraPorts(req, planned[1:])
+	if _, err := m.launch(req); err != nil {
+		release()
+		if pod != nil {
+			return nil, fmt.Errorf("failed to start port forward for %s %s via pod %s: %w", resource.Type, resource.Name, pod.Name, err)
 		}
+		return nil, fmt.Errorf("failed to start port forward for %s: %w", resource.Name, err)
 	}
+	return req.forwardIDs(), nil
+}
 
-	return nil
+// portTarget is the pod port a port of a resource is forwarded to
+type portTarget struct {
+	// index is the index of the port among the resource's ports
+	index int
+	// podName is the pod backing the resource, empty for pod resources
+	podName    string
+	remotePort int32
+	// preferredPort is the local port recommended for the port, or 0
+	preferredPort int32
 }
 
-// forwardServicePort handles port forwarding for a service by finding a backing pod and resolving the target port
-func (m *Manager) forwardServicePort(resource ui.Resource, portIndex int, localPort, servicePort int32) error {
-	// Get the target port spec for this service port
-	if portIndex >= len(resource.TargetPortSpecs) {
-		return fmt.Errorf("port index %d out of bounds for target port specs of service %s", portIndex, resource.Name)
-	}
-	targetSpec := resource.TargetPortSpecs[portIndex]
+// plannedPort is a port of a resource whose local port is allocated, waiting to be started
+// together with the other ports of the resource
+type plannedPort struct {
+	portTarget
+	localPort int32
+}
 
-	// Find pods that back this service
-	pods, err := m.K8sClient.GetPodsForService(m.Context, resource.Name)
+// selectBackingPod looks up the pods backing a service, deployment, statefulset or custom
+// resource and picks the one to forward to
+func (m *Manager) selectBackingPod(resource model.Resource) (*k8s.Pod, error) {
+	owner := string(resource.Type) + " " + resource.Name
+	if resource.Type == model.CustomResource {
+		owner = resource.Name
+	}
+	pods, err := m.backingPods(resource)
 	if err != nil {
 		// If pods cannot be found, we cannot forward.
-		return fmt.Errorf("failed to find pods for service %s: %w", resource.Name, err)
+		return nil, findPodsError(owner, err)
 	}
+	// Use the first pod matching the requested node, zone and labels if any
+	return m.selectPod(resource, pods, owner)
+}
 
-	// Use the first ready pod
-	// TODO: Implement better pod selection (e.g., check readiness, round-robin?)
-	var selectedPod *k8s.Pod
-	for i := range pods {
-		// Simple selection of the first pod for now
-		selectedPod = &pods[i]
-		break
+// portTarget resolves the port at portIndex of a resource, whose value is portValue, to the
+// port of pod it is forwarded to; pod is nil for pod resources. It returns nil for ports that
+// are skipped because they are not TCP.
+func (m *Manager) portTarget(resource model.Resource, pod *k8s.Pod, portIndex int, portValue int32) (*portTarget, error) {
+	switch resource.Type {
+	case model.ServiceResource:
+		return m.serviceTarget(resource, *pod, portIndex, portValue)
+	case model.DeploymentResource, model.StatefulSetResource, model.CustomResource:
+		return m.workloadTarget(resource, *pod, portIndex)
+	default: // PodResource
+		// portValue represents the container port here
+		if m.skipNonTCP(resource, portValue, resource.PortProtocol(portIndex)) {
+			return nil, nil
+		}
+		return &portTarget{index: portIndex, remotePort: portValue, preferredPort: resource.PreferredLocalPort(portIndex)}, nil
 	}
+}
 
-	if selectedPod == nil {
-		return fmt.Errorf("no pods found for service %s to forward port %d", resource.Name, servicePort)
+// serviceTarget resolves the target port of a service port on the selected pod
+func (m *Manager) serviceTarget(resource model.Resource, pod k8s.Pod, portIndex int, servicePort int32) (*portTarget, error) {
+	// Get the target port spec for this service port
+	if portIndex >= len(resource.TargetPortSpecs) {
+		return nil, fmt.Errorf("port index %d out of bounds for target port specs of service %s", portIndex, resource.Name)
 	}
+	targetSpec := resource.TargetPortSpecs[portIndex]
 
 	// Resolve the target container port on the selected pod
-	resolvedPodPort, err := resolveTargetPort(targetSpec, servicePort, *selectedPod)
+	resolvedPodPort, err := resolveTargetPort(targetSpec, servicePort, pod)
 	if err != nil {
 		// If target port cannot be resolved (e.g., named port not found), we cannot forward this specific port.
-		return fmt.Errorf("failed to resolve target port for service %s port %d on pod %s: %w", resource.Name, servicePort, selectedPod.Name, err)
+		return nil, fmt.Errorf("failed to resolve target port for service %s port %d on pod %s: %w", resource.Name, servicePort, pod.Name, err)
 	}
+	protocol := resource.PortProtocol(portIndex)
+	if protocol == "" {
+		protocol = pod.PortProtocol(resolvedPodPort)
+	}
+	if m.skipNonTCP(resource, servicePort, protocol) {
+		return nil, nil
+	}
+	return &portTarget{index: portIndex, podName: pod.Name, remotePort: resolvedPodPort, preferredPort: resource.PreferredLocalPort(portIndex)}, nil
+}
 
-	// If localPort was 0 (ephemeral case), allocate a port
-	if localPort == 0 {
-		// Try to use the resolved pod port as a suggestion
-		suggestedPort := resolvedPodPort
-
-		// Try to allocate that port
-		allocatedPort, err := m.PortAllocator.AllocatePort(suggestedPort)
-		if err != nil {
-			// If the suggested port is unavailable, try to get any available port
-			allocatedPort, err = m.PortAllocator.AllocatePort(0)
-			if err != nil {
-				return fmt.Errorf("failed to allocate local port: %w", err)
-			}
-		}
-		localPort = allocatedPort
+// workloadTarget finds the container port of the selected pod of a deployment, statefulset or
+// custom resource. Unlike services, the port index refers to the container ports of the pod.
+func (m *Manager) workloadTarget(resource model.Resource, pod k8s.Pod, portIndex int) (*portTarget, error) {
+	var podPort int32
+	if portIndex < len(pod.Ports) {
+		podPort = pod.Ports[portIndex].ContainerPort
+	} else if len(pod.Ports) > 0 {
+		// If port index is out of bounds but pod has ports, use the first port
+		podPort = pod.Ports[0].ContainerPort
 	} else {
-		// If a specific port was requested, try to allocate it
-		_, err := m.PortAllocator.AllocatePort(localPort)
-		if err != nil {
-			return fmt.Errorf("failed to allocate requested local port %d: %w", localPort, err)
-		}
+		return nil, fmt.Errorf("no container ports found in pod %s for %s %s", pod.Name, resource.Type, resource.Name)
 	}
-
-	// Start port forwarding to the selected pod and resolved port
-	req := ForwardRequest{
-		RestConfig: m.RestConfig,
-		ClientSet:  m.ClientSet,
-		Resource:   resource,
-		LocalPort:  localPort,
-		RemotePort: resolvedPodPort, // Use the RESOLVED container port
-		Streams:    m.Streams,
-		Context:    m.Context,
-		PodName:    selectedPod.Name, // Pod needed for the port-forward API call
-		AutoRetry:  true,             // Enable auto-retry by default
+	if m.skipNonTCP(resource, podPort, pod.PortProtocol(podPort)) {
+		return nil, nil
 	}
+	return &portTarget{index: portIndex, podName: pod.Name, remotePort: podPort, preferredPort: preferredLocalPort(resource, portIndex, pod, podPort)}, nil
+}
 
-	forwarder, err := StartPortForward(req)
+// selectPod picks the pod to forward to from the pods backing a resource described by owner,
+// such as "deployment web": the first ready one passing the pod filter, or else the first one.
+// Terminating, evicted and crash-looping pods are skipped with a warning.
+func (m *Manager) selectPod(resource model.Resource, pods []k8s.Pod, owner string) (*k8s.Pod, error) {
+	if len(pods) == 0 {
+		return nil, withSentinel(ErrNoReadyPods, fmt.Errorf("no pods found for %s to forward port", owner))
+	}
+	filter, err := m.podFilterFor(resource)
 	if err != nil {
-		// Release the allocated port
-		m.PortAllocator.ReleasePort(localPort)
-		// Stop any previously started forwarders
-		m.stopResourceForwarders(resource)
-		return fmt.Errorf("failed to start port forward for service %s via pod %s: %w",
-			resource.Name, selectedPod.Name, err)
+		return nil, err
 	}
-
-	m.Forwarders = append(m.Forwarders, forwarder)
-	m.startForwarderMonitor(forwarder)
-	return nil
-}
-
-// forwardDeploymentPort handles port forwarding for a deployment by finding a backing pod
-func (m *Manager) forwardDeploymentPort(resource ui.Resource, portIndex int, localPort, deploymentPort int32) error {
-	// Find pods that back this deployment
-	pods, err := m.K8sClient.GetPodsForDeployment(m.Context, resource.Name)
+	candidates, err := m.filterPods(resource, filter, pods)
 	if err != nil {
-		return fmt.Errorf("failed to find pods for deployment %s: %w", resource.Name, err)
+		return nil, err
 	}
-
-	// Use the first ready pod
-	// TODO: Implement better pod selection (e.g., check readiness, round-robin?)
-	var selectedPod *k8s.Pod
-	for i := range pods {
-		// Simple selection of the first pod for now
-		selectedPod = &pods[i]
-		break
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("none of the %d pods of %s %s", len(pods), owner, filter)
+	}
+	candidates, skipped := usablePods(candidates)
+	if len(candidates) == 0 {
+		return nil, withSentinel(ErrNoReadyPods, fmt.Errorf("no usable pods for %s to forward port: %s", owner, strings.Join(skipped, ", ")))
+	}
+	if len(skipped) > 0 {
+		m.Log().Warn(fmt.Sprintf("Skipping pods of %s: %s", owner, strings.Join(skipped, ", ")), "event", "skipped", "pods", skipped)
 	}
+	for i := range candidates {
+		if candidates[i].Ready {
+			return &candidates[i], nil
+		}
+	}
+	return &candidates[0], nil
+}
 
-	if selectedPod == nil {
-		return fmt.Errorf("no pods found for deployment %s to forward port", resource.Name)
+// preferredLocalPort returns the local port recommended for a port of a resource forwarded via
+// pod, either by the resource itself or by the pod's annotations, or 0
+func preferredLocalPort(resource model.Resource, portIndex int, pod k8s.Pod, podPort int32) int32 {
+	if preferred := resource.PreferredLocalPort(portIndex); preferred != 0 {
+		return preferred
 	}
+	return pod.LocalPorts[podPort]
+}
 
-	// Find the container port in the selected pod
-	// Unlike services, we need to find the actual container port
-	var podPort int32
-	if portIndex < len(selectedPod.Ports) {
-		podPort = selectedPod.Ports[portIndex].ContainerPort
-	} else if len(selectedPod.Ports) > 0 {
-		// If port index is out of bounds but pod has ports, use the first port
-		podPort = selectedPod.Ports[0].ContainerPort
-	} else {
-		return fmt.Errorf("no container ports found in pod %s for deployment %s", selectedPod.Name, resource.Name)
+// allocateLocalPort reserves the requested local port. When no port was requested (0), the
+// preferred port recommended by annotations, then the suggested port (or the stable port in
+// StablePorts mode) is tried first and an ephemeral port is used if they are unavailable. The
+// suggested port is the remote port being forwarded; preferredPort is 0 without a
+// recommendation. PortOffset is added to the requested, preferred and suggested ports.
+// errForwardedElsewhere is returned when another pfw process already serves this forward on
+// the requested port. A busy requested port is replaced according to OnConflict, and a
+// requested port that PortOffset pushes beyond 65535 is an error. Suggested and preferred ports
+// pushed beyond it are skipped.
+func (m *Manager) allocateLocalPort(resource model.Resource, localPort, suggestedPort, preferredPort int32) (int32, error) {
+	if err := m.checkOffset(resource, localPort); err != nil {
+		return 0, err
+	}
+	localPort = m.withOffset(localPort)
+	if localPort != 0 {
+		// If a specific port was requested, try to allocate it
+		if _, err := m.PortAllocator.AllocatePort(localPort); err != nil {
+			if privilegedPortsEnforced && localPort < PrivilegedPortLimit && isPermissionDenied(err) {
+				return m.allocateForPrivilegedPort(localPort)
+			}
+			conflict := m.checkPortConflict(resource, localPort, suggestedPort)
+			if errors.Is(conflict, errForwardedElsewhere) {
+				return 0, conflict
+			}
+			if substitute, ok := m.substitutePort(resource, localPort, suggestedPort); ok {
+				return substitute, nil
+			}
+			return 0, fmt.Errorf("failed to allocate requested local port %d: %w", localPort, conflict)
+		}
+		return localPort, nil
 	}
 
-	// If localPort was 0 (ephemeral case), allocate a port
-	if localPort == 0 {
-		// Try to use the pod port as a suggestion
-		suggestedPort := podPort
+	stableKey := StableKey(resource.Namespace, resource.Type, resource.Name, suggestedPort)
 
-		// Try to allocate that port
-		allocatedPort, err := m.PortAllocator.AllocatePort(suggestedPort)
-		if err != nil {
-			// If the suggested port is unavailable, try to get any available port
-			allocatedPort, err = m.PortAllocator.AllocatePort(0)
-			if err != nil {
-				return fmt.Errorf("failed to allocate local port: %w", err)
+	key := AssignmentKey(m.contextFor(resource), resource.Namespace, resource.Type, resource.Name, suggestedPort)
+
+	// Reuse the port remembered from a previous run while it is still free
+	if m.PortAssignments != nil {
+		if remembered, ok := m.PortAssignments.Get(key); ok {
+			if _, err := m.PortAllocator.AllocatePort(remembered); err == nil {
+				return remembered, nil
 			}
 		}
-		localPort = allocatedPort
-	} else {
-		// If a specific port was requested, try to allocate it
-		_, err := m.PortAllocator.AllocatePort(localPort)
-		if err != nil {
-			return fmt.Errorf("failed to allocate requested local port %d: %w", localPort, err)
-		}
 	}
 
-	// Start port forwarding to the selected pod
-	req := ForwardRequest{
-		RestConfig: m.RestConfig,
-		ClientSet:  m.ClientSet,
-		Resource:   resource,
-		LocalPort:  localPort,
-		RemotePort: podPort,
-		Streams:    m.Streams,
-		Context:    m.Context,
-		PodName:    selectedPod.Name,
-		AutoRetry:  true, // Enable auto-retry by default
+	if m.StablePorts {
+		suggestedPort = m.PortAllocator.StablePort(stableKey)
 	}
 
-	forwarder, err := StartPortForward(req)
+	// Try the recommended port, then the suggested port, then any available port (0)
+	var candidates []int32
+	for _, port := range []int32{preferredPort, suggestedPort} {
+		if port != 0 && m.checkOffset(resource, port) == nil {
+			candidates = append(candidates, m.withOffset(port))
+		}
+	}
+	candidates = append(candidates, 0)
+	var allocatedPort int32
+	var err error
+	for _, candidate := range candidates {
+		if allocatedPort, err = m.PortAllocator.AllocatePort(candidate); err == nil {
+			break
+		}
+	}
 	if err != nil {
-		// Release the allocated port
-		m.PortAllocator.ReleasePort(localPort)
-		// Stop any previously started forwarders
-		m.stopResourceForwarders(resource)
-		return fmt.Errorf("failed to start port forward for deployment %s via pod %s: %w",
-			resource.Name, selectedPod.Name, err)
+		return 0, fmt.Errorf("failed to allocate local port: %w", err)
+	}
+
+	if m.PortAssignments != nil {
+		if err := m.PortAssignments.Set(key, allocatedPort); err != nil {
+			m.Log().Warn(fmt.Sprintf("Failed to remember local port %d: %v", allocatedPort, err),
+				"localPort", allocatedPort, "error", err.Error())
+		}
 	}
+	return allocatedPort, nil
+}
 
-	m.Forwarders = append(m.Forwarders, forwarder)
-	m.startForwarderMonitor(forwarder)
+// withOffset adds PortOffset to a local port; 0, which asks for any port, is kept
+func (m *Manager) withOffset(port int32) int32 {
+	if port == 0 {
+		return 0
+	}
+	return port + m.PortOffset
+}
+
+// checkOffset returns an error naming resource if PortOffset pushes its local port beyond 65535
+func (m *Manager) checkOffset(resource model.Resource, port int32) error {
+	if port != 0 && int64(port)+int64(m.PortOffset) > 65535 {
+		return fmt.Errorf("local port %d of %s/%s plus port offset %d exceeds 65535", port, resource.Type, resource.Name, m.PortOffset)
+	}
 	return nil
 }
 
-// forwardStatefulSetPort handles port forwarding for a statefulset by finding a backing pod
-func (m *Manager) forwardStatefulSetPort(resource ui.Resource, portIndex int, localPort, statefulSetPort int32) error {
-	// Find pods that back this statefulset
-	pods, err := m.K8sClient.GetPodsForStatefulSet(m.Context, resource.Name)
+// allocateForPrivilegedPort handles a requested port that needs elevated privileges to bind by
+// forwarding on an unprivileged port instead and, if configured, starting the privileged helper
+func (m *Manager) allocateForPrivilegedPort(privilegedPort int32) (int32, error) {
+	localPort, err := m.allocatePrivilegedSubstitute(privilegedPort)
 	if err != nil {
-		return fmt.Errorf("failed to find pods for statefulset %s: %w", resource.Name, err)
+		return 0, fmt.Errorf("local port %d requires elevated privileges and no substitute port is available: %w", privilegedPort, err)
 	}
 
-	// Use the first ready pod
-	// TODO: Implement better pod selection (e.g., check readiness, round-robin?)
-	var selectedPod *k8s.Pod
-	for i := range pods {
-		// Simple selection of the first pod for now
-		selectedPod = &pods[i]
-		break
+	if m.PrivilegedHelper == nil {
+		m.Log().Warn(fmt.Sprintf("Local port %d requires elevated privileges, forwarding on localhost:%d instead",
+			privilegedPort, localPort), "privilegedPort", privilegedPort, "localPort", localPort)
+		return localPort, nil
 	}
 
-	if selectedPod == nil {
-		return fmt.Errorf("no pods found for statefulset %s to forward port", resource.Name)
+	if err := m.PrivilegedHelper(privilegedPort, localPort); err != nil {
+		m.Log().Warn(fmt.Sprintf("Failed to start privileged helper for port %d, forwarding on localhost:%d only: %v",
+			privilegedPort, localPort, err), "privilegedPort", privilegedPort, "localPort", localPort, "error", err.Error())
+		return localPort, nil
 	}
+	m.Log().Warn(fmt.Sprintf("Local port %d is relayed to localhost:%d by a privileged helper", privilegedPort, localPort),
+		"privilegedPort", privilegedPort, "localPort", localPort)
+	return localPort, nil
+}
 
-	// Find the container port in the selected pod
-	// Unlike services, we need to find the actual container port
-	var podPort int32
-	if portIndex < len(selectedPod.Ports) {
-		podPort = selectedPod.Ports[portIndex].ContainerPort
-	} else if len(selectedPod.Ports) > 0 {
-		// If port index is out of bounds but pod has ports, use the first port
-		podPort = selectedPod.Ports[0].ContainerPort
-	} else {
-		return fmt.Errorf("no container ports found in pod %s for statefulset %s", selectedPod.Name, resource.Name)
+// newForwardRequest builds a ForwardRequest carrying the manager-wide settings.
+// podName is empty when forwarding directly to a pod resource; portIndex is the index of the
+// forwarded port among the resource's ports.
+func (m *Manager) newForwardRequest(resource model.Resource, portIndex int, localPort, remotePort int32, podName string) ForwardRequest {
+	cluster := m.clusterFor(resource)
+	listeners := m.PortAllocator.TakeListeners(localPort)
+	return ForwardRequest{
+		RestConfig:        cluster.RestConfig,
+		ClientSet:         cluster.ClientSet,
+		Resource:          resource,
+		LocalPort:         localPort,
+		RemotePort:        remotePort,
+		Streams:           m.Streams,
+		Context:           m.Context,
+		PodName:           podName,
+		Scheme:            portScheme(resource, portIndex, remotePort),
+		Dialers:           m.podDialers(resource, cluster, len(listeners) > 0),
+		AutoRetry:         true, // Enable auto-retry by default
+		KeepaliveInterval: m.KeepaliveInterval,
+		Lazy:              m.Lazy,
+		IdleTimeout:       m.LazyIdleTimeout,
+		Logger:            m.Log(),
+		Events:            m.Events,
+		Audit:             m.Audit,
+		onRetry:           func(err error) { m.recordRetry(localPort, err) },
+		onReconnect:       func() { m.recordReconnect(localPort) },
+		onPodChange:       func(pod string) { m.recordPod(localPort, pod) },
+		// Hand over the listeners bound during allocation
+		Listeners: listeners,
 	}
+}
 
-	// If localPort was 0 (ephemeral case), allocate a port
-	if localPort == 0 {
-		// Try to use the pod port as a suggestion
-		suggestedPort := podPort
+// withExtraPorts makes the request carry the further planned ports of its pod, handing over
+// the listeners bound for them during allocation
+func (m *Manager) withExtraPorts(req ForwardRequest, planned []plannedPort) ForwardRequest {
+	if len(planned) == 0 {
+		return req
+	}
+	for _, p := range planned {
+		req.ExtraPorts = append(req.ExtraPorts, PortPair{LocalPort: p.localPort, RemotePort: p.remotePort, Scheme: portScheme(req.Resource, p.index, p.remotePort)})
+		req.ExtraListeners = append(req.ExtraListeners, m.PortAllocator.TakeListeners(p.localPort))
+	}
+	req.Dialers = m.podDialers(req.Resource, m.clusterFor(req.Resource), req.holdsListeners())
 
-		// Try to allocate that port
-		allocatedPort, err := m.PortAllocator.AllocatePort(suggestedPort)
-		if err != nil {
-			// If the suggested port is unavailable, try to get any available port
-			allocatedPort, err = m.PortAllocator.AllocatePort(0)
-			if err != nil {
-				return fmt.Errorf("failed to allocate local port: %w", err)
-			}
+	// Retries, reconnections and pod changes concern every port of the tunnel
+	ports := req.ports()
+	req.onRetry = func(err error) {
+		for _, port := range ports {
+			m.recordRetry(port.LocalPort, err)
 		}
-		localPort = allocatedPort
-	} else {
-		// If a specific port was requested, try to allocate it
-		_, err := m.PortAllocator.AllocatePort(localPort)
-		if err != nil {
-			return fmt.Errorf("failed to allocate requested local port %d: %w", localPort, err)
+	}
+	req.onReconnect = func() {
+		for _, port := range ports {
+			m.recordReconnect(port.LocalPort)
 		}
 	}
+	req.onPodChange = func(pod string) {
+		for _, port := range ports {
+			m.recordPod(port.LocalPort, pod)
+		}
+	}
+	return req
+}
+
+// podDialers returns the dialers of a resource's forwards. Forwards serving their own
+// listeners, and lazy forwards, share one connection per pod; others are run by client-go,
+// which numbers the streams of its connection itself.
+func (m *Manager) podDialers(resource model.Resource, cluster *Cluster, held bool) DialerFactory {
+	dialers := cluster.Dialers
+	if dialers == nil {
+		dialers = NewSPDYDialerFactory(cluster.RestConfig)
+	}
+	if !held && !m.Lazy {
+		return dialers
+	}
+	return sharedDialerFactory{shared: &m.sharedDialers, cluster: resource.ClusterKey(), dialers: dialers}
+}
 
-	// Start port forwarding to the selected pod
-	req := ForwardRequest{
-		RestConfig: m.RestConfig,
-		ClientSet:  m.ClientSet,
-		Resource:   resource,
-		LocalPort:  localPort,
-		RemotePort: podPort,
-		Streams:    m.Streams,
-		Context:    m.Context,
-		PodName:    selectedPod.Name,
-		AutoRetry:  true, // Enable auto-retry by default
+// launch starts a forwarder for the request, honoring MaxForwards. When the limit is reached
+// the request is either queued until a running forward ends or rejected. It returns the ID of
+// the forward. Must be called with m.mutex held.
+func (m *Manager) launch(req ForwardRequest) (string, error) {
+	if m.MaxForwards > 0 && m.running >= m.MaxForwards {
+		if !m.QueueExcessForwards {
+			req.closeAllListeners()
+			return "", fmt.Errorf("limit of %d concurrent forwards reached, not forwarding remote port %d",
+				m.MaxForwards, req.RemotePort)
+		}
+		m.queue = append(m.queue, req)
+		entry := m.track(req, ForwardQueued)
+		m.forwardLog(req).Warn(fmt.Sprintf("Queued %s/%s port %d: limit of %d concurrent forwards reached",
+			req.Resource.Type, req.Resource.Name, req.RemotePort, m.MaxForwards), "event", "queued", "maxForwards", m.MaxForwards)
+		return entry.id, nil
 	}
 
 	forwarder, err := StartPortForward(req)
 	if err != nil {
-		// Release the allocated port
-		m.PortAllocator.ReleasePort(localPort)
-		// Stop any previously started forwarders
-		m.stopResourceForwarders(resource)
-		return fmt.Errorf("failed to start port forward for statefulset %s via pod %s: %w",
-			resource.Name, selectedPod.Name, err)
+		req.closeAllListeners()
+		return "", err
 	}
 
-	m.Forwarders = append(m.Forwarders, forwarder)
-	m.startForwarderMonitor(forwarder)
-	return nil
+	entry := m.track(req, ForwardStarting)
+	m.startForwarder(entry, forwarder)
+	return entry.id, nil
 }
 
-// startForwarderMonitor starts a goroutine to monitor the forwarding status
-func (m *Manager) startForwarderMonitor(forwarder *PortForwarder) {
-	m.ForwardWait.Add(1)
-
-	// Wait for ready or error
-	go func(pf *PortForwarder) {
-		defer m.ForwardWait.Done()
-		select {
-		case <-pf.ReadyChannel:
-			fmt.Fprintf(m.Streams.Out, "%s\n", pf.GetPortForwardString())
-			// After ready, wait for either an error or context done
-			select {
-			case err := <-pf.ErrorChannel:
-				fmt.Fprintf(m.Streams.ErrOut, "Error forwarding ports for %s: %v\n", pf.Resource.Name, err)
-				// Release the port when forwarding ends
-				m.PortAllocator.ReleasePort(pf.LocalPort)
-			case <-m.Context.Done():
-				// Release the port when forwarding ends
-				m.PortAllocator.ReleasePort(pf.LocalPort)
-				// No need to call pf.Stop() here, manager.Stop() handles it
-			}
-		case err := <-pf.ErrorChannel:
-			fmt.Fprintf(m.Streams.ErrOut, "Error forwarding ports for %s: %v\n", pf.Resource.Name, err)
-			// Release the port when forwarding ends with error
-			m.PortAllocator.ReleasePort(pf.LocalPort)
-		case <-m.Context.Done():
-			// Release the port when forwarding ends
-			m.PortAllocator.ReleasePort(pf.LocalPort)
-			// No need to call pf.Stop() here, manager.Stop() handles it
-		}
-	}(forwarder)
-}
+// reportError logs the error that ended a forward and records it for the session summary
+func (m *Manager) reportError(req ForwardRequest, pf *PortForwarder, err error) {
+	m.forwardLog(req).Error(fmt.Sprintf("Error forwarding ports for %s: %v", req.Resource.Name, err),
+		"event", "error", "error", err.Error())
+	m.Events.Emit(req.forwardEvent(EventForwardFailed, err))
 
-// stopResourceForwarders stops forwarders for a specific resource
-func (m *Manager) stopResourceForwarders(resource ui.Resource) {
-	for _, fw := range m.Forwarders {
-		if fw.Resource.Name == resource.Name && fw.Resource.Namespace == resource.Namespace {
-			fw.Stop()
-			// Release the port
-			m.PortAllocator.ReleasePort(fw.LocalPort)
-		}
-	}
+	m.mutex.Lock()
+	m.failures = append(m.failures, req.failure(pf.Attempts(), err))
+	m.mutex.Unlock()
 }
 
-// Stop stops all port forwarding
+// Stop stops all port forwarding. Running forwards release their ports from the supervision
+// loop once they have shut down.
 func (m *Manager) Stop() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	for _, forwarder := range m.Forwarders {
-		forwarder.Stop()
-		// Release the port
-		m.PortAllocator.ReleasePort(forwarder.LocalPort)
+	m.stopped = true
+	for _, entry := range m.forwards {
+		m.removeLocked(entry)
+	}
+	m.queue = nil
+
+	if m.Registry != nil {
+		m.Registry.UnregisterAll()
 	}
 }
 
-// SetupSignalHandler sets up a signal handler to stop port forwarding on interrupt
+// ShutdownTimeout bounds how long a session waits for its forwards to shut down after a
+// shutdown signal before exiting anyway. It stays below the few seconds Windows grants after
+// the console window is closed.
+const ShutdownTimeout = 2 * time.Second
+
+// SetupSignalHandler sets up a signal handler to stop port forwarding on interrupt.
+// It exits the process once the forwards have shut down, or after ShutdownTimeout; programs
+// embedding the Manager should handle signals themselves and call Stop.
 func (m *Manager) SetupSignalHandler() {
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(signals, ShutdownSignals()...)
 
 	go func() {
 		<-signals
-		fmt.Fprintln(m.Streams.Out, "\nShutting down port forwarding...")
+		if isConsole(m.Log()) {
+			// End the line echoing ^C
+			fmt.Fprintln(m.Streams.Out)
+		}
+		m.Log().Info("Shutting down port forwarding...", "event", "shutdown")
 		m.Stop()
 
-		// Wait briefly for port forwards to clean up
-		time.Sleep(500 * time.Millisecond)
-
-		// Force exit to handle the case where some goroutines are stuck
+		// Force exit to handle the case where some forwards are stuck
+		m.WaitForCompletionTimeout(ShutdownTimeout)
 		os.Exit(0)
 	}()
 }
@@ -476,6 +751,22 @@ func (m *Manager) WaitForCompletion() {
 	m.ForwardWait.Wait()
 }
 
+// WaitForCompletionTimeout waits like WaitForCompletion, but at most timeout. It reports
+// whether all port forwards completed.
+func (m *Manager) WaitForCompletionTimeout(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		m.WaitForCompletion()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 // resolveTargetPort determines the numeric target port on a pod corresponding to a service's targetPort spec.
 func resolveTargetPort(targetSpec *intstr.IntOrString, servicePort int32, pod k8s.Pod) (int32, error) {
 	if targetSpec == nil {
@@ -500,7 +791,7 @@ func resolveTargetPort(targetSpec *intstr.IntOrString, servicePort int32, pod k8
 				return podPort.ContainerPort, nil
 			}
 		}
-		return 0, fmt.Errorf("named target port '%s' not found on pod '%s' in namespace '%s'", portName, pod.Name, pod.Namespace)
+		return 0, withSentinel(ErrNamedPortNotFound, fmt.Errorf("named target port '%s' not found on pod '%s' in namespace '%s'", portName, pod.Name, pod.Namespace))
 	default:
 		return 0, fmt.Errorf("unknown targetPort type: %v", targetSpec.Type)
 	}
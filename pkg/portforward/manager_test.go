@@ -2,13 +2,25 @@ package portforward
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
 
-	"k8s.io/cli-runtime/pkg/genericclioptions"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 // TestNewManager verifies that NewManager returns a properly initialized Manager.
@@ -16,10 +28,10 @@ func TestNewManager(t *testing.T) {
 	cfg := &rest.Config{}
 	clientset := &kubernetes.Clientset{}
 	k8sClient := &k8s.Client{} // Use real type, not a mock
-	streams := genericclioptions.IOStreams{}
+	streams := genericiooptions.IOStreams{}
 	ctx := context.Background()
 
-	mgr := NewManager(cfg, clientset, k8sClient, streams, ctx)
+	mgr := NewManager(ctx, cfg, clientset, k8sClient, streams)
 	if mgr == nil {
 		t.Fatal("expected non-nil Manager")
 	}
@@ -43,28 +55,602 @@ func TestNewManager(t *testing.T) {
 	}
 }
 
-// TestManager_Stop verifies that Stop releases all ports and stops all forwarders.
+// TestManager_Stop verifies that Stop stops all forwarders and that their ports are released once they exit.
 func TestManager_Stop(t *testing.T) {
-	mgr := &Manager{
-		PortAllocator: NewPortAllocator(),
-		Forwarders:    []*PortForwarder{},
-	}
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, nil, nil, streams)
+
 	// Add a dummy forwarder
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+		LocalPort:  12345,
+		RemotePort: 80,
+	}
 	pf := &PortForwarder{
-		LocalPort:   12345,
-		StopChannel: make(chan struct{}, 1),
+		Resource:     req.Resource,
+		LocalPort:    req.LocalPort,
+		StopChannel:  make(chan struct{}, 1),
+		ReadyChannel: make(chan struct{}, 1),
+		ErrorChannel: make(chan error, 1),
 	}
-	mgr.Forwarders = append(mgr.Forwarders, pf)
 	mgr.PortAllocator.allocatedPorts[12345] = true
+	mgr.mutex.Lock()
+	mgr.startForwarder(mgr.track(req, ForwardStarting), pf)
+	mgr.mutex.Unlock()
 
 	mgr.Stop()
-	if mgr.PortAllocator.allocatedPorts[12345] {
-		t.Error("expected port to be released after Stop")
-	}
 	select {
 	case <-pf.StopChannel:
 		// ok
 	default:
 		t.Error("expected StopChannel to be closed")
 	}
+
+	mgr.WaitForCompletion()
+	if mgr.PortAllocator.allocatedPorts[12345] {
+		t.Error("expected port to be released after Stop")
+	}
+	if status := mgr.GetStatus(); len(status) != 0 {
+		t.Errorf("expected no forwards after Stop, got %d", len(status))
+	}
+}
+
+// TestManager_RemoveForward verifies that a single forward can be removed by ID without affecting others.
+func TestManager_RemoveForward(t *testing.T) {
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, nil, nil, streams)
+
+	var forwarders []*PortForwarder
+	for _, port := range []int32{12345, 12346} {
+		req := ForwardRequest{
+			Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+			LocalPort:  port,
+			RemotePort: 80,
+		}
+		pf := &PortForwarder{
+			Resource:     req.Resource,
+			LocalPort:    port,
+			StopChannel:  make(chan struct{}, 1),
+			ReadyChannel: make(chan struct{}, 1),
+			ErrorChannel: make(chan error, 1),
+		}
+		mgr.PortAllocator.allocatedPorts[port] = true
+		mgr.mutex.Lock()
+		mgr.startForwarder(mgr.track(req, ForwardStarting), pf)
+		mgr.mutex.Unlock()
+		forwarders = append(forwarders, pf)
+	}
+
+	id := ForwardID(forwarders[0].Resource, 12345)
+	if err := mgr.RemoveForward(id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mgr.RemoveForward("ns1/pod/missing:1"); err == nil {
+		t.Error("expected error for unknown forward ID")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(mgr.GetStatus()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected one remaining forward, got %d", len(mgr.GetStatus()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := mgr.GetStatus(); status[0].LocalPort != 12346 {
+		t.Errorf("expected forward on port 12346 to remain, got %d", status[0].LocalPort)
+	}
+
+	mgr.Stop()
+	mgr.WaitForCompletion()
+}
+
+// TestManager_StopForward verifies that StopForward returns only once the forward is gone and
+// its port released, for running as well as queued forwards.
+func TestManager_StopForward(t *testing.T) {
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, nil, nil, streams)
+
+	running := ForwardRequest{
+		Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+		LocalPort:  12345,
+		RemotePort: 80,
+	}
+	queued := running
+	queued.LocalPort = 12346
+	pf := &PortForwarder{
+		Resource:     running.Resource,
+		LocalPort:    running.LocalPort,
+		StopChannel:  make(chan struct{}, 1),
+		ReadyChannel: make(chan struct{}, 1),
+		ErrorChannel: make(chan error, 1),
+	}
+	mgr.PortAllocator.allocatedPorts[12345] = true
+	mgr.PortAllocator.allocatedPorts[12346] = true
+	mgr.mutex.Lock()
+	mgr.startForwarder(mgr.track(running, ForwardStarting), pf)
+	mgr.queue = append(mgr.queue, queued)
+	mgr.track(queued, ForwardQueued)
+	mgr.mutex.Unlock()
+
+	// The queued forward goes first, as stopping the running one would start it
+	for _, port := range []int32{12346, 12345} {
+		if err := mgr.StopForward(ForwardID(running.Resource, port)); err != nil {
+			t.Fatalf("unexpected error stopping the forward on port %d: %v", port, err)
+		}
+		if mgr.PortAllocator.IsAllocated(port) {
+			t.Errorf("expected port %d to be released once StopForward returned", port)
+		}
+	}
+	if status := mgr.GetStatus(); len(status) != 0 {
+		t.Errorf("expected no forwards after stopping both, got %+v", status)
+	}
+	if err := mgr.StopForward(ForwardID(running.Resource, 12345)); err == nil {
+		t.Error("expected an error stopping a forward that is gone")
+	}
+	mgr.WaitForCompletion()
+}
+
+// TestManager_LaunchRespectsMaxForwards verifies that requests beyond MaxForwards are rejected or queued.
+func TestManager_LaunchRespectsMaxForwards(t *testing.T) {
+	streams, _, _, errOut := genericiooptions.NewTestIOStreams()
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "svc1", Namespace: "ns1", Type: model.ServiceResource},
+		LocalPort:  8080,
+		RemotePort: 80,
+	}
+
+	mgr := &Manager{Streams: streams, MaxForwards: 1, running: 1}
+	if _, err := mgr.launch(req); err == nil {
+		t.Error("expected error when limit is reached and queueing is disabled")
+	}
+
+	mgr.QueueExcessForwards = true
+	if _, err := mgr.launch(req); err != nil {
+		t.Fatalf("unexpected error when queueing: %v", err)
+	}
+	if len(mgr.queue) != 1 {
+		t.Errorf("expected 1 queued request, got %d", len(mgr.queue))
+	}
+	if errOut.Len() == 0 {
+		t.Error("expected a message about the queued forward")
+	}
+}
+
+// TestManager_Summary verifies that forwards ending with an error and resources that failed to
+// start are counted in the session summary.
+func TestManager_Summary(t *testing.T) {
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, nil, nil, streams)
+
+	ok := ForwardRequest{Resource: model.Resource{Name: "ok", Type: model.ServiceResource}, LocalPort: 8080, RemotePort: 80}
+	broken := ForwardRequest{Resource: model.Resource{Name: "broken", Type: model.ServiceResource}, LocalPort: 8081, RemotePort: 80}
+	mgr.mutex.Lock()
+	mgr.track(ok, ForwardActive)
+	mgr.track(broken, ForwardActive)
+	mgr.mutex.Unlock()
+
+	mgr.reportError(broken, &PortForwarder{RetryAttempts: 5}, errors.New("lost connection to pod"))
+	mgr.RecordFailure(ForwardFailure{Resource: model.Resource{Name: "missing"}, Err: errors.New("not found")})
+
+	summary := mgr.Summary()
+	if summary.Forwards != 3 {
+		t.Errorf("expected 3 forwards, got %d", summary.Forwards)
+	}
+	if len(summary.Failures) != 2 {
+		t.Fatalf("expected 2 failures, got %d", len(summary.Failures))
+	}
+	if f := summary.Failures[0]; f.Resource.Name != "broken" || f.Retries != 5 || f.LocalPort != 8081 {
+		t.Errorf("unexpected failure %+v", f)
+	}
+}
+
+// TestManager_AllocatePreferredLocalPort verifies that a recommended local port is used when
+// free and that the suggested port is used otherwise.
+func TestManager_AllocatePreferredLocalPort(t *testing.T) {
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, nil, nil, streams)
+	resource := model.Resource{Name: "db", Namespace: "ns1", Type: model.PodResource}
+
+	preferred, err := mgr.PortAllocator.AllocatePort(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.PortAllocator.ReleasePort(preferred)
+
+	port, err := mgr.allocateLocalPort(resource, 0, 0, preferred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if port != preferred {
+		t.Errorf("expected preferred port %d, got %d", preferred, port)
+	}
+
+	// The preferred port is taken now, so an ephemeral port is used
+	other, err := mgr.allocateLocalPort(resource, 0, 0, preferred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if other == preferred || other == 0 {
+		t.Errorf("expected another port than %d, got %d", preferred, other)
+	}
+}
+
+// TestManager_AllocateWithPortOffset verifies that PortOffset shifts requested and suggested
+// local ports but not requests for any port.
+func TestManager_AllocateWithPortOffset(t *testing.T) {
+	mgr := NewManager(context.Background(), nil, nil, nil, genericiooptions.IOStreams{})
+	resource := model.Resource{Name: "web", Namespace: "ns1", Type: model.ServiceResource}
+
+	free, err := mgr.PortAllocator.AllocatePort(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.PortAllocator.ReleasePort(free)
+	mgr.PortOffset = free - 80
+
+	if port, err := mgr.allocateLocalPort(resource, 80, 80, 0); err != nil || port != free {
+		t.Errorf("expected requested port 80 to be shifted to %d, got %d, %v", free, port, err)
+	}
+	mgr.PortAllocator.ReleasePort(free)
+	if port, err := mgr.allocateLocalPort(resource, 0, 80, 0); err != nil || port != free {
+		t.Errorf("expected suggested port 80 to be shifted to %d, got %d, %v", free, port, err)
+	}
+	if mgr.withOffset(0) != 0 {
+		t.Error("expected a request for any port to stay 0")
+	}
+	mgr.PortAllocator.ReleasePort(free)
+
+	// Ports pushed beyond 65535 fail when requested and fall back to any port when suggested
+	mgr.PortOffset = 65500
+	_, err = mgr.allocateLocalPort(resource, 80, 80, 0)
+	if err == nil || !strings.Contains(err.Error(), "service/web") {
+		t.Errorf("expected an error naming service/web, got %v", err)
+	}
+	port, err := mgr.allocateLocalPort(resource, 0, 80, 0)
+	if err != nil || port == 0 || port == 65580 {
+		t.Errorf("expected any free port, got %d, %v", port, err)
+	}
+	mgr.PortAllocator.ReleasePort(port)
+	err = mgr.CheckLocalPorts([]LocalPortRequest{{Resource: resource, LocalPort: 80, RemotePort: 80}})
+	if err == nil || !strings.Contains(err.Error(), "exceeds 65535") {
+		t.Errorf("expected CheckLocalPorts to report the overflow, got %v", err)
+	}
+}
+
+// TestManager_SelectPodOnNode verifies that Node restricts the pods forwarded to.
+func TestManager_SelectPodOnNode(t *testing.T) {
+	mgr := NewManager(context.Background(), nil, nil, nil, genericiooptions.IOStreams{})
+	pods := []k8s.Pod{{Name: "agent-a", Node: "node-a"}, {Name: "agent-b", Node: "node-b"}}
+
+	pod, err := mgr.selectPod(model.Resource{}, pods, "daemonset agent")
+	if err != nil || pod.Name != "agent-a" {
+		t.Errorf("expected the first pod without a node, got %+v, %v", pod, err)
+	}
+
+	mgr.Node = "node-b"
+	pod, err = mgr.selectPod(model.Resource{}, pods, "daemonset agent")
+	if err != nil || pod.Name != "agent-b" {
+		t.Errorf("expected the pod on node-b, got %+v, %v", pod, err)
+	}
+
+	mgr.Node = "node-c"
+	if _, err := mgr.selectPod(model.Resource{}, pods, "daemonset agent"); err == nil {
+		t.Error("expected an error when no pod runs on the node")
+	}
+}
+
+// rolloutResolver returns the next list of deployment pods on each call, repeating the last one
+type rolloutResolver struct {
+	mu     sync.Mutex
+	phases [][]k8s.Pod
+	calls  int
+}
+
+func (r *rolloutResolver) GetPodsForDeployment(ctx context.Context, name string) ([]k8s.Pod, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.calls
+	if i >= len(r.phases) {
+		i = len(r.phases) - 1
+	}
+	r.calls++
+	if len(r.phases[i]) == 0 {
+		return nil, fmt.Errorf("%w for deployment %s", k8s.ErrNoPods, name)
+	}
+	return r.phases[i], nil
+}
+
+func (r *rolloutResolver) GetPodsForService(ctx context.Context, name string) ([]k8s.Pod, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *rolloutResolver) GetPodsForStatefulSet(ctx context.Context, name string) ([]k8s.Pod, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *rolloutResolver) GetPodsForCustomResource(ctx context.Context, name string) ([]k8s.Pod, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *rolloutResolver) GetPod(ctx context.Context, name string) (k8s.Pod, error) {
+	return k8s.Pod{}, errors.New("not implemented")
+}
+
+func (r *rolloutResolver) GetContext() string { return "" }
+
+// TestManager_AwaitReadyPod verifies that forwarding waits through a rollout until a pod is
+// ready, and gives up after the timeout.
+func TestManager_AwaitReadyPod(t *testing.T) {
+	defer func(interval time.Duration) { readyPollInterval = interval }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	web := model.Resource{Name: "web", Namespace: "apps", Type: model.DeploymentResource}
+	resolver := &rolloutResolver{phases: [][]k8s.Pod{
+		nil,
+		{{Name: "web-1", Status: "ContainerCreating"}},
+		{{Name: "web-1", Status: "Running", Ready: true}},
+	}}
+	mgr := NewManager(context.Background(), nil, nil, resolver, genericiooptions.IOStreams{})
+	mgr.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := mgr.awaitReadyPod(web, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolver.calls != 3 {
+		t.Errorf("expected 3 lookups until the pod was ready, got %d", resolver.calls)
+	}
+
+	resolver = &rolloutResolver{phases: [][]k8s.Pod{{{Name: "web-1", Status: "ImagePullBackOff"}}}}
+	mgr.K8sClient = resolver
+	err := mgr.awaitReadyPod(web, time.Nanosecond)
+	if err == nil || !strings.Contains(err.Error(), "web-1 ImagePullBackOff") {
+		t.Errorf("expected a timeout naming the pod status, got %v", err)
+	}
+}
+
+// TestManager_SelectPodPrefersReady verifies that ready pods are picked over pods listed before them.
+func TestManager_SelectPodPrefersReady(t *testing.T) {
+	mgr := NewManager(context.Background(), nil, nil, nil, genericiooptions.IOStreams{})
+	pods := []k8s.Pod{{Name: "web-old"}, {Name: "web-new", Ready: true}}
+	pod, err := mgr.selectPod(model.Resource{}, pods, "deployment web")
+	if err != nil || pod.Name != "web-new" {
+		t.Errorf("expected the ready pod, got %+v, %v", pod, err)
+	}
+}
+
+// TestManager_SelectPodSkipsUnusable verifies that terminating, evicted and crash-looping pods
+// are skipped with a warning naming them, and that selection only fails without a usable pod.
+func TestManager_SelectPodSkipsUnusable(t *testing.T) {
+	streams, _, _, errOut := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, nil, nil, streams)
+	pods := []k8s.Pod{
+		{Name: "web-old", Status: "Terminating", Ready: true},
+		{Name: "web-crash", Status: "CrashLoopBackOff"},
+		{Name: "web-evicted", Status: "Evicted"},
+		{Name: "web-new", Status: "Running"},
+	}
+
+	pod, err := mgr.selectPod(model.Resource{}, pods, "deployment web")
+	if err != nil || pod.Name != "web-new" {
+		t.Fatalf("expected the only usable pod, got %+v, %v", pod, err)
+	}
+	for _, skipped := range []string{"web-old (Terminating)", "web-crash (CrashLoopBackOff)", "web-evicted (Evicted)"} {
+		if !strings.Contains(errOut.String(), skipped) {
+			t.Errorf("expected a warning naming %s, got %q", skipped, errOut.String())
+		}
+	}
+
+	_, err = mgr.selectPod(model.Resource{}, pods[:3], "deployment web")
+	if !errors.Is(err, ErrNoReadyPods) || !strings.Contains(err.Error(), "web-crash (CrashLoopBackOff)") {
+		t.Errorf("expected no usable pods naming the skipped ones, got %v", err)
+	}
+}
+
+// TestManager_SkipsNonTCPPorts verifies that UDP ports are skipped instead of forwarded, while
+// ports declared over both UDP and TCP are still forwarded.
+func TestManager_SkipsNonTCPPorts(t *testing.T) {
+	resolver := &rolloutResolver{phases: [][]k8s.Pod{{{
+		Name:  "dns-1",
+		Ready: true,
+		Ports: []k8s.PodPort{{ContainerPort: 5353, Protocol: "UDP"}, {ContainerPort: 53, Protocol: "UDP"}, {ContainerPort: 53, Protocol: "TCP"}},
+	}}}}
+	mgr := NewManager(context.Background(), nil, nil, resolver, genericiooptions.IOStreams{})
+	var logs strings.Builder
+	mgr.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	dns := model.Resource{Name: "dns", Namespace: "kube-system", Type: model.DeploymentResource, Ports: []int32{5353}}
+	ids, err := mgr.AddForward(dns, nil)
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("expected the UDP port to be skipped, got %v, %v", ids, err)
+	}
+	if !strings.Contains(logs.String(), "port 5353: it is a UDP port") {
+		t.Errorf("expected a warning about the UDP port, got %q", logs.String())
+	}
+
+	pod := model.Resource{Name: "dns-1", Type: model.PodResource, Ports: []int32{5353}, Protocols: []string{"UDP"}}
+	if ids, err := mgr.AddForward(pod, nil); err != nil || len(ids) != 0 {
+		t.Errorf("expected the UDP pod port to be skipped, got %v, %v", ids, err)
+	}
+
+	dnsPod := k8s.Pod{Ports: resolver.phases[0][0].Ports}
+	if mgr.skipNonTCP(dns, 53, dnsPod.PortProtocol(53)) {
+		t.Error("expected a port served over TCP and UDP not to be skipped")
+	}
+}
+
+// TestManager_ReuseDuplicate verifies that a second forward to the same pod and port reuses the
+// existing one unless it was explicitly asked for on another local port.
+func TestManager_ReuseDuplicate(t *testing.T) {
+	mgr := NewManager(context.Background(), nil, nil, nil, genericiooptions.IOStreams{})
+	var logs strings.Builder
+	mgr.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	web := model.Resource{Name: "web", Namespace: "ns1", Type: model.ServiceResource}
+	mgr.track(ForwardRequest{Resource: web, LocalPort: 8080, RemotePort: 80, PodName: "web-1"}, ForwardQueued)
+
+	deployment := model.Resource{Name: "web", Namespace: "ns1", Type: model.DeploymentResource}
+	if !mgr.reuseDuplicate(deployment, "web-1", 0, 80) || !mgr.reuseDuplicate(deployment, "web-1", 8080, 80) {
+		t.Error("expected the forward of the service to be reused")
+	}
+	if !strings.Contains(logs.String(), "Reusing forward of service/web on localhost:8080") {
+		t.Errorf("expected a message about the reused forward, got %q", logs.String())
+	}
+	if mgr.reuseDuplicate(deployment, "web-1", 9090, 80) {
+		t.Error("expected a forward on another explicit local port not to be reused")
+	}
+	if !strings.Contains(logs.String(), "duplicates service/web on localhost:8080") {
+		t.Errorf("expected a warning about the duplicate, got %q", logs.String())
+	}
+	if mgr.reuseDuplicate(deployment, "web-2", 0, 80) || mgr.reuseDuplicate(deployment, "web-1", 0, 81) {
+		t.Error("expected forwards to another pod or port not to be reused")
+	}
+}
+
+// TestManager_ScaleFromZero verifies that idle workloads are scaled to one replica and back to
+// zero, and that workloads scaled by someone else meanwhile are left alone.
+func TestManager_ScaleFromZero(t *testing.T) {
+	replicas := int32(0)
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		return true, &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: replicas}}, nil
+	})
+	clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+		replicas = scale.Spec.Replicas
+		return true, scale, nil
+	})
+
+	mgr := NewManager(context.Background(), nil, clientset, nil, genericiooptions.IOStreams{})
+	mgr.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	web := model.Resource{Name: "web", Namespace: "apps", Type: model.DeploymentResource}
+
+	if scaled, err := mgr.scaleFromZero(web); err != nil || scaled {
+		t.Fatalf("expected nothing to happen without ScaleFromZero, got %v, %v", scaled, err)
+	}
+	mgr.ScaleFromZero = true
+	if scaled, err := mgr.scaleFromZero(web); err != nil || !scaled || replicas != 1 {
+		t.Fatalf("expected the deployment to be scaled to 1, got %v, %v, %d replicas", scaled, err, replicas)
+	}
+	if scaled, _ := mgr.scaleFromZero(web); scaled {
+		t.Error("expected a running deployment not to be scaled again")
+	}
+
+	mgr.RestoreScale()
+	if replicas != 0 {
+		t.Errorf("expected the deployment to be scaled back to 0, got %d replicas", replicas)
+	}
+
+	mgr.scaleFromZero(web)
+	replicas = 3
+	mgr.RestoreScale()
+	if replicas != 3 {
+		t.Errorf("expected a deployment scaled by someone else to keep its replicas, got %d", replicas)
+	}
+}
+
+// TestManager_ExtraPorts verifies that the ports of a resource are carried to their pod by a
+// single forward, over held listeners and lazily, and are stopped together.
+func TestManager_ExtraPorts(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy=%v", lazy), func(t *testing.T) {
+			resolver := &rolloutResolver{phases: [][]k8s.Pod{{{
+				Name:  "web-1",
+				Ready: true,
+				Ports: []k8s.PodPort{{ContainerPort: 8080}, {ContainerPort: 9090}},
+			}}}}
+			mgr := NewManager(context.Background(), nil, nil, resolver, genericiooptions.IOStreams{})
+			mgr.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			mgr.Dialers = portDialerFactory{}
+			mgr.Lazy = lazy
+			web := model.Resource{Name: "web", Namespace: "apps", Type: model.DeploymentResource, Ports: []int32{8080, 9090}}
+
+			ids, err := mgr.AddForward(web, map[int]int32{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(ids) != 2 {
+				t.Fatalf("expected a forward ID per port, got %v", ids)
+			}
+			mgr.mutex.Lock()
+			shared := mgr.forwards[ids[0]] == mgr.forwards[ids[1]]
+			running := mgr.running
+			mgr.mutex.Unlock()
+			if !shared || running != 1 {
+				t.Errorf("expected both ports on one running forward, got shared=%v and %d running", shared, running)
+			}
+
+			var statuses []ForwardStatus
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				statuses = mgr.GetStatus()
+				if len(statuses) == 2 && statuses[0].State == ForwardActive && statuses[1].State == ForwardActive {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("forwards did not become active: %+v", statuses)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			for _, status := range statuses {
+				if status.PodName != "web-1" {
+					t.Errorf("expected %s via pod web-1, got %s", status.ID, status.PodName)
+				}
+				expectRemotePort(t, status.LocalPort, status.RemotePort)
+			}
+
+			// Stopping either port stops the forward carrying both
+			if err := mgr.StopForward(ids[1]); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if remaining := mgr.GetStatus(); len(remaining) != 0 {
+				t.Errorf("expected no forwards after stopping, got %+v", remaining)
+			}
+			for _, status := range statuses {
+				if mgr.PortAllocator.IsAllocated(status.LocalPort) {
+					t.Errorf("expected local port %d to be released", status.LocalPort)
+				}
+			}
+		})
+	}
+}
+
+// TestManager_WaitForCompletionTimeout verifies that waiting ends once the forwards complete,
+// or after the timeout while one is stuck.
+func TestManager_WaitForCompletionTimeout(t *testing.T) {
+	mgr := NewManager(context.Background(), nil, nil, nil, genericiooptions.IOStreams{})
+	if !mgr.WaitForCompletionTimeout(time.Second) {
+		t.Error("expected waiting without forwards to complete")
+	}
+
+	mgr.ForwardWait.Add(1)
+	if mgr.WaitForCompletionTimeout(10 * time.Millisecond) {
+		t.Error("expected waiting for a stuck forward to time out")
+	}
+	mgr.ForwardWait.Done()
+}
+
+// TestManager_ExtraPortSchemes verifies that each port carried by a forward keeps its own
+// scheme, https for 443 and none for 80, in the statuses and in the ready message.
+func TestManager_ExtraPortSchemes(t *testing.T) {
+	mgr := NewManager(context.Background(), nil, nil, nil, genericiooptions.IOStreams{})
+	mgr.Dialers = portDialerFactory{}
+	web := model.Resource{Name: "web-1", Namespace: "apps", Type: model.PodResource, Ports: []int32{443, 80}}
+
+	req := mgr.newForwardRequest(web, 0, 8443, 443, "")
+	req = mgr.withExtraPorts(req, []plannedPort{{portTarget: portTarget{index: 1, remotePort: 80}, localPort: 8080}})
+
+	mgr.mutex.Lock()
+	statuses := mgr.track(req, ForwardQueued).statuses()
+	mgr.mutex.Unlock()
+	if len(statuses) != 2 || statuses[0].Scheme != "https" || statuses[1].Scheme != "" {
+		t.Errorf("expected an https and a plain status, got %+v", statuses)
+	}
+
+	pf := newListenerForwarder(req)
+	want := "Forwarding pod/web-1 (target port 443) -> https://localhost:8443, (target port 80) -> localhost:8080"
+	if got := pf.GetPortForwardString(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
 }
@@ -0,0 +1,110 @@
+package portforward
+
+import (
+	"fmt"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// podFilter restricts the pods a service or workload is forwarded to by node, topology zone
+// and labels; the zero filter lets every pod through
+type podFilter struct {
+	node     string
+	zone     string
+	selector labels.Selector
+}
+
+// podFilterFor returns the filter of resource: its own pod selector, node and zone, each
+// falling back to the one of the session
+func (m *Manager) podFilterFor(resource model.Resource) (podFilter, error) {
+	filter := podFilter{node: resource.Node, zone: resource.Zone}
+	if filter.node == "" {
+		filter.node = m.Node
+	}
+	if filter.zone == "" {
+		filter.zone = m.Zone
+	}
+	selector := resource.PodSelector
+	if selector == "" {
+		selector = m.PodSelector
+	}
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return podFilter{}, fmt.Errorf("invalid pod selector %q: %w", selector, err)
+		}
+		filter.selector = parsed
+	}
+	return filter, nil
+}
+
+// String describes what the filter requires of a pod, e.g. "runs in zone eu-west-1a and
+// matches track=canary"
+func (f podFilter) String() string {
+	var parts []string
+	if f.node != "" {
+		parts = append(parts, "runs on node "+f.node)
+	}
+	if f.zone != "" {
+		parts = append(parts, "runs in zone "+f.zone)
+	}
+	if f.selector != nil {
+		parts = append(parts, "matches "+f.selector.String())
+	}
+	return strings.Join(parts, " and ")
+}
+
+// filterPods returns the pods of resource passing filter. The zones of their nodes are looked
+// up only when the filter has a zone.
+func (m *Manager) filterPods(resource model.Resource, filter podFilter, pods []k8s.Pod) ([]k8s.Pod, error) {
+	if filter.node == "" && filter.zone == "" && filter.selector == nil {
+		return pods, nil
+	}
+	var matching []k8s.Pod
+	for _, pod := range pods {
+		if filter.node != "" && pod.Node != filter.node {
+			continue
+		}
+		if filter.selector != nil && !filter.selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if filter.zone != "" {
+			// Pending pods have no node and so no zone yet
+			if pod.Node == "" {
+				continue
+			}
+			zone, err := m.nodeZone(resource, pod.Node)
+			if err != nil {
+				return nil, err
+			}
+			if zone != filter.zone {
+				continue
+			}
+		}
+		matching = append(matching, pod)
+	}
+	return matching, nil
+}
+
+// nodeZone returns the topology zone of a node in the cluster of resource, remembering it for
+// the rest of the session
+func (m *Manager) nodeZone(resource model.Resource, node string) (string, error) {
+	key := resource.ClusterKey() + "|" + node
+	if zone, ok := m.nodeZones.Load(key); ok {
+		return zone.(string), nil
+	}
+	resolver, ok := m.clusterFor(resource).K8sClient.(ZoneResolver)
+	if !ok {
+		return "", fmt.Errorf("cannot look up the zone of node %s to restrict pods to a zone", node)
+	}
+	zone, err := resolver.NodeZone(m.Context, node)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the zone of node %s: %w", node, err)
+	}
+	m.nodeZones.Store(key, zone)
+	return zone, nil
+}
@@ -0,0 +1,94 @@
+package portforward
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+// zoneResolver knows the zones of nodes and counts the lookups
+type zoneResolver struct {
+	PodResolver
+	zones   map[string]string
+	lookups int
+}
+
+func (r *zoneResolver) NodeZone(_ context.Context, node string) (string, error) {
+	r.lookups++
+	return r.zones[node], nil
+}
+
+// TestManager_SelectPodFiltered verifies that the pod selector, node and zone of a resource
+// restrict the pods forwarded to, override those of the session, and that node zones are only
+// looked up once.
+func TestManager_SelectPodFiltered(t *testing.T) {
+	resolver := &zoneResolver{zones: map[string]string{"node-a": "eu-west-1a", "node-b": "eu-west-1b"}}
+	mgr := NewManager(context.Background(), nil, nil, resolver, genericiooptions.IOStreams{})
+	pods := []k8s.Pod{
+		{Name: "web-a", Node: "node-a", Labels: map[string]string{"app": "web", "track": "stable"}},
+		{Name: "web-b", Node: "node-b", Labels: map[string]string{"app": "web", "track": "canary"}},
+		{Name: "web-pending", Labels: map[string]string{"app": "web", "track": "canary"}},
+	}
+
+	tests := []struct {
+		name     string
+		resource model.Resource
+		want     string
+	}{
+		{name: "selector", resource: model.Resource{PodSelector: "track=canary", Zone: "eu-west-1b"}, want: "web-b"},
+		{name: "zone", resource: model.Resource{Zone: "eu-west-1b"}, want: "web-b"},
+		{name: "node", resource: model.Resource{Node: "node-a"}, want: "web-a"},
+		{name: "session zone", resource: model.Resource{}, want: "web-a"},
+	}
+	mgr.Zone = "eu-west-1a"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod, err := mgr.selectPod(tt.resource, pods, "deployment web")
+			if err != nil || pod.Name != tt.want {
+				t.Errorf("expected %s, got %+v, %v", tt.want, pod, err)
+			}
+		})
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("expected one zone lookup per node, got %d", resolver.lookups)
+	}
+
+	_, err := mgr.selectPod(model.Resource{PodSelector: "track=canary"}, pods, "deployment web")
+	if err == nil || !strings.Contains(err.Error(), "runs in zone eu-west-1a and matches track=canary") {
+		t.Errorf("expected an error naming the filter, got %v", err)
+	}
+	if _, err := mgr.selectPod(model.Resource{PodSelector: "track in ("}, pods, "deployment web"); err == nil {
+		t.Error("expected an error for an invalid pod selector")
+	}
+}
+
+// TestManager_SwitchCandidates verifies that forwards only switch to pods selectPod could pick:
+// pods passing the pod filter that are not crash-looping
+func TestManager_SwitchCandidates(t *testing.T) {
+	mgr := NewManager(context.Background(), nil, nil, nil, genericiooptions.IOStreams{})
+	mgr.PodSelector = "track=stable"
+	pods := []k8s.Pod{
+		{Name: "web-0", Ready: true, Labels: map[string]string{"track": "stable"}},
+		{Name: "web-1", Ready: true, Labels: map[string]string{"track": "canary"}},
+		{Name: "web-2", Ready: true, Status: "CrashLoopBackOff", Labels: map[string]string{"track": "stable"}},
+		{Name: "web-3", Ready: true, Labels: map[string]string{"track": "stable"}},
+	}
+
+	candidates, err := mgr.switchCandidates(model.Resource{}, pods)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod, err := nextPod(candidates, "web-0", ""); err != nil || pod != "web-3" {
+		t.Errorf("expected web-3, got %s, %v", pod, err)
+	}
+	for _, name := range []string{"web-1", "web-2"} {
+		if _, err := nextPod(candidates, "web-0", name); err == nil {
+			t.Errorf("expected an error switching to %s", name)
+		}
+	}
+}
@@ -2,22 +2,35 @@ package portforward
 
 import (
 	"fmt"
+	"hash/fnv"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
 )
 
 // PortAllocator manages port allocation for port forwarding
 type PortAllocator struct {
 	// Track ports that have been allocated by this tool
 	allocatedPorts map[int32]bool
+	// Listeners kept bound for reserved ports until a forwarder takes them over
+	heldListeners map[int32][]net.Listener
 	// Protect the allocatedPorts map from concurrent access
 	mu sync.Mutex
+	// Optional range for ephemeral allocations; both zero means use OS-assigned ports
+	rangeMin int32
+	rangeMax int32
+	// Addresses reserved ports listen on in addition to the loopback addresses
+	extraAddresses []string
 }
 
 // NewPortAllocator creates a new port allocator
 func NewPortAllocator() *PortAllocator {
 	return &PortAllocator{
 		allocatedPorts: make(map[int32]bool),
+		heldListeners:  make(map[int32][]net.Listener),
 	}
 }
 
@@ -42,36 +55,216 @@ func (pa *PortAllocator) AllocatePort(requestedPort int32) (int32, error) {
 	return port, nil
 }
 
-// ReleasePort releases a previously allocated port
+// ReleasePort releases a previously allocated port, closing its listeners if no forwarder took them
 func (pa *PortAllocator) ReleasePort(port int32) {
 	pa.mu.Lock()
 	defer pa.mu.Unlock()
 
+	closeListeners(pa.heldListeners[port])
+	delete(pa.heldListeners, port)
 	delete(pa.allocatedPorts, port)
 }
 
-// findAvailableEphemeralPort finds an available ephemeral port by binding to port 0
-func (pa *PortAllocator) findAvailableEphemeralPort() (int32, error) {
-	// Bind to port 0 to get an available port from the OS
-	listener, err := net.Listen("tcp", ":0")
+// IsAllocated reports whether port is currently allocated by this allocator
+func (pa *PortAllocator) IsAllocated(port int32) bool {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	return pa.allocatedPorts[port]
+}
+
+// TakeListeners hands over the listeners bound while reserving port. The caller becomes
+// responsible for closing them; the port itself stays allocated until ReleasePort.
+func (pa *PortAllocator) TakeListeners(port int32) []net.Listener {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	listeners := pa.heldListeners[port]
+	delete(pa.heldListeners, port)
+	return listeners
+}
+
+// SetRange restricts ephemeral allocations to ports between min and max (inclusive)
+func (pa *PortAllocator) SetRange(min, max int32) error {
+	if min < 1 || max > 65535 || min > max {
+		return fmt.Errorf("invalid port range %d-%d", min, max)
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	pa.rangeMin = min
+	pa.rangeMax = max
+	return nil
+}
+
+// AddListenAddress makes ports reserved from now on also listen on addr, e.g. the Docker bridge
+// gateway so containers can reach the forwards. A port counts as available only if it can be
+// bound on every address.
+func (pa *PortAllocator) AddListenAddress(addr string) error {
+	if net.ParseIP(addr) == nil {
+		return fmt.Errorf("invalid listen address '%s'", addr)
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	pa.extraAddresses = append(pa.extraAddresses, addr)
+	return nil
+}
+
+// listenExtra binds port on the additional listen addresses, closing what it bound on failure
+func listenExtra(port int32, addresses []string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addresses {
+		l, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(int(port))))
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("unable to listen on %s:%d: %w", addr, port, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// ParsePortRange parses a range in the form "20000-21000"
+func ParsePortRange(value string) (int32, int32, error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port range '%s', expected format min-max", value)
+	}
+
+	min, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range '%s': %w", value, err)
+	}
+	max, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 32)
 	if err != nil {
-		return 0, fmt.Errorf("failed to bind to ephemeral port: %w", err)
+		return 0, 0, fmt.Errorf("invalid port range '%s': %w", value, err)
+	}
+	if min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid port range '%s', ports must satisfy 1 <= min <= max <= 65535", value)
 	}
 
-	// Get the actual port number
-	port := int32(listener.Addr().(*net.TCPAddr).Port)
+	return int32(min), int32(max), nil
+}
 
-	// Close the listener to release the port for use by port-forward
-	listener.Close()
+// ephemeralAttempts bounds how often an OS-assigned port is tried when it is taken on one of
+// the additional listen addresses
+const ephemeralAttempts = 10
 
-	// Mark the port as allocated
+// findAvailableEphemeralPort finds an available ephemeral port, either from the configured
+// range or by binding to port 0
+func (pa *PortAllocator) findAvailableEphemeralPort() (int32, error) {
+	pa.mu.Lock()
+	rangeMin, rangeMax := pa.rangeMin, pa.rangeMax
+	extraAddresses := pa.extraAddresses
+	pa.mu.Unlock()
+
+	if rangeMin > 0 {
+		return pa.findAvailablePortInRange(rangeMin, rangeMax)
+	}
+
+	var port int32
+	var listeners []net.Listener
+	for attempt := 0; ; attempt++ {
+		// Bind to port 0 to get an available port from the OS
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, fmt.Errorf("failed to bind to ephemeral port: %w", err)
+		}
+
+		// Get the actual port number
+		port = int32(listener.Addr().(*net.TCPAddr).Port)
+		listeners = []net.Listener{listener}
+
+		// Also hold the IPv6 loopback when possible, like the forwarder would
+		if l6, err := net.Listen("tcp", net.JoinHostPort("::1", strconv.Itoa(int(port)))); err == nil {
+			listeners = append(listeners, l6)
+		}
+
+		// The port the OS picked on the loopback may be taken on the other addresses
+		extra, err := listenExtra(port, extraAddresses)
+		if err == nil {
+			listeners = append(listeners, extra...)
+			break
+		}
+		closeListeners(listeners)
+		if attempt == ephemeralAttempts-1 {
+			return 0, err
+		}
+	}
+
+	// Keep the listeners open so nothing else can grab the port before the forward starts
 	pa.mu.Lock()
 	defer pa.mu.Unlock()
 	pa.allocatedPorts[port] = true
+	pa.heldListeners[port] = listeners
 
 	return port, nil
 }
 
+// DefaultStablePortMin and DefaultStablePortMax bound stable port assignment when no range is configured
+const (
+	DefaultStablePortMin int32 = 20000
+	DefaultStablePortMax int32 = 29999
+)
+
+// StableKey builds the identity hashed by stable port assignment
+func StableKey(namespace string, resourceType model.ResourceType, name string, remotePort int32) string {
+	return fmt.Sprintf("%s/%s/%s/%d", namespace, resourceType, name, remotePort)
+}
+
+// AssignmentKey identifies a resource port in remembered local ports. Unlike StableKey it
+// includes the kubeconfig context, if any, so clusters sharing namespaces don't collide.
+func AssignmentKey(contextName, namespace string, resourceType model.ResourceType, name string, remotePort int32) string {
+	key := StableKey(namespace, resourceType, name, remotePort)
+	if contextName != "" {
+		key = contextName + "/" + key
+	}
+	return key
+}
+
+// StablePort returns a deterministic local port for key. The key is hashed into the configured
+// range (or the default stable range) and the next free port is chosen on collision. The port
+// is not reserved.
+func (pa *PortAllocator) StablePort(key string) int32 {
+	pa.mu.Lock()
+	min, max := pa.rangeMin, pa.rangeMax
+	pa.mu.Unlock()
+	if min == 0 {
+		min, max = DefaultStablePortMin, DefaultStablePortMax
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	size := uint32(max - min + 1)
+	start := h.Sum32() % size
+
+	for i := uint32(0); i < size; i++ {
+		port := min + int32((start+i)%size)
+		pa.mu.Lock()
+		allocated := pa.allocatedPorts[port]
+		pa.mu.Unlock()
+		if !allocated && IsPortAvailable(port) {
+			return port
+		}
+	}
+
+	// Everything is taken; return the hashed port and let allocation report the conflict
+	return min + int32(start)
+}
+
+// findAvailablePortInRange reserves the lowest free port in the range, so allocations are
+// predictable across runs
+func (pa *PortAllocator) findAvailablePortInRange(min, max int32) (int32, error) {
+	for port := min; port <= max; port++ {
+		if err := pa.reserveSpecificPort(port); err == nil {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no available port in range %d-%d", min, max)
+}
+
 // reserveSpecificPort checks if a specific port is available and reserves it
 func (pa *PortAllocator) reserveSpecificPort(port int32) error {
 	pa.mu.Lock()
@@ -82,17 +275,21 @@ func (pa *PortAllocator) reserveSpecificPort(port int32) error {
 		return fmt.Errorf("port %d is already allocated", port)
 	}
 
-	// Try to bind to the port to check availability
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	// Bind the port to check availability, keeping it bound for the forwarder
+	listeners, err := listenLocal(port)
 	if err != nil {
 		return fmt.Errorf("port %d is not available: %w", port, err)
 	}
-
-	// Close the listener to release the port for use by port-forward
-	listener.Close()
+	extra, err := listenExtra(port, pa.extraAddresses)
+	if err != nil {
+		closeListeners(listeners)
+		return fmt.Errorf("port %d is not available: %w", port, err)
+	}
+	listeners = append(listeners, extra...)
 
 	// Mark the port as allocated
 	pa.allocatedPorts[port] = true
+	pa.heldListeners[port] = listeners
 
 	return nil
 }
@@ -106,3 +303,10 @@ func IsPortAvailable(port int32) bool {
 	listener.Close()
 	return true
 }
+
+// closeListeners closes every listener in the list
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
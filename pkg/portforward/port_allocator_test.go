@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net"
 	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
 )
 
 // TestNewPortAllocator verifies that a new PortAllocator is initialized correctly.
@@ -91,3 +93,124 @@ func TestIsPortAvailable(t *testing.T) {
 func listenOnPort(port int32) (interface{ Close() error }, error) {
 	return net.Listen("tcp", fmt.Sprintf(":%d", port))
 }
+
+// TestParsePortRange verifies parsing of valid and invalid port ranges.
+func TestParsePortRange(t *testing.T) {
+	min, max, err := ParsePortRange("20000-21000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if min != 20000 || max != 21000 {
+		t.Errorf("expected 20000-21000, got %d-%d", min, max)
+	}
+
+	for _, value := range []string{"", "20000", "a-b", "21000-20000", "0-10", "1-70000"} {
+		if _, _, err := ParsePortRange(value); err == nil {
+			t.Errorf("expected error for range %q", value)
+		}
+	}
+}
+
+// TestAllocatePort_InRange verifies that ephemeral ports come from the configured range.
+func TestAllocatePort_InRange(t *testing.T) {
+	pa := NewPortAllocator()
+	if err := pa.SetRange(31000, 31100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Skipf("no available port in test range: %v", err)
+	}
+	if first < 31000 || first > 31100 {
+		t.Errorf("expected port in range, got %d", first)
+	}
+
+	second, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second == first {
+		t.Error("expected a different port for the second allocation")
+	}
+	pa.ReleasePort(first)
+	pa.ReleasePort(second)
+}
+
+// TestStablePort verifies that stable ports are deterministic and stay inside the range.
+func TestStablePort(t *testing.T) {
+	pa := NewPortAllocator()
+	if err := pa.SetRange(32000, 32999); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key := StableKey("ns1", model.ServiceResource, "svc1", 80)
+	first := pa.StablePort(key)
+	if first < 32000 || first > 32999 {
+		t.Errorf("expected port in range, got %d", first)
+	}
+	if second := pa.StablePort(key); second != first {
+		t.Errorf("expected the same port for the same key, got %d and %d", first, second)
+	}
+
+	// A reserved port must be skipped
+	pa.allocatedPorts[first] = true
+	if next := pa.StablePort(key); next == first {
+		t.Error("expected a different port once the stable port is allocated")
+	}
+}
+
+// TestAllocatePort_HoldsListener verifies that a reserved port stays bound until it is released.
+func TestAllocatePort_HoldsListener(t *testing.T) {
+	pa := NewPortAllocator()
+	port, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if IsPortAvailable(port) {
+		t.Error("expected allocated port to be held")
+	}
+
+	pa.ReleasePort(port)
+	if !IsPortAvailable(port) {
+		t.Error("expected port to be free after release")
+	}
+}
+
+// TestAllocatePort_ExtraListenAddress verifies that reserved ports are also bound on added
+// listen addresses and that ports taken there are not reserved.
+func TestAllocatePort_ExtraListenAddress(t *testing.T) {
+	// Another loopback address stands in for the Docker bridge gateway
+	probe, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	probe.Close()
+
+	pa := NewPortAllocator()
+	if err := pa.AddListenAddress("127.0.0.2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	port, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pa.ReleasePort(port)
+	if l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.2:%d", port)); err == nil {
+		l.Close()
+		t.Errorf("expected port %d to be held on 127.0.0.2", port)
+	}
+
+	taken, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	if _, err := pa.AllocatePort(int32(taken.Addr().(*net.TCPAddr).Port)); err == nil {
+		t.Error("expected a port taken on 127.0.0.2 to be unavailable")
+	}
+
+	if err := pa.AddListenAddress("docker0"); err == nil {
+		t.Error("expected an error for an address that is not an IP")
+	}
+}
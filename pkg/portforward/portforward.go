@@ -3,18 +3,18 @@ package portforward
 import (
 	"context"
 	"fmt"
-	"net/http"
-	"net/url"
-	"strings"
+	"log/slog"
+	"net"
+	"sync"
 	"time"
 
-	"roeyazroel/kubectl-pfw/pkg/ui"
+	"roeyazroel/kubectl-pfw/pkg/model"
 
-	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
 )
 
 // MaxRetries is the maximum number of reconnection attempts
@@ -28,68 +28,319 @@ const (
 
 // PortForwarder represents a port forwarding connection
 type PortForwarder struct {
-	Resource     ui.Resource
+	Resource     model.Resource
 	LocalPort    int32
 	RemotePort   int32
 	StopChannel  chan struct{}
 	ReadyChannel chan struct{}
+	// ForwardFn is client-go's forwarder of the current attempt; read it with Forwarder
 	ForwardFn    *portforward.PortForwarder
 	ErrorChannel chan error
 	// Auto-retry settings
-	AutoRetry     bool
+	AutoRetry bool
+	// RetryAttempts counts the attempts after the first; read it with Attempts
 	RetryAttempts int
+	// KeepaliveInterval is how often the tunnel is exercised while idle (0 disables it)
+	KeepaliveInterval time.Duration
+	// PodName is the pod carrying the tunnel; read and change it with Pod and SetPod
+	PodName string
+	// Scheme is the URL scheme of the remote port, e.g. https, or empty if unknown
+	Scheme string
+	// ExtraPorts are the further ports of the pod carried by the same tunnel
+	ExtraPorts []PortPair
+
+	// tunnel is set for forwards that serve their own listeners, which can switch pods
+	tunnel *tunnel
+	// retryStats counts the reconnection attempts; read it with RetryStats
+	retryStats RetryStats
+	// connectedSince is when the tunnel was last (re)established; read it with ConnectedSince
+	connectedSince time.Time
+	// status delivers the tunnel's state changes; read it with Status
+	status *statusStream
+	// onPodChange, when set, is called with the new pod each time the tunnel changes pods
+	onPodChange func(pod string)
+	// state holds the forwarder's locks, shared by copies
+	state *forwarderState
+}
+
+// PortPair is a local port forwarded to a remote port
+type PortPair struct {
+	LocalPort  int32
+	RemotePort int32
+	// Scheme is the URL scheme of the remote port, e.g. https, or empty if unknown
+	Scheme string
+}
+
+// String formats the pair like kubectl port-forward, as local:remote
+func (p PortPair) String() string {
+	return fmt.Sprintf("%d:%d", p.LocalPort, p.RemotePort)
+}
+
+// Ports returns every local:remote pair carried by the forwarder, LocalPort first
+func (pf *PortForwarder) Ports() []PortPair {
+	return append([]PortPair{{LocalPort: pf.LocalPort, RemotePort: pf.RemotePort, Scheme: pf.Scheme}}, pf.ExtraPorts...)
+}
+
+// RetryStats counts the reconnection attempts of a forward, so flapping forwards stand out
+type RetryStats struct {
+	// Retries is the number of reconnection attempts so far
+	Retries int
+	// LastError is the error that caused the most recent attempt, at LastErrorTime
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// forwarderState holds the locks of a forwarder. Forwarders refer to it by pointer, so copies of
+// a PortForwarder share its locks while unrelated forwarders never wait on each other.
+type forwarderState struct {
+	// stop serializes closing of StopChannel, which is closed both by Stop and by the failing
+	// forwarder, and of ReadyChannel, which every successful attempt may close
+	stop sync.Mutex
+	// pod guards PodName, which changes when the forward moves to another pod
+	pod sync.Mutex
+	// stats guards the retry statistics and connectedSince
+	stats sync.Mutex
+	// attempt guards ForwardFn and RetryAttempts, which the forwarder goroutine updates on
+	// every connection attempt
+	attempt sync.Mutex
+}
+
+// unownedState serves the forwarders not created by StartPortForward, which have no state
+var unownedState forwarderState
+
+// locks returns the forwarder's state
+func (pf *PortForwarder) locks() *forwarderState {
+	if pf.state == nil {
+		return &unownedState
+	}
+	return pf.state
+}
+
+// Pod returns the name of the pod currently carrying the tunnel
+func (pf *PortForwarder) Pod() string {
+	pf.locks().pod.Lock()
+	defer pf.locks().pod.Unlock()
+	return pf.PodName
+}
+
+// Forwarder returns client-go's forwarder of the current attempt, or nil before the first one
+func (pf *PortForwarder) Forwarder() *portforward.PortForwarder {
+	pf.locks().attempt.Lock()
+	defer pf.locks().attempt.Unlock()
+	return pf.ForwardFn
+}
+
+// Attempts returns the number of connection attempts after the first so far
+func (pf *PortForwarder) Attempts() int {
+	pf.locks().attempt.Lock()
+	defer pf.locks().attempt.Unlock()
+	return pf.RetryAttempts
+}
+
+// setForwardFn records client-go's forwarder of the current attempt
+func (pf *PortForwarder) setForwardFn(fn *portforward.PortForwarder) {
+	pf.locks().attempt.Lock()
+	defer pf.locks().attempt.Unlock()
+	pf.ForwardFn = fn
+}
+
+// setAttempts records the number of connection attempts after the first
+func (pf *PortForwarder) setAttempts(attempts int) {
+	pf.locks().attempt.Lock()
+	defer pf.locks().attempt.Unlock()
+	pf.RetryAttempts = attempts
+}
+
+// RetryStats returns the reconnection attempts of the forward so far
+func (pf *PortForwarder) RetryStats() RetryStats {
+	pf.locks().stats.Lock()
+	defer pf.locks().stats.Unlock()
+	return pf.retryStats
+}
+
+// recordRetry counts a reconnection attempt caused by err
+func (pf *PortForwarder) recordRetry(err error) {
+	pf.locks().stats.Lock()
+	defer pf.locks().stats.Unlock()
+	pf.retryStats.Retries++
+	pf.retryStats.LastError = err.Error()
+	pf.retryStats.LastErrorTime = time.Now()
+}
+
+// ConnectedSince returns when the tunnel was last (re)established, or the zero time before
+func (pf *PortForwarder) ConnectedSince() time.Time {
+	pf.locks().stats.Lock()
+	defer pf.locks().stats.Unlock()
+	return pf.connectedSince
+}
+
+// markConnected records that the tunnel was (re)established now and reports reconnections
+// to the request's onReconnect hook
+func (pf *PortForwarder) markConnected(req ForwardRequest) {
+	pf.locks().stats.Lock()
+	reconnected := !pf.connectedSince.IsZero()
+	pf.connectedSince = time.Now()
+	pf.locks().stats.Unlock()
+
+	if reconnected && req.onReconnect != nil {
+		req.onReconnect()
+	}
+}
+
+// SetPod records that the tunnel is now carried by pod name
+func (pf *PortForwarder) SetPod(name string) {
+	pf.locks().pod.Lock()
+	pf.PodName = name
+	pf.locks().pod.Unlock()
+
+	if pf.onPodChange != nil {
+		pf.onPodChange(name)
+	}
+}
+
+// SwitchPod moves the forward to pod name, reached through dialer. New connections go to the
+// new pod; connections carried by the old one are closed.
+func (pf *PortForwarder) SwitchPod(name string, dialer httpstream.Dialer) error {
+	if pf.tunnel == nil {
+		return fmt.Errorf("forward of %s/%s port %d cannot switch pods", pf.Resource.Type, pf.Resource.Name, pf.RemotePort)
+	}
+	pf.tunnel.switchDialer(dialer)
+	pf.SetPod(name)
+	return nil
 }
 
 // ForwardRequest contains the information needed to start port forwarding
 type ForwardRequest struct {
 	RestConfig *rest.Config
-	ClientSet  *kubernetes.Clientset
-	Resource   ui.Resource
+	ClientSet  kubernetes.Interface
+	Resource   model.Resource
 	LocalPort  int32
 	RemotePort int32 // For Pods: the container port; For Services/Deployments/StatefulSets: the target port
-	Streams    genericclioptions.IOStreams
+	Streams    genericiooptions.IOStreams
 	Context    context.Context
 	// If not pod type, we need to port-forward to a specific pod
 	PodName string
+	// Scheme is the URL scheme of the remote port, e.g. https, or empty if unknown
+	Scheme string
 	// Auto-retry settings
 	AutoRetry bool
+	// KeepaliveInterval enables periodic keepalive probes through the tunnel when > 0
+	KeepaliveInterval time.Duration
+	// Lazy binds the local port immediately but dials the pod on the first connection
+	Lazy bool
+	// IdleTimeout closes a lazy tunnel after this long without connections
+	IdleTimeout time.Duration
+	// Dialers creates the connection to the pod; nil uses SPDY with RestConfig
+	Dialers DialerFactory
+	// Logger receives the forward's operational messages; nil prints them to Streams
+	Logger *slog.Logger
+	// Events receives the forward's retry events; nil discards them
+	Events *EventWriter
+	// Audit receives an event for every local connection opened and closed; nil disables them
+	Audit *slog.Logger
+	// onRetry, when set, is called with the error of each reconnection attempt
+	onRetry func(err error)
+	// onReconnect, when set, is called each time the tunnel is re-established
+	onReconnect func()
+	// onPodChange, when set, is called with the new pod each time the tunnel changes pods
+	onPodChange func(pod string)
+	// ExtraPorts are further ports of the same pod forwarded over the same connection and
+	// retried together with LocalPort, instead of starting one forwarder per port
+	ExtraPorts []PortPair
+	// Listeners already bound to LocalPort; when set they are served directly instead of
+	// letting client-go bind the port again
+	Listeners []net.Listener
+	// ExtraListeners are the listeners already bound to the local ports of ExtraPorts, by
+	// index. Ports of forwards serving their own listeners that have none are bound on start.
+	ExtraListeners [][]net.Listener
 	// TargetPort field removed - not needed as K8s handles service->pod target port resolution.
 }
 
-// StartPortForward starts a port forward connection for a service or pod
+// targetPod returns the pod the request forwards to: PodName, or the resource itself for pods
+func (req ForwardRequest) targetPod() string {
+	if req.Resource.Type == model.PodResource {
+		return req.Resource.Name
+	}
+	return req.PodName
+}
+
+// holdsListeners reports whether listeners are already bound to any port of the request
+func (req ForwardRequest) holdsListeners() bool {
+	if len(req.Listeners) > 0 {
+		return true
+	}
+	for _, listeners := range req.ExtraListeners {
+		if len(listeners) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// closeAllListeners closes the listeners held for every port of the request
+func (req ForwardRequest) closeAllListeners() {
+	closeListeners(req.Listeners)
+	for _, listeners := range req.ExtraListeners {
+		closeListeners(listeners)
+	}
+}
+
+// ports returns every local:remote pair of the request, LocalPort first
+func (req ForwardRequest) ports() []PortPair {
+	return append([]PortPair{{LocalPort: req.LocalPort, RemotePort: req.RemotePort, Scheme: req.Scheme}}, req.ExtraPorts...)
+}
+
+// StartPortForward starts a port forward connection for a service or pod. Further ports of the
+// same pod given as ExtraPorts share its connection, retries and lifetime.
 func StartPortForward(req ForwardRequest) (*PortForwarder, error) {
-	var path string
+	var podName string
 	var remotePort int32
 
-	// Determine the path and remote port based on resource type
+	// Determine the pod and remote port based on resource type
 	switch req.Resource.Type {
-	case ui.ServiceResource, ui.DeploymentResource, ui.StatefulSetResource:
-		// For services, deployments, and statefulsets, we need to port-forward to a pod
+	case model.ServiceResource, model.DeploymentResource, model.StatefulSetResource, model.CustomResource:
+		// For services, deployments, statefulsets and custom resources, we need to port-forward to a pod
 		if req.PodName == "" {
 			return nil, fmt.Errorf("pod name is required for %s port forwarding", req.Resource.Type)
 		}
-		path = fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", req.Resource.Namespace, req.PodName)
+		podName = req.PodName
 		// Use the service/deployment/statefulset port. Kubernetes port-forward handles TargetPort resolution.
 		remotePort = req.RemotePort
-	case ui.PodResource:
-		path = fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", req.Resource.Namespace, req.Resource.Name)
+	case model.PodResource:
+		podName = req.Resource.Name
 		remotePort = req.RemotePort
 	default:
 		return nil, fmt.Errorf("unsupported resource type: %s", req.Resource.Type)
 	}
 
-	hostIP := strings.TrimPrefix(req.RestConfig.Host, "https://")
+	// All messages of the forward share one console logger, whose lock serializes them
+	if req.Logger == nil {
+		req.Logger = newConsoleLogger(req.Streams)
+	}
 
-	transport, upgrader, err := spdy.RoundTripperFor(req.RestConfig)
+	dialers := req.Dialers
+	if dialers == nil {
+		dialers = NewSPDYDialerFactory(req.RestConfig)
+	}
+	dialer, err := dialers.DialerFor(req.Resource.Namespace, podName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create round tripper: %w", err)
+		return nil, err
 	}
 
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, &url.URL{
-		Scheme: "https",
-		Path:   path,
-		Host:   hostIP,
-	})
+	// In lazy mode the tunnel is only dialed once a client connects
+	if req.Lazy {
+		return startLazyPortForward(req, dialer)
+	}
+
+	// Serve listeners reserved by the PortAllocator so the port is never released in between
+	if req.holdsListeners() {
+		forwarder, err := startHeldPortForward(req, dialer)
+		if err != nil {
+			return nil, err
+		}
+		forwarder.startKeepalive()
+		return forwarder, nil
+	}
 
 	stopChannel := make(chan struct{}, 1)
 	readyChannel := make(chan struct{}, 1)
@@ -97,7 +348,11 @@ func StartPortForward(req ForwardRequest) (*PortForwarder, error) {
 
 	// Format as localPort:remotePort
 	// The remotePort is now correctly set to the service port for services, or pod port for pods.
-	ports := []string{fmt.Sprintf("%d:%d", req.LocalPort, remotePort)}
+	// All ports share the forwarder, and with it the connection and the retry loop.
+	ports := []string{PortPair{LocalPort: req.LocalPort, RemotePort: remotePort}.String()}
+	for _, extra := range req.ExtraPorts {
+		ports = append(ports, extra.String())
+	}
 
 	// Default to global setting if not specified in request
 	autoRetry := AutoRetryEnable
@@ -115,24 +370,23 @@ func StartPortForward(req ForwardRequest) (*PortForwarder, error) {
 		ErrorChannel:  errorChannel,
 		AutoRetry:     autoRetry,
 		RetryAttempts: 0,
+		// Keepalive is opt-in to avoid generating extra connections against the pod
+		KeepaliveInterval: req.KeepaliveInterval,
+		PodName:           podName,
+		Scheme:            req.Scheme,
+		ExtraPorts:        req.ExtraPorts,
+		status:            newStatusStream(),
+		onPodChange:       req.onPodChange,
+		state:             &forwarderState{},
 	}
 
+	forwarder.startKeepalive()
+
 	// Start port forwarding in a goroutine
 	go func() {
 		var retryCount int
 		var backoff time.Duration = InitialBackoff
 
-		// Create a new pf instance to use within this loop
-		pf, err := portforward.New(dialer, ports, stopChannel, readyChannel, req.Streams.Out, req.Streams.ErrOut)
-		if err != nil {
-			errorChannel <- fmt.Errorf("failed to create port forwarder: %w", err)
-			close(stopChannel)
-			return
-		}
-
-		// Set the ForwardFn so the caller can reference it
-		forwarder.ForwardFn = pf
-
 		for {
 			// Check if we should stop
 			select {
@@ -142,8 +396,32 @@ func StartPortForward(req ForwardRequest) (*PortForwarder, error) {
 				// Continue with the forwarding
 			}
 
+			// client-go closes the ready channel of every forwarder it runs, so each attempt
+			// gets its own; the forwarder's ReadyChannel is only closed once
+			attemptReady := make(chan struct{})
+			pf, err := portforward.New(dialer, ports, stopChannel, attemptReady, req.clientGoOut(), req.clientGoOut())
+			if err != nil {
+				forwarder.status.publish(TunnelFailed, retryCount, err)
+				errorChannel <- fmt.Errorf("failed to create port forwarder: %w", err)
+				forwarder.Stop()
+				return
+			}
+
+			// Set the ForwardFn so the caller can reference it
+			forwarder.setForwardFn(pf)
+
 			// Start the port forwarding
-			err := pf.ForwardPorts()
+			forwarder.status.publish(TunnelConnecting, retryCount, nil)
+			attemptDone := make(chan struct{})
+			go func(attempt int) {
+				select {
+				case <-attemptReady:
+					forwarder.markReady(req, attempt)
+				case <-attemptDone:
+				}
+			}(retryCount)
+			err = pf.ForwardPorts()
+			close(attemptDone)
 
 			// If forwarding ended without error, just return
 			if err == nil {
@@ -153,14 +431,16 @@ func StartPortForward(req ForwardRequest) (*PortForwarder, error) {
 			// Error occurred, decide whether to retry
 			if !forwarder.AutoRetry || retryCount >= MaxRetries {
 				// Either auto-retry is disabled or we've reached the max retry count
+				forwarder.status.publish(TunnelFailed, retryCount, err)
 				errorChannel <- fmt.Errorf("port forwarding failed after %d attempts: %w", retryCount+1, err)
-				close(stopChannel)
+				forwarder.Stop()
 				return
 			}
 
 			// Log the retry attempt
-			fmt.Fprintf(req.Streams.ErrOut, "Port forwarding error: %v. Retrying (%d/%d) in %v...\n",
-				err, retryCount+1, MaxRetries, backoff)
+			req.logRetry(err, retryCount+1, backoff)
+			forwarder.recordRetry(err)
+			forwarder.status.publish(TunnelRetrying, retryCount+1, err)
 
 			// Wait before retrying
 			select {
@@ -170,20 +450,9 @@ func StartPortForward(req ForwardRequest) (*PortForwarder, error) {
 				// Continue with retry
 			}
 
-			// Create a new port forwarder for the retry
-			pf, err = portforward.New(dialer, ports, stopChannel, readyChannel, req.Streams.Out, req.Streams.ErrOut)
-			if err != nil {
-				errorChannel <- fmt.Errorf("failed to create port forwarder for retry: %w", err)
-				close(stopChannel)
-				return
-			}
-
-			// Update forwarder's pf reference
-			forwarder.ForwardFn = pf
-
 			// Increase retry count and backoff
 			retryCount++
-			forwarder.RetryAttempts = retryCount
+			forwarder.setAttempts(retryCount)
 
 			// Apply exponential backoff with a maximum limit
 			backoff = time.Duration(float64(backoff) * BackoffFactor)
@@ -196,9 +465,18 @@ func StartPortForward(req ForwardRequest) (*PortForwarder, error) {
 	return forwarder, nil
 }
 
-// Stop stops the port forwarding
+// Stop stops the port forwarding and ends its status stream. It is safe to call more than once.
 func (pf *PortForwarder) Stop() {
-	close(pf.StopChannel)
+	pf.locks().stop.Lock()
+	select {
+	case <-pf.StopChannel:
+		// Already stopped
+	default:
+		close(pf.StopChannel)
+	}
+	pf.locks().stop.Unlock()
+
+	pf.status.close()
 }
 
 // GetPortForwardString returns a string representation of the port forwarding
@@ -206,17 +484,31 @@ func (pf *PortForwarder) GetPortForwardString() string {
 	var resourceType string
 
 	switch pf.Resource.Type {
-	case ui.ServiceResource:
+	case model.ServiceResource:
 		resourceType = "service"
-	case ui.DeploymentResource:
+	case model.DeploymentResource:
 		resourceType = "deployment"
-	case ui.StatefulSetResource:
+	case model.StatefulSetResource:
 		resourceType = "statefulset"
+	case model.CustomResource:
+		resourceType = "custom"
 	default:
 		resourceType = "pod"
 	}
 
-	// Simplified message showing the actual local and remote (container) ports being used.
-	return fmt.Sprintf("Forwarding %s/%s (target port %d) -> localhost:%d",
-		resourceType, pf.Resource.Name, pf.RemotePort, pf.LocalPort)
+	// Simplified message showing the actual local and remote (container) ports being used,
+	// and the pod chosen for resources backed by several pods
+	target := resourceType + "/" + pf.Resource.Name
+	if pod := pf.Pod(); pod != "" && pf.Resource.Type != model.PodResource {
+		target += " via pod " + pod
+	}
+	msg := fmt.Sprintf("Forwarding %s (target port %d) -> %s",
+		target, pf.RemotePort, LocalAddress(pf.Scheme, pf.LocalPort))
+	for _, extra := range pf.ExtraPorts {
+		msg += fmt.Sprintf(", (target port %d) -> %s", extra.RemotePort, LocalAddress(extra.Scheme, extra.LocalPort))
+	}
+	if pf.Resource.Context != "" {
+		msg = "[" + pf.Resource.Context + "] " + msg
+	}
+	return msg
 }
@@ -1,9 +1,20 @@
 package portforward
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"testing"
+	"time"
 
-	"roeyazroel/kubectl-pfw/pkg/ui"
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
 )
 
 // TestPortForwarder_GetPortForwardString verifies the output string for various resource types.
@@ -16,16 +27,26 @@ func TestPortForwarder_GetPortForwardString(t *testing.T) {
 		{
 			name: "service resource",
 			pf: PortForwarder{
-				Resource:   ui.Resource{Name: "svc1", Namespace: "ns1", Type: ui.ServiceResource},
+				Resource:   model.Resource{Name: "svc1", Namespace: "ns1", Type: model.ServiceResource},
 				LocalPort:  8080,
 				RemotePort: 80,
 			},
 			expected: "Forwarding service/svc1 (target port 80) -> localhost:8080",
 		},
+		{
+			name: "service resource with backing pod",
+			pf: PortForwarder{
+				Resource:   model.Resource{Name: "svc1", Namespace: "ns1", Type: model.ServiceResource},
+				LocalPort:  8080,
+				RemotePort: 80,
+				PodName:    "svc1-7d9f8-abcde",
+			},
+			expected: "Forwarding service/svc1 via pod svc1-7d9f8-abcde (target port 80) -> localhost:8080",
+		},
 		{
 			name: "deployment resource",
 			pf: PortForwarder{
-				Resource:   ui.Resource{Name: "dep1", Namespace: "ns1", Type: ui.DeploymentResource},
+				Resource:   model.Resource{Name: "dep1", Namespace: "ns1", Type: model.DeploymentResource},
 				LocalPort:  8081,
 				RemotePort: 81,
 			},
@@ -34,7 +55,7 @@ func TestPortForwarder_GetPortForwardString(t *testing.T) {
 		{
 			name: "statefulset resource",
 			pf: PortForwarder{
-				Resource:   ui.Resource{Name: "ss1", Namespace: "ns1", Type: ui.StatefulSetResource},
+				Resource:   model.Resource{Name: "ss1", Namespace: "ns1", Type: model.StatefulSetResource},
 				LocalPort:  8082,
 				RemotePort: 82,
 			},
@@ -43,12 +64,47 @@ func TestPortForwarder_GetPortForwardString(t *testing.T) {
 		{
 			name: "pod resource",
 			pf: PortForwarder{
-				Resource:   ui.Resource{Name: "pod1", Namespace: "ns1", Type: ui.PodResource},
+				Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
 				LocalPort:  8083,
 				RemotePort: 83,
+				PodName:    "pod1",
 			},
 			expected: "Forwarding pod/pod1 (target port 83) -> localhost:8083",
 		},
+		{
+			name: "https port",
+			pf: PortForwarder{
+				Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+				LocalPort:  8443,
+				RemotePort: 443,
+				PodName:    "pod1",
+				Scheme:     "https",
+			},
+			expected: "Forwarding pod/pod1 (target port 443) -> https://localhost:8443",
+		},
+		{
+			name: "extra ports",
+			pf: PortForwarder{
+				Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+				LocalPort:  8083,
+				RemotePort: 83,
+				PodName:    "pod1",
+				ExtraPorts: []PortPair{{LocalPort: 9093, RemotePort: 93}},
+			},
+			expected: "Forwarding pod/pod1 (target port 83) -> localhost:8083, (target port 93) -> localhost:9093",
+		},
+		{
+			name: "extra ports with their own schemes",
+			pf: PortForwarder{
+				Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+				LocalPort:  8443,
+				RemotePort: 443,
+				PodName:    "pod1",
+				Scheme:     "https",
+				ExtraPorts: []PortPair{{LocalPort: 8080, RemotePort: 80, Scheme: "http"}},
+			},
+			expected: "Forwarding pod/pod1 (target port 443) -> https://localhost:8443, (target port 80) -> http://localhost:8080",
+		},
 	}
 
 	for _, c := range cases {
@@ -74,3 +130,320 @@ func TestPortForwarder_Stop(t *testing.T) {
 		t.Error("expected StopChannel to be closed after Stop")
 	}
 }
+
+// TestPortForwarder_RetryStats verifies that reconnection attempts are counted with the most
+// recent error and reported in the forward's status.
+func TestPortForwarder_RetryStats(t *testing.T) {
+	pf := &PortForwarder{}
+	pf.recordRetry(errors.New("lost connection to pod"))
+	pf.recordRetry(errors.New("connection refused"))
+
+	entry := &forwardEntry{id: "1", forwarder: pf, state: ForwardActive}
+	stats := entry.status().RetryStats
+	if stats.Retries != 2 || stats.LastError != "connection refused" || stats.LastErrorTime.IsZero() {
+		t.Errorf("expected 2 retries with the last error, got %+v", stats)
+	}
+}
+
+// TestPortForwarder_ConnectedSince verifies that the tunnel's uptime restarts on reconnection
+// and that only reconnections are reported to the request's hook.
+func TestPortForwarder_ConnectedSince(t *testing.T) {
+	pf := &PortForwarder{}
+	reconnects := 0
+	req := ForwardRequest{onReconnect: func() { reconnects++ }}
+
+	pf.markConnected(req)
+	first := pf.ConnectedSince()
+	if first.IsZero() || reconnects != 0 {
+		t.Fatalf("expected the first connection to be recorded without a reconnect, got %v and %d reconnects", first, reconnects)
+	}
+
+	time.Sleep(time.Millisecond)
+	pf.markConnected(req)
+	entry := &forwardEntry{id: "1", forwarder: pf, state: ForwardActive}
+	if connectedSince := entry.status().ConnectedSince; !connectedSince.After(first) || reconnects != 1 {
+		t.Errorf("expected the reconnection to restart the uptime, got %v (first %v) and %d reconnects", connectedSince, first, reconnects)
+	}
+}
+
+// TestPortForwarder_LocksPerForwarder verifies that forwarders do not wait on each other's
+// locks, while copies of a forwarder share them.
+func TestPortForwarder_LocksPerForwarder(t *testing.T) {
+	busy := &PortForwarder{state: &forwarderState{}}
+	other := &PortForwarder{state: &forwarderState{}}
+
+	busy.locks().pod.Lock()
+	defer busy.locks().pod.Unlock()
+	done := make(chan struct{})
+	go func() {
+		other.SetPod("web-1")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected changing the pod of one forwarder not to wait on another's lock")
+	}
+
+	copied := *busy
+	if copied.locks() != busy.locks() {
+		t.Error("expected a copy of a forwarder to share its locks")
+	}
+}
+
+// TestStartPortForward_ExtraPorts verifies that several ports of a pod are carried by a single
+// forwarder over one connection.
+func TestStartPortForward_ExtraPorts(t *testing.T) {
+	pa := NewPortAllocator()
+	var ports []int32
+	for i := 0; i < 2; i++ {
+		port, err := pa.AllocatePort(0)
+		if err != nil {
+			t.Fatalf("failed to allocate port: %v", err)
+		}
+		// Let client-go bind the port itself
+		pa.ReleasePort(port)
+		ports = append(ports, port)
+	}
+
+	factory := &echoDialerFactory{}
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	pf, err := StartPortForward(ForwardRequest{
+		Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+		LocalPort:  ports[0],
+		RemotePort: 8080,
+		ExtraPorts: []PortPair{{LocalPort: ports[1], RemotePort: 9090}},
+		Streams:    streams,
+		Dialers:    factory,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pf.Stop()
+
+	select {
+	case <-pf.ReadyChannel:
+	case err := <-pf.ErrorChannel:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the forward to become ready")
+	}
+
+	for _, port := range ports {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatalf("failed to connect to port %d: %v", port, err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintln(conn, "ping")
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if err != nil || reply != "ping\n" {
+			t.Errorf("expected the echo through port %d, got %q (%v)", port, reply, err)
+		}
+	}
+	if len(factory.pods) != 1 {
+		t.Errorf("expected a single dialer for both ports, got %v", factory.pods)
+	}
+	if got := pf.Ports(); len(got) != 2 || got[1].RemotePort != 9090 {
+		t.Errorf("expected both ports on the forwarder, got %v", got)
+	}
+}
+
+// portDialerFactory hands out connections answering every data stream with the remote port
+// it was opened for
+type portDialerFactory struct{}
+
+func (portDialerFactory) DialerFor(namespace, podName string) (httpstream.Dialer, error) {
+	return portDialer{}, nil
+}
+
+type portDialer struct{}
+
+func (portDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	return &portConnection{echoConnection: echoConnection{closed: make(chan bool)}}, protocols[0], nil
+}
+
+// portConnection is a fake port-forward connection to a pod naming the port of each stream
+type portConnection struct {
+	echoConnection
+}
+
+func (c *portConnection) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	if headers.Get(corev1.StreamType) == corev1.StreamTypeError {
+		return c.echoConnection.CreateStream(headers)
+	}
+	local, remote := net.Pipe()
+	go func() {
+		defer remote.Close()
+		fmt.Fprintln(remote, headers.Get(corev1.PortHeader))
+		io.Copy(io.Discard, remote)
+	}()
+	return &pipeStream{Conn: local, headers: headers}, nil
+}
+
+// expectRemotePort connects to localPort and checks that it reaches remotePort of the pod
+func expectRemotePort(t *testing.T, localPort, remotePort int32) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", localPort), time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to port %d: %v", localPort, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if want := fmt.Sprintf("%d\n", remotePort); err != nil || reply != want {
+		t.Errorf("expected localhost:%d to reach port %d, got %q (%v)", localPort, remotePort, reply, err)
+	}
+}
+
+// TestStartPortForward_ExtraPortsOverListeners verifies that forwards serving their own
+// listeners, held or lazy, carry extra ports to their own remote ports.
+func TestStartPortForward_ExtraPortsOverListeners(t *testing.T) {
+	cases := []struct {
+		name string
+		lazy bool
+		// held hands over the listeners bound by the allocator; otherwise the forward binds them
+		held bool
+	}{
+		{"held", false, true},
+		{"lazy held", true, true},
+		{"lazy", true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pa := NewPortAllocator()
+			var ports []int32
+			for i := 0; i < 2; i++ {
+				port, err := pa.AllocatePort(0)
+				if err != nil {
+					t.Fatalf("failed to allocate port: %v", err)
+				}
+				ports = append(ports, port)
+			}
+			req := ForwardRequest{
+				Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+				LocalPort:  ports[0],
+				RemotePort: 8080,
+				ExtraPorts: []PortPair{{LocalPort: ports[1], RemotePort: 9090}},
+				Lazy:       c.lazy,
+				Dialers:    portDialerFactory{},
+			}
+			if c.held {
+				req.Listeners = pa.TakeListeners(ports[0])
+				req.ExtraListeners = [][]net.Listener{pa.TakeListeners(ports[1])}
+			} else {
+				pa.ReleasePort(ports[0])
+				pa.ReleasePort(ports[1])
+			}
+
+			pf, err := StartPortForward(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer pf.Stop()
+			select {
+			case <-pf.ReadyChannel:
+			case err := <-pf.ErrorChannel:
+				t.Fatalf("unexpected error: %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the forward to become ready")
+			}
+
+			expectRemotePort(t, ports[0], 8080)
+			expectRemotePort(t, ports[1], 9090)
+		})
+	}
+}
+
+// droppingDialerFactory hands out echo connections that the pod drops shortly after dialing
+type droppingDialerFactory struct{}
+
+func (droppingDialerFactory) DialerFor(namespace, podName string) (httpstream.Dialer, error) {
+	return droppingDialer{}, nil
+}
+
+type droppingDialer struct{}
+
+func (droppingDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	conn := &echoConnection{closed: make(chan bool)}
+	time.AfterFunc(100*time.Millisecond, func() { conn.Close() })
+	return conn, protocols[0], nil
+}
+
+// TestStartPortForward_ReadyOnEveryAttempt verifies that a client-go forwarder reconnecting
+// after a lost connection reports each attempt on its status stream instead of reusing the
+// ready channel of the first one.
+func TestStartPortForward_ReadyOnEveryAttempt(t *testing.T) {
+	pa := NewPortAllocator()
+	port, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Fatalf("failed to allocate port: %v", err)
+	}
+	pa.ReleasePort(port)
+
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	pf, err := StartPortForward(ForwardRequest{
+		Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+		LocalPort:  port,
+		RemotePort: 8080,
+		Streams:    streams,
+		Dialers:    droppingDialerFactory{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var states []TunnelState
+	timeout := time.After(10 * time.Second)
+	for readies := 0; readies < 2; {
+		select {
+		case status := <-pf.Status():
+			states = append(states, status.State)
+			if status.State == TunnelReady {
+				readies++
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for the reconnection, got %v", states)
+		}
+	}
+	select {
+	case <-pf.ReadyChannel:
+	default:
+		t.Error("expected ReadyChannel to be closed after the first connection")
+	}
+	if attempts := pf.Attempts(); attempts != 1 {
+		t.Errorf("expected 1 attempt after the first, got %d", attempts)
+	}
+
+	pf.Stop()
+	for status := range pf.Status() {
+		states = append(states, status.State)
+	}
+	expected := []TunnelState{TunnelConnecting, TunnelReady, TunnelRetrying, TunnelConnecting, TunnelReady, TunnelStopped}
+	if fmt.Sprint(states) != fmt.Sprint(expected) {
+		t.Errorf("expected states %v, got %v", expected, states)
+	}
+}
+
+// TestStatusStream_StoppedDeliveredWhenFull verifies that closing a stream nobody reads still
+// delivers TunnelStopped as its last status, dropping the oldest one to make room.
+func TestStatusStream_StoppedDeliveredWhenFull(t *testing.T) {
+	s := newStatusStream()
+	for i := 0; i < statusBuffer+4; i++ {
+		s.publish(TunnelRetrying, i, nil)
+	}
+	s.close()
+	s.close()
+
+	var statuses []TunnelStatus
+	for status := range s.ch {
+		statuses = append(statuses, status)
+	}
+	if len(statuses) != statusBuffer {
+		t.Fatalf("expected %d statuses, got %d", statusBuffer, len(statuses))
+	}
+	if statuses[0].Attempt != 1 || statuses[len(statuses)-1].State != TunnelStopped {
+		t.Errorf("expected the oldest status dropped and TunnelStopped last, got %+v", statuses)
+	}
+}
@@ -0,0 +1,84 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/state"
+)
+
+// PrivilegedPortLimit is the first port that unprivileged processes may bind on most systems
+const PrivilegedPortLimit = 1024
+
+// privilegedPortOffset maps a privileged port to its unprivileged substitute (80 -> 8080, 443 -> 8443)
+const privilegedPortOffset = 8000
+
+// isPermissionDenied reports whether a bind failed because the port requires elevated privileges
+func isPermissionDenied(err error) bool {
+	return errors.Is(err, os.ErrPermission)
+}
+
+// allocatePrivilegedSubstitute reserves an unprivileged port to use instead of a privileged
+// one, preferring port+8000 and falling back to an ephemeral port
+func (m *Manager) allocatePrivilegedSubstitute(privilegedPort int32) (int32, error) {
+	substitute := privilegedPort + privilegedPortOffset
+	if _, err := m.PortAllocator.AllocatePort(substitute); err == nil {
+		return substitute, nil
+	}
+	return m.PortAllocator.AllocatePort(0)
+}
+
+// RunPrivilegedRelay serves listenPort on the loopback interface and copies every connection
+// to targetPort on localhost. It is meant to run with elevated privileges for ports below
+// 1024 and returns once the process with parentPID has exited.
+func RunPrivilegedRelay(listenPort, targetPort int32, parentPID int) error {
+	listeners, err := listenLocal(listenPort)
+	if err != nil {
+		return err
+	}
+	defer closeListeners(listeners)
+
+	for _, listener := range listeners {
+		go func(l net.Listener) {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go relayConnection(conn, targetPort)
+			}
+		}(listener)
+	}
+
+	// The relay must not outlive the pfw session that started it
+	for state.ProcessAlive(parentPID) {
+		time.Sleep(time.Second)
+	}
+	return nil
+}
+
+// relayConnection copies data between a local connection and targetPort on localhost
+func relayConnection(local net.Conn, targetPort int32) {
+	defer local.Close()
+
+	remote, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", targetPort))
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
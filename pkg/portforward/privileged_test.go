@@ -0,0 +1,37 @@
+package portforward
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// TestIsPermissionDenied verifies detection of bind errors caused by missing privileges.
+func TestIsPermissionDenied(t *testing.T) {
+	err := fmt.Errorf("port 80 is not available: %w", &os.SyscallError{Syscall: "bind", Err: syscall.EACCES})
+	if !isPermissionDenied(err) {
+		t.Error("expected EACCES to be reported as permission denied")
+	}
+	if isPermissionDenied(fmt.Errorf("port 80 is not available: %w", syscall.EADDRINUSE)) {
+		t.Error("expected EADDRINUSE not to be reported as permission denied")
+	}
+}
+
+// TestRunPrivilegedRelay_ExitsWithParent verifies that the relay stops once its parent is gone.
+func TestRunPrivilegedRelay_ExitsWithParent(t *testing.T) {
+	pa := NewPortAllocator()
+	port, err := pa.AllocatePort(0)
+	if err != nil {
+		t.Fatalf("failed to allocate port: %v", err)
+	}
+	pa.ReleasePort(port)
+
+	// A PID above the kernel's maximum is never running
+	if err := RunPrivilegedRelay(port, port+1, 1<<22); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsPortAvailable(port) {
+		t.Error("expected the relay to release its port on exit")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package portforward
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findKubectlPortForward looks for a running `kubectl port-forward` process whose arguments
+// bind localPort and returns its PID and command line
+func findKubectlPortForward(localPort int32) (int, string, bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, "", false
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil || len(raw) == 0 {
+			continue
+		}
+		args := strings.Split(string(bytes.TrimRight(raw, "\x00")), "\x00")
+		if isKubectlPortForward(args, localPort) {
+			return pid, strings.Join(args, " "), true
+		}
+	}
+	return 0, "", false
+}
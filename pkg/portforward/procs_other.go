@@ -0,0 +1,9 @@
+//go:build !linux
+
+package portforward
+
+// findKubectlPortForward is only implemented on Linux, where process arguments are readable
+// without extra dependencies
+func findKubectlPortForward(localPort int32) (int, string, bool) {
+	return 0, "", false
+}
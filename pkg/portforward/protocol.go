@@ -0,0 +1,42 @@
+package portforward
+
+import (
+	"fmt"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// skipNonTCP reports whether port is served over a protocol other than TCP, such as UDP or
+// SCTP, and warns that it is skipped: port-forwarding only tunnels TCP, so a forward to it
+// would start but never carry any traffic
+func (m *Manager) skipNonTCP(resource model.Resource, port int32, protocol string) bool {
+	if k8s.IsTCP(protocol) {
+		return false
+	}
+	m.Log().Warn(fmt.Sprintf("Skipping %s/%s port %d: it is a %s port and port-forwarding only supports TCP",
+		resource.Type, resource.Name, port, protocol),
+		"event", "skipped", "resource", string(resource.Type)+"/"+resource.Name, "namespace", resource.Namespace,
+		"port", port, "protocol", protocol)
+	return true
+}
+
+// withPodProtocols fills in the protocols of the ports of a pod resource that was not listed
+// from the cluster, e.g. one from a configuration file, by looking up the pod. The resource is
+// returned unchanged if the pod cannot be looked up; forwarding reports that instead.
+func (m *Manager) withPodProtocols(resource model.Resource) model.Resource {
+	client := m.clusterFor(resource).K8sClient
+	if resource.Type != model.PodResource || len(resource.Protocols) > 0 || client == nil {
+		return resource
+	}
+	pods, err := BackingPods(m.Context, client, resource)
+	if err != nil {
+		return resource
+	}
+	pod := pods[0]
+	resource.Protocols = make([]string, len(resource.Ports))
+	for i, port := range resource.Ports {
+		resource.Protocols[i] = pod.PortProtocol(port)
+	}
+	return resource
+}
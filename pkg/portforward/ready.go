@@ -0,0 +1,108 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// readyPollInterval is how often the pods of a resource are checked while waiting for one to
+// be ready; a variable so tests can shorten it
+var readyPollInterval = 2 * time.Second
+
+// awaitReadyPod waits up to timeout until a ready pod backs resource, e.g. right after a helm
+// install, logging progress whenever the pods change. Pods forwarded directly are not waited
+// for, nor is anything when timeout is 0.
+func (m *Manager) awaitReadyPod(resource model.Resource, timeout time.Duration) error {
+	if timeout <= 0 || resource.Type == model.PodResource {
+		return nil
+	}
+
+	owner := fmt.Sprintf("%s %s", resource.Type, resource.Name)
+	attrs := []any{"event", "waiting", "resource", string(resource.Type) + "/" + resource.Name, "namespace", resource.Namespace}
+	filter, err := m.podFilterFor(resource)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	progress := ""
+	for {
+		pods, err := m.backingPods(resource)
+		if err != nil && !errors.Is(err, k8s.ErrNoPods) {
+			return err
+		}
+		if pods, err = m.filterPods(resource, filter, pods); err != nil {
+			return err
+		}
+		if hasReadyPod(pods) {
+			if progress != "" {
+				m.Log().Info(fmt.Sprintf("A pod of %s is ready", owner), attrs...)
+			}
+			return nil
+		}
+
+		current := readyProgress(pods)
+		if current != progress {
+			m.Log().Info(fmt.Sprintf("Waiting for a ready pod of %s (%s)...", owner, current), attrs...)
+			progress = current
+		}
+		if time.Now().After(deadline) {
+			return withSentinel(ErrNoReadyPods, fmt.Errorf("no pod of %s became ready within %s (%s)", owner, timeout, progress))
+		}
+
+		select {
+		case <-m.Context.Done():
+			return m.Context.Err()
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// unusablePodStatuses are the statuses of pods that cannot carry a tunnel: pods being deleted,
+// evicted pods and pods whose containers keep crashing
+var unusablePodStatuses = map[string]bool{
+	"Terminating":      true,
+	"Evicted":          true,
+	"CrashLoopBackOff": true,
+}
+
+// usablePods returns the pods that can carry a tunnel, and the others described by name and
+// status, e.g. web-1 (CrashLoopBackOff)
+func usablePods(pods []k8s.Pod) ([]k8s.Pod, []string) {
+	var usable []k8s.Pod
+	var skipped []string
+	for _, pod := range pods {
+		if unusablePodStatuses[pod.Status] {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", pod.Name, pod.Status))
+			continue
+		}
+		usable = append(usable, pod)
+	}
+	return usable, skipped
+}
+
+// hasReadyPod reports whether any of pods is ready
+func hasReadyPod(pods []k8s.Pod) bool {
+	for _, pod := range pods {
+		if pod.Ready {
+			return true
+		}
+	}
+	return false
+}
+
+// readyProgress describes pods that are not ready yet, e.g. "0/2 ready: web-1 ContainerCreating"
+func readyProgress(pods []k8s.Pod) string {
+	if len(pods) == 0 {
+		return "no pods yet"
+	}
+	statuses := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		statuses = append(statuses, pod.Name+" "+pod.Status)
+	}
+	return fmt.Sprintf("0/%d ready: %s", len(pods), strings.Join(statuses, ", "))
+}
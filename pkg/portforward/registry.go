@@ -0,0 +1,278 @@
+package portforward
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// ForwardState describes where a forward is in its lifecycle
+type ForwardState string
+
+const (
+	// ForwardQueued means the forward waits for a free slot under MaxForwards
+	ForwardQueued ForwardState = "queued"
+	// ForwardStarting means the tunnel was started but is not ready yet
+	ForwardStarting ForwardState = "starting"
+	// ForwardActive means the local port accepts connections
+	ForwardActive ForwardState = "active"
+)
+
+// ForwardStatus is a snapshot of a single forward managed by the Manager
+type ForwardStatus struct {
+	ID         string
+	Resource   model.Resource
+	PodName    string
+	LocalPort  int32
+	RemotePort int32
+	State      ForwardState
+	// Scheme is the URL scheme of the remote port, e.g. https, or empty if unknown
+	Scheme string
+	// RetryStats counts the reconnection attempts of running forwards
+	RetryStats
+	// ConnectedSince is when the tunnel of a running forward was last (re)established
+	ConnectedSince time.Time
+}
+
+// ForwardFailure describes a forward that could not be started or ended with an error
+type ForwardFailure struct {
+	Resource   model.Resource
+	LocalPort  int32
+	RemotePort int32
+	// Retries is the number of reconnection attempts made before giving up
+	Retries int
+	Err     error
+}
+
+// SessionSummary counts the forwards of a session and lists those that failed
+type SessionSummary struct {
+	Forwards int
+	Failures []ForwardFailure
+}
+
+// forwardEntry is the Manager's record of a forward. The entry is owned by the Manager until
+// the forward starts; from then on the supervision loop owns it and is the only place that
+// removes it and releases its local port.
+type forwardEntry struct {
+	id        string
+	seq       int
+	req       ForwardRequest
+	forwarder *PortForwarder
+	state     ForwardState
+	// exited is set by the supervision loop once the forwarder ended
+	exited bool
+	// done is closed once the forward is removed and its local port released
+	done chan struct{}
+}
+
+// ForwardID returns the identifier of a forward. Local ports are unique within a session, so
+// the resource together with its local port identifies a forward. Resources of another
+// kubeconfig context are prefixed with the context name.
+func ForwardID(resource model.Resource, localPort int32) string {
+	id := fmt.Sprintf("%s/%s/%s:%d", resource.Namespace, resource.Type, resource.Name, localPort)
+	if resource.Context != "" {
+		id = resource.Context + "/" + id
+	}
+	return id
+}
+
+// forwardIDs returns the IDs of every port of the request, the one of LocalPort first
+func (req ForwardRequest) forwardIDs() []string {
+	var ids []string
+	for _, port := range req.ports() {
+		ids = append(ids, ForwardID(req.Resource, port.LocalPort))
+	}
+	return ids
+}
+
+// track adds a forward to the registry under the IDs of all its ports, so each of them can be
+// looked up, stopped and listed on its own. Must be called with m.mutex held.
+func (m *Manager) track(req ForwardRequest, state ForwardState) *forwardEntry {
+	if m.forwards == nil {
+		m.forwards = make(map[string]*forwardEntry)
+	}
+	m.seq++
+	m.attempted++
+	entry := &forwardEntry{
+		id:    ForwardID(req.Resource, req.LocalPort),
+		seq:   m.seq,
+		req:   req,
+		state: state,
+		done:  make(chan struct{}),
+	}
+	for _, id := range req.forwardIDs() {
+		m.forwards[id] = entry
+	}
+	return entry
+}
+
+// untrackLocked removes a forward from the registry. Must be called with m.mutex held.
+func (m *Manager) untrackLocked(entry *forwardEntry) {
+	for _, id := range entry.req.forwardIDs() {
+		if m.forwards[id] == entry {
+			delete(m.forwards, id)
+		}
+	}
+}
+
+// releasePorts releases the local ports of every port of the request
+func (m *Manager) releasePorts(req ForwardRequest) {
+	for _, port := range req.ports() {
+		m.PortAllocator.ReleasePort(port.LocalPort)
+	}
+}
+
+// GetStatus returns a snapshot of all forwards in the order they were added. Ports carried
+// by the same tunnel are listed as forwards of their own.
+func (m *Manager) GetStatus() []ForwardStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entries := make([]*forwardEntry, 0, len(m.forwards))
+	seen := make(map[*forwardEntry]bool)
+	for _, entry := range m.forwards {
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	statuses := make([]ForwardStatus, 0, len(m.forwards))
+	for _, entry := range entries {
+		statuses = append(statuses, entry.statuses()...)
+	}
+	return statuses
+}
+
+// statuses describes every port of the entry, LocalPort first; the caller holds the manager
+// mutex
+func (e *forwardEntry) statuses() []ForwardStatus {
+	status := e.status()
+	statuses := []ForwardStatus{status}
+	for _, extra := range e.req.ExtraPorts {
+		status.ID = ForwardID(e.req.Resource, extra.LocalPort)
+		status.LocalPort = extra.LocalPort
+		status.RemotePort = extra.RemotePort
+		status.Scheme = extra.Scheme
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// status describes the entry; the caller holds the manager mutex. The pod is taken from the
+// running forwarder, which may have moved to another pod since the forward was requested.
+func (e *forwardEntry) status() ForwardStatus {
+	podName := e.req.targetPod()
+	var stats RetryStats
+	var connectedSince time.Time
+	if e.forwarder != nil {
+		podName = e.forwarder.Pod()
+		stats = e.forwarder.RetryStats()
+		connectedSince = e.forwarder.ConnectedSince()
+	}
+	return ForwardStatus{
+		ID:             e.id,
+		Resource:       e.req.Resource,
+		PodName:        podName,
+		LocalPort:      e.req.LocalPort,
+		RemotePort:     e.req.RemotePort,
+		State:          e.state,
+		Scheme:         e.req.Scheme,
+		RetryStats:     stats,
+		ConnectedSince: connectedSince,
+	}
+}
+
+// TunnelIDs returns the IDs of all ports carried by the tunnel of the forward with the given ID,
+// which are stopped together with it, the one of the tunnel's first port first. It returns nil
+// if no forward has that ID.
+func (m *Manager) TunnelIDs(id string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, ok := m.forwards[id]
+	if !ok {
+		return nil
+	}
+	return entry.req.forwardIDs()
+}
+
+// RemoveForward stops the forward with the given ID, together with the other ports carried by
+// its tunnel. Running forwards release their local ports once their tunnel has shut down;
+// queued forwards are dropped immediately.
+func (m *Manager) RemoveForward(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, ok := m.forwards[id]
+	if !ok {
+		return fmt.Errorf("no forward with ID %s", id)
+	}
+	m.removeLocked(entry)
+	return nil
+}
+
+// StopForward stops the forward with the given ID like RemoveForward, but waits until it has
+// shut down: its local port is released and it is removed from the shared registry
+func (m *Manager) StopForward(id string) error {
+	m.mutex.Lock()
+	entry, ok := m.forwards[id]
+	if !ok {
+		m.mutex.Unlock()
+		return fmt.Errorf("no forward with ID %s", id)
+	}
+	m.removeLocked(entry)
+	m.mutex.Unlock()
+
+	select {
+	case <-entry.done:
+		return nil
+	case <-m.Context.Done():
+		return m.Context.Err()
+	}
+}
+
+// removeLocked stops a forward. Must be called with m.mutex held.
+func (m *Manager) removeLocked(entry *forwardEntry) {
+	if entry.forwarder != nil {
+		// The supervision loop removes the entry and releases the port
+		entry.forwarder.Stop()
+		return
+	}
+
+	// Queued forwards are still owned by the Manager
+	for i, req := range m.queue {
+		if ForwardID(req.Resource, req.LocalPort) == entry.id {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			break
+		}
+	}
+	m.untrackLocked(entry)
+	entry.req.closeAllListeners()
+	m.releasePorts(entry.req)
+	close(entry.done)
+}
+
+// RecordFailure adds a resource that failed to start, and therefore never became a tracked
+// forward, to the session summary
+func (m *Manager) RecordFailure(failure ForwardFailure) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.attempted++
+	m.failures = append(m.failures, failure)
+}
+
+// Summary returns the number of forwards attempted in this session and those that failed
+func (m *Manager) Summary() SessionSummary {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return SessionSummary{
+		Forwards: m.attempted,
+		Failures: append([]ForwardFailure(nil), m.failures...),
+	}
+}
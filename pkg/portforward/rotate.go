@@ -0,0 +1,122 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotationPolicy limits how large and old a log file grows and how many rotated files are kept
+type RotationPolicy struct {
+	// MaxSize rotates the file before it grows beyond this many bytes; 0 disables it
+	MaxSize int64
+	// MaxAge rotates the file this long after it was opened or last rotated; 0 disables it
+	MaxAge time.Duration
+	// MaxFiles is the number of rotated files kept, as <path>.1 (newest) to <path>.<MaxFiles>.
+	// Older files are deleted; with 0 the file is emptied on rotation.
+	MaxFiles int
+}
+
+// RotatingFile appends to a log file and rotates it according to its policy, so long-lived
+// sessions do not fill the disk. It is safe for concurrent use.
+type RotatingFile struct {
+	path    string
+	policy  RotationPolicy
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+}
+
+// OpenRotatingFile opens path for appending, creating it if needed
+func OpenRotatingFile(path string, policy RotationPolicy) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, policy: policy}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file at path and records its size
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.started = file, info.Size(), time.Now()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would exceed MaxSize or the file has
+// reached MaxAge. Messages are never split across files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, fs.ErrClosed
+	}
+	oversized := f.policy.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.policy.MaxSize
+	expired := f.policy.MaxAge > 0 && time.Since(f.started) >= f.policy.MaxAge
+	if oversized || expired {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file to <path>.1, shifting older rotated files up and deleting those beyond
+// MaxFiles, and starts a new file. Must be called with f.mu held.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.policy.MaxFiles <= 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to rotate %s: %w", f.path, err)
+		}
+		return f.open()
+	}
+	if err := os.Remove(rotatedName(f.path, f.policy.MaxFiles)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to rotate %s: %w", f.path, err)
+	}
+	for i := f.policy.MaxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedName(f.path, i), rotatedName(f.path, i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to rotate %s: %w", f.path, err)
+		}
+	}
+	if err := os.Rename(f.path, rotatedName(f.path, 1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to rotate %s: %w", f.path, err)
+	}
+	return f.open()
+}
+
+// rotatedName returns the name of the i-th rotated file of path
+func rotatedName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// Close closes the file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
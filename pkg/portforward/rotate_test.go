@@ -0,0 +1,61 @@
+package portforward
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRotatingFile_MaxSize verifies that the file is rotated before it exceeds its maximum
+// size and that only MaxFiles rotated files are kept.
+func TestRotatingFile_MaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pfw.log")
+	f, err := OpenRotatingFile(path, RotationPolicy{MaxSize: 10, MaxFiles: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		got, err := os.ReadFile(name)
+		if err != nil || string(got) != want {
+			t.Errorf("expected %s to contain %q, got %q, %v", filepath.Base(name), want, got, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no third rotated file, got %v", err)
+	}
+}
+
+// TestRotatingFile_MaxAge verifies that the file is rotated once it reaches its maximum age,
+// and emptied when no rotated files are kept.
+func TestRotatingFile_MaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pfw.log")
+	os.WriteFile(path, []byte("previous session\n"), 0o600)
+	f, err := OpenRotatingFile(path, RotationPolicy{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("today\n"))
+	if got, _ := os.ReadFile(path); string(got) != "previous session\ntoday\n" {
+		t.Errorf("expected the existing file to be appended to, got %q", got)
+	}
+
+	f.started = time.Now().Add(-time.Hour)
+	f.Write([]byte("tomorrow\n"))
+	if got, _ := os.ReadFile(path); string(got) != "tomorrow\n" {
+		t.Errorf("expected a new file after MaxAge, got %q", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("expected no rotated file without MaxFiles, got %v", err)
+	}
+}
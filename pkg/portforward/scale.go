@@ -0,0 +1,122 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultScaleReadyTimeout is how long a workload scaled up from zero may take to get a ready
+// pod when ReadyTimeout is not set
+const DefaultScaleReadyTimeout = 5 * time.Minute
+
+// scaleClient reads and updates the scale subresource of a workload
+type scaleClient struct {
+	get    func(ctx context.Context, name string) (*autoscalingv1.Scale, error)
+	update func(ctx context.Context, name string, scale *autoscalingv1.Scale) error
+}
+
+// scaleClientFor returns the scale subresource client of a deployment or statefulset, or false
+// for other resources
+func (m *Manager) scaleClientFor(resource model.Resource) (scaleClient, bool) {
+	clientset := m.clusterFor(resource).ClientSet
+	if clientset == nil {
+		return scaleClient{}, false
+	}
+	apps := clientset.AppsV1()
+	switch resource.Type {
+	case model.DeploymentResource:
+		deployments := apps.Deployments(resource.Namespace)
+		return scaleClient{
+			get: func(ctx context.Context, name string) (*autoscalingv1.Scale, error) {
+				return deployments.GetScale(ctx, name, metav1.GetOptions{})
+			},
+			update: func(ctx context.Context, name string, scale *autoscalingv1.Scale) error {
+				_, err := deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+				return err
+			},
+		}, true
+	case model.StatefulSetResource:
+		statefulSets := apps.StatefulSets(resource.Namespace)
+		return scaleClient{
+			get: func(ctx context.Context, name string) (*autoscalingv1.Scale, error) {
+				return statefulSets.GetScale(ctx, name, metav1.GetOptions{})
+			},
+			update: func(ctx context.Context, name string, scale *autoscalingv1.Scale) error {
+				_, err := statefulSets.UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+				return err
+			},
+		}, true
+	default:
+		return scaleClient{}, false
+	}
+}
+
+// scaleFromZero scales a deployment or statefulset with 0 replicas to 1 when ScaleFromZero is
+// set, and remembers it so RestoreScale can scale it back down. It reports whether the
+// workload was scaled up.
+func (m *Manager) scaleFromZero(resource model.Resource) (bool, error) {
+	if !m.ScaleFromZero {
+		return false, nil
+	}
+	client, ok := m.scaleClientFor(resource)
+	if !ok {
+		return false, nil
+	}
+
+	scale, err := client.get(m.Context, resource.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to get replicas of %s %s: %w", resource.Type, resource.Name, err)
+	}
+	if scale.Spec.Replicas != 0 {
+		return false, nil
+	}
+
+	scale.Spec.Replicas = 1
+	if err := client.update(m.Context, resource.Name, scale); err != nil {
+		return false, fmt.Errorf("failed to scale %s %s from zero: %w", resource.Type, resource.Name, err)
+	}
+	m.mutex.Lock()
+	m.scaledUp = append(m.scaledUp, resource)
+	m.mutex.Unlock()
+
+	m.Log().Info(fmt.Sprintf("Scaled %s %s from 0 to 1 replica; it is scaled back down when the session ends", resource.Type, resource.Name),
+		"event", "scaled", "resource", string(resource.Type)+"/"+resource.Name, "namespace", resource.Namespace, "replicas", 1)
+	return true, nil
+}
+
+// RestoreScale scales the workloads scaled up by ScaleFromZero back to zero replicas. Workloads
+// whose replicas were changed by someone else in the meantime are left alone.
+func (m *Manager) RestoreScale() {
+	m.mutex.Lock()
+	scaled := m.scaledUp
+	m.scaledUp = nil
+	m.mutex.Unlock()
+
+	// The session context may already be canceled when the session ends
+	ctx := context.Background()
+	for _, resource := range scaled {
+		attrs := []any{"event", "scaled", "resource", string(resource.Type) + "/" + resource.Name, "namespace", resource.Namespace}
+		client, _ := m.scaleClientFor(resource)
+		scale, err := client.get(ctx, resource.Name)
+		if err == nil && scale.Spec.Replicas != 1 {
+			m.Log().Warn(fmt.Sprintf("Not scaling %s %s back to 0: it now has %d replicas", resource.Type, resource.Name, scale.Spec.Replicas), attrs...)
+			continue
+		}
+		if err == nil {
+			scale.Spec.Replicas = 0
+			err = client.update(ctx, resource.Name, scale)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to scale %s %s back to 0: %w", resource.Type, resource.Name, err)
+			m.Log().Error(err.Error(), "event", "error", "error", err.Error())
+			continue
+		}
+		m.Log().Info(fmt.Sprintf("Scaled %s %s back to 0 replicas", resource.Type, resource.Name), append(attrs, "replicas", 0)...)
+	}
+}
@@ -0,0 +1,46 @@
+package portforward
+
+import (
+	"fmt"
+	"strings"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// DetectScheme returns "https" for ports that likely serve TLS: 443, 8443 and ports whose name
+// contains "https" or "tls". It returns "" otherwise, as such ports may not serve HTTP at all.
+func DetectScheme(port int32, name string) string {
+	name = strings.ToLower(name)
+	if port == 443 || port == 8443 || strings.Contains(name, "https") || strings.Contains(name, "tls") {
+		return "https"
+	}
+	return ""
+}
+
+// LocalAddress returns the local address of a forward: a URL when the scheme is known, e.g.
+// https://localhost:8443, or else localhost:<port>
+func LocalAddress(scheme string, localPort int32) string {
+	if scheme == "" {
+		return fmt.Sprintf("localhost:%d", localPort)
+	}
+	return fmt.Sprintf("%s://localhost:%d", scheme, localPort)
+}
+
+// portScheme returns the scheme of the port at portIndex of a resource forwarded to remotePort:
+// the scheme configured for the resource, or else the one detected from the port, its name or
+// the remote port
+func portScheme(resource model.Resource, portIndex int, remotePort int32) string {
+	if resource.Scheme != "" {
+		return resource.Scheme
+	}
+	if portIndex < len(resource.Ports) {
+		var name string
+		if portIndex < len(resource.PortNames) {
+			name = resource.PortNames[portIndex]
+		}
+		if scheme := DetectScheme(resource.Ports[portIndex], name); scheme != "" {
+			return scheme
+		}
+	}
+	return DetectScheme(remotePort, "")
+}
@@ -0,0 +1,39 @@
+package portforward
+
+import (
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// TestPortScheme verifies that TLS ports are detected from their number, their name or the
+// remote port, and that a configured scheme takes precedence.
+func TestPortScheme(t *testing.T) {
+	cases := []struct {
+		name       string
+		resource   model.Resource
+		remotePort int32
+		expected   string
+	}{
+		{"https port", model.Resource{Ports: []int32{443}}, 8080, "https"},
+		{"port named tls", model.Resource{Ports: []int32{9000}, PortNames: []string{"grpc-TLS"}}, 9000, "https"},
+		{"https target port", model.Resource{Ports: []int32{80}}, 8443, "https"},
+		{"plain port", model.Resource{Ports: []int32{5432}, PortNames: []string{"postgres"}}, 5432, ""},
+		{"configured scheme", model.Resource{Ports: []int32{9000}, Scheme: "https"}, 9000, "https"},
+		{"configured http", model.Resource{Ports: []int32{443}, Scheme: "http"}, 443, "http"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := portScheme(c.resource, 0, c.remotePort); got != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, got)
+			}
+		})
+	}
+
+	if got := LocalAddress("https", 8443); got != "https://localhost:8443" {
+		t.Errorf("unexpected address %q", got)
+	}
+	if got := LocalAddress("", 5432); got != "localhost:5432" {
+		t.Errorf("unexpected address %q", got)
+	}
+}
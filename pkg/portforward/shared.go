@@ -0,0 +1,142 @@
+package portforward
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// lastRequestID numbers the stream pairs of all tunnels. Tunnels to the same pod share one
+// connection, on which the API server tells their streams apart by request ID.
+var lastRequestID atomic.Int64
+
+// nextRequestID returns a request ID that is unique within the process
+func nextRequestID() int64 {
+	return lastRequestID.Add(1)
+}
+
+// sharedDialers hands out one dialer per pod, so the tunnels of all ports of a pod share a
+// single connection instead of each building its own round tripper and connection
+type sharedDialers struct {
+	mu      sync.Mutex
+	dialers map[string]*sharedDialer
+}
+
+// dialerFor returns the shared dialer of a pod, identified by key, creating it with dialers
+// the first time
+func (s *sharedDialers) dialerFor(key string, dialers DialerFactory, namespace, podName string) (httpstream.Dialer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.dialers[key]; ok {
+		return d, nil
+	}
+	dialer, err := dialers.DialerFor(namespace, podName)
+	if err != nil {
+		return nil, err
+	}
+	if s.dialers == nil {
+		s.dialers = make(map[string]*sharedDialer)
+	}
+	d := &sharedDialer{dialer: dialer}
+	s.dialers[key] = d
+	return d, nil
+}
+
+// sharedDialerFactory creates the shared dialers of the pods of one cluster
+type sharedDialerFactory struct {
+	shared  *sharedDialers
+	cluster string
+	dialers DialerFactory
+}
+
+func (f sharedDialerFactory) DialerFor(namespace, podName string) (httpstream.Dialer, error) {
+	return f.shared.dialerFor(f.cluster+"|"+namespace+"/"+podName, f.dialers, namespace, podName)
+}
+
+// sharedDialer dials a pod once and hands the connection to every caller of Dial until all
+// of them closed it or it was lost
+type sharedDialer struct {
+	dialer httpstream.Dialer
+
+	mu       sync.Mutex
+	conn     httpstream.Connection
+	protocol string
+	refs     int
+}
+
+// Dial returns a handle on the pod's connection, dialing it if there is none
+func (d *sharedDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.conn != nil {
+		select {
+		case <-d.conn.CloseChan():
+			d.conn = nil
+		default:
+		}
+	}
+	if d.conn == nil {
+		conn, protocol, err := d.dialer.Dial(protocols...)
+		if err != nil {
+			return nil, "", err
+		}
+		d.conn, d.protocol, d.refs = conn, protocol, 0
+	}
+	d.refs++
+	return newSharedConn(d, d.conn), d.protocol, nil
+}
+
+// release drops a reference on conn and closes it once nobody uses it anymore
+func (d *sharedDialer) release(conn httpstream.Connection) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn != conn {
+		// Already lost and replaced
+		conn.Close()
+		return
+	}
+	d.refs--
+	if d.refs == 0 {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
+
+// sharedConn is a handle on a shared connection. Closing it only closes the connection when
+// it was the last handle; its CloseChan is closed when either happened.
+type sharedConn struct {
+	httpstream.Connection
+	dialer *sharedDialer
+	once   sync.Once
+	closed chan struct{}
+	done   chan bool
+}
+
+// newSharedConn returns a handle on conn, which was dialed by dialer
+func newSharedConn(dialer *sharedDialer, conn httpstream.Connection) *sharedConn {
+	c := &sharedConn{Connection: conn, dialer: dialer, closed: make(chan struct{}), done: make(chan bool)}
+	go func() {
+		select {
+		case <-conn.CloseChan():
+		case <-c.closed:
+		}
+		close(c.done)
+	}()
+	return c
+}
+
+// Close releases the handle
+func (c *sharedConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.dialer.release(c.Connection)
+	})
+	return nil
+}
+
+// CloseChan is closed when the handle was closed or the connection was lost
+func (c *sharedConn) CloseChan() <-chan bool {
+	return c.done
+}
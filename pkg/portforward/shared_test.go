@@ -0,0 +1,101 @@
+package portforward
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// echoCountingDialer dials echo connections and counts them
+type echoCountingDialer struct {
+	dials atomic.Int32
+	last  *echoConnection
+}
+
+func (d *echoCountingDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	d.dials.Add(1)
+	d.last = &echoConnection{closed: make(chan bool)}
+	return d.last, protocols[0], nil
+}
+
+// isClosed reports whether ch is closed within a short time
+func isClosed(ch <-chan bool) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+// TestSharedDialer verifies that tunnels to a pod share one connection, which is closed with
+// the last handle and dialed again once lost.
+func TestSharedDialer(t *testing.T) {
+	base := &echoCountingDialer{}
+	d := &sharedDialer{dialer: base}
+
+	first, _, err := d.Dial("portforward.k8s.io")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _, err := d.Dial("portforward.k8s.io")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := base.dials.Load(); n != 1 {
+		t.Fatalf("expected one connection for both tunnels, got %d", n)
+	}
+	underlying := base.last
+
+	first.Close()
+	if !isClosed(first.CloseChan()) {
+		t.Error("expected the closed handle to report closure")
+	}
+	if isClosed(second.CloseChan()) || isClosed(underlying.CloseChan()) {
+		t.Fatal("expected the connection to stay open while a handle uses it")
+	}
+
+	second.Close()
+	if !isClosed(underlying.CloseChan()) {
+		t.Fatal("expected the connection to be closed with the last handle")
+	}
+
+	third, _, err := d.Dial("portforward.k8s.io")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base.last.Close()
+	if !isClosed(third.CloseChan()) {
+		t.Error("expected handles to report a lost connection")
+	}
+	if _, _, err := d.Dial("portforward.k8s.io"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := base.dials.Load(); n != 3 {
+		t.Errorf("expected a new connection after the last one closed or was lost, got %d dials", n)
+	}
+}
+
+// TestSharedDialerFactory verifies that dialers are shared per cluster and pod.
+func TestSharedDialerFactory(t *testing.T) {
+	shared := &sharedDialers{}
+	factory := &echoDialerFactory{}
+	staging := sharedDialerFactory{shared: shared, cluster: "staging", dialers: factory}
+	prod := sharedDialerFactory{shared: shared, cluster: "prod", dialers: factory}
+
+	a, _ := staging.DialerFor("ns1", "web-0")
+	b, _ := staging.DialerFor("ns1", "web-0")
+	c, _ := staging.DialerFor("ns1", "web-1")
+	d, _ := prod.DialerFor("ns1", "web-0")
+	if a != b {
+		t.Error("expected the same dialer for the same pod")
+	}
+	if a == c || a == d {
+		t.Error("expected other pods and clusters to get their own dialer")
+	}
+	if len(factory.pods) != 3 {
+		t.Errorf("expected 3 dialers to be created, got %v", factory.pods)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package portforward
+
+import (
+	"os"
+	"syscall"
+)
+
+// privilegedPortsEnforced reports whether binding ports below PrivilegedPortLimit requires
+// elevated privileges
+const privilegedPortsEnforced = true
+
+// ShutdownSignals returns the signals that end a session: Ctrl+C and SIGTERM
+func ShutdownSignals() []os.Signal {
+	return []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+}
+
+// ReloadSignals returns the signals asking a session to reload its configuration
+func ReloadSignals() []os.Signal {
+	return []os.Signal{syscall.SIGHUP}
+}
+
+// BackgroundReadSignals returns the signals that stop a process reading the terminal while it
+// runs in the background
+func BackgroundReadSignals() []os.Signal {
+	return []os.Signal{syscall.SIGTTIN}
+}
+
+// reservedPortHint explains why port cannot be bound when the platform reserves it
+func reservedPortHint(port int32) string {
+	return ""
+}
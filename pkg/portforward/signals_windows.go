@@ -0,0 +1,48 @@
+//go:build windows
+
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// privilegedPortsEnforced reports whether binding ports below PrivilegedPortLimit requires
+// elevated privileges. Windows has no privileged ports; access denied errors come from port
+// ranges reserved by Hyper-V or WinNAT instead.
+const privilegedPortsEnforced = false
+
+// ShutdownSignals returns the signals that end a session. Go delivers Ctrl+C and Ctrl+Break as
+// os.Interrupt and closing the console window, logging off or shutting down as SIGTERM, after
+// which Windows only grants a few seconds to clean up.
+func ShutdownSignals() []os.Signal {
+	return []os.Signal{os.Interrupt, syscall.SIGTERM}
+}
+
+// ReloadSignals returns the signals asking a session to reload its configuration. Windows has
+// no SIGHUP.
+func ReloadSignals() []os.Signal {
+	return nil
+}
+
+// BackgroundReadSignals returns the signals that stop a process reading the terminal while it
+// runs in the background. Windows has no job control.
+func BackgroundReadSignals() []os.Signal {
+	return nil
+}
+
+// reservedPortHint explains why port cannot be bound when Windows reserves it
+func reservedPortHint(port int32) string {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err == nil {
+		listener.Close()
+		return ""
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		return ""
+	}
+	return "reserved by Windows (see: netsh interface ipv4 show excludedportrange protocol=tcp)"
+}
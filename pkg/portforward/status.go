@@ -0,0 +1,119 @@
+package portforward
+
+import (
+	"sync"
+	"time"
+)
+
+// TunnelState is the state of a forwarder's tunnel to its pod
+type TunnelState string
+
+const (
+	// TunnelConnecting means the tunnel is being (re)established
+	TunnelConnecting TunnelState = "connecting"
+	// TunnelReady means the tunnel carries local connections
+	TunnelReady TunnelState = "ready"
+	// TunnelRetrying means the tunnel was lost and is re-established after a backoff
+	TunnelRetrying TunnelState = "retrying"
+	// TunnelFailed means the tunnel was given up after too many attempts
+	TunnelFailed TunnelState = "failed"
+	// TunnelStopped means the forwarder was stopped; it is always the last status
+	TunnelStopped TunnelState = "stopped"
+)
+
+// TunnelStatus is a state change of a forwarder's tunnel
+type TunnelStatus struct {
+	State TunnelState
+	// Attempt counts the reconnection attempts so far, 0 for the first connection
+	Attempt int
+	// Err is the error that caused a retry or the failure
+	Err  error
+	Time time.Time
+}
+
+// statusBuffer is how many status changes are kept for a slow reader before newer ones are
+// dropped
+const statusBuffer = 16
+
+// statusStream delivers the tunnel status changes of a forwarder. A nil stream discards them.
+type statusStream struct {
+	mu     sync.Mutex
+	ch     chan TunnelStatus
+	closed bool
+}
+
+// newStatusStream creates an open status stream
+func newStatusStream() *statusStream {
+	return &statusStream{ch: make(chan TunnelStatus, statusBuffer)}
+}
+
+// publish sends a status change without blocking the forwarder
+func (s *statusStream) publish(state TunnelState, attempt int, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- TunnelStatus{State: state, Attempt: attempt, Err: err, Time: time.Now()}:
+	default:
+	}
+}
+
+// close publishes TunnelStopped and ends the stream. When the buffer is full the oldest status
+// is dropped to make room, so TunnelStopped is always delivered. It is safe to call more than
+// once.
+func (s *statusStream) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	stopped := TunnelStatus{State: TunnelStopped, Time: time.Now()}
+	for {
+		select {
+		case s.ch <- stopped:
+			s.closed = true
+			close(s.ch)
+			return
+		default:
+		}
+		select {
+		case <-s.ch:
+		default:
+		}
+	}
+}
+
+// Status returns the stream of the tunnel's state changes: each (re)connection, retry and the
+// failure, ending with TunnelStopped once the forwarder stopped. Unlike ReadyChannel, which
+// is closed on the first connection only, it reports every reconnection. Changes are dropped
+// while the reader falls more than a few behind, but TunnelStopped is never. Forwarders not created by StartPortForward
+// have no stream and return nil.
+func (pf *PortForwarder) Status() <-chan TunnelStatus {
+	if pf.status == nil {
+		return nil
+	}
+	return pf.status.ch
+}
+
+// markReady records that an attempt established the tunnel. ReadyChannel is closed on the
+// first one only; later attempts are reported as reconnections.
+func (pf *PortForwarder) markReady(req ForwardRequest, attempt int) {
+	pf.markConnected(req)
+	pf.status.publish(TunnelReady, attempt, nil)
+
+	pf.locks().stop.Lock()
+	defer pf.locks().stop.Unlock()
+	select {
+	case <-pf.ReadyChannel:
+	default:
+		close(pf.ReadyChannel)
+	}
+}
@@ -0,0 +1,171 @@
+package portforward
+
+import (
+	"fmt"
+)
+
+// lifecycleKind is the kind of a lifecycleEvent
+type lifecycleKind int
+
+const (
+	// forwardReady means the forwarder accepts local connections
+	forwardReady lifecycleKind = iota
+	// forwardExited means the forwarder ended, with the error that ended it if any
+	forwardExited
+)
+
+// lifecycleEvent reports a change of a running forward to the supervision loop
+type lifecycleEvent struct {
+	entry *forwardEntry
+	kind  lifecycleKind
+	err   error
+}
+
+// startForwarder hands a started forwarder to the supervision loop, which from then on owns
+// the registry entry and the local port. Must be called with m.mutex held.
+func (m *Manager) startForwarder(entry *forwardEntry, forwarder *PortForwarder) {
+	entry.forwarder = forwarder
+	entry.state = ForwardStarting
+	m.running++
+	m.registerForward(entry.req)
+
+	m.supervisorOnce.Do(func() {
+		m.lifecycle = make(chan lifecycleEvent)
+		go m.supervise()
+	})
+	m.ForwardWait.Add(1)
+	go m.watchForwarder(entry, m.lifecycle)
+}
+
+// watchForwarder turns the channels of a forwarder into lifecycle events. It makes no state
+// changes itself; those are left to the supervision loop.
+func (m *Manager) watchForwarder(entry *forwardEntry, events chan<- lifecycleEvent) {
+	pf := entry.forwarder
+	var err error
+	select {
+	case <-pf.ReadyChannel:
+		events <- lifecycleEvent{entry: entry, kind: forwardReady}
+		// After ready, wait for an error, a stop or context done
+		err = waitForExit(pf, m.Context.Done())
+	case err = <-pf.ErrorChannel:
+	case <-pf.StopChannel:
+		err = stopError(pf)
+	case <-m.Context.Done():
+		// No need to call pf.Stop() here, manager.Stop() handles it
+	}
+	events <- lifecycleEvent{entry: entry, kind: forwardExited, err: err}
+}
+
+// waitForExit waits until the forwarder ended and returns the error that ended it, if any
+func waitForExit(pf *PortForwarder, done <-chan struct{}) error {
+	select {
+	case err := <-pf.ErrorChannel:
+		return err
+	case <-pf.StopChannel:
+		return stopError(pf)
+	case <-done:
+		// No need to call pf.Stop() here, manager.Stop() handles it
+		return nil
+	}
+}
+
+// stopError returns the error of a forwarder that stopped itself after failing, or nil when
+// it was stopped on purpose
+func stopError(pf *PortForwarder) error {
+	select {
+	case err := <-pf.ErrorChannel:
+		return err
+	default:
+		return nil
+	}
+}
+
+// supervise is the supervision loop. It handles the lifecycle events of all forwards one at a
+// time, so their state transitions never race with each other.
+func (m *Manager) supervise() {
+	for event := range m.lifecycle {
+		m.handleLifecycle(event)
+	}
+}
+
+// handleLifecycle applies a lifecycle event to the forward it belongs to. Events of forwards
+// that already exited are ignored, so a forward releases its local port only once.
+func (m *Manager) handleLifecycle(event lifecycleEvent) {
+	entry := event.entry
+	m.mutex.Lock()
+	if entry.exited {
+		m.mutex.Unlock()
+		return
+	}
+	switch event.kind {
+	case forwardReady:
+		entry.state = ForwardActive
+		statuses := entry.statuses()
+		m.mutex.Unlock()
+		m.forwardReady(entry, statuses)
+	case forwardExited:
+		entry.exited = true
+		m.mutex.Unlock()
+		if event.err != nil {
+			m.reportError(entry.req, entry.forwarder, event.err)
+		}
+		m.forwarderExited(entry)
+		m.ForwardWait.Done()
+	default:
+		m.mutex.Unlock()
+	}
+}
+
+// forwardReady announces a forward that became active, with the statuses of all its ports
+func (m *Manager) forwardReady(entry *forwardEntry, statuses []ForwardStatus) {
+	m.forwardLog(entry.req).Info(entry.forwarder.GetPortForwardString(), "event", "ready", "pod", statuses[0].PodName)
+	event := entry.req.forwardEvent(EventForwardReady, nil)
+	event.Pod = statuses[0].PodName
+	m.Events.Emit(event)
+	if m.OnReady != nil {
+		for _, status := range statuses {
+			m.OnReady(status)
+		}
+	}
+}
+
+// forwarderExited removes a finished forward from the registry, releases its local ports and
+// starts the next queued request. It is only called by the supervision loop.
+func (m *Manager) forwarderExited(entry *forwardEntry) {
+	for _, port := range entry.req.ports() {
+		m.unregisterForward(port.LocalPort)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.untrackLocked(entry)
+	m.releasePorts(entry.req)
+	m.running--
+	close(entry.done)
+
+	// Do not start queued forwards while shutting down
+	if m.stopped || m.Context.Err() != nil {
+		return
+	}
+
+	for len(m.queue) > 0 && (m.MaxForwards <= 0 || m.running < m.MaxForwards) {
+		req := m.queue[0]
+		m.queue = m.queue[1:]
+		queued := m.forwards[ForwardID(req.Resource, req.LocalPort)]
+
+		forwarder, err := StartPortForward(req)
+		if err != nil {
+			req.closeAllListeners()
+			m.untrackLocked(queued)
+			m.releasePorts(req)
+			close(queued.done)
+			m.forwardLog(req).Error(fmt.Sprintf("Error starting queued forward for %s: %v", req.Resource.Name, err),
+				"event", "error", "error", err.Error())
+			m.Events.Emit(req.forwardEvent(EventForwardFailed, err))
+			m.failures = append(m.failures, req.failure(0, err))
+			continue
+		}
+		m.startForwarder(queued, forwarder)
+	}
+}
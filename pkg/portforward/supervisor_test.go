@@ -0,0 +1,60 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/model"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+// TestManager_HandleLifecycle verifies the state transitions of a forward driven by its
+// lifecycle events, and that a forward exiting twice releases its port only once.
+func TestManager_HandleLifecycle(t *testing.T) {
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	mgr := NewManager(context.Background(), nil, nil, nil, streams)
+	var ready []ForwardStatus
+	mgr.OnReady = func(status ForwardStatus) { ready = append(ready, status) }
+
+	req := ForwardRequest{
+		Resource:   model.Resource{Name: "pod1", Namespace: "ns1", Type: model.PodResource},
+		LocalPort:  12345,
+		RemotePort: 80,
+	}
+	mgr.PortAllocator.allocatedPorts[12345] = true
+	mgr.mutex.Lock()
+	entry := mgr.track(req, ForwardStarting)
+	entry.forwarder = &PortForwarder{Resource: req.Resource, LocalPort: req.LocalPort, RemotePort: req.RemotePort}
+	mgr.running = 1
+	mgr.mutex.Unlock()
+
+	mgr.handleLifecycle(lifecycleEvent{entry: entry, kind: forwardReady})
+	if status := mgr.GetStatus(); len(status) != 1 || status[0].State != ForwardActive {
+		t.Fatalf("expected the forward to be active, got %+v", status)
+	}
+	if len(ready) != 1 {
+		t.Errorf("expected OnReady to be called once, got %d", len(ready))
+	}
+
+	// startForwarder adds the forward to ForwardWait, which its exit marks done
+	mgr.ForwardWait.Add(1)
+	mgr.handleLifecycle(lifecycleEvent{entry: entry, kind: forwardExited, err: errors.New("lost connection to pod")})
+	mgr.handleLifecycle(lifecycleEvent{entry: entry, kind: forwardExited})
+	mgr.handleLifecycle(lifecycleEvent{entry: entry, kind: forwardReady})
+	mgr.WaitForCompletion()
+
+	if len(mgr.GetStatus()) != 0 || mgr.PortAllocator.IsAllocated(12345) {
+		t.Error("expected the exited forward to be removed and its port released")
+	}
+	if mgr.running != 0 {
+		t.Errorf("expected the forward to be counted out once, got %d running", mgr.running)
+	}
+	if summary := mgr.Summary(); len(summary.Failures) != 1 {
+		t.Errorf("expected the error to be recorded once, got %+v", summary.Failures)
+	}
+	if len(ready) != 1 {
+		t.Error("expected no ready notification after the forward exited")
+	}
+}
@@ -0,0 +1,167 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+
+	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
+)
+
+// SwitchPod moves the running forward with the given ID to another ready pod backing its
+// service, deployment, statefulset or custom resource, keeping the local port, e.g. to compare
+// two replicas. Like the pod first forwarded to, it must pass the pod filter and must not be
+// terminating, evicted or crash-looping. When podName is empty the next such pod is taken.
+// It returns the name of the pod now carrying the forward. The remote port stays the same.
+func (m *Manager) SwitchPod(id, podName string) (string, error) {
+	m.mutex.Lock()
+	entry, ok := m.forwards[id]
+	var forwarder *PortForwarder
+	var req ForwardRequest
+	if ok {
+		forwarder, req = entry.forwarder, entry.req
+	}
+	m.mutex.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("no forward with ID %s", id)
+	}
+	if forwarder == nil {
+		return "", fmt.Errorf("forward %s is not running", id)
+	}
+	resource := req.Resource
+	if resource.Type == model.PodResource {
+		return "", fmt.Errorf("forward %s targets a pod and cannot switch pods", id)
+	}
+
+	pods, err := m.backingPods(resource)
+	if err != nil {
+		return "", fmt.Errorf("failed to find pods for %s %s: %w", resource.Type, resource.Name, err)
+	}
+	candidates, err := m.switchCandidates(resource, pods)
+	if err != nil {
+		return "", err
+	}
+	current := forwarder.Pod()
+	target, err := nextPod(candidates, current, podName)
+	if err != nil {
+		return "", fmt.Errorf("cannot switch %s %s: %w", resource.Type, resource.Name, err)
+	}
+	if target == current {
+		return current, nil
+	}
+
+	// Only forwards with their own tunnel can switch, and those share connections per pod
+	dialer, err := m.podDialers(resource, m.clusterFor(resource), true).DialerFor(resource.Namespace, target)
+	if err != nil {
+		return "", err
+	}
+	if err := forwarder.SwitchPod(target, dialer); err != nil {
+		return "", err
+	}
+
+	m.forwardLog(req).Info(fmt.Sprintf("Switched %s/%s port %d from pod %s to pod %s",
+		resource.Type, resource.Name, req.RemotePort, current, target), "event", "switched", "pod", target)
+	return target, nil
+}
+
+// backingPods returns the pods backing a resource, looked up in its cluster
+func (m *Manager) backingPods(resource model.Resource) ([]k8s.Pod, error) {
+	return BackingPods(m.Context, m.clusterFor(resource).K8sClient, resource)
+}
+
+// BackingPods returns the pods backing a service, deployment, statefulset or custom resource,
+// or the pod itself for pod resources. They are looked up in the namespace of the resource if
+// client is a NamespacedPodResolver, and in the namespace of client otherwise.
+func BackingPods(ctx context.Context, client PodResolver, resource model.Resource) ([]k8s.Pod, error) {
+	if namespaced, ok := client.(NamespacedPodResolver); ok {
+		return namespacedBackingPods(ctx, namespaced, resource)
+	}
+	switch resource.Type {
+	case model.ServiceResource:
+		return client.GetPodsForService(ctx, resource.Name)
+	case model.DeploymentResource:
+		return client.GetPodsForDeployment(ctx, resource.Name)
+	case model.StatefulSetResource:
+		return client.GetPodsForStatefulSet(ctx, resource.Name)
+	case model.CustomResource:
+		return client.GetPodsForCustomResource(ctx, resource.Name)
+	case model.PodResource:
+		pod, err := client.GetPod(ctx, resource.Name)
+		if err != nil {
+			return nil, err
+		}
+		return []k8s.Pod{pod}, nil
+	default:
+		return nil, fmt.Errorf("unsupported resource type: %s", resource.Type)
+	}
+}
+
+// namespacedBackingPods returns the pods backing a resource, looked up in its namespace
+func namespacedBackingPods(ctx context.Context, client NamespacedPodResolver, resource model.Resource) ([]k8s.Pod, error) {
+	switch resource.Type {
+	case model.ServiceResource:
+		return client.GetPodsForServiceInNamespace(ctx, resource.Namespace, resource.Name)
+	case model.DeploymentResource:
+		return client.GetPodsForDeploymentInNamespace(ctx, resource.Namespace, resource.Name)
+	case model.StatefulSetResource:
+		return client.GetPodsForStatefulSetInNamespace(ctx, resource.Namespace, resource.Name)
+	case model.CustomResource:
+		return client.GetPodsForCustomResourceInNamespace(ctx, resource.Namespace, resource.Name)
+	case model.PodResource:
+		pod, err := client.GetPodInNamespace(ctx, resource.Namespace, resource.Name)
+		if err != nil {
+			return nil, err
+		}
+		return []k8s.Pod{pod}, nil
+	default:
+		return nil, fmt.Errorf("unsupported resource type: %s", resource.Type)
+	}
+}
+
+// switchCandidates returns the pods of resource that selectPod could pick: those passing the
+// pod filter that are not terminating, evicted or crash-looping
+func (m *Manager) switchCandidates(resource model.Resource, pods []k8s.Pod) ([]k8s.Pod, error) {
+	filter, err := m.podFilterFor(resource)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := m.filterPods(resource, filter, pods)
+	if err != nil {
+		return nil, err
+	}
+	candidates, _ = usablePods(candidates)
+	return candidates, nil
+}
+
+// nextPod returns podName if it is one of the ready pods, or when podName is empty the first
+// ready pod after current, wrapping around
+func nextPod(pods []k8s.Pod, current, podName string) (string, error) {
+	if podName != "" {
+		for _, pod := range pods {
+			if pod.Name != podName {
+				continue
+			}
+			if !pod.Ready {
+				return "", fmt.Errorf("pod %s is not ready", podName)
+			}
+			return podName, nil
+		}
+		return "", fmt.Errorf("pod %s is not one of its usable pods", podName)
+	}
+
+	start := 0
+	for i, pod := range pods {
+		if pod.Name == current {
+			start = i + 1
+			break
+		}
+	}
+	for i := 0; i < len(pods); i++ {
+		pod := pods[(start+i)%len(pods)]
+		if pod.Ready && pod.Name != current {
+			return pod.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no other ready pod to switch to")
+}
@@ -0,0 +1,250 @@
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/portforward"
+)
+
+// tunnel proxies local connections to ports of a pod over a SPDY connection, which the
+// manager shares between the tunnels to the same pod.
+// The connection is dialed on first use and, when idleTimeout is set, closed again once
+// no local connections have been active for that long.
+type tunnel struct {
+	dialer      httpstream.Dialer
+	idleTimeout time.Duration
+	log         *slog.Logger
+	// audit, when set, receives an event per local connection
+	audit *slog.Logger
+
+	mu        sync.Mutex
+	conn      httpstream.Connection
+	active    int
+	idleTimer *time.Timer
+	// generation counts pod switches, so a dropped connection can be told from a switch
+	generation int
+}
+
+// newTunnel creates a tunnel that dials the pod through dialer
+func newTunnel(dialer httpstream.Dialer, idleTimeout time.Duration, log *slog.Logger) *tunnel {
+	return &tunnel{
+		dialer:      dialer,
+		idleTimeout: idleTimeout,
+		log:         log,
+	}
+}
+
+// acquire returns an established connection, dialing a new one if needed, and marks a
+// local connection as active
+func (t *tunnel) acquire() (httpstream.Connection, int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+		t.idleTimer = nil
+	}
+
+	conn, err := t.connectLocked()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	t.active++
+	return conn, nextRequestID(), nil
+}
+
+// connect returns an established connection, dialing a new one if needed, together with
+// the generation of the dialer it was dialed with
+func (t *tunnel) connect() (httpstream.Connection, int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conn, err := t.connectLocked()
+	return conn, t.generation, err
+}
+
+// switchDialer makes new connections go through dialer, e.g. to another pod. The current
+// connection is closed, which also ends the local connections carried by it unless other
+// tunnels still share it.
+func (t *tunnel) switchDialer(dialer httpstream.Dialer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.dialer = dialer
+	t.generation++
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// switchedSince reports whether the dialer was switched after generation
+func (t *tunnel) switchedSince(generation int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.generation != generation
+}
+
+// connectLocked implements connect; t.mu must be held
+func (t *tunnel) connectLocked() (httpstream.Connection, error) {
+	// Drop connections the API server has already closed
+	if t.conn != nil {
+		select {
+		case <-t.conn.CloseChan():
+			t.conn = nil
+		default:
+		}
+	}
+
+	if t.conn == nil {
+		conn, _, err := t.dialer.Dial(portforward.PortForwardProtocolV1Name)
+		if err != nil {
+			return nil, fmt.Errorf("error upgrading connection: %w", err)
+		}
+		t.conn = conn
+	}
+	return t.conn, nil
+}
+
+// release marks a local connection as finished and schedules an idle teardown
+func (t *tunnel) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.active--
+	if t.active > 0 || t.idleTimeout <= 0 || t.conn == nil {
+		return
+	}
+
+	conn := t.conn
+	t.idleTimer = time.AfterFunc(t.idleTimeout, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.active == 0 && t.conn == conn {
+			t.conn.Close()
+			t.conn = nil
+		}
+	})
+}
+
+// close tears down the underlying connection, if any
+func (t *tunnel) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+		t.idleTimer = nil
+	}
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// handleConnection copies data between a local connection and a new stream pair to remotePort
+// on the tunnel
+func (t *tunnel) handleConnection(local net.Conn, remotePort int32) {
+	defer local.Close()
+
+	var received, sent atomic.Int64
+	if t.audit != nil {
+		started := time.Now()
+		client := local.RemoteAddr().String()
+		t.audit.Info(fmt.Sprintf("Connection from %s opened", client), "event", "connection_opened", "client", client)
+		defer func() {
+			duration := time.Since(started).Round(time.Millisecond)
+			t.audit.Info(fmt.Sprintf("Connection from %s closed after %s", client, duration), "event", "connection_closed",
+				"client", client, "duration", duration.String(), "bytesReceived", received.Load(), "bytesSent", sent.Load())
+		}()
+	}
+
+	conn, requestID, err := t.acquire()
+	if err != nil {
+		t.log.Error(fmt.Sprintf("Failed to establish tunnel to remote port %d: %v", remotePort, err), "event", "error", "error", err.Error())
+		return
+	}
+	defer t.release()
+
+	// create error stream
+	headers := http.Header{}
+	headers.Set(v1.StreamType, v1.StreamTypeError)
+	headers.Set(v1.PortHeader, strconv.Itoa(int(remotePort)))
+	headers.Set(v1.PortForwardRequestIDHeader, strconv.FormatInt(requestID, 10))
+	errorStream, err := conn.CreateStream(headers)
+	if err != nil {
+		t.log.Error(fmt.Sprintf("Error creating error stream for remote port %d: %v", remotePort, err), "event", "error", "error", err.Error())
+		conn.Close()
+		return
+	}
+	// we're not writing to this stream
+	errorStream.Close()
+	defer conn.RemoveStreams(errorStream)
+
+	errorChan := make(chan error)
+	go func() {
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errorChan <- fmt.Errorf("error reading from error stream for remote port %d: %w", remotePort, err)
+		case len(message) > 0:
+			errorChan <- fmt.Errorf("an error occurred forwarding to remote port %d: %s", remotePort, string(message))
+		}
+		close(errorChan)
+	}()
+
+	// create data stream
+	headers.Set(v1.StreamType, v1.StreamTypeData)
+	dataStream, err := conn.CreateStream(headers)
+	if err != nil {
+		t.log.Error(fmt.Sprintf("Error creating data stream for remote port %d: %v", remotePort, err), "event", "error", "error", err.Error())
+		conn.Close()
+		return
+	}
+	defer conn.RemoveStreams(dataStream)
+
+	localError := make(chan struct{})
+	remoteDone := make(chan struct{})
+
+	go func() {
+		// Copy from the remote side to the local connection
+		n, _ := io.Copy(local, dataStream)
+		received.Add(n)
+		close(remoteDone)
+	}()
+
+	go func() {
+		// inform server we're not sending any more data after copy unblocks
+		defer dataStream.Close()
+		// Copy from the local connection to the remote side
+		n, err := io.Copy(dataStream, local)
+		sent.Add(n)
+		if err != nil {
+			// break out of the select below without waiting for the remote copy
+			close(localError)
+		}
+	}()
+
+	// wait for either a local->remote error or for copying from remote->local to finish
+	select {
+	case <-remoteDone:
+	case <-localError:
+	}
+
+	// always expect something on errorChan (it may be nil)
+	if err := <-errorChan; err != nil {
+		t.log.Error(err.Error(), "event", "error", "error", err.Error())
+	}
+}
@@ -0,0 +1,110 @@
+// Package report renders the endpoints of running sessions as Markdown or HTML snippets, so
+// "how to reach staging locally" docs can be generated from the forwards that actually run.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// Endpoint is a forwarded resource port reachable on the local machine
+type Endpoint struct {
+	// Resource is the type and name of the resource, e.g. service/web
+	Resource  string
+	Namespace string
+	// Context is the kubeconfig context of the resource, empty for the current context
+	Context    string
+	RemotePort int32
+	// URL is the local address of the forward, e.g. http://localhost:8080, or localhost:5432
+	// when the scheme of the port is unknown
+	URL   string
+	Notes string
+}
+
+// Link reports whether URL has a scheme and can be linked to
+func (e Endpoint) Link() bool {
+	return strings.Contains(e.URL, "://")
+}
+
+// spansContexts reports whether the endpoints come from several contexts, which adds a
+// context column
+func spansContexts(endpoints []Endpoint) bool {
+	for _, e := range endpoints {
+		if e.Context != endpoints[0].Context {
+			return true
+		}
+	}
+	return false
+}
+
+// Markdown renders the endpoints as a Markdown table under a title heading
+func Markdown(title string, endpoints []Endpoint) []byte {
+	withContext := spansContexts(endpoints)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "## %s\n\n", title)
+	header := []string{"Resource", "Namespace", "Remote port", "Local URL", "Notes"}
+	if withContext {
+		header = append([]string{"Context"}, header...)
+	}
+	writeRow(&b, header)
+	separators := make([]string, len(header))
+	for i := range separators {
+		separators[i] = "---"
+	}
+	writeRow(&b, separators)
+
+	for _, e := range endpoints {
+		address := "`" + e.URL + "`"
+		if e.Link() {
+			address = "<" + e.URL + ">"
+		}
+		row := []string{markdownCell(e.Resource), markdownCell(e.Namespace), fmt.Sprint(e.RemotePort), address, markdownCell(e.Notes)}
+		if withContext {
+			row = append([]string{markdownCell(e.Context)}, row...)
+		}
+		writeRow(&b, row)
+	}
+	return b.Bytes()
+}
+
+// writeRow writes a Markdown table row
+func writeRow(b *bytes.Buffer, cells []string) {
+	b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+}
+
+// markdownCell escapes text for a table cell, which cannot contain pipes or line breaks
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// htmlTemplate is an HTML fragment meant to be pasted into a larger page
+var htmlTemplate = template.Must(template.New("report").Parse(`<h2>{{.Title}}</h2>
+<table>
+  <thead>
+    <tr>{{if .WithContext}}<th>Context</th>{{end}}<th>Resource</th><th>Namespace</th><th>Remote port</th><th>Local URL</th><th>Notes</th></tr>
+  </thead>
+  <tbody>
+{{- range .Endpoints}}
+    <tr>{{if $.WithContext}}<td>{{.Context}}</td>{{end}}<td>{{.Resource}}</td><td>{{.Namespace}}</td><td>{{.RemotePort}}</td><td>{{if .Link}}<a href="{{.URL}}">{{.URL}}</a>{{else}}<code>{{.URL}}</code>{{end}}</td><td>{{.Notes}}</td></tr>
+{{- end}}
+  </tbody>
+</table>
+`))
+
+// HTML renders the endpoints as an HTML table under a title heading
+func HTML(title string, endpoints []Endpoint) ([]byte, error) {
+	var b bytes.Buffer
+	err := htmlTemplate.Execute(&b, struct {
+		Title       string
+		WithContext bool
+		Endpoints   []Endpoint
+	}{title, spansContexts(endpoints), endpoints})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMarkdown verifies the table layout, links and escaping of notes.
+func TestMarkdown(t *testing.T) {
+	endpoints := []Endpoint{
+		{Resource: "service/web", Namespace: "apps", RemotePort: 8080, URL: "http://localhost:8080", Notes: "Frontend | login with\nthe dev account"},
+		{Resource: "statefulset/postgres", Namespace: "data", RemotePort: 5432, URL: "localhost:15432"},
+	}
+	want := "## Staging\n\n" +
+		"| Resource | Namespace | Remote port | Local URL | Notes |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| service/web | apps | 8080 | <http://localhost:8080> | Frontend \\| login with the dev account |\n" +
+		"| statefulset/postgres | data | 5432 | `localhost:15432` |  |\n"
+	if got := string(Markdown("Staging", endpoints)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestMarkdown_Contexts verifies that a context column is added when endpoints come from
+// several contexts.
+func TestMarkdown_Contexts(t *testing.T) {
+	got := string(Markdown("Endpoints", []Endpoint{
+		{Resource: "service/web", Context: "prod", URL: "localhost:80"},
+		{Resource: "service/web", Context: "staging", URL: "localhost:81"},
+	}))
+	if !strings.Contains(got, "| Context | Resource |") || !strings.Contains(got, "| staging | service/web |") {
+		t.Errorf("expected a context column, got:\n%s", got)
+	}
+}
+
+// TestHTML verifies that links are only made for URLs with a scheme and that text is escaped.
+func TestHTML(t *testing.T) {
+	endpoints := []Endpoint{
+		{Resource: "service/web", Namespace: "apps", RemotePort: 8080, URL: "https://localhost:8443", Notes: "<b>new</b> UI"},
+		{Resource: "statefulset/postgres", Namespace: "data", RemotePort: 5432, URL: "localhost:15432"},
+	}
+	content, err := HTML("Staging & QA", endpoints)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := string(content)
+	for _, want := range []string{
+		"<h2>Staging &amp; QA</h2>",
+		`<a href="https://localhost:8443">https://localhost:8443</a>`,
+		"<code>localhost:15432</code>",
+		"&lt;b&gt;new&lt;/b&gt; UI",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<th>Context</th>") {
+		t.Errorf("unexpected context column in:\n%s", got)
+	}
+}
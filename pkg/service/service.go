@@ -0,0 +1,169 @@
+// Package service renders the definitions that run a kubectl-pfw session as a per-user
+// background service: systemd user units on Linux and launchd agents on macOS.
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Spec describes the service running a session
+type Spec struct {
+	// Name is the systemd unit name without suffix and the launchd label
+	Name string
+	// Description is shown by systemctl status
+	Description string
+	// Executable is the absolute path of the kubectl-pfw binary
+	Executable string
+	// Args are the arguments of the session, e.g. -f and the absolute config path
+	Args []string
+	// Env holds KEY=VALUE pairs set for the session, such as PATH for exec credential plugins
+	Env []string
+	// LogFile receives the output of launchd agents; systemd units log to the journal
+	LogFile string
+}
+
+// invalidNameChars matches characters not allowed in service names
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// DefaultName derives the service name from a configuration file path, e.g. dev.yaml becomes
+// kubectl-pfw-dev
+func DefaultName(configFile string) string {
+	base := strings.TrimSuffix(filepath.Base(configFile), filepath.Ext(configFile))
+	base = strings.Trim(invalidNameChars.ReplaceAllString(base, "-"), "-")
+	if base == "" {
+		return "kubectl-pfw"
+	}
+	return "kubectl-pfw-" + base
+}
+
+// ValidateName checks that name can be used as a unit name and launchd label
+func ValidateName(name string) error {
+	if name == "" || invalidNameChars.MatchString(name) {
+		return fmt.Errorf("invalid service name %q: use letters, digits, '-', '_' and '.'", name)
+	}
+	return nil
+}
+
+// SystemdUnitPath returns the path of the systemd user unit for name
+func SystemdUnitPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config directory: %w", err)
+	}
+	return filepath.Join(dir, "systemd", "user", name+".service"), nil
+}
+
+// LaunchdPlistPath returns the path of the launchd agent for name
+func LaunchdPlistPath(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", name+".plist"), nil
+}
+
+var systemdTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{
+	"systemdQuote": systemdQuote,
+}).Parse(`[Unit]
+Description={{ .Description }}
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{ systemdQuote .Executable }}{{ range .Args }} {{ systemdQuote . }}{{ end }}
+{{- range .Env }}
+Environment={{ systemdQuote . }}
+{{- end }}
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`))
+
+// RenderSystemdUnit returns the systemd user unit running spec
+func RenderSystemdUnit(spec Spec) (string, error) {
+	var buf bytes.Buffer
+	if err := systemdTemplate.Execute(&buf, spec); err != nil {
+		return "", fmt.Errorf("failed to render systemd unit: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// systemdQuote quotes a word of an ExecStart or Environment line, escaping the characters
+// systemd would otherwise expand
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	if s == "" || strings.ContainsAny(s, " \t'\"") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+var launchdTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml":   xmlEscape,
+	"split": func(kv string) []string { return strings.SplitN(kv, "=", 2) },
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{ xml .Name }}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{ xml .Executable }}</string>
+{{- range .Args }}
+		<string>{{ xml . }}</string>
+{{- end }}
+	</array>
+{{- if .Env }}
+	<key>EnvironmentVariables</key>
+	<dict>
+{{- range .Env }}{{ $kv := split . }}
+		<key>{{ xml (index $kv 0) }}</key>
+		<string>{{ if gt (len $kv) 1 }}{{ xml (index $kv 1) }}{{ end }}</string>
+{{- end }}
+	</dict>
+{{- end }}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>5</integer>
+{{- if .LogFile }}
+	<key>StandardOutPath</key>
+	<string>{{ xml .LogFile }}</string>
+	<key>StandardErrorPath</key>
+	<string>{{ xml .LogFile }}</string>
+{{- end }}
+</dict>
+</plist>
+`))
+
+// RenderLaunchdPlist returns the launchd agent running spec
+func RenderLaunchdPlist(spec Spec) (string, error) {
+	var buf bytes.Buffer
+	if err := launchdTemplate.Execute(&buf, spec); err != nil {
+		return "", fmt.Errorf("failed to render launchd plist: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// xmlEscape escapes s for use in XML character data
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
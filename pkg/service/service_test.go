@@ -0,0 +1,74 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDefaultName verifies that service names are derived from the config file name.
+func TestDefaultName(t *testing.T) {
+	tests := map[string]string{
+		"/home/me/dev.yaml":          "kubectl-pfw-dev",
+		"configs/shared cluster.yml": "kubectl-pfw-shared-cluster",
+		".yaml":                      "kubectl-pfw",
+	}
+	for file, want := range tests {
+		if got := DefaultName(file); got != want {
+			t.Errorf("DefaultName(%q) = %q, want %q", file, got, want)
+		}
+		if err := ValidateName(DefaultName(file)); err != nil {
+			t.Errorf("derived name should be valid: %v", err)
+		}
+	}
+	if err := ValidateName("bad/name"); err == nil {
+		t.Error("expected names with slashes to be rejected")
+	}
+}
+
+// TestRenderSystemdUnit verifies the ExecStart line, quoting and environment of the unit.
+func TestRenderSystemdUnit(t *testing.T) {
+	unit, err := RenderSystemdUnit(Spec{
+		Name:        "kubectl-pfw-dev",
+		Description: "kubectl-pfw dev",
+		Executable:  "/usr/local/bin/kubectl-pfw",
+		Args:        []string{"-f", "/home/me/my configs/dev.yaml", "--context", "100%"},
+		Env:         []string{"PATH=/usr/bin:/bin"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`ExecStart=/usr/local/bin/kubectl-pfw -f "/home/me/my configs/dev.yaml" --context 100%%` + "\n",
+		"Environment=PATH=/usr/bin:/bin\n",
+		"Restart=on-failure\n",
+		"WantedBy=default.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("expected unit to contain %q, got:\n%s", want, unit)
+		}
+	}
+}
+
+// TestRenderLaunchdPlist verifies the label, arguments, environment and log file of the agent.
+func TestRenderLaunchdPlist(t *testing.T) {
+	plist, err := RenderLaunchdPlist(Spec{
+		Name:       "kubectl-pfw-dev",
+		Executable: "/usr/local/bin/kubectl-pfw",
+		Args:       []string{"-f", "/Users/me/a&b.yaml"},
+		Env:        []string{"PATH=/usr/bin:/bin"},
+		LogFile:    "/Users/me/Library/Logs/kubectl-pfw-dev.log",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"<key>Label</key>\n\t<string>kubectl-pfw-dev</string>",
+		"<string>/Users/me/a&amp;b.yaml</string>",
+		"<key>PATH</key>\n\t\t<string>/usr/bin:/bin</string>",
+		"<key>StandardOutPath</key>\n\t<string>/Users/me/Library/Logs/kubectl-pfw-dev.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("expected plist to contain %q, got:\n%s", want, plist)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package state stores data shared between kubectl-pfw runs and processes, such as remembered
+// local ports, the running sessions and their forwards.
+package state
@@ -0,0 +1,208 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ForwardsFile is the name of the file listing forwards of all running pfw processes
+const ForwardsFile = "forwards.yaml"
+
+// ActiveForward describes a forward served by a running pfw process
+type ActiveForward struct {
+	PID        int       `yaml:"pid"`
+	LocalPort  int32     `yaml:"localPort"`
+	Context    string    `yaml:"context,omitempty"`
+	Namespace  string    `yaml:"namespace"`
+	Type       string    `yaml:"type"`
+	Name       string    `yaml:"name"`
+	RemotePort int32     `yaml:"remotePort"`
+	Started    time.Time `yaml:"started"`
+	// Pod is the pod carrying the tunnel, or empty if not known
+	Pod string `yaml:"pod,omitempty"`
+	// Retries counts the reconnection attempts of the forward so far
+	Retries int `yaml:"retries,omitempty"`
+	// LastError is the error of the most recent reconnection attempt, at LastErrorTime
+	LastError     string    `yaml:"lastError,omitempty"`
+	LastErrorTime time.Time `yaml:"lastErrorTime,omitempty"`
+	// Connected is when the tunnel was last re-established, zero if it never dropped
+	Connected time.Time `yaml:"connected,omitempty"`
+	// Scheme is the URL scheme of the remote port, e.g. https, or empty if unknown
+	Scheme string `yaml:"scheme,omitempty"`
+	// Notes describe the forwarded resource, e.g. the notes of its configuration entry
+	Notes string `yaml:"notes,omitempty"`
+	// Session is the name of the session serving the forward, or empty if it is unnamed
+	Session string `yaml:"session,omitempty"`
+}
+
+// Uptime returns how long the tunnel of the forward has been up at now: since it was last
+// re-established, or since it started
+func (f ActiveForward) Uptime(now time.Time) time.Duration {
+	if f.Connected.After(f.Started) {
+		return now.Sub(f.Connected)
+	}
+	return now.Sub(f.Started)
+}
+
+// String returns a human readable description of the forward
+func (f ActiveForward) String() string {
+	return fmt.Sprintf("%s %s/%s port %d on localhost:%d (pid %d)", f.Type, f.Namespace, f.Name, f.RemotePort, f.LocalPort, f.PID)
+}
+
+// forwardsFile is the on-disk layout of the forwards file
+type forwardsFile struct {
+	Forwards []ActiveForward `yaml:"forwards"`
+}
+
+// ForwardRegistry records active forwards in a state file shared by all pfw processes, so
+// one process can tell which local ports another one is using
+type ForwardRegistry struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewForwardRegistry returns a registry backed by the file at path
+func NewForwardRegistry(path string) *ForwardRegistry {
+	return &ForwardRegistry{path: path}
+}
+
+// Register adds a forward served by the current process
+func (r *ForwardRegistry) Register(f ActiveForward) error {
+	if f.PID == 0 {
+		f.PID = os.Getpid()
+	}
+	if f.Started.IsZero() {
+		f.Started = time.Now()
+	}
+
+	return r.update(func(forwards []ActiveForward) []ActiveForward {
+		// Replace a previous entry for the same local port of this process
+		forwards = removeForwards(forwards, func(existing ActiveForward) bool {
+			return existing.PID == f.PID && existing.LocalPort == f.LocalPort
+		})
+		return append(forwards, f)
+	})
+}
+
+// RecordRetry counts a reconnection attempt of the current process's forward on localPort
+// that failed with errMsg
+func (r *ForwardRegistry) RecordRetry(localPort int32, errMsg string) error {
+	pid := os.Getpid()
+	return r.update(func(forwards []ActiveForward) []ActiveForward {
+		for i := range forwards {
+			if forwards[i].PID == pid && forwards[i].LocalPort == localPort {
+				forwards[i].Retries++
+				forwards[i].LastError = errMsg
+				forwards[i].LastErrorTime = time.Now()
+			}
+		}
+		return forwards
+	})
+}
+
+// RecordConnected records that the tunnel of the current process's forward on localPort was
+// re-established now
+func (r *ForwardRegistry) RecordConnected(localPort int32) error {
+	pid := os.Getpid()
+	return r.update(func(forwards []ActiveForward) []ActiveForward {
+		for i := range forwards {
+			if forwards[i].PID == pid && forwards[i].LocalPort == localPort {
+				forwards[i].Connected = time.Now()
+			}
+		}
+		return forwards
+	})
+}
+
+// RecordPod records that the current process's forward on localPort is now carried by pod
+func (r *ForwardRegistry) RecordPod(localPort int32, pod string) error {
+	pid := os.Getpid()
+	return r.update(func(forwards []ActiveForward) []ActiveForward {
+		for i := range forwards {
+			if forwards[i].PID == pid && forwards[i].LocalPort == localPort {
+				forwards[i].Pod = pod
+			}
+		}
+		return forwards
+	})
+}
+
+// Unregister removes the current process's forward on localPort
+func (r *ForwardRegistry) Unregister(localPort int32) error {
+	pid := os.Getpid()
+	return r.update(func(forwards []ActiveForward) []ActiveForward {
+		return removeForwards(forwards, func(existing ActiveForward) bool {
+			return existing.PID == pid && existing.LocalPort == localPort
+		})
+	})
+}
+
+// UnregisterAll removes every forward of the current process
+func (r *ForwardRegistry) UnregisterAll() error {
+	pid := os.Getpid()
+	return r.update(func(forwards []ActiveForward) []ActiveForward {
+		return removeForwards(forwards, func(existing ActiveForward) bool {
+			return existing.PID == pid
+		})
+	})
+}
+
+// List returns the forwards of all running pfw processes. Entries of processes that are no
+// longer running are skipped.
+func (r *ForwardRegistry) List() ([]ActiveForward, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var file forwardsFile
+	if err := readYAML(r.path, &file); err != nil {
+		return nil, err
+	}
+	return removeForwards(file.Forwards, isStale), nil
+}
+
+// Lookup returns the forward of another running pfw process that uses localPort
+func (r *ForwardRegistry) Lookup(localPort int32) (*ActiveForward, error) {
+	forwards, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range forwards {
+		if forwards[i].LocalPort == localPort && forwards[i].PID != os.Getpid() {
+			return &forwards[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// update applies fn to the stored forwards under the file lock, pruning stale entries
+func (r *ForwardRegistry) update(fn func([]ActiveForward) []ActiveForward) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return withLock(r.path, func() error {
+		var file forwardsFile
+		if err := readYAML(r.path, &file); err != nil {
+			return err
+		}
+		file.Forwards = fn(removeForwards(file.Forwards, isStale))
+		return writeYAML(r.path, &file)
+	})
+}
+
+// isStale reports whether a forward belongs to a process that is no longer running
+func isStale(f ActiveForward) bool {
+	return !ProcessAlive(f.PID)
+}
+
+// removeForwards returns the forwards for which drop returns false
+func removeForwards(forwards []ActiveForward, drop func(ActiveForward) bool) []ActiveForward {
+	kept := make([]ActiveForward, 0, len(forwards))
+	for _, f := range forwards {
+		if !drop(f) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,80 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestForwardRegistry_RegisterAndLookup verifies registration, lookup, retry, reconnection and
+// pod tracking and removal of forwards.
+func TestForwardRegistry_RegisterAndLookup(t *testing.T) {
+	registry := NewForwardRegistry(filepath.Join(t.TempDir(), ForwardsFile))
+
+	if err := registry.Register(ActiveForward{LocalPort: 8080, Namespace: "default", Type: "service", Name: "web", RemotePort: 80}); err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+
+	forwards, err := registry.List()
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(forwards) != 1 || forwards[0].PID != os.Getpid() {
+		t.Fatalf("expected one forward owned by this process, got %+v", forwards)
+	}
+
+	// Lookup ignores forwards of the current process
+	if owner, err := registry.Lookup(8080); err != nil || owner != nil {
+		t.Errorf("expected no foreign owner, got %+v (err=%v)", owner, err)
+	}
+
+	if err := registry.RecordRetry(8080, "lost connection to pod"); err != nil {
+		t.Fatalf("unexpected error recording a retry: %v", err)
+	}
+	registry.RecordRetry(8080, "connection refused")
+	forwards, _ = registry.List()
+	if forwards[0].Retries != 2 || forwards[0].LastError != "connection refused" || forwards[0].LastErrorTime.IsZero() {
+		t.Errorf("expected 2 retries with the last error, got %+v", forwards[0])
+	}
+
+	if err := registry.RecordConnected(8080); err != nil {
+		t.Fatalf("unexpected error recording a reconnection: %v", err)
+	}
+	forwards, _ = registry.List()
+	if now := time.Now(); forwards[0].Connected.IsZero() || forwards[0].Uptime(now) != now.Sub(forwards[0].Connected) {
+		t.Errorf("expected the uptime to count from the reconnection, got %+v", forwards[0])
+	}
+
+	if err := registry.RecordPod(8080, "web-2"); err != nil {
+		t.Fatalf("unexpected error recording the pod: %v", err)
+	}
+	forwards, _ = registry.List()
+	if forwards[0].Pod != "web-2" {
+		t.Errorf("expected the forward to be carried by pod web-2, got %q", forwards[0].Pod)
+	}
+
+	if err := registry.Unregister(8080); err != nil {
+		t.Fatalf("unexpected error unregistering: %v", err)
+	}
+	if forwards, _ := registry.List(); len(forwards) != 0 {
+		t.Errorf("expected no forwards after unregister, got %d", len(forwards))
+	}
+}
+
+// TestForwardRegistry_PrunesDeadProcesses verifies that entries of exited processes are ignored.
+func TestForwardRegistry_PrunesDeadProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ForwardsFile)
+	stale := forwardsFile{Forwards: []ActiveForward{{PID: 1 << 22, LocalPort: 9090}}}
+	if err := writeYAML(path, &stale); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+
+	forwards, err := NewForwardRegistry(path).List()
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(forwards) != 0 {
+		t.Errorf("expected stale forward to be pruned, got %+v", forwards)
+	}
+}
@@ -0,0 +1,93 @@
+package state
+
+import (
+	"sync"
+	"time"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+)
+
+// HistoryFile is the name of the file storing previous selections
+const HistoryFile = "history.yaml"
+
+// History remembers the resources and ports selected in previous sessions, per context,
+// namespace and selection mode, which selection was made last and when each resource was
+// last forwarded
+type History struct {
+	path       string
+	Selections map[string]*config.ForwardingConfig `yaml:"selections"`
+	Last       string                              `yaml:"last,omitempty"`
+	// Used holds the time each resource was last forwarded, keyed by ResourceKey
+	Used map[string]time.Time `yaml:"used,omitempty"`
+	mu   sync.Mutex
+}
+
+// HistoryKey identifies the selections made in a context and namespace in a mode such as
+// services or pods
+func HistoryKey(contextName, namespace, mode string) string {
+	return contextName + "/" + namespace + "/" + mode
+}
+
+// ResourceKey identifies a resource of a type such as service in a context and namespace
+func ResourceKey(contextName, namespace, resourceType, name string) string {
+	return contextName + "/" + namespace + "/" + resourceType + "/" + name
+}
+
+// LoadHistory reads the selection history stored at path. A missing file yields an empty history.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+	if err := readYAML(path, h); err != nil {
+		return nil, err
+	}
+	if h.Selections == nil {
+		h.Selections = make(map[string]*config.ForwardingConfig)
+	}
+	if h.Used == nil {
+		h.Used = make(map[string]time.Time)
+	}
+	return h, nil
+}
+
+// Get returns the selection remembered for key, or nil
+func (h *History) Get(key string) *config.ForwardingConfig {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.Selections[key]
+}
+
+// LastSelection returns the most recently recorded selection, or nil
+func (h *History) LastSelection() *config.ForwardingConfig {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.Selections[h.Last]
+}
+
+// LastUsed returns when the resource identified by ResourceKey was last forwarded, or the zero
+// time if it never was
+func (h *History) LastUsed(resourceKey string) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.Used[resourceKey]
+}
+
+// Record remembers the selection for key as the most recent one, marks its resources as used
+// now and writes the file
+func (h *History) Record(key string, selection *config.ForwardingConfig) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.Selections[key] = selection
+	h.Last = key
+	now := time.Now()
+	for _, entry := range selection.Resources {
+		namespace := entry.Namespace
+		if namespace == "" {
+			namespace = selection.DefaultNamespace
+		}
+		h.Used[ResourceKey(selection.Context, namespace, entry.ResourceType, entry.Name)] = now
+	}
+	return writeYAML(h.path, h)
+}
@@ -0,0 +1,88 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+)
+
+// TestHistory_RoundTrip verifies that selections and the last selection survive a reload.
+func TestHistory_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFile)
+
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading missing file: %v", err)
+	}
+	if h.LastSelection() != nil {
+		t.Fatal("expected no last selection in a fresh history")
+	}
+
+	services := &config.ForwardingConfig{
+		Context:          "dev",
+		DefaultNamespace: "apps",
+		Resources: []config.PortForwardEntry{
+			{ResourceType: "service", Name: "web", Ports: []config.PortMapping{{LocalPort: 8080, RemotePort: 80}}},
+		},
+	}
+	pods := &config.ForwardingConfig{
+		Context:          "dev",
+		DefaultNamespace: "apps",
+		Resources:        []config.PortForwardEntry{{ResourceType: "pod", Name: "db-0"}},
+	}
+	if err := h.Record(HistoryKey("dev", "apps", "services"), services); err != nil {
+		t.Fatalf("unexpected error recording: %v", err)
+	}
+	if err := h.Record(HistoryKey("dev", "apps", "pods"), pods); err != nil {
+		t.Fatalf("unexpected error recording: %v", err)
+	}
+
+	reloaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	got := reloaded.Get(HistoryKey("dev", "apps", "services"))
+	if got == nil || len(got.Resources) != 1 || got.Resources[0].Ports[0].LocalPort != 8080 {
+		t.Errorf("expected the services selection to be remembered, got %+v", got)
+	}
+	last := reloaded.LastSelection()
+	if last == nil || last.Resources[0].Name != "db-0" {
+		t.Errorf("expected the pods selection to be last, got %+v", last)
+	}
+}
+
+// TestHistory_LastUsed verifies that recording a selection stamps each of its resources.
+func TestHistory_LastUsed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFile)
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	selection := &config.ForwardingConfig{
+		Context:          "dev",
+		DefaultNamespace: "apps",
+		Resources: []config.PortForwardEntry{
+			{ResourceType: "service", Name: "web"},
+			{ResourceType: "pod", Name: "db-0", Namespace: "data"},
+		},
+	}
+	if err := h.Record(HistoryKey("dev", "apps", "services"), selection); err != nil {
+		t.Fatalf("unexpected error recording: %v", err)
+	}
+
+	reloaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	if reloaded.LastUsed(ResourceKey("dev", "apps", "service", "web")).IsZero() {
+		t.Error("expected web to be marked as used in the default namespace")
+	}
+	if reloaded.LastUsed(ResourceKey("dev", "data", "pod", "db-0")).IsZero() {
+		t.Error("expected db-0 to be marked as used in its own namespace")
+	}
+	if !reloaded.LastUsed(ResourceKey("prod", "apps", "service", "web")).IsZero() {
+		t.Error("expected no use of web in another context")
+	}
+}
@@ -0,0 +1,51 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// lockTimeout bounds how long a process waits for another one to finish updating a state file
+	lockTimeout = 2 * time.Second
+	// staleLockAge is the age after which a lock file is assumed to be left over from a crash
+	staleLockAge = 10 * time.Second
+)
+
+// withLock runs fn while holding an exclusive lock file next to path, so concurrent pfw
+// processes don't lose each other's updates
+func withLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("failed to lock state file %s: %w", path, err)
+		}
+
+		// Break locks left behind by a process that died while holding them
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for lock on state file %s", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer os.Remove(lockPath)
+
+	return fn()
+}
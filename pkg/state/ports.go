@@ -0,0 +1,76 @@
+package state
+
+import (
+	"sync"
+)
+
+// PortAssignmentsFile is the name of the file storing local port assignments
+const PortAssignmentsFile = "ports.yaml"
+
+// PortAssignments remembers which local port each forwarded resource port used, so the same
+// port can be reused on the next run, and which local port the user chose for it in prompts,
+// so it is offered again
+type PortAssignments struct {
+	path        string
+	Assignments map[string]int32 `yaml:"assignments"`
+	Chosen      map[string]int32 `yaml:"chosen,omitempty"`
+	mu          sync.Mutex
+}
+
+// LoadPortAssignments reads the port assignments stored at path. A missing file yields an
+// empty set of assignments.
+func LoadPortAssignments(path string) (*PortAssignments, error) {
+	pa := &PortAssignments{path: path}
+	if err := readYAML(path, pa); err != nil {
+		return nil, err
+	}
+	if pa.Assignments == nil {
+		pa.Assignments = make(map[string]int32)
+	}
+	if pa.Chosen == nil {
+		pa.Chosen = make(map[string]int32)
+	}
+	return pa, nil
+}
+
+// Get returns the remembered local port for key
+func (pa *PortAssignments) Get(key string) (int32, bool) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	port, ok := pa.Assignments[key]
+	return port, ok
+}
+
+// Set records the local port used for key and writes the file if it changed
+func (pa *PortAssignments) Set(key string, port int32) error {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	if current, ok := pa.Assignments[key]; ok && current == port {
+		return nil
+	}
+	pa.Assignments[key] = port
+	return writeYAML(pa.path, pa)
+}
+
+// GetChosen returns the local port last chosen in a prompt for key
+func (pa *PortAssignments) GetChosen(key string) (int32, bool) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	port, ok := pa.Chosen[key]
+	return port, ok
+}
+
+// SetChosen records the local port chosen in a prompt for key and writes the file if it changed
+func (pa *PortAssignments) SetChosen(key string, port int32) error {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	if current, ok := pa.Chosen[key]; ok && current == port {
+		return nil
+	}
+	pa.Chosen[key] = port
+	return writeYAML(pa.path, pa)
+}
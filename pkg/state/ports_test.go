@@ -0,0 +1,56 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestPortAssignments_RoundTrip verifies that assignments survive a reload from disk.
+func TestPortAssignments_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", PortAssignmentsFile)
+
+	pa, err := LoadPortAssignments(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading missing file: %v", err)
+	}
+	if _, ok := pa.Get("ctx/default/service/web/80"); ok {
+		t.Fatal("expected no assignment in a fresh file")
+	}
+
+	if err := pa.Set("ctx/default/service/web/80", 20080); err != nil {
+		t.Fatalf("unexpected error saving assignment: %v", err)
+	}
+
+	reloaded, err := LoadPortAssignments(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	port, ok := reloaded.Get("ctx/default/service/web/80")
+	if !ok || port != 20080 {
+		t.Errorf("expected remembered port 20080, got %d (found=%v)", port, ok)
+	}
+}
+
+// TestPortAssignments_Chosen verifies that ports chosen in prompts are kept apart from
+// automatic assignments and survive a reload.
+func TestPortAssignments_Chosen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), PortAssignmentsFile)
+	pa, err := LoadPortAssignments(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading missing file: %v", err)
+	}
+	if err := pa.SetChosen("ctx/default/service/web/8080", 9090); err != nil {
+		t.Fatalf("unexpected error saving choice: %v", err)
+	}
+	if _, ok := pa.Get("ctx/default/service/web/8080"); ok {
+		t.Error("expected a choice not to count as an automatic assignment")
+	}
+
+	reloaded, err := LoadPortAssignments(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	if port, ok := reloaded.GetChosen("ctx/default/service/web/8080"); !ok || port != 9090 {
+		t.Errorf("expected chosen port 9090, got %d (found=%v)", port, ok)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package state
+
+import (
+	"os"
+)
+
+// ProcessAlive reports whether a process with the given PID is still running
+func ProcessAlive(pid int) bool {
+	// On Windows FindProcess opens a handle and fails for processes that have exited
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
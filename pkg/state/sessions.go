@@ -0,0 +1,148 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SessionsFile is the name of the file listing the running pfw sessions
+const SessionsFile = "sessions.yaml"
+
+// ErrSessionNameTaken is returned when registering a session under the name of another
+// running session
+var ErrSessionNameTaken = errors.New("session name is taken")
+
+// Session describes a running pfw process
+type Session struct {
+	PID int `yaml:"pid"`
+	// Name is the name given with --session, or empty for unnamed sessions
+	Name string `yaml:"name,omitempty"`
+	// ControlAddr is the address of the session's control API, or empty if it serves none
+	ControlAddr string `yaml:"controlAddr,omitempty"`
+	// ConfigFile is the absolute path of the configuration file the session serves, if any
+	ConfigFile string `yaml:"configFile,omitempty"`
+	// Forced is set for sessions started with --force although another session served the
+	// same configuration file
+	Forced  bool      `yaml:"forced,omitempty"`
+	Started time.Time `yaml:"started"`
+}
+
+// DuplicateSessionError is returned when registering a session for a configuration file that
+// another running session serves already
+type DuplicateSessionError struct {
+	// Existing is the running session serving the file
+	Existing Session
+}
+
+func (e *DuplicateSessionError) Error() string {
+	return fmt.Sprintf("%s is already served by pfw process %d", e.Existing.ConfigFile, e.Existing.PID)
+}
+
+// sessionsFile is the on-disk layout of the sessions file
+type sessionsFile struct {
+	Sessions []Session `yaml:"sessions"`
+}
+
+// SessionRegistry records the running sessions in a state file shared by all pfw processes,
+// so commands like pfw stop can find the control API of another process
+type SessionRegistry struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewSessionRegistry returns a registry backed by the file at path
+func NewSessionRegistry(path string) *SessionRegistry {
+	return &SessionRegistry{path: path}
+}
+
+// Register records the session of the current process, replacing an earlier record of it. A
+// named session fails with ErrSessionNameTaken if another running session has the same name,
+// and unless Forced is set, a session serving a configuration file fails with a
+// *DuplicateSessionError if another running session serves the same file.
+func (r *SessionRegistry) Register(s Session) error {
+	if s.PID == 0 {
+		s.PID = os.Getpid()
+	}
+	if s.Started.IsZero() {
+		s.Started = time.Now()
+	}
+
+	return r.update(func(sessions []Session) ([]Session, error) {
+		for _, existing := range sessions {
+			if existing.PID == s.PID {
+				continue
+			}
+			if s.Name != "" && existing.Name == s.Name {
+				return nil, fmt.Errorf("%w: session %s is already running (pid %d)", ErrSessionNameTaken, s.Name, existing.PID)
+			}
+			if s.ConfigFile != "" && existing.ConfigFile == s.ConfigFile && !s.Forced {
+				return nil, &DuplicateSessionError{Existing: existing}
+			}
+		}
+		return append(removeSessions(sessions, func(existing Session) bool {
+			return existing.PID == s.PID
+		}), s), nil
+	})
+}
+
+// Unregister removes the session of the current process
+func (r *SessionRegistry) Unregister() error {
+	pid := os.Getpid()
+	return r.update(func(sessions []Session) ([]Session, error) {
+		return removeSessions(sessions, func(existing Session) bool {
+			return existing.PID == pid
+		}), nil
+	})
+}
+
+// List returns the running sessions. Sessions of processes that are no longer running are
+// skipped.
+func (r *SessionRegistry) List() ([]Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var file sessionsFile
+	if err := readYAML(r.path, &file); err != nil {
+		return nil, err
+	}
+	return removeSessions(file.Sessions, isStaleSession), nil
+}
+
+// update applies fn to the stored sessions under the file lock, pruning stale entries. The
+// file is left unchanged when fn fails.
+func (r *SessionRegistry) update(fn func([]Session) ([]Session, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return withLock(r.path, func() error {
+		var file sessionsFile
+		if err := readYAML(r.path, &file); err != nil {
+			return err
+		}
+		sessions, err := fn(removeSessions(file.Sessions, isStaleSession))
+		if err != nil {
+			return err
+		}
+		file.Sessions = sessions
+		return writeYAML(r.path, &file)
+	})
+}
+
+// isStaleSession reports whether a session belongs to a process that is no longer running
+func isStaleSession(s Session) bool {
+	return !ProcessAlive(s.PID)
+}
+
+// removeSessions returns the sessions for which drop returns false
+func removeSessions(sessions []Session, drop func(Session) bool) []Session {
+	kept := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		if !drop(s) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
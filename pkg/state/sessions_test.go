@@ -0,0 +1,78 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSessionRegistry verifies registration, replacement, pruning and removal of sessions.
+func TestSessionRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SessionsFile)
+	stale := sessionsFile{Sessions: []Session{{PID: 1 << 22, ControlAddr: "127.0.0.1:7000"}}}
+	if err := writeYAML(path, &stale); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	registry := NewSessionRegistry(path)
+
+	if err := registry.Register(Session{}); err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+	if err := registry.Register(Session{ControlAddr: "127.0.0.1:7777"}); err != nil {
+		t.Fatalf("unexpected error registering again: %v", err)
+	}
+
+	sessions, err := registry.List()
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].PID != os.Getpid() || sessions[0].ControlAddr != "127.0.0.1:7777" || sessions[0].Started.IsZero() {
+		t.Fatalf("expected only the latest session of this process, got %+v", sessions)
+	}
+
+	if err := registry.Unregister(); err != nil {
+		t.Fatalf("unexpected error unregistering: %v", err)
+	}
+	if sessions, _ := registry.List(); len(sessions) != 0 {
+		t.Errorf("expected no sessions after unregister, got %+v", sessions)
+	}
+}
+
+// TestSessionRegistry_NameTaken verifies that a name can only be used by one running session.
+func TestSessionRegistry_NameTaken(t *testing.T) {
+	registry := NewSessionRegistry(filepath.Join(t.TempDir(), SessionsFile))
+	// The parent process stands in for another running session
+	if err := registry.Register(Session{PID: os.Getppid(), Name: "payments-debug"}); err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+
+	err := registry.Register(Session{Name: "payments-debug"})
+	if !errors.Is(err, ErrSessionNameTaken) {
+		t.Fatalf("expected the name to be taken, got %v", err)
+	}
+	if err := registry.Register(Session{Name: "orders"}); err != nil {
+		t.Fatalf("unexpected error registering another name: %v", err)
+	}
+	if sessions, _ := registry.List(); len(sessions) != 2 {
+		t.Errorf("expected both sessions to be listed, got %+v", sessions)
+	}
+}
+
+// TestSessionRegistry_DuplicateConfig verifies that a configuration file is only served by one
+// running session unless the next one is forced.
+func TestSessionRegistry_DuplicateConfig(t *testing.T) {
+	registry := NewSessionRegistry(filepath.Join(t.TempDir(), SessionsFile))
+	if err := registry.Register(Session{PID: os.Getppid(), ConfigFile: "/work/dev.yaml"}); err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+
+	var duplicate *DuplicateSessionError
+	err := registry.Register(Session{ConfigFile: "/work/dev.yaml"})
+	if !errors.As(err, &duplicate) || duplicate.Existing.PID != os.Getppid() {
+		t.Fatalf("expected the file to be served by the parent process, got %v", err)
+	}
+	if err := registry.Register(Session{ConfigFile: "/work/dev.yaml", Forced: true}); err != nil {
+		t.Fatalf("unexpected error registering a forced session: %v", err)
+	}
+}
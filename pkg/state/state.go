@@ -0,0 +1,68 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"roeyazroel/kubectl-pfw/pkg/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Path returns the location of a named state file inside the kubectl-pfw config directory
+func Path(name string) (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// readYAML decodes a YAML state file into out. A missing file leaves out untouched.
+func readYAML(path string, out interface{}) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeYAML atomically replaces a YAML state file with the encoding of in
+func writeYAML(path string, in interface{}) error {
+	content, err := yaml.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// Write to a temporary file first so concurrent readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file %s: %w", path, err)
+	}
+	return nil
+}
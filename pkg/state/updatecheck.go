@@ -0,0 +1,38 @@
+package state
+
+import (
+	"time"
+)
+
+// UpdateCheckFile is the name of the file remembering the last check for new releases
+const UpdateCheckFile = "update-check.yaml"
+
+// UpdateCheck remembers when the latest release was last looked up and what it was, so
+// sessions check for new releases at most once per interval
+type UpdateCheck struct {
+	path      string
+	CheckedAt time.Time `yaml:"checkedAt"`
+	Latest    string    `yaml:"latest,omitempty"`
+}
+
+// LoadUpdateCheck reads the update check stored at path. A missing file yields a check that
+// is due.
+func LoadUpdateCheck(path string) (*UpdateCheck, error) {
+	uc := &UpdateCheck{path: path}
+	if err := readYAML(path, uc); err != nil {
+		return nil, err
+	}
+	return uc, nil
+}
+
+// Due reports whether the last check is older than interval
+func (uc *UpdateCheck) Due(now time.Time, interval time.Duration) bool {
+	return now.Sub(uc.CheckedAt) >= interval
+}
+
+// Record stores the latest release found at now
+func (uc *UpdateCheck) Record(now time.Time, latest string) error {
+	uc.CheckedAt = now
+	uc.Latest = latest
+	return writeYAML(uc.path, uc)
+}
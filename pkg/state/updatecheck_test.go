@@ -0,0 +1,38 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestUpdateCheck_Due verifies that checks are rate-limited across reloads.
+func TestUpdateCheck_Due(t *testing.T) {
+	path := filepath.Join(t.TempDir(), UpdateCheckFile)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	uc, err := LoadUpdateCheck(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading missing file: %v", err)
+	}
+	if !uc.Due(now, 24*time.Hour) {
+		t.Fatal("expected a check to be due without a previous check")
+	}
+	if err := uc.Record(now, "v1.4.0"); err != nil {
+		t.Fatalf("unexpected error recording check: %v", err)
+	}
+
+	reloaded, err := LoadUpdateCheck(path)
+	if err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	if reloaded.Latest != "v1.4.0" {
+		t.Errorf("expected latest v1.4.0, got %q", reloaded.Latest)
+	}
+	if reloaded.Due(now.Add(time.Hour), 24*time.Hour) {
+		t.Error("expected no check to be due an hour later")
+	}
+	if !reloaded.Due(now.Add(25*time.Hour), 24*time.Hour) {
+		t.Error("expected a check to be due a day later")
+	}
+}
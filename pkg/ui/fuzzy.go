@@ -0,0 +1,39 @@
+package ui
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// FuzzyMatch reports whether query matches text, ignoring case, and scores the match so better
+// matches sort first. Substrings score higher than scattered characters, matches at the start of
+// text higher than later ones, and closer characters higher than spread out ones. An empty query
+// matches everything.
+func FuzzyMatch(query, text string) (int, bool) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	text = strings.ToLower(text)
+	if query == "" {
+		return 0, true
+	}
+
+	if idx := strings.Index(text, query); idx >= 0 {
+		score := 1000 - idx - (len(text) - len(query))
+		if idx == 0 {
+			score += 500
+		}
+		return score, true
+	}
+
+	// Every query character must appear in order; gaps between them lower the score
+	score := 500
+	pos := 0
+	for _, r := range query {
+		idx := strings.IndexRune(text[pos:], r)
+		if idx < 0 {
+			return 0, false
+		}
+		score -= idx
+		pos += idx + utf8.RuneLen(r)
+	}
+	return score - (len(text) - pos), true
+}
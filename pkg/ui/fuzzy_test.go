@@ -0,0 +1,39 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFuzzyMatch tests which texts match a query.
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		want  bool
+	}{
+		{"", "anything", true},
+		{"api", "payments-api", true},
+		{"API", "payments-api", true},
+		{"pmtapi", "payments-api", true},
+		{"ipa", "payments-api", false},
+		{"web", "worker", false},
+	}
+	for _, tt := range tests {
+		_, ok := FuzzyMatch(tt.query, tt.text)
+		assert.Equal(t, tt.want, ok, "FuzzyMatch(%q, %q)", tt.query, tt.text)
+	}
+}
+
+// TestFuzzyMatch_Ranking tests that prefixes beat substrings and substrings beat scattered matches.
+func TestFuzzyMatch_Ranking(t *testing.T) {
+	prefix, _ := FuzzyMatch("api", "api-gateway")
+	substring, _ := FuzzyMatch("api", "payments-api")
+	scattered, _ := FuzzyMatch("api", "a-profile-importer")
+	assert.Greater(t, prefix, substring)
+	assert.Greater(t, substring, scattered)
+
+	exact, _ := FuzzyMatch("api", "api")
+	assert.Greater(t, exact, prefix)
+}
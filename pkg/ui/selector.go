@@ -2,124 +2,96 @@ package ui
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 
 	"roeyazroel/kubectl-pfw/pkg/k8s"
+	"roeyazroel/kubectl-pfw/pkg/model"
 
 	"github.com/AlecAivazis/survey/v2"
-	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // ResourceType represents the type of Kubernetes resource
-type ResourceType string
+type ResourceType = model.ResourceType
 
 const (
 	// ServiceResource represents a Kubernetes service
-	ServiceResource ResourceType = "service"
+	ServiceResource = model.ServiceResource
 	// PodResource represents a Kubernetes pod
-	PodResource ResourceType = "pod"
+	PodResource = model.PodResource
 	// DeploymentResource represents a Kubernetes deployment
-	DeploymentResource ResourceType = "deployment"
+	DeploymentResource = model.DeploymentResource
 	// StatefulSetResource represents a Kubernetes statefulset
-	StatefulSetResource ResourceType = "statefulset"
+	StatefulSetResource = model.StatefulSetResource
+	// CustomResource represents a resource of an arbitrary kind listed with --resource
+	CustomResource = model.CustomResource
 )
 
 // Resource represents a Kubernetes resource that can be port-forwarded
-type Resource struct {
-	Name            string
-	Namespace       string
-	Type            ResourceType
-	Ports           []int32               // ServicePort or ContainerPort
-	PortNames       []string              // Name of the port (if specified)
-	TargetPortSpecs []*intstr.IntOrString // For services, the original targetPort spec
-	DisplayName     string
-	PortMetadata    []k8s.PortMetadata // Additional metadata about ports (like init container info)
-}
+type Resource = model.Resource
 
 var askOne = survey.AskOne
 
-// NewResourceFromService creates a Resource from a k8s.Service
-func NewResourceFromService(svc k8s.Service) Resource {
-	ports := make([]int32, len(svc.Ports))
-	portNames := make([]string, len(svc.Ports))
-	targetPortSpecs := make([]*intstr.IntOrString, len(svc.Ports))
-
-	for i, port := range svc.Ports {
-		ports[i] = port.Port
-		portNames[i] = port.Name
-		targetPortSpecs[i] = port.TargetPortSpec
+// PromptOnStderr draws all following prompts on stderr instead of stdout, keeping stdout free
+// for output that is piped into other tools
+func PromptOnStderr() {
+	ask := askOne
+	askOne = func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		return ask(prompt, response, append(opts, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr))...)
 	}
+}
 
-	return Resource{
-		Name:            svc.Name,
-		Namespace:       svc.Namespace,
-		Type:            ServiceResource,
-		Ports:           ports,
-		PortNames:       portNames,
-		TargetPortSpecs: targetPortSpecs,
-		DisplayName:     k8s.ServiceToString(svc),
-	}
+// NewResourceFromService creates a Resource from a k8s.Service
+func NewResourceFromService(svc k8s.Service) Resource {
+	return model.NewResourceFromService(svc)
 }
 
 // NewResourceFromPod creates a Resource from a k8s.Pod
 func NewResourceFromPod(pod k8s.Pod) Resource {
-	ports := make([]int32, len(pod.Ports))
-	portNames := make([]string, len(pod.Ports))
-	targetPortSpecs := make([]*intstr.IntOrString, len(pod.Ports))
-	portMetadata := make([]k8s.PortMetadata, len(pod.Ports))
-
-	for i, port := range pod.Ports {
-		ports[i] = port.ContainerPort
-		portNames[i] = port.Name
-		intOrStr := intstr.FromInt(int(port.ContainerPort))
-		targetPortSpecs[i] = &intOrStr
-
-		// Store metadata about the port
-		portMetadata[i] = k8s.PortMetadata{
-			ContainerName:   port.ContainerName,
-			IsInitContainer: port.IsInitContainer,
-		}
-	}
-
-	return Resource{
-		Name:            pod.Name,
-		Namespace:       pod.Namespace,
-		Type:            PodResource,
-		Ports:           ports,
-		PortNames:       portNames,
-		TargetPortSpecs: targetPortSpecs,
-		DisplayName:     k8s.PodToString(pod),
-		PortMetadata:    portMetadata,
-	}
+	return model.NewResourceFromPod(pod)
 }
 
 // NewResourceFromDeployment creates a Resource from a k8s.Deployment
 func NewResourceFromDeployment(deployment k8s.Deployment) Resource {
-	// For deployments, ports will be populated when resolving pods
-	return Resource{
-		Name:        deployment.Name,
-		Namespace:   deployment.Namespace,
-		Type:        DeploymentResource,
-		Ports:       []int32{},  // Will be populated when selecting a pod
-		PortNames:   []string{}, // Will be populated when selecting a pod
-		DisplayName: k8s.DeploymentToString(deployment),
-	}
+	return model.NewResourceFromDeployment(deployment)
 }
 
 // NewResourceFromStatefulSet creates a Resource from a k8s.StatefulSet
 func NewResourceFromStatefulSet(statefulSet k8s.StatefulSet) Resource {
-	// For statefulsets, ports will be populated when resolving pods
-	return Resource{
-		Name:        statefulSet.Name,
-		Namespace:   statefulSet.Namespace,
-		Type:        StatefulSetResource,
-		Ports:       []int32{},  // Will be populated when selecting a pod
-		PortNames:   []string{}, // Will be populated when selecting a pod
-		DisplayName: k8s.StatefulSetToString(statefulSet),
+	return model.NewResourceFromStatefulSet(statefulSet)
+}
+
+// NewResourceFromCustomResource creates a Resource from a k8s.CustomResource
+func NewResourceFromCustomResource(custom k8s.CustomResource) Resource {
+	return model.NewResourceFromCustomResource(custom)
+}
+
+// selectPageSize is the number of resources shown at once; typing narrows the list
+const selectPageSize = 20
+
+// matchesResource reports whether a typed filter fuzzily matches a resource's name, namespace
+// or one of its port names
+func matchesResource(filter string, resource Resource) bool {
+	for _, text := range append([]string{resource.Name, resource.Namespace, resource.Context}, resource.PortNames...) {
+		if text == "" {
+			continue
+		}
+		if _, ok := FuzzyMatch(filter, text); ok {
+			return true
+		}
 	}
+	return false
 }
 
 // SelectResources displays a multi-select UI for services or pods
 func SelectResources(resources []Resource, message string) ([]Resource, error) {
+	return SelectResourcesWithDefaults(resources, message, nil)
+}
+
+// SelectResourcesWithDefaults displays a multi-select UI with the resources at the given
+// indices checked initially
+func SelectResourcesWithDefaults(resources []Resource, message string, defaults []int) ([]Resource, error) {
 	if len(resources) == 0 {
 		return nil, fmt.Errorf("no resources available for selection")
 	}
@@ -133,11 +105,18 @@ func SelectResources(resources []Resource, message string) ([]Resource, error) {
 	prompt := &survey.MultiSelect{
 		Message:  message,
 		Options:  options,
-		Help:     "Use arrow keys to navigate, space to select, and enter to confirm",
-		PageSize: len(options),
+		Help:     "Type to filter by name, namespace or port name, use arrow keys to navigate, space to select, and enter to confirm",
+		PageSize: min(len(options), selectPageSize),
+		Filter: func(filter string, value string, index int) bool {
+			return matchesResource(filter, resources[index])
+		},
+	}
+	if len(defaults) > 0 {
+		prompt.Default = defaults
 	}
 
-	err := askOne(prompt, &selected)
+	// Keep the filter after selecting so all matches of a query can be picked in a row
+	err := askOne(prompt, &selected, survey.WithKeepFilter(true))
 	if err != nil {
 		return nil, fmt.Errorf("selection error: %w", err)
 	}
@@ -156,6 +135,14 @@ func SelectResources(resources []Resource, message string) ([]Resource, error) {
 
 // AskForLocalPort asks the user to confirm or change the local port
 func AskForLocalPort(resource Resource, suggestedPort int32, portIndex int) (int32, error) {
+	return AskForLocalPortWithDefault(resource, suggestedPort, suggestedPort, portIndex, nil)
+}
+
+// AskForLocalPortWithDefault asks the user to confirm or change the local port for remotePort,
+// offering defaultPort as the pre-filled answer. Answering auto or 0 returns 0 for any free
+// port. checkPort, when set, rejects answers that cannot be used, e.g. ports already reserved
+// in the session, with the reason returned.
+func AskForLocalPortWithDefault(resource Resource, remotePort, defaultPort int32, portIndex int, checkPort func(port int32) error) (int32, error) {
 	// Get port name and container info
 	portName := ""
 	isInitContainer := false
@@ -178,48 +165,264 @@ func AskForLocalPort(resource Resource, suggestedPort int32, portIndex int) (int
 	if portName != "" {
 		if isInitContainer {
 			message = fmt.Sprintf("Local port for %s/%s (remote port %d)",
-				resource.Name, portName, suggestedPort)
+				resource.Name, portName, remotePort)
 		} else {
 			message = fmt.Sprintf("Local port for %s/%s (remote port %d)",
-				resource.Name, portName, suggestedPort)
+				resource.Name, portName, remotePort)
 		}
 	} else {
 		if isInitContainer {
 			message = fmt.Sprintf("Local port for %s (remote port %d)",
-				resource.Name, suggestedPort)
+				resource.Name, remotePort)
 		} else {
 			message = fmt.Sprintf("Local port for %s (remote port %d)",
-				resource.Name, suggestedPort)
+				resource.Name, remotePort)
 		}
 	}
 
-	var port string
+	var answer string
 	prompt := &survey.Input{
 		Message: message,
-		Default: fmt.Sprintf("%d", suggestedPort),
+		Default: fmt.Sprintf("%d", defaultPort),
+		Help:    "Enter a port number from 1 to 65535, or auto (or 0) for any free port",
 	}
 
-	err := askOne(prompt, &port, survey.WithValidator(func(val interface{}) error {
+	err := askOne(prompt, &answer, survey.WithValidator(func(val interface{}) error {
 		str, ok := val.(string)
 		if !ok {
 			return fmt.Errorf("invalid input")
 		}
-
-		// Check if the value is a valid port number
-		var portNum int
-		_, err := fmt.Sscanf(str, "%d", &portNum)
-		if err != nil || portNum < 1 || portNum > 65535 {
-			return fmt.Errorf("please enter a valid port number (1-65535)")
+		port, err := ParseLocalPort(str)
+		if err != nil {
+			return err
+		}
+		if port != 0 && checkPort != nil {
+			return checkPort(port)
 		}
-
 		return nil
 	}))
-
 	if err != nil {
 		return 0, err
 	}
 
-	var portNum int32
-	fmt.Sscanf(port, "%d", &portNum)
-	return portNum, nil
+	return ParseLocalPort(answer)
+}
+
+// LocalPortRow is a line of the local port form: a port of a resource with the local port
+// proposed for it
+type LocalPortRow struct {
+	Resource   Resource
+	PortIndex  int
+	RemotePort int32
+	LocalPort  int32
+}
+
+// EditLocalPorts shows the local ports proposed for all rows in a single numbered table and
+// lets the user accept them with enter or change some in one answer, such as "2=9090 3=auto",
+// instead of asking about each port in turn. It returns the rows with the chosen local ports,
+// 0 standing for any free port. Duplicated local ports are refused, as are those rejected by
+// checkPort when set.
+func EditLocalPorts(rows []LocalPortRow, checkPort func(port int32) error) ([]LocalPortRow, error) {
+	var table strings.Builder
+	table.WriteString("Local ports:")
+	for i, row := range rows {
+		fmt.Fprintf(&table, "\n  %2d) %s/%s %s -> %s", i+1, row.Resource.Type, row.Resource.Name,
+			portLabel(row.Resource, row.PortIndex), formatLocalPort(row.LocalPort))
+	}
+	table.WriteString("\nPress enter to accept, or change ports as <number>=<port>")
+
+	var answer string
+	prompt := &survey.Input{
+		Message: table.String(),
+		Help:    "Separate changes with spaces or commas, e.g. 2=9090 3=auto; auto (or 0) picks any free port",
+	}
+	err := askOne(prompt, &answer, survey.WithValidator(func(val interface{}) error {
+		str, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("invalid input")
+		}
+		_, err := applyLocalPortEdits(rows, str, checkPort)
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return applyLocalPortEdits(rows, answer, checkPort)
+}
+
+// applyLocalPortEdits returns a copy of rows with the changes of answer applied and validates
+// the resulting local ports
+func applyLocalPortEdits(rows []LocalPortRow, answer string, checkPort func(port int32) error) ([]LocalPortRow, error) {
+	edited := append([]LocalPortRow(nil), rows...)
+	for _, change := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' }) {
+		number, value, ok := strings.Cut(change, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid change %q, use <number>=<port>, e.g. 2=9090", change)
+		}
+		line, err := strconv.Atoi(number)
+		if err != nil || line < 1 || line > len(rows) {
+			return nil, fmt.Errorf("invalid change %q, the number must be between 1 and %d", change, len(rows))
+		}
+		port, err := ParseLocalPort(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid change %q: %w", change, err)
+		}
+		edited[line-1].LocalPort = port
+	}
+
+	usedBy := make(map[int32]int)
+	for i, row := range edited {
+		if row.LocalPort == 0 {
+			continue
+		}
+		if first, ok := usedBy[row.LocalPort]; ok {
+			return nil, fmt.Errorf("local port %d is chosen for both %d and %d", row.LocalPort, first+1, i+1)
+		}
+		usedBy[row.LocalPort] = i
+		if checkPort != nil {
+			if err := checkPort(row.LocalPort); err != nil {
+				return nil, fmt.Errorf("%d: %w", i+1, err)
+			}
+		}
+	}
+	return edited, nil
+}
+
+// formatLocalPort renders a local port of the form, 0 being any free port
+func formatLocalPort(port int32) string {
+	if port == 0 {
+		return "auto"
+	}
+	return strconv.Itoa(int(port))
+}
+
+// ParseLocalPort parses a local port answer: a port number from 1 to 65535, or auto or 0 for
+// any free port, which is returned as 0
+func ParseLocalPort(answer string) (int32, error) {
+	answer = strings.TrimSpace(answer)
+	if strings.EqualFold(answer, "auto") {
+		return 0, nil
+	}
+	port, err := strconv.ParseInt(answer, 10, 32)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("please enter a valid port number (1-65535), or auto for any free port")
+	}
+	return int32(port), nil
+}
+
+// SelectContext asks the user to pick one of the kubeconfig contexts. The current context is
+// marked and selected by default.
+func SelectContext(contexts []string, current string) (string, error) {
+	if len(contexts) == 0 {
+		return "", fmt.Errorf("no contexts available for selection")
+	}
+
+	options := make([]string, len(contexts))
+	defaultIndex := 0
+	for i, name := range contexts {
+		options[i] = name
+		if name == current {
+			options[i] = name + " (current)"
+			defaultIndex = i
+		}
+	}
+
+	selected := 0
+	prompt := &survey.Select{
+		Message: "Select a Kubernetes context:",
+		Options: options,
+		Default: defaultIndex,
+		Help:    "Use arrow keys to navigate and enter to confirm",
+	}
+
+	if err := askOne(prompt, &selected); err != nil {
+		return "", fmt.Errorf("selection error: %w", err)
+	}
+	return contexts[selected], nil
+}
+
+// SelectNode asks the user to pick one of nodes, each shown with its number of pods
+func SelectNode(nodes []string, pods map[string]int) (string, error) {
+	if len(nodes) == 0 {
+		return "", fmt.Errorf("no nodes available for selection")
+	}
+
+	options := make([]string, len(nodes))
+	for i, name := range nodes {
+		options[i] = fmt.Sprintf("%s (%d pods)", name, pods[name])
+	}
+
+	selected := 0
+	prompt := &survey.Select{
+		Message: "Select a node:",
+		Options: options,
+		Help:    "Pods backing the selected resources are picked from this node",
+	}
+
+	if err := askOne(prompt, &selected); err != nil {
+		return "", fmt.Errorf("selection error: %w", err)
+	}
+	return nodes[selected], nil
+}
+
+// portLabel describes a resource port for selection, e.g. "http 80->8080" for a service
+func portLabel(resource Resource, i int) string {
+	label := fmt.Sprintf("%d", resource.Ports[i])
+	if i < len(resource.TargetPortSpecs) && resource.TargetPortSpecs[i] != nil && resource.Type == ServiceResource {
+		if target := resource.TargetPortSpecs[i].String(); target != "0" && target != label {
+			label += "->" + target
+		}
+	}
+	if i < len(resource.PortMetadata) {
+		if resource.PortMetadata[i].IsInitContainer {
+			label += " (init)"
+		} else if resource.PortMetadata[i].IsEphemeralContainer {
+			label += " (debug)"
+		}
+	}
+	if protocol := resource.PortProtocol(i); !k8s.IsTCP(protocol) {
+		label += fmt.Sprintf(" (%s, cannot be forwarded)", protocol)
+	}
+	if i < len(resource.PortNames) && resource.PortNames[i] != "" {
+		label = resource.PortNames[i] + " " + label
+	}
+	return label
+}
+
+// SelectPorts asks which ports of a resource to forward and returns their indices. All TCP
+// ports are selected by default, and resources with a single port are not asked about.
+func SelectPorts(resource Resource) ([]int, error) {
+	if len(resource.Ports) <= 1 {
+		indices := make([]int, len(resource.Ports))
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices, nil
+	}
+
+	options := make([]string, len(resource.Ports))
+	defaults := make([]int, 0, len(resource.Ports))
+	for i := range resource.Ports {
+		options[i] = portLabel(resource, i)
+		if k8s.IsTCP(resource.PortProtocol(i)) {
+			defaults = append(defaults, i)
+		}
+	}
+
+	selected := []int{}
+	prompt := &survey.MultiSelect{
+		Message:  fmt.Sprintf("Select ports of %s/%s to forward:", resource.Type, resource.Name),
+		Options:  options,
+		Default:  defaults,
+		Help:     "Use arrow keys to navigate, space to toggle a port, and enter to confirm",
+		PageSize: min(len(options), selectPageSize),
+	}
+
+	if err := askOne(prompt, &selected); err != nil {
+		return nil, fmt.Errorf("selection error: %w", err)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no ports selected for %s", resource.Name)
+	}
+	return selected, nil
 }
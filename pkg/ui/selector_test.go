@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"roeyazroel/kubectl-pfw/pkg/k8s"
@@ -120,6 +122,30 @@ func TestSelectResources_Success(t *testing.T) {
 	assert.Equal(t, []Resource{resources[0], resources[2]}, selected)
 }
 
+// TestSelectResources_Filter tests that typing matches names, namespaces and port names.
+func TestSelectResources_Filter(t *testing.T) {
+	resources := []Resource{
+		{Name: "payments-api", Namespace: "prod", PortNames: []string{"http"}, DisplayName: "payments-api"},
+		{Name: "redis", Namespace: "cache", PortNames: []string{"redis", "metrics"}, DisplayName: "redis"},
+	}
+	var filter func(string, string, int) bool
+	restore := mockAskOne(func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		filter = prompt.(*survey.MultiSelect).Filter
+		*response.(*[]int) = []int{0}
+		return nil
+	})
+	defer restore()
+
+	_, err := SelectResources(resources, "pick")
+	assert.NoError(t, err)
+
+	assert.True(t, filter("pmtapi", "", 0), "fuzzy name match")
+	assert.False(t, filter("pmtapi", "", 1))
+	assert.True(t, filter("cache", "", 1), "namespace match")
+	assert.True(t, filter("metrics", "", 1), "port name match")
+	assert.False(t, filter("metrics", "", 0))
+}
+
 // TestSelectResources_EmptyInput returns error if no resources.
 func TestSelectResources_EmptyInput(t *testing.T) {
 	selected, err := SelectResources([]Resource{}, "pick")
@@ -198,3 +224,184 @@ func TestAskForLocalPort_InvalidInput(t *testing.T) {
 	_, err := AskForLocalPort(resource, 8080, 0)
 	assert.Error(t, err)
 }
+
+// TestAskForLocalPort_Auto verifies that answering auto requests any free port.
+func TestAskForLocalPort_Auto(t *testing.T) {
+	resource := Resource{Name: "svc"}
+	restore := mockAskOne(func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		*response.(*string) = "auto"
+		return nil
+	})
+	defer restore()
+
+	port, err := AskForLocalPort(resource, 8080, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), port)
+}
+
+// TestEditLocalPorts verifies that all proposed local ports are shown in one prompt and that
+// the changes of a single answer are applied.
+func TestEditLocalPorts(t *testing.T) {
+	web := Resource{Name: "web", Type: ServiceResource, Ports: []int32{80, 443}}
+	db := Resource{Name: "db", Type: StatefulSetResource, Ports: []int32{5432}}
+	rows := []LocalPortRow{
+		{Resource: web, PortIndex: 0, RemotePort: 8080, LocalPort: 8080},
+		{Resource: web, PortIndex: 1, RemotePort: 8443, LocalPort: 8443},
+		{Resource: db, PortIndex: 0, RemotePort: 5432, LocalPort: 5432},
+	}
+	prompts := 0
+	restore := mockAskOne(func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		prompts++
+		input, ok := prompt.(*survey.Input)
+		if !ok || !strings.Contains(input.Message, " 3) statefulset/db 5432 -> 5432") {
+			return fmt.Errorf("unexpected prompt %+v", prompt)
+		}
+		*response.(*string) = "2=9443, 3=auto"
+		return nil
+	})
+	defer restore()
+
+	edited, err := EditLocalPorts(rows, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, prompts)
+	assert.Equal(t, []int32{8080, 9443, 0}, []int32{edited[0].LocalPort, edited[1].LocalPort, edited[2].LocalPort})
+	assert.Equal(t, int32(8443), rows[1].LocalPort, "the proposed rows must not be changed")
+}
+
+// TestApplyLocalPortEdits_Invalid verifies that malformed changes, duplicated ports and ports
+// rejected by the check are refused.
+func TestApplyLocalPortEdits_Invalid(t *testing.T) {
+	web := Resource{Name: "web", Type: ServiceResource, Ports: []int32{80, 443}}
+	rows := []LocalPortRow{{Resource: web, PortIndex: 0, LocalPort: 8080}, {Resource: web, PortIndex: 1, LocalPort: 8443}}
+	reserved := func(port int32) error {
+		if port == 9000 {
+			return errors.New("reserved")
+		}
+		return nil
+	}
+	for _, answer := range []string{"2", "3=9090", "x=9090", "1=http", "2=8080", "1=9000"} {
+		_, err := applyLocalPortEdits(rows, answer, reserved)
+		assert.Error(t, err, answer)
+	}
+	edited, err := applyLocalPortEdits(rows, "", reserved)
+	assert.NoError(t, err)
+	assert.Equal(t, rows, edited)
+}
+
+// TestParseLocalPort verifies that only whole port numbers, auto and 0 are accepted.
+func TestParseLocalPort(t *testing.T) {
+	valid := map[string]int32{"8080": 8080, " 443 ": 443, "0": 0, "auto": 0, "AUTO": 0, "65535": 65535}
+	for answer, want := range valid {
+		port, err := ParseLocalPort(answer)
+		assert.NoError(t, err, answer)
+		assert.Equal(t, want, port, answer)
+	}
+	for _, answer := range []string{"", "80abc", "8080.5", "-1", "65536", "0x50", "http"} {
+		_, err := ParseLocalPort(answer)
+		assert.Error(t, err, answer)
+	}
+}
+
+// TestPromptOnStderr verifies that prompts get an extra option moving them off stdout.
+func TestPromptOnStderr(t *testing.T) {
+	var options int
+	restore := mockAskOne(func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		options = len(opts)
+		*response.(*string) = "8080"
+		return nil
+	})
+	defer restore()
+
+	PromptOnStderr()
+	_, err := AskForLocalPort(Resource{Name: "svc"}, 8080, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, options, "expected the validator and the stdio option")
+}
+
+// TestSelectContext_DefaultsToCurrent verifies that the current context is marked and preselected.
+func TestSelectContext_DefaultsToCurrent(t *testing.T) {
+	restore := mockAskOne(func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		sel, ok := prompt.(*survey.Select)
+		if !ok {
+			return errors.New("bad prompt type")
+		}
+		assert.Equal(t, []string{"dev", "prod (current)"}, sel.Options)
+		ptr, ok := response.(*int)
+		if !ok {
+			return errors.New("bad response type")
+		}
+		*ptr = sel.Default.(int)
+		return nil
+	})
+	defer restore()
+
+	selected, err := SelectContext([]string{"dev", "prod"}, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", selected)
+}
+
+// TestSelectNode verifies that nodes are offered with their pod counts.
+func TestSelectNode(t *testing.T) {
+	restore := mockAskOne(func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		sel, ok := prompt.(*survey.Select)
+		if !ok {
+			return errors.New("bad prompt type")
+		}
+		assert.Equal(t, []string{"node-a (2 pods)", "node-b (1 pods)"}, sel.Options)
+		ptr, ok := response.(*int)
+		if !ok {
+			return errors.New("bad response type")
+		}
+		*ptr = 1
+		return nil
+	})
+	defer restore()
+
+	selected, err := SelectNode([]string{"node-a", "node-b"}, map[string]int{"node-a": 2, "node-b": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "node-b", selected)
+}
+
+// TestSelectPorts tests that every port is offered, that TCP ports are preselected and that
+// single-port resources are not prompted for.
+func TestSelectPorts(t *testing.T) {
+	web := intstr.FromString("web")
+	resource := Resource{
+		Name:            "api",
+		Type:            ServiceResource,
+		Ports:           []int32{80, 9090},
+		PortNames:       []string{"http", "metrics"},
+		TargetPortSpecs: []*intstr.IntOrString{&web, nil},
+	}
+	var options []string
+	var defaults interface{}
+	restore := mockAskOne(func(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+		multi := prompt.(*survey.MultiSelect)
+		options, defaults = multi.Options, multi.Default
+		*response.(*[]int) = []int{1}
+		return nil
+	})
+	defer restore()
+
+	selected, err := SelectPorts(resource)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, selected)
+	assert.Equal(t, []string{"http 80->web", "metrics 9090"}, options)
+	assert.Equal(t, []int{0, 1}, defaults)
+
+	narrowed := resource.WithPorts(selected)
+	assert.Equal(t, []int32{9090}, narrowed.Ports)
+	assert.Equal(t, []string{"metrics"}, narrowed.PortNames)
+
+	options = nil
+	selected, err = SelectPorts(Resource{Name: "db", Ports: []int32{5432}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0}, selected)
+	assert.Nil(t, options, "single-port resources should not be prompted for")
+
+	resource.Protocols = []string{"TCP", "UDP"}
+	_, err = SelectPorts(resource)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http 80->web", "metrics 9090 (UDP, cannot be forwarded)"}, options)
+	assert.Equal(t, []int{0}, defaults, "UDP ports should not be preselected")
+}
@@ -0,0 +1,298 @@
+// Package update finds kubectl-pfw releases on GitHub and replaces the running executable
+// with the binary of a newer release.
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProjectName is the name used for release archives and the binary
+const ProjectName = "kubectl-pfw"
+
+// LatestReleaseURL is the GitHub API endpoint describing the latest release
+var LatestReleaseURL = "https://api.github.com/repos/roeyazroel/kubectl-pfw/releases/latest"
+
+// maxDownloadSize bounds the size of downloaded archives
+const maxDownloadSize = 200 << 20
+
+// Release is a published GitHub release
+type Release struct {
+	TagName string  `json:"tag_name"`
+	HTMLURL string  `json:"html_url"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// Version returns the release version without the leading v, as used in archive names
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+// asset returns the attached file named name
+func (r *Release) asset(name string) (Asset, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, nil
+		}
+	}
+	return Asset{}, fmt.Errorf("release %s has no asset %s", r.TagName, name)
+}
+
+// LatestRelease fetches the latest published release
+func LatestRelease(ctx context.Context, client *http.Client) (*Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, LatestReleaseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to check for releases: %s", resp.Status)
+	}
+
+	var release Release
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to decode release: %w", err)
+	}
+	return &release, nil
+}
+
+// IsNewer reports whether version latest is newer than current. Versions are compared by
+// their numeric major, minor and patch components; unparsable versions such as "dev" are
+// never older or newer.
+func IsNewer(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+// IsRelease reports whether version is a released version rather than a development build
+func IsRelease(version string) bool {
+	_, ok := parseVersion(version)
+	return ok
+}
+
+// parseVersion parses a version such as v1.2.3 or 1.2.3-rc.1, ignoring pre-release suffixes
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+// ArchiveName returns the name of the release archive for a platform
+func ArchiveName(version, goos, goarch string) string {
+	ext := ".tar.gz"
+	if goos == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("%s_%s_%s_%s%s", ProjectName, version, goos, goarch, ext)
+}
+
+// checksumsName returns the name of the release's checksum file
+func checksumsName(version string) string {
+	return fmt.Sprintf("%s_%s_checksums.txt", ProjectName, version)
+}
+
+// DownloadBinary downloads the archive of release for a platform, verifies it against the
+// release's SHA-256 checksums and returns the kubectl-pfw binary it contains
+func DownloadBinary(ctx context.Context, client *http.Client, release *Release, goos, goarch string) ([]byte, error) {
+	archiveName := ArchiveName(release.Version(), goos, goarch)
+	archiveAsset, err := release.asset(archiveName)
+	if err != nil {
+		return nil, fmt.Errorf("no release archive for %s/%s: %w", goos, goarch, err)
+	}
+	checksumsAsset, err := release.asset(checksumsName(release.Version()))
+	if err != nil {
+		return nil, err
+	}
+
+	checksums, err := download(ctx, client, checksumsAsset.BrowserDownloadURL)
+	if err != nil {
+		return nil, err
+	}
+	want, err := findChecksum(checksums, archiveName)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := download(ctx, client, archiveAsset.BrowserDownloadURL)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(archive)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", archiveName, want, got)
+	}
+
+	if goos == "windows" {
+		return extractZip(archive, ProjectName+".exe")
+	}
+	return extractTarGz(archive, ProjectName)
+}
+
+// download fetches url
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	return data, nil
+}
+
+// findChecksum returns the SHA-256 checksum listed for name in a checksums file with lines
+// of the form "<hex>  <name>"
+func findChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum listed for %s", name)
+}
+
+// extractTarGz returns the file named binaryName from a gzipped tar archive
+func extractTarGz(archive []byte, binaryName string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive does not contain %s", binaryName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == binaryName {
+			return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		}
+	}
+}
+
+// extractZip returns the file named binaryName from a zip archive
+func extractZip(archive []byte, binaryName string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	for _, file := range zr.File {
+		if path.Base(file.Name) != binaryName {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %w", binaryName, err)
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, maxDownloadSize))
+	}
+	return nil, fmt.Errorf("archive does not contain %s", binaryName)
+}
+
+// ReplaceExecutable atomically replaces the file at executable with binary. The running
+// executable is moved aside first because Windows does not allow overwriting it; the old
+// copy is removed where the platform allows it.
+func ReplaceExecutable(executable string, binary []byte) error {
+	info, err := os.Stat(executable)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", executable, err)
+	}
+
+	dir := filepath.Dir(executable)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(executable)+".new-*")
+	if err != nil {
+		return fmt.Errorf("failed to write to %s: %w", dir, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write new executable: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write new executable: %w", err)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()|0o111); err != nil {
+		return fmt.Errorf("failed to make new executable runnable: %w", err)
+	}
+
+	old := executable + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(executable, old); err != nil {
+		return fmt.Errorf("failed to move %s aside: %w", executable, err)
+	}
+	if err := os.Rename(tmpPath, executable); err != nil {
+		// Put the previous version back
+		_ = os.Rename(old, executable)
+		return fmt.Errorf("failed to replace %s: %w", executable, err)
+	}
+	// Fails on Windows while the old executable is still running; it is replaced next time
+	_ = os.Remove(old)
+	return nil
+}
@@ -0,0 +1,116 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestIsNewer verifies the version comparison.
+func TestIsNewer(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.2.0", "1.1.9", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.2.0", "v1.3.0", false},
+		{"v2.0.0", "v2.0.0-rc.1", false},
+		{"v1.2.0", "dev", false},
+	}
+	for _, tt := range tests {
+		if got := IsNewer(tt.latest, tt.current); got != tt.want {
+			t.Errorf("IsNewer(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+// tarGz returns a gzipped tar archive containing one file
+func tarGz(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// TestDownloadBinary verifies that the archive of the platform is checksummed and unpacked
+// and that tampered archives are rejected.
+func TestDownloadBinary(t *testing.T) {
+	archive := tarGz(t, "kubectl-pfw", []byte("new binary"))
+	sum := sha256.Sum256(archive)
+	checksums := fmt.Sprintf("%s  kubectl-pfw_1.2.0_linux_amd64.tar.gz\n", hex.EncodeToString(sum[:]))
+
+	files := map[string][]byte{
+		"/archive":   archive,
+		"/checksums": []byte(checksums),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(files[r.URL.Path])
+	}))
+	defer server.Close()
+
+	release := &Release{
+		TagName: "v1.2.0",
+		Assets: []Asset{
+			{Name: "kubectl-pfw_1.2.0_linux_amd64.tar.gz", BrowserDownloadURL: server.URL + "/archive"},
+			{Name: "kubectl-pfw_1.2.0_checksums.txt", BrowserDownloadURL: server.URL + "/checksums"},
+		},
+	}
+
+	binary, err := DownloadBinary(context.Background(), server.Client(), release, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(binary) != "new binary" {
+		t.Errorf("unexpected binary %q", binary)
+	}
+
+	if _, err := DownloadBinary(context.Background(), server.Client(), release, "darwin", "arm64"); err == nil {
+		t.Error("expected an error for a platform without archive")
+	}
+
+	files["/archive"] = tarGz(t, "kubectl-pfw", []byte("tampered"))
+	if _, err := DownloadBinary(context.Background(), server.Client(), release, "linux", "amd64"); err == nil {
+		t.Error("expected a checksum mismatch for a tampered archive")
+	}
+}
+
+// TestReplaceExecutable verifies that the executable is replaced and stays executable.
+func TestReplaceExecutable(t *testing.T) {
+	executable := filepath.Join(t.TempDir(), "kubectl-pfw")
+	if err := os.WriteFile(executable, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplaceExecutable(executable, []byte("new")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := os.ReadFile(executable)
+	if string(content) != "new" {
+		t.Errorf("expected the new binary, got %q", content)
+	}
+	info, _ := os.Stat(executable)
+	if info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("expected the new binary to be executable, mode %v", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(executable))
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, found %d entries", len(entries))
+	}
+}